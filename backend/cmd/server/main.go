@@ -1,93 +1,311 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/audit"
 	"github.com/katim/secure-doc-vault/internal/config"
 	"github.com/katim/secure-doc-vault/internal/database"
 	"github.com/katim/secure-doc-vault/internal/handlers"
+	"github.com/katim/secure-doc-vault/internal/logging"
+	"github.com/katim/secure-doc-vault/internal/mailer"
+	"github.com/katim/secure-doc-vault/internal/metrics"
 	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/ratelimit"
 	"github.com/katim/secure-doc-vault/internal/services"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	// Load configuration
 	cfg := config.Load()
 
+	// Log JSON records tagged with the request they belong to
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+
+	// Trace requests through the services down to SQL and file storage
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+
 	// Initialize database
 	db, err := database.New(cfg.DatabaseURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("failed to connect to database", err)
 	}
 	defer db.Close()
 
-	// Run migrations
+	// Apply pending migrations; replicas starting together wait on a lock
 	if err := db.Migrate(); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		fatal("failed to run migrations", err)
 	}
 
 	// Initialize services
 	userService := services.NewUserService(db)
 	documentService := services.NewDocumentService(db, cfg.UploadDir)
+	transferService := services.NewTransferService(db, documentService)
+	folderService := services.NewFolderService(db)
+	metadataService := services.NewMetadataService(db, documentService)
+	searchService := services.NewSearchService(db)
+	auditService := services.NewAuditService(db)
+	webhookService := services.NewWebhookService(db)
+	notificationService := services.NewNotificationService(db)
+	commentService := services.NewCommentService(db, documentService)
+	previewService := services.NewPreviewService(db, documentService)
+
+	// Forward the audit log to external sinks in the background
+	auditSinks, err := audit.NewSinks(cfg)
+	if err != nil {
+		fatal("failed to configure audit sinks", err)
+	}
+	background := newWorkers()
+	background.Go(services.NewAuditShipper(db, auditSinks).Run)
+
+	// Deliver queued webhook events in the background
+	background.Go(services.NewWebhookDispatcher(db).Run)
+
+	// Notify expired shares and send notification emails in the background
+	background.Go(services.NewNotificationWorker(db, mailer.New(cfg)).Run)
+
+	// Render thumbnails and text previews in the background
+	background.Go(services.NewPreviewWorker(db).Run)
+
+	// Re-hash stored files to catch corruption on disk
+	background.Go(services.NewIntegrityScrubber(db, cfg.IntegrityScrubInterval).Run)
+
+	// Remove files left behind by deletes whose own removal failed
+	background.Go(services.NewFileReaper(db).Run)
+
+	// Relay live user events from every replica to this one's streams
+	eventBroker := services.NewEventBroker()
+	background.Go(func(ctx context.Context) {
+		if err := eventBroker.Listen(ctx, cfg.DatabaseURL); err != nil {
+			slog.Error("live events disabled", "error", err)
+		}
+	})
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSecret)
 
+	// Throttle each user, or client IP on public routes, per route group
+	var rateLimits ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "postgres" {
+		store := ratelimit.NewPostgresStore(db)
+		background.Go(store.Run)
+		rateLimits = store
+	}
+	rateLimit := func(group string) gin.HandlerFunc {
+		limit := cfg.RateLimits[group]
+		return middleware.RateLimit(rateLimits, group, ratelimit.Limit{Requests: limit.Requests, Period: limit.Period})
+	}
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userService, authMiddleware)
-	documentHandler := handlers.NewDocumentHandler(documentService, cfg.MaxFileSize)
+	authHandler := handlers.NewAuthHandler(userService, authMiddleware, auditService)
+	documentHandler := handlers.NewDocumentHandler(documentService, auditService, cfg.MaxFileSize)
+	transferHandler := handlers.NewTransferHandler(transferService, auditService)
+	folderHandler := handlers.NewFolderHandler(folderService, auditService)
+	metadataHandler := handlers.NewMetadataHandler(metadataService)
+	bulkHandler := handlers.NewBulkHandler(documentService, metadataService, auditService, cfg.MaxFileSize)
+	searchHandler := handlers.NewSearchHandler(searchService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	eventHandler := handlers.NewEventHandler(eventBroker)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	commentHandler := handlers.NewCommentHandler(commentService)
+	previewHandler := handlers.NewPreviewHandler(previewService)
+	healthHandler := handlers.NewHealthHandler(services.NewHealthService(db, cfg.UploadDir, cfg.MinFreeDiskBytes, cfg.ReadinessTimeout))
 
 	// Setup router
-	router := gin.Default()
+	router := gin.New()
+
+	// Only believe X-Forwarded-For from our own proxies, or clients could
+	// pick the IP that rate limits and audit entries see
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("invalid TRUSTED_PROXIES", err)
+	}
+
+	// Continue the caller's trace from its traceparent header, or start one
+	router.Use(otelgin.Middleware(cfg.TracingServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		switch r.URL.Path {
+		case "/health", "/livez", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	})))
+
+	// Tag each request with an ID, log it once handled and turn panics
+	// into 500s
+	router.Use(middleware.RequestID(), middleware.RequestLogger(), middleware.Recovery())
+
+	// Count and time every request, including ones later middleware rejects
+	router.Use(middleware.Metrics())
 
 	// Apply CORS middleware
 	router.Use(middleware.CORS(cfg.AllowedOrigins))
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
-	})
+	// Cancel a request's queries when its client goes away or it runs too long
+	router.Use(middleware.Timeout(cfg.RequestTimeout, cfg.RouteTimeouts))
+
+	// Liveness and readiness probes; /health predates /readyz and is kept for
+	// existing probes
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/health", healthHandler.Readyz)
+
+	// Prometheus metrics; keep this path off the public ingress
+	metrics.RegisterDatabase(db)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	// Auth routes (public)
 	auth := router.Group("/auth")
 	{
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/login", authHandler.Login)
-		auth.GET("/me", authMiddleware.Authenticate(), authHandler.GetMe)
+		auth.POST("/register", rateLimit("auth"), authHandler.Register)
+		auth.POST("/login", rateLimit("auth"), authHandler.Login)
+		auth.GET("/me", authMiddleware.Authenticate(), rateLimit("api"), authHandler.GetMe)
 	}
 
 	// Document routes (protected)
 	documents := router.Group("/documents")
-	documents.Use(authMiddleware.Authenticate())
+	documents.Use(authMiddleware.Authenticate(), rateLimit("api"))
 	{
 		documents.GET("", documentHandler.ListDocuments)
-		documents.POST("", documentHandler.UploadDocument)
+		documents.POST("", rateLimit("upload"), documentHandler.UploadDocument)
+		documents.POST("/batch", rateLimit("upload"), bulkHandler.UploadDocuments)
+		documents.POST("/batch/delete", bulkHandler.DeleteDocuments)
+		documents.POST("/batch/move", bulkHandler.MoveDocuments)
+		documents.POST("/batch/share", bulkHandler.ShareDocuments)
+		documents.POST("/batch/tags", bulkHandler.TagDocuments)
+		documents.POST("/archive", bulkHandler.DownloadArchive)
 		documents.GET("/:id", documentHandler.GetDocument)
 		documents.PATCH("/:id", documentHandler.RenameDocument)
 		documents.DELETE("/:id", documentHandler.DeleteDocument)
 		documents.GET("/:id/download", documentHandler.DownloadDocument)
+		documents.GET("/:id/thumbnail", previewHandler.GetThumbnail)
+		documents.GET("/:id/preview", previewHandler.GetPreview)
 		documents.POST("/:id/share", documentHandler.ShareDocument)
+		documents.DELETE("/:id/share/:user_id", documentHandler.RevokeShare)
+		documents.POST("/:id/transfer", transferHandler.OfferTransfer)
+		documents.PUT("/:id/folder", documentHandler.MoveDocument)
+		documents.GET("/:id/tags", metadataHandler.GetTags)
+		documents.PUT("/:id/tags", metadataHandler.SetTags)
+		documents.GET("/:id/metadata", metadataHandler.GetMetadata)
+		documents.PUT("/:id/metadata", metadataHandler.SetMetadata)
+		documents.DELETE("/:id/metadata/:key", metadataHandler.DeleteMetadata)
+		documents.GET("/:id/activity", auditHandler.DocumentActivity)
+		documents.GET("/:id/comments", commentHandler.ListComments)
+		documents.POST("/:id/comments", commentHandler.CreateComment)
+		documents.PATCH("/:id/comments/:comment_id", commentHandler.UpdateComment)
+		documents.DELETE("/:id/comments/:comment_id", commentHandler.DeleteComment)
+		documents.POST("/:id/comments/:comment_id/resolve", commentHandler.ResolveComment)
+		documents.POST("/:id/comments/:comment_id/unresolve", commentHandler.UnresolveComment)
+	}
+
+	// Tag autocomplete (protected)
+	router.GET("/tags", authMiddleware.Authenticate(), rateLimit("api"), metadataHandler.SuggestTags)
+	router.GET("/search", authMiddleware.Authenticate(), rateLimit("api"), searchHandler.Search)
+
+	// Live event stream (protected)
+	router.GET("/events", authMiddleware.Authenticate(), rateLimit("api"), eventHandler.Stream)
+
+	// Notification routes (protected)
+	notifications := router.Group("/notifications")
+	notifications.Use(authMiddleware.Authenticate(), rateLimit("api"))
+	{
+		notifications.GET("", notificationHandler.ListNotifications)
+		notifications.POST("/read-all", notificationHandler.MarkAllNotificationsRead)
+		notifications.POST("/:id/read", notificationHandler.MarkNotificationRead)
+		notifications.GET("/preferences", notificationHandler.GetNotificationPreferences)
+		notifications.PUT("/preferences", notificationHandler.UpdateNotificationPreferences)
+	}
+
+	// Folder routes (protected)
+	folders := router.Group("/folders")
+	folders.Use(authMiddleware.Authenticate(), rateLimit("api"))
+	{
+		folders.GET("", folderHandler.ListFolders)
+		folders.POST("", folderHandler.CreateFolder)
+		folders.GET("/shared", folderHandler.ListSharedFolders)
+		folders.GET("/:id", folderHandler.GetFolder)
+		folders.PATCH("/:id", folderHandler.RenameFolder)
+		folders.DELETE("/:id", folderHandler.DeleteFolder)
+		folders.POST("/:id/move", folderHandler.MoveFolder)
+		folders.POST("/:id/share", folderHandler.ShareFolder)
+		folders.DELETE("/:id/share/:user_id", folderHandler.RevokeFolderShare)
+	}
+
+	// Ownership transfer routes (protected)
+	transfers := router.Group("/transfers")
+	transfers.Use(authMiddleware.Authenticate(), rateLimit("api"))
+	{
+		transfers.GET("", transferHandler.ListTransfers)
+		transfers.POST("", transferHandler.OfferAllTransfers)
+		transfers.POST("/accept-all", transferHandler.AcceptAllTransfers)
+		transfers.POST("/:id/accept", transferHandler.AcceptTransfer)
+		transfers.POST("/:id/decline", transferHandler.DeclineTransfer)
+		transfers.DELETE("/:id", transferHandler.CancelTransfer)
+	}
+
+	// Audit routes (auditors only)
+	audit := router.Group("/audit")
+	audit.Use(authMiddleware.Authenticate(), rateLimit("api"), middleware.RequireEmail(cfg.AuditorEmails))
+	{
+		audit.GET("/export", auditHandler.ExportAudit)
+		audit.GET("/verify", auditHandler.VerifyAudit)
+	}
+
+	// Webhook routes (protected)
+	webhooks := router.Group("/webhooks")
+	webhooks.Use(authMiddleware.Authenticate(), rateLimit("api"))
+	{
+		webhooks.GET("", webhookHandler.ListWebhooks)
+		webhooks.POST("", webhookHandler.CreateWebhook)
+		webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+		webhooks.POST("/:id/replay", webhookHandler.ReplayDeliveries)
+		webhooks.POST("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayDelivery)
+	}
+
+	// Admin routes
+	admin := router.Group("/admin")
+	admin.Use(authMiddleware.Authenticate(), rateLimit("api"), middleware.RequireEmail(cfg.AdminEmails))
+	{
+		admin.POST("/webhooks", webhookHandler.CreateGlobalWebhook)
 	}
 
 	// Shared documents route (protected)
-	router.GET("/shared", authMiddleware.Authenticate(), documentHandler.ListSharedDocuments)
-
-	// Graceful shutdown
-	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-		log.Println("Shutting down gracefully...")
-		os.Exit(0)
-	}()
+	router.GET("/shared", authMiddleware.Authenticate(), rateLimit("api"), documentHandler.ListSharedDocuments)
 
-	// Start server
-	log.Printf("Server starting on port %s", cfg.Port)
-	if err := router.Run(":" + cfg.Port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Start server; SIGTERM drains requests and stops the workers before
+	// returning, so the database is closed cleanly
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: router}
+	// Event streams never end on their own
+	srv.RegisterOnShutdown(eventBroker.Close)
+
+	slog.Info("server starting", "port", cfg.Port)
+	if err := serve(srv, healthHandler, background, cfg); err != nil {
+		fatal("failed to start server", err)
 	}
 }
+
+// fatal logs err and exits without running deferred calls, like log.Fatal.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
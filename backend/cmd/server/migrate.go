@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+	"github.com/katim/secure-doc-vault/internal/database"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and when they were applied
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+	case "down":
+		if len(args) > 2 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "migrate down: %q is not a positive number of steps\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := database.New(config.DatabaseURL())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := db.NewMigrator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			name, applied := s.Name, "pending"
+			if s.Missing {
+				name = "(no file in this build)"
+			}
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, name, applied)
+		}
+		w.Flush()
+	}
+	return 0
+}
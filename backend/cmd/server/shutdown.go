@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+	"github.com/katim/secure-doc-vault/internal/handlers"
+)
+
+// workers runs the background jobs and stops them together.
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel}
+}
+
+// Go starts run in the background; it should return once its context is
+// cancelled.
+func (w *workers) Go(run func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		run(w.ctx)
+	}()
+}
+
+// Stop cancels the workers and waits for each to finish what it's doing,
+// giving up after timeout. It reports whether all of them stopped.
+func (w *workers) Stop(timeout time.Duration) bool {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// serve runs srv until SIGINT or SIGTERM, then shuts down in order: the
+// health check fails for cfg.ShutdownDelay so load balancers stop routing
+// here, in-flight requests get cfg.ShutdownTimeout to finish, and then the
+// background workers are stopped. Only a failure to listen is returned.
+func serve(srv *http.Server, health *handlers.HealthHandler, background *workers, cfg *config.Config) error {
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		background.Stop(cfg.ShutdownTimeout)
+		return err
+	case <-signals.Done():
+	}
+	// A second signal kills the process straight away
+	stop()
+
+	slog.Info("shutting down", "drain_for", cfg.ShutdownDelay)
+	health.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		// Whatever is still running is cut off
+		slog.Warn("requests still running at the shutdown timeout", "timeout", cfg.ShutdownTimeout, "error", err)
+		srv.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server error", "error", err)
+	}
+
+	if !background.Stop(cfg.ShutdownTimeout) {
+		slog.Warn("background workers still running at the shutdown timeout", "timeout", cfg.ShutdownTimeout)
+	}
+	slog.Info("shutdown complete")
+	return nil
+}
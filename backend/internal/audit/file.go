@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// FileSink appends entries as JSON lines, rotating the file once it would
+// grow past maxBytes. Rotated files are kept as path.1 (newest) up to
+// path.<maxBackups>.
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	s := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file:" + s.path
+}
+
+func (s *FileSink) Write(entries []models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range entries {
+		line, err := json.Marshal(&entries[i])
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if s.maxBackups < 1 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	// Shift path.N-1 -> path.N, dropping the oldest
+	for i := s.maxBackups; i > 1; i-- {
+		err := os.Rename(s.backupPath(i-1), s.backupPath(i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.backupPath(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+func readJSONLines(t *testing.T, path string) []models.AuditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var entries []models.AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFileSink_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+
+	sink, err := NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	if err := sink.Write(testEntries()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	sink.Close()
+
+	// Reopening appends rather than truncating
+	sink, err = NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	if err := sink.Write(testEntries()[:1]); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	sink.Close()
+
+	entries := readJSONLines(t, path)
+	if len(entries) != 3 {
+		t.Fatalf("got %d lines, want 3", len(entries))
+	}
+	if entries[1].Action != "auth.login" || entries[1].Details["error"] != "invalid password" {
+		t.Errorf("second line = %+v, want the login failure", entries[1])
+	}
+}
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	entries := testEntries()[:1]
+
+	line, _ := json.Marshal(&entries[0])
+	// Room for two lines per file
+	sink, err := NewFileSink(path, int64(len(line)+1)*2, 2)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(entries); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// Lines 1-2 were dropped, 3-4 are in path.2, 5-6 in path.1 and 7 is current
+	if got := len(readJSONLines(t, path)); got != 1 {
+		t.Errorf("current file has %d lines, want 1", got)
+	}
+	for _, backup := range []string{path + ".1", path + ".2"} {
+		if got := len(readJSONLines(t, backup)); got != 2 {
+			t.Errorf("%s has %d lines, want 2", filepath.Base(backup), got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, found %s.3", filepath.Base(path))
+	}
+}
@@ -0,0 +1,65 @@
+// Package audit forwards audit log entries to external collectors such as a
+// SIEM. Sinks receive entries in chain order, at least once; consumers can
+// deduplicate on the entry ID or sequence number.
+package audit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// Sink delivers batches of audit entries to one destination. A returned error
+// means the whole batch should be retried.
+type Sink interface {
+	// Name identifies the sink; it keys the sink's delivery offset, so it
+	// must stay stable across restarts.
+	Name() string
+	Write(entries []models.AuditEntry) error
+	Close() error
+}
+
+// NewSinks builds the sinks enabled in the configuration.
+func NewSinks(cfg *config.Config) ([]Sink, error) {
+	var sinks []Sink
+
+	if cfg.AuditSyslogURL != "" {
+		var tlsConfig *tls.Config
+		if cfg.AuditSyslogCAFile != "" {
+			pem, err := os.ReadFile(cfg.AuditSyslogCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("audit syslog CA: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("audit syslog CA: no certificates found")
+			}
+			tlsConfig = &tls.Config{RootCAs: pool}
+		}
+
+		sink, err := NewSyslogSink(cfg.AuditSyslogURL, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.AuditFilePath != "" {
+		sink, err := NewFileSink(cfg.AuditFilePath, cfg.AuditFileMaxBytes, cfg.AuditFileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.AuditWebhookURL != "" {
+		sinks = append(sinks, NewWebhookSink(cfg.AuditWebhookURL, cfg.AuditWebhookToken))
+	}
+
+	return sinks, nil
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+)
+
+func TestNewSinks(t *testing.T) {
+	cfg := &config.Config{
+		AuditSyslogURL:  "udp://127.0.0.1:514",
+		AuditFilePath:   filepath.Join(t.TempDir(), "audit.jsonl"),
+		AuditWebhookURL: "http://127.0.0.1:9/audit",
+	}
+
+	sinks, err := NewSinks(cfg)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+	defer func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	}()
+
+	want := []string{
+		"syslog:udp://127.0.0.1:514",
+		"file:" + cfg.AuditFilePath,
+		"webhook:http://127.0.0.1:9/audit",
+	}
+	if len(sinks) != len(want) {
+		t.Fatalf("NewSinks() returned %d sinks, want %d", len(sinks), len(want))
+	}
+	for i, sink := range sinks {
+		if sink.Name() != want[i] {
+			t.Errorf("sink %d = %q, want %q", i, sink.Name(), want[i])
+		}
+	}
+}
+
+func TestNewSinks_NoneConfigured(t *testing.T) {
+	sinks, err := NewSinks(&config.Config{})
+	if err != nil || len(sinks) != 0 {
+		t.Errorf("NewSinks() = %d sinks, %v; want none", len(sinks), err)
+	}
+}
+
+func TestNewSinks_MissingCAFile(t *testing.T) {
+	_, err := NewSinks(&config.Config{
+		AuditSyslogURL:    "tls://127.0.0.1:6514",
+		AuditSyslogCAFile: filepath.Join(t.TempDir(), "missing.pem"),
+	})
+	if err == nil {
+		t.Error("NewSinks() should fail when the CA file is missing")
+	}
+}
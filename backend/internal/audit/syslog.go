@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+const (
+	syslogAppName      = "docvault"
+	syslogFacilityAuth = 10 // authpriv
+	syslogSeverityInfo = 6
+	syslogSeverityWarn = 4
+	// syslogEnterpriseID is the IANA example enterprise number (RFC 5612),
+	// used for the structured data ID.
+	syslogEnterpriseID = 32473
+	syslogDialTimeout  = 10 * time.Second
+	syslogWriteTimeout = 10 * time.Second
+)
+
+// SyslogSink sends entries as RFC 5424 messages. UDP sends one message per
+// datagram; TCP and TLS use octet-counting framing (RFC 6587, RFC 5425).
+type SyslogSink struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	hostname  string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink parses a udp://, tcp:// or tls:// URL. tlsConfig may be nil
+// to verify the server against the system roots.
+func NewSyslogSink(rawURL string, tlsConfig *tls.Config) (*SyslogSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("audit syslog URL: %w", err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("audit syslog URL: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("audit syslog URL: missing host")
+	}
+
+	if u.Scheme == "tls" {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &SyslogSink{
+		network:   u.Scheme,
+		addr:      u.Host,
+		tlsConfig: tlsConfig,
+		hostname:  syslogHeaderValue(hostname, 255),
+	}, nil
+}
+
+func (s *SyslogSink) Name() string {
+	return "syslog:" + s.network + "://" + s.addr
+}
+
+func (s *SyslogSink) Write(entries []models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	for i := range entries {
+		msg, err := s.format(&entries[i])
+		if err != nil {
+			return err
+		}
+		if s.network != "udp" {
+			msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := s.conn.Write(msg); err != nil {
+			// Drop the connection; the retry redials
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.addr)
+}
+
+// format renders an entry as
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+// with the full entry as JSON in MSG.
+func (s *SyslogSink) format(entry *models.AuditEntry) ([]byte, error) {
+	severity := syslogSeverityInfo
+	if entry.Outcome != "success" {
+		severity = syslogSeverityWarn
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	params := []string{
+		fmt.Sprintf(`seq="%d"`, entry.Seq),
+		fmt.Sprintf(`id="%s"`, entry.ID),
+		fmt.Sprintf(`outcome="%s"`, syslogParamValue(entry.Outcome)),
+	}
+	if entry.ActorEmail != "" {
+		params = append(params, fmt.Sprintf(`actor="%s"`, syslogParamValue(entry.ActorEmail)))
+	}
+	if entry.TargetID != nil {
+		params = append(params, fmt.Sprintf(`target="%s:%s"`, syslogParamValue(entry.TargetType), entry.TargetID))
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s [audit@%d %s] ",
+		syslogFacilityAuth*8+severity,
+		entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		syslogAppName,
+		os.Getpid(),
+		syslogHeaderValue(entry.Action, 32),
+		syslogEnterpriseID,
+		strings.Join(params, " "),
+	)
+	return append([]byte(msg), body...), nil
+}
+
+// syslogHeaderValue restricts a header field to printable ASCII without
+// spaces, as RFC 5424 requires, using "-" for an empty value.
+func syslogHeaderValue(value string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func syslogParamValue(value string) string {
+	return syslogParamEscaper.Replace(value)
+}
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+var rfc5424Header = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ docvault \d+ (\S+) \[audit@32473 ((?:[^\]\\]|\\.)*)\] \{`)
+
+func testEntries() []models.AuditEntry {
+	actorID := uuid.New()
+	docID := uuid.New()
+	return []models.AuditEntry{
+		{
+			Seq: 1, ID: uuid.New(), OccurredAt: time.Now().UTC(),
+			Action: "document.upload", Outcome: "success",
+			ActorID: &actorID, ActorEmail: "alice@example.com",
+			TargetType: "document", TargetID: &docID,
+		},
+		{
+			Seq: 2, ID: uuid.New(), OccurredAt: time.Now().UTC(),
+			Action: "auth.login", Outcome: "failure",
+			ActorEmail: `mallory"]@example.com`,
+			Details:    map[string]string{"error": "invalid password"},
+		},
+	}
+}
+
+// readOctetCounted reads one RFC 6587 octet-counted frame.
+func readOctetCounted(r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return ""
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return ""
+	}
+	return string(buf)
+}
+
+func checkSyslogMessage(t *testing.T, msg string, wantPri int, wantMsgID string) {
+	t.Helper()
+	m := rfc5424Header.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("message is not RFC 5424: %q", msg)
+	}
+	if m[1] != strconv.Itoa(wantPri) {
+		t.Errorf("PRI = %s, want %d", m[1], wantPri)
+	}
+	if m[2] != wantMsgID {
+		t.Errorf("MSGID = %s, want %s", m[2], wantMsgID)
+	}
+}
+
+func TestSyslogSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink("udp://"+conn.LocalAddr().String(), nil)
+	if err != nil {
+		t.Fatalf("NewSyslogSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testEntries()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64<<10)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	// authpriv (10) * 8 + info (6)
+	checkSyslogMessage(t, string(buf[:n]), 86, "document.upload")
+
+	n, _, err = conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	msg := string(buf[:n])
+	// authpriv (10) * 8 + warning (4)
+	checkSyslogMessage(t, msg, 84, "auth.login")
+	if !strings.Contains(msg, `actor="mallory\"\]@example.com"`) {
+		t.Errorf("structured data not escaped: %q", msg)
+	}
+}
+
+func TestSyslogSink_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		received <- []string{readOctetCounted(r), readOctetCounted(r)}
+	}()
+
+	sink, err := NewSyslogSink("tcp://"+ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("NewSyslogSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testEntries()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	select {
+	case msgs := <-received:
+		checkSyslogMessage(t, msgs[0], 86, "document.upload")
+		checkSyslogMessage(t, msgs[1], 84, "auth.login")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+}
+
+func TestSyslogSink_TLS(t *testing.T) {
+	// httptest provides a self-signed certificate for 127.0.0.1
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: server.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received <- readOctetCounted(bufio.NewReader(conn))
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	sink, err := NewSyslogSink("tls://"+ln.Addr().String(), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatalf("NewSyslogSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testEntries()[:1]); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		checkSyslogMessage(t, msg, 86, "document.upload")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func TestSyslogSink_ReconnectsAfterFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sink, err := NewSyslogSink("tcp://"+addr, nil)
+	if err != nil {
+		t.Fatalf("NewSyslogSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(testEntries()); err == nil {
+		t.Fatal("Write() to a closed port should fail")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("could not rebind %s: %v", addr, err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			bufio.NewReader(conn).ReadString('\n')
+		}
+	}()
+
+	if err := sink.Write(testEntries()); err != nil {
+		t.Errorf("Write() after the listener came back error = %v", err)
+	}
+}
+
+func TestNewSyslogSink_InvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"http://siem:514", "udp://", "::bad"} {
+		if _, err := NewSyslogSink(rawURL, nil); err == nil {
+			t.Errorf("NewSyslogSink(%q) should fail", rawURL)
+		}
+	}
+}
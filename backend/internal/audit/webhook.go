@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+const webhookTimeout = 15 * time.Second
+
+// WebhookSink POSTs each batch as a JSON array. Any non-2xx response fails
+// the batch.
+type WebhookSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting to url. A non-empty token is sent as
+// a bearer token.
+func NewWebhookSink(url, token string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook:" + s.url
+}
+
+func (s *WebhookSink) Write(entries []models.AuditEntry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+func TestWebhookSink_PostsBatch(t *testing.T) {
+	var got []models.AuditEntry
+	var auth, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "siem-token")
+	defer sink.Close()
+
+	if err := sink.Write(testEntries()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if len(got) != 2 || got[0].Seq != 1 || got[1].Seq != 2 {
+		t.Errorf("server received %+v, want both entries in order", got)
+	}
+	if auth != "Bearer siem-token" {
+		t.Errorf("Authorization = %q, want bearer token", auth)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+}
+
+func TestWebhookSink_ErrorStatusFailsBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "")
+	if err := sink.Write(testEntries()); err == nil {
+		t.Error("Write() should fail on a 503 response")
+	}
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoad_WithJWTSecret(t *testing.T) {
@@ -37,6 +40,24 @@ func TestLoad_Defaults(t *testing.T) {
 	os.Unsetenv("UPLOAD_DIR")
 	os.Unsetenv("MAX_FILE_SIZE")
 	os.Unsetenv("ALLOWED_ORIGINS")
+	os.Unsetenv("TRUSTED_PROXIES")
+	os.Unsetenv("AUDITOR_EMAILS")
+	os.Unsetenv("AUDIT_FILE_MAX_BYTES")
+	os.Unsetenv("AUDIT_FILE_MAX_BACKUPS")
+	os.Unsetenv("MAIL_FROM")
+	os.Unsetenv("INTEGRITY_SCRUB_INTERVAL")
+	os.Unsetenv("REQUEST_TIMEOUT")
+	os.Unsetenv("ROUTE_TIMEOUTS")
+	os.Unsetenv("SHUTDOWN_DELAY")
+	os.Unsetenv("SHUTDOWN_TIMEOUT")
+	os.Unsetenv("RATE_LIMITS")
+	os.Unsetenv("RATE_LIMIT_STORE")
+	os.Unsetenv("READINESS_TIMEOUT")
+	os.Unsetenv("MIN_FREE_DISK_BYTES")
+	os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	os.Unsetenv("OTEL_SERVICE_NAME")
+	os.Unsetenv("OTEL_TRACES_SAMPLER_ARG")
+	os.Unsetenv("LOG_LEVEL")
 
 	cfg := Load()
 
@@ -61,6 +82,56 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.AllowedOrigins != "http://localhost:3000" {
 		t.Errorf("Default AllowedOrigins = %q, want %q", cfg.AllowedOrigins, "http://localhost:3000")
 	}
+
+	if cfg.TrustedProxies != nil {
+		t.Errorf("Default TrustedProxies = %v, want nil", cfg.TrustedProxies)
+	}
+
+	if cfg.AuditorEmails != "" {
+		t.Errorf("Default AuditorEmails = %q, want empty", cfg.AuditorEmails)
+	}
+
+	if cfg.AuditFileMaxBytes != 104857600 || cfg.AuditFileMaxBackups != 5 {
+		t.Errorf("Default audit file rotation = %d bytes, %d backups, want 104857600, 5", cfg.AuditFileMaxBytes, cfg.AuditFileMaxBackups)
+	}
+
+	if cfg.MailFrom != "no-reply@localhost" {
+		t.Errorf("Default MailFrom = %q, want %q", cfg.MailFrom, "no-reply@localhost")
+	}
+
+	if cfg.IntegrityScrubInterval != 24*time.Hour {
+		t.Errorf("Default IntegrityScrubInterval = %v, want 24h", cfg.IntegrityScrubInterval)
+	}
+
+	if cfg.RequestTimeout != 30*time.Second {
+		t.Errorf("Default RequestTimeout = %v, want 30s", cfg.RequestTimeout)
+	}
+	if timeout, ok := cfg.RouteTimeouts["GET /events"]; !ok || timeout != 0 {
+		t.Errorf("Default event stream timeout = %v (set %v), want none", timeout, ok)
+	}
+	if cfg.RouteTimeouts["POST /documents"] != 5*time.Minute {
+		t.Errorf("Default upload timeout = %v, want 5m", cfg.RouteTimeouts["POST /documents"])
+	}
+
+	if cfg.ShutdownDelay != 5*time.Second || cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("Default shutdown = %v delay, %v timeout; want 5s and 30s", cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	}
+
+	if cfg.RateLimitStore != "postgres" || cfg.RateLimits["api"] != (RateLimit{Requests: 600, Period: time.Minute}) || len(cfg.RateLimits) != 3 {
+		t.Errorf("Default rate limits = %q %v, want postgres and the defaults", cfg.RateLimitStore, cfg.RateLimits)
+	}
+
+	if cfg.ReadinessTimeout != 2*time.Second || cfg.MinFreeDiskBytes != 104857600 {
+		t.Errorf("Default readiness = %v timeout, %d bytes free; want 2s and 100MB", cfg.ReadinessTimeout, cfg.MinFreeDiskBytes)
+	}
+
+	if cfg.TracingEndpoint != "" || cfg.TracingServiceName != "secure-doc-vault" || cfg.TracingSampleRatio != 1 {
+		t.Errorf("Default tracing = %q, %q, %v; want disabled, secure-doc-vault, 1", cfg.TracingEndpoint, cfg.TracingServiceName, cfg.TracingSampleRatio)
+	}
+
+	if cfg.LogLevel != slog.LevelInfo {
+		t.Errorf("Default LogLevel = %v, want INFO", cfg.LogLevel)
+	}
 }
 
 func TestLoad_CustomValues(t *testing.T) {
@@ -71,6 +142,24 @@ func TestLoad_CustomValues(t *testing.T) {
 	t.Setenv("UPLOAD_DIR", "/custom/uploads")
 	t.Setenv("MAX_FILE_SIZE", "52428800") // 50MB
 	t.Setenv("ALLOWED_ORIGINS", "https://example.com,https://api.example.com")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1,")
+	t.Setenv("AUDITOR_EMAILS", "audit@example.com")
+	t.Setenv("ADMIN_EMAILS", "admin@example.com")
+	t.Setenv("AUDIT_SYSLOG_URL", "tls://siem.example.com:6514")
+	t.Setenv("AUDIT_FILE_MAX_BYTES", "1024")
+	t.Setenv("INTEGRITY_SCRUB_INTERVAL", "6h")
+	t.Setenv("REQUEST_TIMEOUT", "10s")
+	t.Setenv("ROUTE_TIMEOUTS", "get /search=2s, POST /documents=15m")
+	t.Setenv("SHUTDOWN_DELAY", "0s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "2m")
+	t.Setenv("RATE_LIMITS", "api=100/1s,upload=0/1m,search=5/1h")
+	t.Setenv("RATE_LIMIT_STORE", "memory")
+	t.Setenv("READINESS_TIMEOUT", "500ms")
+	t.Setenv("MIN_FREE_DISK_BYTES", "1073741824")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_SERVICE_NAME", "vault-api")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	t.Setenv("LOG_LEVEL", "debug")
 
 	cfg := Load()
 
@@ -97,6 +186,90 @@ func TestLoad_CustomValues(t *testing.T) {
 	if cfg.AllowedOrigins != "https://example.com,https://api.example.com" {
 		t.Errorf("AllowedOrigins = %q, want custom value", cfg.AllowedOrigins)
 	}
+
+	if !reflect.DeepEqual(cfg.TrustedProxies, []string{"10.0.0.0/8", "192.168.1.1"}) {
+		t.Errorf("TrustedProxies = %v, want 10.0.0.0/8 and 192.168.1.1", cfg.TrustedProxies)
+	}
+
+	if cfg.AuditorEmails != "audit@example.com" {
+		t.Errorf("AuditorEmails = %q, want custom value", cfg.AuditorEmails)
+	}
+
+	if cfg.AdminEmails != "admin@example.com" {
+		t.Errorf("AdminEmails = %q, want custom value", cfg.AdminEmails)
+	}
+
+	if cfg.AuditSyslogURL != "tls://siem.example.com:6514" {
+		t.Errorf("AuditSyslogURL = %q, want custom value", cfg.AuditSyslogURL)
+	}
+
+	if cfg.AuditFileMaxBytes != 1024 {
+		t.Errorf("AuditFileMaxBytes = %d, want %d", cfg.AuditFileMaxBytes, 1024)
+	}
+
+	if cfg.IntegrityScrubInterval != 6*time.Hour {
+		t.Errorf("IntegrityScrubInterval = %v, want 6h", cfg.IntegrityScrubInterval)
+	}
+
+	if cfg.RequestTimeout != 10*time.Second {
+		t.Errorf("RequestTimeout = %v, want 10s", cfg.RequestTimeout)
+	}
+	if cfg.RouteTimeouts["GET /search"] != 2*time.Second || cfg.RouteTimeouts["POST /documents"] != 15*time.Minute {
+		t.Errorf("RouteTimeouts = %v, want the overrides applied", cfg.RouteTimeouts)
+	}
+	if cfg.RouteTimeouts["GET /documents/:id/download"] != 10*time.Minute {
+		t.Errorf("RouteTimeouts lost the download default: %v", cfg.RouteTimeouts)
+	}
+
+	// No delay is allowed, for deployments without a load balancer
+	if cfg.ShutdownDelay != 0 || cfg.ShutdownTimeout != 2*time.Minute {
+		t.Errorf("Shutdown = %v delay, %v timeout; want 0s and 2m", cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	}
+
+	wantLimits := map[string]RateLimit{
+		"auth":   {Requests: 20, Period: time.Minute},
+		"api":    {Requests: 100, Period: time.Second},
+		"upload": {Requests: 0, Period: time.Minute},
+		"search": {Requests: 5, Period: time.Hour},
+	}
+	if cfg.RateLimitStore != "memory" || !reflect.DeepEqual(cfg.RateLimits, wantLimits) {
+		t.Errorf("Rate limits = %q %v, want memory and %v", cfg.RateLimitStore, cfg.RateLimits, wantLimits)
+	}
+
+	if cfg.ReadinessTimeout != 500*time.Millisecond || cfg.MinFreeDiskBytes != 1073741824 {
+		t.Errorf("Readiness = %v timeout, %d bytes free; want 500ms and 1GB", cfg.ReadinessTimeout, cfg.MinFreeDiskBytes)
+	}
+
+	if cfg.TracingEndpoint != "http://collector:4318" || cfg.TracingServiceName != "vault-api" || cfg.TracingSampleRatio != 0.25 {
+		t.Errorf("Tracing = %q, %q, %v; want the custom values", cfg.TracingEndpoint, cfg.TracingServiceName, cfg.TracingSampleRatio)
+	}
+
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("LogLevel = %v, want DEBUG", cfg.LogLevel)
+	}
+}
+
+func TestParseRouteTimeouts_SkipsMalformedEntries(t *testing.T) {
+	timeouts := parseRouteTimeouts("GET /search=5s,/no-method=1s,GET /bad=soon,POST noslash=1s,,DELETE /documents/:id=0")
+
+	if len(timeouts) != 2 || timeouts["GET /search"] != 5*time.Second {
+		t.Errorf("parseRouteTimeouts() = %v, want GET /search and DELETE /documents/:id", timeouts)
+	}
+	if timeout, ok := timeouts["DELETE /documents/:id"]; !ok || timeout != 0 {
+		t.Errorf("parseRouteTimeouts() dropped a zero timeout: %v", timeouts)
+	}
+}
+
+func TestParseRateLimits_SkipsMalformedEntries(t *testing.T) {
+	limits := parseRateLimits("api=10/1m,=5/1s,nosep,upload=ten/1m,auth=5/soon,search=-1/1m,export=1/48h, tags = 3/1s ")
+
+	want := map[string]RateLimit{
+		"api":  {Requests: 10, Period: time.Minute},
+		"tags": {Requests: 3, Period: time.Second},
+	}
+	if !reflect.DeepEqual(limits, want) {
+		t.Errorf("parseRateLimits() = %v, want %v", limits, want)
+	}
 }
 
 func TestLoad_InvalidMaxFileSize(t *testing.T) {
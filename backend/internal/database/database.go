@@ -1,11 +1,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DB struct {
@@ -13,7 +18,15 @@ type DB struct {
 }
 
 func New(databaseURL string) (*DB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+	// Every statement gets a span under the caller's, when it passes a context
+	db, err := otelsql.Open("postgres", databaseURL,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter:           hasParentSpan,
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -31,57 +44,28 @@ func New(databaseURL string) (*DB, error) {
 	return &DB{db}, nil
 }
 
-func (db *DB) Migrate() error {
-	migrations := []string{
-		`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`,
-		`CREATE TABLE IF NOT EXISTS users (
-			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-			email VARCHAR(255) UNIQUE NOT NULL,
-			password VARCHAR(255) NOT NULL,
-			name VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		)`,
-		`CREATE TABLE IF NOT EXISTS documents (
-			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-			owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			name VARCHAR(255) NOT NULL,
-			original_name VARCHAR(255) NOT NULL,
-			size BIGINT NOT NULL,
-			mime_type VARCHAR(100) NOT NULL,
-			encryption_key VARCHAR(255),
-			encryption_algo VARCHAR(50) DEFAULT 'AES-256-GCM',
-			file_path VARCHAR(500) NOT NULL,
-			is_encrypted BOOLEAN DEFAULT false,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			deleted_at TIMESTAMP WITH TIME ZONE
-		)`,
-		`CREATE TABLE IF NOT EXISTS document_shares (
-			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-			document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
-			shared_by_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			shared_with_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			permission VARCHAR(20) NOT NULL DEFAULT 'view',
-			expires_at TIMESTAMP WITH TIME ZONE,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			UNIQUE(document_id, shared_with_id)
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_documents_owner ON documents(owner_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_documents_deleted ON documents(deleted_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_shares_document ON document_shares(document_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_shares_shared_with ON document_shares(shared_with_id)`,
-	}
-
-	for _, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %w", err)
-		}
-	}
-
-	return nil
+// hasParentSpan keeps statement spans that belong to a trace. Background
+// workers poll outside any request, and a root span for each poll would be
+// a steady stream of one-span traces.
+func hasParentSpan(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+	return trace.SpanContextFromContext(ctx).IsValid()
 }
 
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
+
+// InTx runs fn in a transaction, committing when fn returns nil and rolling
+// back otherwise.
+func (db *DB) InTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
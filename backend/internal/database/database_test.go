@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newMockDB(t *testing.T) (*DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return &DB{sqlDB}, mock
+}
+
+func TestInTx_Commits(t *testing.T) {
+	db, mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE widgets`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := db.InTx(context.Background(), func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE widgets SET name = 'a'`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InTx() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInTx_RollsBackOnError(t *testing.T) {
+	db, mock := newMockDB(t)
+	failure := errors.New("failed")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := db.InTx(context.Background(), func(tx *sql.Tx) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("InTx() error = %v, want fn's error", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestHasParentSpan(t *testing.T) {
+	if hasParentSpan(context.Background(), otelsql.MethodConnQuery, "SELECT 1", nil) {
+		t.Error("hasParentSpan() = true without a span in the context")
+	}
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+	if !hasParentSpan(ctx, otelsql.MethodConnQuery, "SELECT 1", nil) {
+		t.Error("hasParentSpan() = false under a span")
+	}
+}
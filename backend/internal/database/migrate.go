@@ -0,0 +1,307 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// migrationLock is the advisory lock key held while migrations run, so
+// replicas starting together apply each migration once.
+const migrationLock int64 = 0x646f637661756c74 // "docvault"
+
+var migrationFilename = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var ErrNoDownMigration = errors.New("migration has no down script")
+
+// Migration is one numbered schema change, read from
+// migrations/<version>_<name>.up.sql and its optional .down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied. A migration
+// recorded in the database without a file in this build has an empty Name
+// and Missing set.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Missing   bool
+}
+
+// Migrator applies and reverts migrations, each in its own transaction.
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+// NewMigrator returns a migrator for the migrations embedded in the binary.
+func (db *DB) NewMigrator() (*Migrator, error) {
+	dir, err := fs.Sub(embeddedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db, dir)
+}
+
+// NewMigrator returns a migrator for the migration files at the root of
+// fsys.
+func NewMigrator(db *DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Migrate applies every pending migration.
+func (db *DB) Migrate() error {
+	m, err := db.NewMigrator()
+	if err != nil {
+		return err
+	}
+	_, err = m.Up()
+	return err
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFilename.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file %q in migrations", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrations returns the migrations in this build, oldest first.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies the migrations that haven't been applied yet, oldest first, and
+// returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(func(conn *sql.Conn, done map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := inTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(
+					`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+					migration.Version, migration.Name,
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and
+// returns them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(func(conn *sql.Conn, done map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, ErrNoDownMigration)
+			}
+			err := inTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and when it was applied, followed by
+// any applied versions this build has no file for.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.locked(func(conn *sql.Conn, done map[int64]time.Time) error {
+		known := make(map[int64]bool)
+		for _, migration := range m.migrations {
+			known[migration.Version] = true
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if at, ok := done[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+
+		var unknown []MigrationStatus
+		for version, at := range done {
+			if !known[version] {
+				at := at
+				unknown = append(unknown, MigrationStatus{Version: version, AppliedAt: &at, Missing: true})
+			}
+		}
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+		statuses = append(statuses, unknown...)
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns the migrations in this build that haven't been applied.
+// Unlike Status it doesn't take the migration lock, so it answers straight
+// away while another replica is migrating, and it fails if
+// schema_migrations doesn't exist yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		done[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// locked runs fn on a single connection holding the migration lock, with
+// the versions already applied. The lock is a session lock, so everything
+// has to happen on that one connection rather than the pool.
+func (m *Migrator) locked(fn func(conn *sql.Conn, done map[int64]time.Time) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	)`); err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		done[version] = appliedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, done)
+}
+
+func inTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_users.up.sql":     {Data: []byte("CREATE TABLE users (id INT);")},
+	"0001_users.down.sql":   {Data: []byte("DROP TABLE users;")},
+	"0002_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INT);")},
+	"0002_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	"0003_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INT);")},
+}
+
+func newMockMigrator(t *testing.T, fsys fstest.MapFS) (*Migrator, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	m, err := NewMigrator(&DB{sqlDB}, fsys)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	return m, mock
+}
+
+// expectLocked expects the lock and the read of the applied versions.
+func expectLocked(mock sqlmock.Sqlmock, applied ...int64) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).
+		WithArgs(migrationLock).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Now())
+	}
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).
+		WithArgs(migrationLock).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(testMigrations)
+	if err != nil {
+		t.Fatalf("loadMigrations() error = %v", err)
+	}
+
+	if len(migrations) != 3 {
+		t.Fatalf("loadMigrations() returned %d migrations, want 3", len(migrations))
+	}
+	for i, want := range []string{"users", "widgets", "gadgets"} {
+		if migrations[i].Version != int64(i+1) || migrations[i].Name != want {
+			t.Errorf("migration %d = %d_%s, want %d_%s", i, migrations[i].Version, migrations[i].Name, i+1, want)
+		}
+	}
+	if migrations[2].Down != "" {
+		t.Errorf("migration 3 has a down script %q, want none", migrations[2].Down)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"stray file":      {"README.md": {Data: []byte("notes")}},
+		"down without up": {"0001_users.down.sql": {Data: []byte("DROP TABLE users;")}},
+		"name mismatch": {
+			"0001_users.up.sql":     {Data: []byte("CREATE TABLE users (id INT);")},
+			"0001_members.down.sql": {Data: []byte("DROP TABLE users;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("loadMigrations() with %s = nil error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := (&DB{}).NewMigrator()
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if len(m.migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, migration := range m.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d has version %d; versions should be consecutive", i, migration.Version)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+
+	expectLocked(mock, 1)
+	for _, migration := range []struct {
+		version int64
+		name    string
+		sql     string
+	}{{2, "widgets", `CREATE TABLE widgets`}, {3, "gadgets", `CREATE TABLE gadgets`}} {
+		mock.ExpectBegin()
+		mock.ExpectExec(migration.sql).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_migrations \(version, name\) VALUES \(\$1, \$2\)`).
+			WithArgs(migration.version, migration.name).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	expectUnlock(mock)
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if len(applied) != 2 || applied[0].Version != 2 || applied[1].Version != 3 {
+		t.Errorf("Up() applied %v, want versions 2 and 3", applied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMigrator_Up_FailureRollsBack(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+
+	expectLocked(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE widgets`).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, err := m.Up()
+	if err == nil {
+		t.Fatal("Up() error = nil, want the failing migration")
+	}
+	if len(applied) != 0 {
+		t.Errorf("Up() applied %v after a failure, want none", applied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+
+	expectLocked(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DROP TABLE widgets`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1`).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	reverted, err := m.Down(1)
+	if err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Errorf("Down(1) reverted %v, want version 2", reverted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMigrator_Down_WithoutScript(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+
+	expectLocked(mock, 1, 2, 3)
+	expectUnlock(mock)
+
+	if _, err := m.Down(1); !errors.Is(err, ErrNoDownMigration) {
+		t.Errorf("Down() error = %v, want ErrNoDownMigration", err)
+	}
+}
+
+func TestMigrator_Status(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+
+	// Version 7 was applied by a newer build
+	expectLocked(mock, 1, 7)
+	expectUnlock(mock)
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	if len(statuses) != 4 {
+		t.Fatalf("Status() returned %d entries, want 4", len(statuses))
+	}
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil || statuses[2].AppliedAt != nil {
+		t.Errorf("Status() = %+v, want only version 1 applied", statuses[:3])
+	}
+	if last := statuses[3]; last.Version != 7 || !last.Missing || last.AppliedAt == nil {
+		t.Errorf("Status() last entry = %+v, want applied version 7 with no file", last)
+	}
+}
+
+func TestMigrator_Pending(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3).AddRow(7))
+
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("Pending() = %+v, want only version 2", pending)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMigrator_Pending_NoTable(t *testing.T) {
+	m, mock := newMockMigrator(t, testMigrations)
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnError(errors.New(`relation "schema_migrations" does not exist`))
+
+	if _, err := m.Pending(context.Background()); err == nil {
+		t.Error("Pending() error = nil, want the query error")
+	}
+}
@@ -0,0 +1,21 @@
+-- Drops everything the baseline creates. The uuid-ossp extension is left
+-- installed since other schemas in the database may use it.
+
+DROP TABLE IF EXISTS document_previews;
+DROP TABLE IF EXISTS document_comments;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS audit_sink_offsets;
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP TABLE IF EXISTS document_metadata;
+DROP TABLE IF EXISTS document_tags;
+DROP TABLE IF EXISTS folder_shares;
+DROP TABLE IF EXISTS document_transfers;
+DROP TABLE IF EXISTS document_shares;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS folders;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,269 @@
+-- Baseline: the schema as the server created it before versioned
+-- migrations. Every statement is idempotent so databases created by that
+-- code adopt this version without changes.
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	email VARCHAR(255) UNIQUE NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	original_name VARCHAR(255) NOT NULL,
+	size BIGINT NOT NULL,
+	mime_type VARCHAR(100) NOT NULL,
+	encryption_key VARCHAR(255),
+	encryption_algo VARCHAR(50) DEFAULT 'AES-256-GCM',
+	file_path VARCHAR(500) NOT NULL,
+	is_encrypted BOOLEAN DEFAULT false,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS document_shares (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	shared_by_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	shared_with_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	permission VARCHAR(20) NOT NULL DEFAULT 'view',
+	expires_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(document_id, shared_with_id)
+);
+
+CREATE TABLE IF NOT EXISTS document_transfers (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	keep_access BOOLEAN NOT NULL DEFAULT false,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	responded_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS folders (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS folder_shares (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+	shared_by_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	shared_with_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	permission VARCHAR(20) NOT NULL DEFAULT 'view',
+	expires_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(folder_id, shared_with_id)
+);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS document_tags (
+	document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	tag VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	PRIMARY KEY (document_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS document_metadata (
+	document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	key VARCHAR(64) NOT NULL,
+	value_type VARCHAR(16) NOT NULL,
+	value TEXT NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	PRIMARY KEY (document_id, key)
+);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_text TEXT;
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(content_text, '')), 'B')
+) STORED;
+
+-- Audit entries outlive the users and documents they mention, so there
+-- are no foreign keys; the trigger rejects any change after insert
+CREATE TABLE IF NOT EXISTS audit_log (
+	seq BIGSERIAL PRIMARY KEY,
+	id UUID NOT NULL UNIQUE,
+	occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	action VARCHAR(64) NOT NULL,
+	outcome VARCHAR(16) NOT NULL,
+	actor_id UUID,
+	actor_email VARCHAR(255),
+	ip VARCHAR(64),
+	user_agent TEXT,
+	target_type VARCHAR(32),
+	target_id UUID,
+	details JSONB,
+	prev_hash CHAR(64) NOT NULL,
+	hash CHAR(64) NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TABLE IF NOT EXISTS audit_sink_offsets (
+	sink VARCHAR(255) PRIMARY KEY,
+	seq BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret VARCHAR(64) NOT NULL,
+	event_types TEXT[] NOT NULL DEFAULT '{}',
+	is_global BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id UUID NOT NULL,
+	event_type VARCHAR(64) NOT NULL,
+	payload JSONB NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	last_status_code INTEGER,
+	last_error TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Notifications keep the names they mention in data, so they stay
+-- readable after the document or folder is gone
+CREATE TABLE IF NOT EXISTS notifications (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(64) NOT NULL,
+	actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	document_id UUID REFERENCES documents(id) ON DELETE SET NULL,
+	folder_id UUID REFERENCES folders(id) ON DELETE SET NULL,
+	data JSONB,
+	read_at TIMESTAMP WITH TIME ZONE,
+	email_pending BOOLEAN NOT NULL DEFAULT false,
+	email_attempts INTEGER NOT NULL DEFAULT 0,
+	email_next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	emailed_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type VARCHAR(64) NOT NULL,
+	email BOOLEAN NOT NULL,
+	PRIMARY KEY (user_id, type)
+);
+
+-- Replies point at the top-level comment of their thread; deleting a
+-- comment that has replies only blanks it
+CREATE TABLE IF NOT EXISTS document_comments (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	parent_id UUID REFERENCES document_comments(id) ON DELETE CASCADE,
+	author_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	page INTEGER,
+	version INTEGER,
+	resolved_at TIMESTAMP WITH TIME ZONE,
+	resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Thumbnails and text previews are generated in the background; a row
+-- exists for every document whose type can be previewed
+CREATE TABLE IF NOT EXISTS document_previews (
+	document_id UUID PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	thumbnail BYTEA,
+	thumbnail_type VARCHAR(50),
+	preview_text TEXT,
+	preview_truncated BOOLEAN NOT NULL DEFAULT false,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	last_error TEXT,
+	generated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Hex SHA-256 of the content, backing download ETags
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS sha256 VARCHAR(64);
+
+-- Stored files, shared by an owner's documents with identical content.
+-- ref_count is the number of live documents pointing at the blob.
+CREATE TABLE IF NOT EXISTS blobs (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	sha256 VARCHAR(64) NOT NULL,
+	size BIGINT NOT NULL,
+	file_path VARCHAR(500) NOT NULL,
+	ref_count INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	verified_at TIMESTAMP WITH TIME ZONE,
+	corrupted_at TIMESTAMP WITH TIME ZONE,
+	UNIQUE (owner_id, sha256)
+);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS blob_id UUID REFERENCES blobs(id) ON DELETE SET NULL;
+ALTER TABLE document_shares ADD COLUMN IF NOT EXISTS expiry_notified BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE folder_shares ADD COLUMN IF NOT EXISTS expiry_notified BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_documents_owner ON documents(owner_id);
+CREATE INDEX IF NOT EXISTS idx_documents_deleted ON documents(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_shares_document ON document_shares(document_id);
+CREATE INDEX IF NOT EXISTS idx_shares_shared_with ON document_shares(shared_with_id);
+CREATE INDEX IF NOT EXISTS idx_documents_folder ON documents(folder_id);
+CREATE INDEX IF NOT EXISTS idx_folders_owner_parent ON folders(owner_id, parent_id);
+CREATE INDEX IF NOT EXISTS idx_folder_shares_shared_with ON folder_shares(shared_with_id);
+CREATE INDEX IF NOT EXISTS idx_document_tags_tag ON document_tags(tag);
+CREATE INDEX IF NOT EXISTS idx_document_metadata_key_value ON document_metadata(key, value);
+CREATE INDEX IF NOT EXISTS idx_documents_search ON documents USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_id, seq);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id, seq);
+CREATE INDEX IF NOT EXISTS idx_audit_log_occurred ON audit_log(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner ON webhooks(owner_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_email_due ON notifications(email_next_attempt_at) WHERE email_pending;
+CREATE INDEX IF NOT EXISTS idx_document_comments_document ON document_comments(document_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_document_comments_parent ON document_comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_document_previews_due ON document_previews(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_documents_blob ON documents(blob_id);
+CREATE INDEX IF NOT EXISTS idx_blobs_verified ON blobs(verified_at NULLS FIRST);
+CREATE INDEX IF NOT EXISTS idx_transfers_to_user ON document_transfers(to_user_id, status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transfers_pending ON document_transfers(document_id) WHERE status = 'pending';
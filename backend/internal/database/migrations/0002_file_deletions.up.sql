@@ -0,0 +1,16 @@
+-- Outbox of files to remove once the transaction that orphaned them has
+-- committed. The request removes the file itself and deletes the row; the
+-- file reaper retries whatever is left. The first attempt is held back so
+-- the reaper doesn't race the request.
+
+CREATE TABLE file_deletions (
+	id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+	document_id UUID REFERENCES documents(id) ON DELETE SET NULL,
+	file_path VARCHAR(500) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW() + INTERVAL '1 minute',
+	last_error TEXT,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_file_deletions_due ON file_deletions(next_attempt_at);
@@ -0,0 +1,13 @@
+-- Token buckets shared by every replica, one row per rate-limit group and
+-- user or client IP. allowed is the outcome of the latest request, which
+-- the upsert returns alongside the tokens left. Rows idle long enough to
+-- have refilled are pruned.
+
+CREATE TABLE rate_limits (
+	key VARCHAR(255) PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_rate_limits_updated_at ON rate_limits(updated_at);
@@ -0,0 +1,2 @@
+-- The previous owners' folders are not restored: documents stay at the root.
+SELECT 1;
@@ -0,0 +1,7 @@
+-- Transfers used to keep a document in the folder it had under its previous
+-- owner, leaving it in someone else's tree where that owner's folder shares
+-- still reached it. Such documents move to their new owner's root.
+
+UPDATE documents d SET folder_id = NULL
+FROM folders f
+WHERE d.folder_id = f.id AND f.owner_id <> d.owner_id;
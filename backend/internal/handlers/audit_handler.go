@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// DocumentActivity godoc
+// @Summary Get document activity
+// @Description Get the audit trail of a document, newest first (owner only)
+// @Tags audit
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Items per page" default(20)
+// @Success 200 {object} models.PaginatedResponse{data=[]models.AuditEntry}
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/activity [get]
+func (h *AuditHandler) DocumentActivity(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	entries, total, err := h.auditService.ListForDocument(c.Request.Context(), docID, userID, page, perPage)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDocumentNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
+		case errors.Is(err, services.ErrAccessDenied):
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "access_denied",
+				Message: "Only the document owner can view its activity",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		}
+		return
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	c.JSON(http.StatusOK, paginatedResponse(entries, models.PageInfo{Total: total, Page: page, PerPage: perPage}))
+}
+
+// ExportAudit godoc
+// @Summary Export the audit log
+// @Description Stream matching audit entries as JSON lines in chain order (auditors only)
+// @Tags audit
+// @Security BearerAuth
+// @Produce application/x-ndjson
+// @Param actor_id query string false "Actor user ID"
+// @Param action query string false "Action, or a family wildcard such as document.*"
+// @Param outcome query string false "success or failure"
+// @Param target_id query string false "Target ID"
+// @Param since query string false "Occurred at or after (RFC 3339)"
+// @Param until query string false "Occurred before (RFC 3339)"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /audit/export [get]
+func (h *AuditHandler) ExportAudit(c *gin.Context) {
+	filter := models.AuditFilter{
+		Action:  c.Query("action"),
+		Outcome: c.Query("outcome"),
+	}
+
+	for param, dst := range map[string]**uuid.UUID{"actor_id": &filter.ActorID, "target_id": &filter.TargetID} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "validation_error", Message: "Invalid value for " + param})
+				return
+			}
+			*dst = &id
+		}
+	}
+	for param, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "validation_error", Message: "Invalid value for " + param})
+				return
+			}
+			*dst = &t
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", "attachment; filename=audit-log.jsonl")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	err := h.auditService.Export(c.Request.Context(), filter, func(entry *models.AuditEntry) error {
+		return enc.Encode(entry)
+	})
+	if err != nil {
+		// Headers are already sent; a truncated stream is all we can signal
+		slog.ErrorContext(c.Request.Context(), "audit export failed", "error", err)
+	}
+}
+
+// VerifyAudit godoc
+// @Summary Verify the audit log
+// @Description Recompute the hash chain and report the first tampered entry, if any (auditors only)
+// @Tags audit
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.AuditVerification
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /audit/verify [get]
+func (h *AuditHandler) VerifyAudit(c *gin.Context) {
+	result, err := h.auditService.Verify(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// recordAudit appends an audit entry for the current request, filling in the
+// authenticated actor and client details. A non-nil err marks the outcome as
+// a failure. Audit errors are logged rather than failing the request.
+func recordAudit(c *gin.Context, audit *services.AuditService, entry models.AuditEntry, err error) {
+	if entry.ActorID == nil {
+		if userID, ok := middleware.GetUserID(c); ok {
+			entry.ActorID = &userID
+		}
+	}
+	if entry.ActorEmail == "" {
+		entry.ActorEmail, _ = middleware.GetUserEmail(c)
+	}
+	entry.IP = c.ClientIP()
+	entry.UserAgent = c.Request.UserAgent()
+
+	entry.Outcome = services.AuditSuccess
+	if err != nil {
+		entry.Outcome = services.AuditFailure
+		if entry.Details == nil {
+			entry.Details = map[string]string{}
+		}
+		entry.Details["error"] = err.Error()
+	}
+
+	// The action has happened even if the client has gone away since, so
+	// its entry is written regardless
+	if err := audit.Record(context.WithoutCancel(c.Request.Context()), &entry); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to record audit event", "action", entry.Action, "error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupAuditRouter(db *database.DB, auditorEmails string) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	auditHandler := NewAuditHandler(services.NewAuditService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	router.GET("/documents/:id/activity", authMiddleware.Authenticate(), auditHandler.DocumentActivity)
+
+	audit := router.Group("/audit")
+	audit.Use(authMiddleware.Authenticate(), middleware.RequireEmail(auditorEmails))
+	{
+		audit.GET("/export", auditHandler.ExportAudit)
+		audit.GET("/verify", auditHandler.VerifyAudit)
+	}
+
+	return router, uploadDir
+}
+
+func TestDocumentActivity_RecordsUploadAndDownload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupAuditRouter(db, "")
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "audit-owner@example.com", "password123", "Owner")
+	otherToken := registerAndLogin(router, "audit-other@example.com", "password123", "Other")
+	doc := uploadTestDocument(router, ownerToken)
+
+	req, _ := http.NewRequest("GET", "/documents/"+doc.ID.String()+"/download", nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String()+"/activity", nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Data []models.AuditEntry `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if len(response.Data) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(response.Data))
+	}
+	if response.Data[0].Action != services.AuditDocumentDownload || response.Data[1].Action != services.AuditDocumentUpload {
+		t.Errorf("Expected download then upload, got %s, %s", response.Data[0].Action, response.Data[1].Action)
+	}
+	if response.Data[0].ActorEmail != "audit-owner@example.com" {
+		t.Errorf("Expected actor email to be recorded, got %q", response.Data[0].ActorEmail)
+	}
+
+	// Only the owner may read the trail
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String()+"/activity", nil)
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestAudit_AuditorOnly(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupAuditRouter(db, "auditor@example.com")
+	defer os.RemoveAll(uploadDir)
+
+	auditorToken := registerAndLogin(router, "auditor@example.com", "password123", "Auditor")
+	userToken := registerAndLogin(router, "audit-user@example.com", "password123", "User")
+
+	req, _ := http.NewRequest("GET", "/audit/verify", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/audit/verify", nil)
+	req.Header.Set("Authorization", "Bearer "+auditorToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result models.AuditVerification
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if !result.Valid || result.Entries == 0 {
+		t.Errorf("Expected a valid, non-empty chain, got %+v", result)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/metrics"
 	"github.com/katim/secure-doc-vault/internal/middleware"
 	"github.com/katim/secure-doc-vault/internal/models"
 	"github.com/katim/secure-doc-vault/internal/services"
@@ -13,12 +14,14 @@ import (
 type AuthHandler struct {
 	userService    *services.UserService
 	authMiddleware *middleware.AuthMiddleware
+	auditService   *services.AuditService
 }
 
-func NewAuthHandler(userService *services.UserService, authMiddleware *middleware.AuthMiddleware) *AuthHandler {
+func NewAuthHandler(userService *services.UserService, authMiddleware *middleware.AuthMiddleware, auditService *services.AuditService) *AuthHandler {
 	return &AuthHandler{
 		userService:    userService,
 		authMiddleware: authMiddleware,
+		auditService:   auditService,
 	}
 }
 
@@ -43,7 +46,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.Create(req.Email, req.Password, req.Name)
+	user, err := h.userService.Create(c.Request.Context(), req.Email, req.Password, req.Name)
+	entry := models.AuditEntry{Action: services.AuditRegister, ActorEmail: req.Email}
+	if user != nil {
+		entry.ActorID = &user.ID
+	}
+	recordAudit(c, h.auditService, entry, err)
 	if err != nil {
 		if errors.Is(err, services.ErrUserExists) {
 			c.JSON(http.StatusConflict, models.ErrorResponse{
@@ -95,15 +103,22 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.Authenticate(req.Email, req.Password)
+	user, err := h.userService.Authenticate(c.Request.Context(), req.Email, req.Password)
+	entry := models.AuditEntry{Action: services.AuditLogin, ActorEmail: req.Email}
+	if user != nil {
+		entry.ActorID = &user.ID
+	}
+	recordAudit(c, h.auditService, entry, err)
 	if err != nil {
 		if errors.Is(err, services.ErrUserNotFound) || errors.Is(err, services.ErrInvalidPassword) {
+			metrics.LoginFailures.WithLabelValues("invalid_credentials").Inc()
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error:   "invalid_credentials",
 				Message: "Invalid email or password",
 			})
 			return
 		}
+		metrics.LoginFailures.WithLabelValues("error").Inc()
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "internal_error",
 			Message: "Authentication failed",
@@ -145,7 +160,7 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetByID(userID)
+	user, err := h.userService.GetByID(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "not_found",
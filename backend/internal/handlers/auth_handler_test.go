@@ -49,7 +49,7 @@ func setupAuthRouter(db *database.DB) (*gin.Engine, *AuthHandler) {
 
 	userService := services.NewUserService(db)
 	authMiddleware := middleware.NewAuthMiddleware("test-secret")
-	authHandler := NewAuthHandler(userService, authMiddleware)
+	authHandler := NewAuthHandler(userService, authMiddleware, services.NewAuditService(db))
 
 	auth := router.Group("/auth")
 	{
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxBatchFiles caps how many files one multi-file upload may carry.
+const maxBatchFiles = 100
+
+// BulkHandler applies document operations to many documents in one request.
+// Each item succeeds or fails on its own and is audited like the matching
+// single-document request.
+type BulkHandler struct {
+	documentService *services.DocumentService
+	metadataService *services.MetadataService
+	auditService    *services.AuditService
+	maxFileSize     int64
+}
+
+func NewBulkHandler(documentService *services.DocumentService, metadataService *services.MetadataService, auditService *services.AuditService, maxFileSize int64) *BulkHandler {
+	return &BulkHandler{
+		documentService: documentService,
+		metadataService: metadataService,
+		auditService:    auditService,
+		maxFileSize:     maxFileSize,
+	}
+}
+
+// UploadDocuments godoc
+// @Summary Upload several documents
+// @Description Upload every file in the request as its own document. Files are named after their filenames.
+// @Tags bulk
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param files formData file true "Files to upload (repeat the field for each file)"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /documents/batch [post]
+func (h *BulkHandler) UploadDocuments(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "files_required",
+			Message: "At least one file is required in the files field",
+		})
+		return
+	}
+	headers := form.File["files"]
+	if len(headers) > maxBatchFiles {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "too_many_files",
+			Message: "At most " + strconv.Itoa(maxBatchFiles) + " files can be uploaded at once",
+		})
+		return
+	}
+
+	var response models.BatchResponse
+	for _, header := range headers {
+		result := models.BatchResult{Filename: header.Filename}
+		if header.Size > h.maxFileSize {
+			result.Status, result.Error = http.StatusRequestEntityTooLarge, "file_too_large"
+			addResult(&response, result)
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			result.Status, result.Error = http.StatusBadRequest, "file_unreadable"
+			addResult(&response, result)
+			continue
+		}
+		document, err := h.documentService.Create(c.Request.Context(), userID, header.Filename, header.Filename,
+			header.Header.Get("Content-Type"), header.Size, file, "")
+		file.Close()
+		if err != nil {
+			recordAudit(c, h.auditService, models.AuditEntry{
+				Action:  services.AuditDocumentUpload,
+				Details: map[string]string{"filename": header.Filename},
+			}, err)
+			result.Status, result.Error = batchError(err)
+			if result.Status == http.StatusInternalServerError {
+				result.Error = "upload_failed"
+			}
+			addResult(&response, result)
+			continue
+		}
+
+		recordAudit(c, h.auditService, models.AuditEntry{
+			Action:     services.AuditDocumentUpload,
+			TargetType: "document",
+			TargetID:   &document.ID,
+			Details:    map[string]string{"name": document.Name, "size": strconv.FormatInt(document.Size, 10)},
+		}, nil)
+		result.ID, result.Status, result.Document = &document.ID, http.StatusCreated, document
+		addResult(&response, result)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteDocuments godoc
+// @Summary Delete several documents
+// @Description Soft delete each listed document the caller owns
+// @Tags bulk
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.BatchRequest true "Documents"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /documents/batch/delete [post]
+func (h *BulkHandler) DeleteDocuments(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.BatchRequest
+	if !bindBatch(c, &req) {
+		return
+	}
+
+	c.JSON(http.StatusOK, eachDocument(req.IDs, func(result *models.BatchResult) error {
+		err := h.documentService.Delete(c.Request.Context(), *result.ID, userID)
+		recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentDelete, *result.ID, nil), err)
+		return err
+	}))
+}
+
+// MoveDocuments godoc
+// @Summary Move several documents
+// @Description Move each listed document into one of the owner's folders, or to the root when folder_id is null
+// @Tags bulk
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.BatchMoveRequest true "Documents and target folder"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /documents/batch/move [post]
+func (h *BulkHandler) MoveDocuments(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.BatchMoveRequest
+	if !bindBatch(c, &req) {
+		return
+	}
+
+	folder := "root"
+	if req.FolderID != nil {
+		folder = req.FolderID.String()
+	}
+	c.JSON(http.StatusOK, eachDocument(req.IDs, func(result *models.BatchResult) error {
+		err := h.documentService.Move(c.Request.Context(), *result.ID, userID, req.FolderID)
+		recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentMove, *result.ID, map[string]string{"folder_id": folder}), err)
+		return err
+	}))
+}
+
+// ShareDocuments godoc
+// @Summary Share several documents
+// @Description Share each listed document the caller owns with another user
+// @Tags bulk
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.BatchShareRequest true "Documents and share details"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /documents/batch/share [post]
+func (h *BulkHandler) ShareDocuments(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.BatchShareRequest
+	if !bindBatch(c, &req) {
+		return
+	}
+
+	c.JSON(http.StatusOK, eachDocument(req.IDs, func(result *models.BatchResult) error {
+		err := h.documentService.Share(c.Request.Context(), *result.ID, userID, req.Email, req.Permission)
+		recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentShare, *result.ID, map[string]string{
+			"shared_with": req.Email,
+			"permission":  req.Permission,
+		}), err)
+		return err
+	}))
+}
+
+// TagDocuments godoc
+// @Summary Tag several documents
+// @Description Add and remove tags on each listed document (owner or editor), keeping their other tags
+// @Tags bulk
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.BatchTagsRequest true "Documents and tag changes"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /documents/batch/tags [post]
+func (h *BulkHandler) TagDocuments(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.BatchTagsRequest
+	if !bindBatch(c, &req) {
+		return
+	}
+
+	c.JSON(http.StatusOK, eachDocument(req.IDs, func(result *models.BatchResult) error {
+		tags, err := h.metadataService.UpdateTags(c.Request.Context(), *result.ID, userID, req.Add, req.Remove)
+		result.Tags = tags
+		return err
+	}))
+}
+
+// DownloadArchive godoc
+// @Summary Download documents as a ZIP
+// @Description Stream a ZIP of the listed documents the caller can read. Documents that are missing or not accessible are left out.
+// @Tags bulk
+// @Security BearerAuth
+// @Accept json
+// @Produce application/zip
+// @Param request body models.BatchRequest true "Documents"
+// @Success 200 {file} binary
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/archive [post]
+func (h *BulkHandler) DownloadArchive(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.BatchRequest
+	if !bindBatch(c, &req) {
+		return
+	}
+
+	documents, err := h.documentService.Readable(c.Request.Context(), uniqueIDs(req.IDs), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+	if len(documents) == 0 {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "not_found",
+			Message: "None of the selected documents are available",
+		})
+		return
+	}
+
+	for _, document := range documents {
+		recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentDownload, document.ID, map[string]string{"archive": "true"}), nil)
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="documents-`+time.Now().UTC().Format("20060102-150405")+`.zip"`)
+	c.Status(http.StatusOK)
+	// Once streaming has started the status can't change; a failure leaves
+	// a truncated archive that clients will reject
+	_, span := tracing.Start(c.Request.Context(), "storage.Archive")
+	if err := services.WriteArchive(c.Writer, documents); err != nil {
+		slog.ErrorContext(c.Request.Context(), "archive download failed", "error", err)
+	}
+	if size := c.Writer.Size(); size > 0 {
+		span.SetAttributes(attribute.Int("storage.bytes", size))
+		metrics.DownloadedBytes.Add(float64(size))
+	}
+	span.End()
+}
+
+// eachDocument runs op for every distinct ID and collects the per-item outcomes.
+func eachDocument(ids []uuid.UUID, op func(result *models.BatchResult) error) models.BatchResponse {
+	var response models.BatchResponse
+	for _, id := range uniqueIDs(ids) {
+		id := id
+		result := models.BatchResult{ID: &id, Status: http.StatusOK}
+		if err := op(&result); err != nil {
+			result.Status, result.Error = batchError(err)
+		}
+		addResult(&response, result)
+	}
+	return response
+}
+
+func addResult(response *models.BatchResponse, result models.BatchResult) {
+	if result.Status < http.StatusBadRequest {
+		response.Succeeded++
+	} else {
+		response.Failed++
+	}
+	response.Results = append(response.Results, result)
+}
+
+// bindBatch binds a bulk request body, writing the error response itself on
+// bad input.
+func bindBatch(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// uniqueIDs drops repeated IDs, keeping the first occurrence of each.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// batchError maps a service error to the status and error code the
+// single-document endpoints respond with.
+func batchError(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		return http.StatusNotFound, "not_found"
+	case errors.Is(err, services.ErrFolderNotFound):
+		return http.StatusNotFound, "folder_not_found"
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound, "user_not_found"
+	case errors.Is(err, services.ErrAccessDenied):
+		return http.StatusForbidden, "access_denied"
+	case errors.Is(err, services.ErrInvalidTag):
+		return http.StatusBadRequest, "invalid_tag"
+	default:
+		return http.StatusInternalServerError, "internal_error"
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupBulkRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	documentService := services.NewDocumentService(db, uploadDir)
+	bulkHandler := NewBulkHandler(documentService, services.NewMetadataService(db, documentService), services.NewAuditService(db), 10*1024*1024)
+	metadataHandler := NewMetadataHandler(services.NewMetadataService(db, documentService))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	documents := router.Group("/documents")
+	documents.Use(authMiddleware.Authenticate())
+	{
+		documents.POST("/batch", bulkHandler.UploadDocuments)
+		documents.POST("/batch/delete", bulkHandler.DeleteDocuments)
+		documents.POST("/batch/share", bulkHandler.ShareDocuments)
+		documents.POST("/batch/tags", bulkHandler.TagDocuments)
+		documents.POST("/archive", bulkHandler.DownloadArchive)
+		documents.GET("/:id/tags", metadataHandler.GetTags)
+	}
+
+	return router, uploadDir
+}
+
+func bulkRequest(router *gin.Engine, path, token string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBulk_UploadTagShareArchiveDelete(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupBulkRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "bulk-owner@example.com", "password123", "Owner")
+	otherToken := registerAndLogin(router, "bulk-other@example.com", "password123", "Other")
+
+	// Two text files and one type the vault refuses
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, f := range []struct{ name, contentType, content string }{
+		{"a.txt", "text/plain", "alpha"},
+		{"b.txt", "text/plain", "bravo"},
+		{"evil.exe", "application/x-msdownload", "MZ"},
+	} {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="files"; filename="`+f.name+`"`)
+		h.Set("Content-Type", f.contentType)
+		part, _ := writer.CreatePart(h)
+		io.WriteString(part, f.content)
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/documents/batch", body)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var uploaded models.BatchResponse
+	json.Unmarshal(w.Body.Bytes(), &uploaded)
+	if w.Code != http.StatusOK || uploaded.Succeeded != 2 || uploaded.Failed != 1 {
+		t.Fatalf("Expected 2 uploads and 1 failure, got %d: %s", w.Code, w.Body.String())
+	}
+	if uploaded.Results[2].Filename != "evil.exe" || uploaded.Results[2].Status != http.StatusInternalServerError {
+		t.Errorf("Expected the executable to fail, got %+v", uploaded.Results[2])
+	}
+	ids := []uuid.UUID{*uploaded.Results[0].ID, *uploaded.Results[1].ID}
+
+	// Tagging reports each document, including one that doesn't exist
+	missing := uuid.New()
+	w = bulkRequest(router, "/documents/batch/tags", ownerToken, models.BatchTagsRequest{
+		IDs: append(ids, missing),
+		Add: []string{"Q3", "finance"},
+	})
+	var tagged models.BatchResponse
+	json.Unmarshal(w.Body.Bytes(), &tagged)
+	if tagged.Succeeded != 2 || tagged.Failed != 1 || tagged.Results[2].Status != http.StatusNotFound {
+		t.Errorf("Expected 2 tagged and 1 not found, got %s", w.Body.String())
+	}
+	if tags := tagged.Results[0].Tags; len(tags) != 2 || tags[0] != "finance" || tags[1] != "q3" {
+		t.Errorf("Expected tags [finance q3], got %v", tags)
+	}
+
+	// Nothing is shared with the other user yet
+	if w := bulkRequest(router, "/documents/archive", otherToken, models.BatchRequest{IDs: ids}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an archive of inaccessible documents, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Only the owner can share
+	w = bulkRequest(router, "/documents/batch/share", otherToken, models.BatchShareRequest{IDs: ids, Email: "bulk-owner@example.com", Permission: "view"})
+	var denied models.BatchResponse
+	json.Unmarshal(w.Body.Bytes(), &denied)
+	if denied.Failed != 2 || denied.Results[0].Error != "access_denied" {
+		t.Errorf("Expected both shares to be denied, got %s", w.Body.String())
+	}
+
+	w = bulkRequest(router, "/documents/batch/share", ownerToken, models.BatchShareRequest{IDs: ids[:1], Email: "bulk-other@example.com", Permission: "view"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The other user's archive holds just the shared document
+	w = bulkRequest(router, "/documents/archive", otherToken, models.BatchRequest{IDs: ids})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a ZIP, got %d: %s", w.Code, w.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("archive doesn't open: %v", err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "a.txt" {
+		t.Errorf("Expected only a.txt in the archive, got %d entries", len(archive.File))
+	}
+
+	// The owner's archive holds both
+	w = bulkRequest(router, "/documents/archive", ownerToken, models.BatchRequest{IDs: ids})
+	archive, _ = zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "a.txt" || names[1] != "b.txt" {
+		t.Errorf("Expected [a.txt b.txt] in the archive, got %v", names)
+	}
+
+	// Repeated IDs are handled once
+	w = bulkRequest(router, "/documents/batch/delete", ownerToken, models.BatchRequest{IDs: append(ids, ids[0])})
+	var deleted models.BatchResponse
+	json.Unmarshal(w.Body.Bytes(), &deleted)
+	if deleted.Succeeded != 2 || deleted.Failed != 0 || len(deleted.Results) != 2 {
+		t.Errorf("Expected 2 deletions, got %s", w.Body.String())
+	}
+}
+
+func TestBulk_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupBulkRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "bulk-validation@example.com", "password123", "User")
+
+	if w := bulkRequest(router, "/documents/batch/delete", token, models.BatchRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an empty selection, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	tooMany := make([]uuid.UUID, 101)
+	for i := range tooMany {
+		tooMany[i] = uuid.New()
+	}
+	if w := bulkRequest(router, "/documents/archive", token, models.BatchRequest{IDs: tooMany}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for 101 documents, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req, _ := http.NewRequest("POST", "/documents/batch", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an upload without files, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{services.ErrDocumentNotFound, http.StatusNotFound, "not_found"},
+		{services.ErrFolderNotFound, http.StatusNotFound, "folder_not_found"},
+		{services.ErrAccessDenied, http.StatusForbidden, "access_denied"},
+		{services.ErrInvalidTag, http.StatusBadRequest, "invalid_tag"},
+		{errors.New("boom"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		if status, code := batchError(tt.err); status != tt.wantStatus || code != tt.wantCode {
+			t.Errorf("batchError(%v) = %d %q, want %d %q", tt.err, status, code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type CommentHandler struct {
+	commentService *services.CommentService
+}
+
+func NewCommentHandler(commentService *services.CommentService) *CommentHandler {
+	return &CommentHandler{commentService: commentService}
+}
+
+// ListComments godoc
+// @Summary List document comments
+// @Description List the comment threads on a document, oldest first, each with its replies
+// @Tags comments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {array} models.Comment
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/comments [get]
+func (h *CommentHandler) ListComments(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	comments, err := h.commentService.List(c.Request.Context(), docID, userID)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+
+// CreateComment godoc
+// @Summary Comment on a document
+// @Description Start a thread, optionally anchored to a page or version, or reply to one with parent_id
+// @Tags comments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param request body models.CommentRequest true "Comment"
+// @Success 201 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/comments [post]
+func (h *CommentHandler) CreateComment(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	comment, err := h.commentService.Create(c.Request.Context(), docID, userID, req)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateComment godoc
+// @Summary Edit a comment
+// @Description Replace the body of one of your own comments
+// @Tags comments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param comment_id path string true "Comment ID"
+// @Param request body models.UpdateCommentRequest true "New body"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/comments/{comment_id} [patch]
+func (h *CommentHandler) UpdateComment(c *gin.Context) {
+	userID, docID, commentID, ok := commentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	comment, err := h.commentService.Update(c.Request.Context(), docID, commentID, userID, req.Body)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment godoc
+// @Summary Delete a comment
+// @Description Delete one of your own comments. A thread's first comment is blanked while it has replies.
+// @Tags comments
+// @Security BearerAuth
+// @Param id path string true "Document ID"
+// @Param comment_id path string true "Comment ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/comments/{comment_id} [delete]
+func (h *CommentHandler) DeleteComment(c *gin.Context) {
+	userID, docID, commentID, ok := commentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.commentService.Delete(c.Request.Context(), docID, commentID, userID); err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ResolveComment godoc
+// @Summary Resolve a comment thread
+// @Description Mark a thread resolved (thread author, owner or editors)
+// @Tags comments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param comment_id path string true "Top-level comment ID"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/comments/{comment_id}/resolve [post]
+func (h *CommentHandler) ResolveComment(c *gin.Context) {
+	h.setResolved(c, true)
+}
+
+// UnresolveComment godoc
+// @Summary Reopen a comment thread
+// @Description Mark a resolved thread open again (thread author, owner or editors)
+// @Tags comments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param comment_id path string true "Top-level comment ID"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/comments/{comment_id}/unresolve [post]
+func (h *CommentHandler) UnresolveComment(c *gin.Context) {
+	h.setResolved(c, false)
+}
+
+func (h *CommentHandler) setResolved(c *gin.Context, resolved bool) {
+	userID, docID, commentID, ok := commentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	comment, err := h.commentService.SetResolved(c.Request.Context(), docID, commentID, userID, resolved)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+func commentRequestIDs(c *gin.Context) (uuid.UUID, uuid.UUID, uuid.UUID, bool) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+
+	commentID, err := uuid.Parse(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid comment ID",
+		})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, docID, commentID, true
+}
+
+func respondCommentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
+	case errors.Is(err, services.ErrCommentNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "comment_not_found"})
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "access_denied"})
+	case errors.Is(err, services.ErrEmptyComment),
+		errors.Is(err, services.ErrInvalidCommentParent),
+		errors.Is(err, services.ErrNotCommentThread):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupCommentRouter(db *database.DB) (*gin.Engine, string) {
+	router, uploadDir := setupNotificationRouter(db)
+
+	commentHandler := NewCommentHandler(services.NewCommentService(db, services.NewDocumentService(db, uploadDir)))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	documents := router.Group("/documents")
+	documents.Use(authMiddleware.Authenticate())
+	{
+		documents.GET("/:id/comments", commentHandler.ListComments)
+		documents.POST("/:id/comments", commentHandler.CreateComment)
+		documents.PATCH("/:id/comments/:comment_id", commentHandler.UpdateComment)
+		documents.DELETE("/:id/comments/:comment_id", commentHandler.DeleteComment)
+		documents.POST("/:id/comments/:comment_id/resolve", commentHandler.ResolveComment)
+		documents.POST("/:id/comments/:comment_id/unresolve", commentHandler.UnresolveComment)
+	}
+
+	return router, uploadDir
+}
+
+func commentRequest(router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestComments_ThreadLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupCommentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "comment-owner@example.com", "password123", "Owner")
+	viewerToken := registerAndLogin(router, "comment-viewer@example.com", "password123", "Viewer")
+	strangerToken := registerAndLogin(router, "comment-stranger@example.com", "password123", "Stranger")
+	doc := uploadTestDocument(router, ownerToken)
+	base := "/documents/" + doc.ID.String() + "/comments"
+
+	commentRequest(router, "POST", "/documents/"+doc.ID.String()+"/share", ownerToken,
+		models.ShareRequest{Email: "comment-viewer@example.com", Permission: "view"})
+
+	if w := commentRequest(router, "POST", base, strangerToken, models.CommentRequest{Body: "Hi"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for a stranger, got %d", http.StatusForbidden, w.Code)
+	}
+
+	page := 2
+	w := commentRequest(router, "POST", base, viewerToken, models.CommentRequest{Body: "Typo here", Page: &page})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var thread models.Comment
+	json.Unmarshal(w.Body.Bytes(), &thread)
+
+	// The owner hears about comments on their document
+	list := listNotifications(t, router, ownerToken)
+	data, _ := json.Marshal(list.Data)
+	var notifications []models.Notification
+	json.Unmarshal(data, &notifications)
+	if len(notifications) != 1 || notifications[0].Type != services.NotificationCommentAdded || notifications[0].ActorName != "Viewer" {
+		t.Errorf("Expected a comment.added notification for the owner, got %+v", notifications)
+	}
+
+	w = commentRequest(router, "POST", base, ownerToken, models.CommentRequest{Body: "Fixed", ParentID: &thread.ID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var reply models.Comment
+	json.Unmarshal(w.Body.Bytes(), &reply)
+
+	if w := commentRequest(router, "POST", base, viewerToken, models.CommentRequest{Body: "Nested", ParentID: &reply.ID}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a reply to a reply, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := commentRequest(router, "PATCH", base+"/"+reply.ID.String(), viewerToken, models.UpdateCommentRequest{Body: "Not fixed"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d editing someone else's comment, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = commentRequest(router, "POST", base+"/"+thread.ID.String()+"/resolve", ownerToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = commentRequest(router, "GET", base, viewerToken, nil)
+	var threads []models.Comment
+	json.Unmarshal(w.Body.Bytes(), &threads)
+	if len(threads) != 1 || len(threads[0].Replies) != 1 || threads[0].ResolvedAt == nil || *threads[0].Page != 2 {
+		t.Fatalf("Expected one resolved page 2 thread with a reply, got %+v", threads)
+	}
+
+	// Deleting the opening comment keeps the owner's reply visible
+	if w := commentRequest(router, "DELETE", base+"/"+thread.ID.String(), viewerToken, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	w = commentRequest(router, "GET", base, ownerToken, nil)
+	var remaining []models.Comment
+	json.Unmarshal(w.Body.Bytes(), &remaining)
+	if len(remaining) != 1 || !remaining[0].Deleted || remaining[0].Body != "" || len(remaining[0].Replies) != 1 {
+		t.Errorf("Expected a blanked thread that keeps its reply, got %+v", remaining)
+	}
+}
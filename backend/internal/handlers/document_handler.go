@@ -3,23 +3,30 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/metrics"
 	"github.com/katim/secure-doc-vault/internal/middleware"
 	"github.com/katim/secure-doc-vault/internal/models"
 	"github.com/katim/secure-doc-vault/internal/services"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type DocumentHandler struct {
 	documentService *services.DocumentService
+	auditService    *services.AuditService
 	maxFileSize     int64
 }
 
-func NewDocumentHandler(documentService *services.DocumentService, maxFileSize int64) *DocumentHandler {
+func NewDocumentHandler(documentService *services.DocumentService, auditService *services.AuditService, maxFileSize int64) *DocumentHandler {
 	return &DocumentHandler{
 		documentService: documentService,
+		auditService:    auditService,
 		maxFileSize:     maxFileSize,
 	}
 }
@@ -32,7 +39,20 @@ func NewDocumentHandler(documentService *services.DocumentService, maxFileSize i
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param per_page query int false "Items per page" default(20)
+// @Param cursor query string false "Opaque cursor from a previous page's next_cursor (replaces page)"
+// @Param sort query string false "Sort field: created_at, updated_at, name or size" default(created_at)
+// @Param order query string false "Sort order: asc or desc (default desc, asc for name)"
+// @Param folder_id query string false "Folder ID, or \"root\" for documents outside any folder"
+// @Param tag query []string false "Only documents carrying every given tag"
+// @Param meta[key] query string false "Only documents whose metadata key equals the value"
+// @Param mime_type query string false "MIME type, or a wildcard such as image/*"
+// @Param min_size query int false "Minimum size in bytes"
+// @Param max_size query int false "Maximum size in bytes"
+// @Param created_after query string false "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param created_before query string false "Created before (RFC 3339 or YYYY-MM-DD)"
+// @Param name_prefix query string false "Case-insensitive name prefix"
 // @Success 200 {object} models.PaginatedResponse
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Router /documents [get]
 func (h *DocumentHandler) ListDocuments(c *gin.Context) {
@@ -42,26 +62,33 @@ func (h *DocumentHandler) ListDocuments(c *gin.Context) {
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	filter, opts, ok := listingParams(c)
+	if !ok {
+		return
+	}
+	switch folderParam := c.Query("folder_id"); folderParam {
+	case "":
+	case "root":
+		filter.InRoot = true
+	default:
+		folderID, err := uuid.Parse(folderParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_id",
+				Message: "Invalid folder ID",
+			})
+			return
+		}
+		filter.FolderID = &folderID
+	}
 
-	documents, total, err := h.documentService.GetByOwner(userID, page, perPage)
+	documents, info, err := h.documentService.List(c.Request.Context(), userID, filter, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "internal_error",
-			Message: "Failed to fetch documents",
-		})
+		respondListingError(c, err, "Failed to fetch documents")
 		return
 	}
 
-	totalPages := (total + perPage - 1) / perPage
-	c.JSON(http.StatusOK, models.PaginatedResponse{
-		Data:       documents,
-		Total:      total,
-		Page:       page,
-		PerPage:    perPage,
-		TotalPages: totalPages,
-	})
+	c.JSON(http.StatusOK, paginatedResponse(documents, info))
 }
 
 // UploadDocument godoc
@@ -73,6 +100,7 @@ func (h *DocumentHandler) ListDocuments(c *gin.Context) {
 // @Produce json
 // @Param file formance file true "File to upload"
 // @Param name formance string false "Document name"
+// @Param sha256 formData string false "Expected hex SHA-256 of the file; the upload is rejected if the content differs"
 // @Success 201 {object} models.Document
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
@@ -111,14 +139,34 @@ func (h *DocumentHandler) UploadDocument(c *gin.Context) {
 	}
 
 	document, err := h.documentService.Create(
+		c.Request.Context(),
 		userID,
 		name,
 		header.Filename,
 		header.Header.Get("Content-Type"),
 		header.Size,
 		file,
+		c.PostForm("sha256"),
 	)
 	if err != nil {
+		recordAudit(c, h.auditService, models.AuditEntry{
+			Action:  services.AuditDocumentUpload,
+			Details: map[string]string{"filename": header.Filename},
+		}, err)
+		if errors.Is(err, services.ErrInvalidDigest) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_digest",
+				Message: err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, services.ErrDigestMismatch) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "digest_mismatch",
+				Message: err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "upload_failed",
 			Message: "Failed to upload document",
@@ -126,6 +174,12 @@ func (h *DocumentHandler) UploadDocument(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.auditService, models.AuditEntry{
+		Action:     services.AuditDocumentUpload,
+		TargetType: "document",
+		TargetID:   &document.ID,
+		Details:    map[string]string{"name": document.Name, "size": strconv.FormatInt(document.Size, 10)},
+	}, nil)
 	c.JSON(http.StatusCreated, document)
 }
 
@@ -157,7 +211,7 @@ func (h *DocumentHandler) GetDocument(c *gin.Context) {
 		return
 	}
 
-	canAccess, _, err := h.documentService.CanAccess(docID, userID)
+	canAccess, _, err := h.documentService.CanAccess(c.Request.Context(), docID, userID)
 	if err != nil {
 		if errors.Is(err, services.ErrDocumentNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -178,7 +232,7 @@ func (h *DocumentHandler) GetDocument(c *gin.Context) {
 		return
 	}
 
-	document, err := h.documentService.GetByID(docID)
+	document, err := h.documentService.GetByID(c.Request.Context(), docID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
 		return
@@ -189,15 +243,21 @@ func (h *DocumentHandler) GetDocument(c *gin.Context) {
 
 // DownloadDocument godoc
 // @Summary Download a document
-// @Description Download the file content of a document
+// @Description Download the file content of a document. The strong ETag is the content's SHA-256, so If-None-Match answers 304. Range requests get 206, with multipart/byteranges for several ranges.
 // @Tags documents
 // @Security BearerAuth
 // @Produce octet-stream
 // @Param id path string true "Document ID"
+// @Param Range header string false "Byte ranges, e.g. bytes=0-1023"
+// @Param If-None-Match header string false "ETag from an earlier download"
+// @Param If-Range header string false "Only honour Range if the ETag still matches"
 // @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Success 304 "Not Modified"
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 416 "Range Not Satisfiable"
 // @Router /documents/{id}/download [get]
 func (h *DocumentHandler) DownloadDocument(c *gin.Context) {
 	userID, ok := middleware.GetUserID(c)
@@ -215,7 +275,13 @@ func (h *DocumentHandler) DownloadDocument(c *gin.Context) {
 		return
 	}
 
-	filePath, err := h.documentService.GetFilePath(docID, userID)
+	var details map[string]string
+	if ranges := c.GetHeader("Range"); ranges != "" {
+		details = map[string]string{"range": ranges}
+	}
+
+	filePath, err := h.documentService.GetFilePath(c.Request.Context(), docID, userID)
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentDownload, docID, details), err)
 	if err != nil {
 		if errors.Is(err, services.ErrDocumentNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
@@ -229,10 +295,40 @@ func (h *DocumentHandler) DownloadDocument(c *gin.Context) {
 		return
 	}
 
-	document, _ := h.documentService.GetByID(docID)
+	document, err := h.documentService.GetByID(c.Request.Context(), docID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	// The ETag comes from the recorded hash of the plaintext, not the bytes
+	// on disk, so it stays stable however the file is stored
+	digest, err := h.documentService.ContentHash(c.Request.Context(), document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+	defer file.Close()
+
+	c.Header("ETag", `"`+digest+`"`)
+	c.Header("Cache-Control", "private, no-cache")
 	c.Header("Content-Disposition", "attachment; filename="+document.OriginalName)
 	c.Header("Content-Type", document.MimeType)
-	c.File(filePath)
+	// ServeContent evaluates If-None-Match and If-Range against the ETag and
+	// serves single ranges as 206 and several as multipart/byteranges
+	_, span := tracing.Start(c.Request.Context(), "storage.Read")
+	http.ServeContent(c.Writer, c.Request, "", document.CreatedAt, file)
+	if size := c.Writer.Size(); size > 0 {
+		span.SetAttributes(attribute.Int("storage.bytes", size))
+		metrics.DownloadedBytes.Add(float64(size))
+	}
+	span.End()
 }
 
 // DeleteDocument godoc
@@ -262,7 +358,8 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
-	err = h.documentService.Delete(docID, userID)
+	err = h.documentService.Delete(c.Request.Context(), docID, userID)
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentDelete, docID, nil), err)
 	if err != nil {
 		if errors.Is(err, services.ErrDocumentNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
@@ -322,7 +419,11 @@ func (h *DocumentHandler) ShareDocument(c *gin.Context) {
 		return
 	}
 
-	err = h.documentService.Share(docID, userID, req.Email, req.Permission)
+	err = h.documentService.Share(c.Request.Context(), docID, userID, req.Email, req.Permission)
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentShare, docID, map[string]string{
+		"shared_with": req.Email,
+		"permission":  req.Permission,
+	}), err)
 	if err != nil {
 		if errors.Is(err, services.ErrDocumentNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "document_not_found"})
@@ -346,15 +447,68 @@ func (h *DocumentHandler) ShareDocument(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Document shared successfully"})
 }
 
+// RevokeShare godoc
+// @Summary Revoke a share
+// @Description Remove a user's access to a shared document
+// @Tags documents
+// @Security BearerAuth
+// @Param id path string true "Document ID"
+// @Param user_id path string true "User the document is shared with"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/share/{user_id} [delete]
+func (h *DocumentHandler) RevokeShare(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	sharedWithID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	err = h.documentService.RemoveShare(c.Request.Context(), docID, userID, sharedWithID)
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentUnshare, docID, map[string]string{
+		"shared_with_id": sharedWithID.String(),
+	}), err)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDocumentNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "document_not_found"})
+		case errors.Is(err, services.ErrShareNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "share_not_found"})
+		case errors.Is(err, services.ErrAccessDenied):
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "access_denied"})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // ListSharedDocuments godoc
 // @Summary List shared documents
-// @Description Get documents shared with the current user
+// @Description Get documents shared with the current user. Accepts the same filters as /documents except folder_id.
 // @Tags documents
 // @Security BearerAuth
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param per_page query int false "Items per page" default(20)
+// @Param cursor query string false "Opaque cursor from a previous page's next_cursor (replaces page)"
+// @Param sort query string false "Sort field: shared_at, created_at, updated_at, name or size" default(shared_at)
+// @Param order query string false "Sort order: asc or desc (default desc, asc for name)"
 // @Success 200 {object} models.PaginatedResponse
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Router /shared [get]
 func (h *DocumentHandler) ListSharedDocuments(c *gin.Context) {
@@ -364,26 +518,103 @@ func (h *DocumentHandler) ListSharedDocuments(c *gin.Context) {
 		return
 	}
 
+	filter, opts, ok := listingParams(c)
+	if !ok {
+		return
+	}
+
+	documents, info, err := h.documentService.ListShared(c.Request.Context(), userID, filter, opts)
+	if err != nil {
+		respondListingError(c, err, "Failed to fetch shared documents")
+		return
+	}
+
+	c.JSON(http.StatusOK, paginatedResponse(documents, info))
+}
+
+// listingParams parses the filter, sort and paging query parameters shared
+// by the document listings, writing the error response itself on bad input.
+func listingParams(c *gin.Context) (models.DocumentFilter, models.ListOptions, bool) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
 
-	documents, total, err := h.documentService.GetSharedWithUser(userID, page, perPage)
-	if err != nil {
+	opts := models.ListOptions{
+		Sort:    c.Query("sort"),
+		Order:   c.Query("order"),
+		Page:    page,
+		PerPage: perPage,
+		Cursor:  c.Query("cursor"),
+	}
+	filter := models.DocumentFilter{
+		Tags:       c.QueryArray("tag"),
+		Metadata:   c.QueryMap("meta"),
+		MimeType:   c.Query("mime_type"),
+		NamePrefix: c.Query("name_prefix"),
+	}
+
+	invalid := func(param string) (models.DocumentFilter, models.ListOptions, bool) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid value for " + param,
+		})
+		return filter, opts, false
+	}
+
+	for param, dst := range map[string]**int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		if value := c.Query(param); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return invalid(param)
+			}
+			*dst = &size
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				t, err = time.Parse("2006-01-02", value)
+			}
+			if err != nil {
+				return invalid(param)
+			}
+			*dst = &t
+		}
+	}
+
+	return filter, opts, true
+}
+
+func paginatedResponse(data interface{}, info models.PageInfo) models.PaginatedResponse {
+	return models.PaginatedResponse{
+		Data:       data,
+		Total:      info.Total,
+		Page:       info.Page,
+		PerPage:    info.PerPage,
+		TotalPages: (info.Total + info.PerPage - 1) / info.PerPage,
+		NextCursor: info.NextCursor,
+	}
+}
+
+func respondListingError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSort):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_sort",
+			Message: "Unsupported sort field or order",
+		})
+	case errors.Is(err, services.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_cursor",
+			Message: "Cursor is malformed or does not match the requested sort",
+		})
+	default:
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "internal_error",
-			Message: "Failed to fetch shared documents",
+			Message: message,
 		})
-		return
 	}
-
-	totalPages := (total + perPage - 1) / perPage
-	c.JSON(http.StatusOK, models.PaginatedResponse{
-		Data:       documents,
-		Total:      total,
-		Page:       page,
-		PerPage:    perPage,
-		TotalPages: totalPages,
-	})
 }
 
 // RenameDocument godoc
@@ -427,7 +658,8 @@ func (h *DocumentHandler) RenameDocument(c *gin.Context) {
 		return
 	}
 
-	err = h.documentService.Rename(docID, userID, req.Name)
+	err = h.documentService.Rename(c.Request.Context(), docID, userID, req.Name)
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentRename, docID, map[string]string{"name": req.Name}), err)
 	if err != nil {
 		if errors.Is(err, services.ErrDocumentNotFound) {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
@@ -443,3 +675,76 @@ func (h *DocumentHandler) RenameDocument(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Document renamed successfully"})
 }
+
+// MoveDocument godoc
+// @Summary Move a document
+// @Description Move a document into one of the owner's folders, or to the root when folder_id is null
+// @Tags documents
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param request body models.MoveDocumentRequest true "Target folder"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/folder [put]
+func (h *DocumentHandler) MoveDocument(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	docID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid document ID",
+		})
+		return
+	}
+
+	var req models.MoveDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err = h.documentService.Move(c.Request.Context(), docID, userID, req.FolderID)
+	folder := "root"
+	if req.FolderID != nil {
+		folder = req.FolderID.String()
+	}
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditDocumentMove, docID, map[string]string{"folder_id": folder}), err)
+	if err != nil {
+		if errors.Is(err, services.ErrDocumentNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
+			return
+		}
+		if errors.Is(err, services.ErrFolderNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "folder_not_found"})
+			return
+		}
+		if errors.Is(err, services.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "access_denied",
+				Message: "Only the document owner can move it into their own folders",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document moved successfully"})
+}
+
+func documentAuditEntry(action string, docID uuid.UUID, details map[string]string) models.AuditEntry {
+	return models.AuditEntry{Action: action, TargetType: "document", TargetID: &docID, Details: details}
+}
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -27,10 +32,11 @@ func setupDocumentRouter(db *database.DB) (*gin.Engine, *AuthHandler, *DocumentH
 
 	userService := services.NewUserService(db)
 	documentService := services.NewDocumentService(db, uploadDir)
+	auditService := services.NewAuditService(db)
 	authMiddleware := middleware.NewAuthMiddleware("test-secret")
 
-	authHandler := NewAuthHandler(userService, authMiddleware)
-	documentHandler := NewDocumentHandler(documentService, 10*1024*1024) // 10MB
+	authHandler := NewAuthHandler(userService, authMiddleware, auditService)
+	documentHandler := NewDocumentHandler(documentService, auditService, 10*1024*1024) // 10MB
 
 	// Auth routes
 	auth := router.Group("/auth")
@@ -50,6 +56,7 @@ func setupDocumentRouter(db *database.DB) (*gin.Engine, *AuthHandler, *DocumentH
 		documents.DELETE("/:id", documentHandler.DeleteDocument)
 		documents.GET("/:id/download", documentHandler.DownloadDocument)
 		documents.POST("/:id/share", documentHandler.ShareDocument)
+		documents.DELETE("/:id/share/:user_id", documentHandler.RevokeShare)
 	}
 
 	router.GET("/shared", authMiddleware.Authenticate(), documentHandler.ListSharedDocuments)
@@ -113,6 +120,83 @@ func TestListDocuments_Empty(t *testing.T) {
 	}
 }
 
+func TestListDocuments_CursorWalk(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, _, _, uploadDir := setupDocumentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "list-cursor@example.com", "password123", "Test User")
+	for i := 0; i < 3; i++ {
+		body, contentType := createTestFile("Cursor content")
+		req, _ := http.NewRequest("POST", "/documents", body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Walk the listing two at a time by cursor until it runs out
+	seen := make(map[string]bool)
+	url := "/documents?sort=name&per_page=2"
+	for pages := 0; url != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("Cursor walk did not terminate")
+		}
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var response struct {
+			Data       []models.Document `json:"data"`
+			NextCursor string            `json:"next_cursor"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		for _, doc := range response.Data {
+			if seen[doc.ID.String()] {
+				t.Errorf("Document %s returned twice", doc.ID)
+			}
+			seen[doc.ID.String()] = true
+		}
+
+		url = ""
+		if response.NextCursor != "" {
+			url = "/documents?per_page=2&cursor=" + response.NextCursor
+		}
+	}
+
+	if len(seen) != 3 {
+		t.Errorf("Expected to walk 3 documents, got %d", len(seen))
+	}
+}
+
+func TestListDocuments_InvalidFilter(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, _, _, uploadDir := setupDocumentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "list-invalid@example.com", "password123", "Test User")
+
+	for _, query := range []string{"min_size=-1", "created_after=yesterday", "sort=owner_id", "cursor=bogus"} {
+		req, _ := http.NewRequest("GET", "/documents?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
 func TestUploadDocument_Success(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -143,6 +227,33 @@ func TestUploadDocument_Success(t *testing.T) {
 	}
 }
 
+func TestUploadDocument_LargeDistinctText(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, _, _, uploadDir := setupDocumentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "large-text@example.com", "password123", "Test User")
+
+	// Nearly every word is unique, the worst case for the search vector's size
+	var content strings.Builder
+	for i := 0; content.Len() < 2<<20; i++ {
+		fmt.Fprintf(&content, "w%x ", i)
+	}
+
+	body, contentType := createTestFile(content.String())
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+}
+
 func TestUploadDocument_Unauthorized(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -161,6 +272,79 @@ func TestUploadDocument_Unauthorized(t *testing.T) {
 	}
 }
 
+func TestUploadDocument_DigestAndDeduplication(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, _, _, uploadDir := setupDocumentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "digest@example.com", "password123", "Test User")
+
+	fileContent := "Same bytes twice"
+	sum := sha256.Sum256([]byte(fileContent))
+	digest := hex.EncodeToString(sum[:])
+
+	upload := func(expected string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("sha256", expected)
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="file"; filename="test.txt"`)
+		h.Set("Content-Type", "text/plain")
+		part, _ := writer.CreatePart(h)
+		io.WriteString(part, fileContent)
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/documents", body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var response models.ErrorResponse
+	w := upload(strings.Repeat("0", 64))
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusBadRequest || response.Error != "digest_mismatch" {
+		t.Errorf("Expected status %d digest_mismatch, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if w := upload("not-a-digest"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a malformed digest, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var first, second models.Document
+	w = upload(digest)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &first)
+	if first.SHA256 != digest {
+		t.Errorf("sha256 = %q, want %q", first.SHA256, digest)
+	}
+	json.Unmarshal(upload("").Body.Bytes(), &second)
+
+	// Both documents share one file on disk
+	files, _ := os.ReadDir(uploadDir)
+	if len(files) != 1 {
+		t.Errorf("Expected 1 stored file for identical uploads, found %d", len(files))
+	}
+
+	// Deleting one leaves the content for the other
+	req, _ := http.NewRequest("DELETE", "/documents/"+first.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/documents/"+second.ID.String()+"/download", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != fileContent {
+		t.Errorf("Expected the shared content after deleting the other copy, got %d", w.Code)
+	}
+}
+
 func TestGetDocument_Success(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -496,3 +680,85 @@ func TestDownloadDocument_Success(t *testing.T) {
 		t.Errorf("Expected content '%s', got '%s'", fileContent, w.Body.String())
 	}
 }
+
+func TestDownloadDocument_ConditionalAndRanges(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, _, _, uploadDir := setupDocumentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "download-range@example.com", "password123", "Test User")
+
+	fileContent := "Hello, ranged world!"
+	body, contentType := createTestFile(fileContent)
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var doc models.Document
+	json.Unmarshal(w.Body.Bytes(), &doc)
+
+	download := func(headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/documents/"+doc.ID.String()+"/download", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The ETag is the content's SHA-256
+	w = download(nil)
+	sum := sha256.Sum256([]byte(fileContent))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if w.Header().Get("ETag") != etag || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("Expected ETag %s with Accept-Ranges, got %v", etag, w.Header())
+	}
+
+	if w := download(map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty %d for a matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	w = download(map[string]string{"Range": "bytes=7-12"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "ranged" {
+		t.Errorf("Expected %d with %q, got %d with %q", http.StatusPartialContent, "ranged", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 7-12/20" {
+		t.Errorf("Content-Range = %q, want %q", got, "bytes 7-12/20")
+	}
+
+	// Several ranges come back as multipart/byteranges
+	w = download(map[string]string{"Range": "bytes=0-4,14-18"})
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if w.Code != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+		t.Fatalf("Expected %d multipart/byteranges, got %d %s", http.StatusPartialContent, w.Code, mediaType)
+	}
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, string(data))
+	}
+	if len(parts) != 2 || parts[0] != "Hello" || parts[1] != "world" {
+		t.Errorf("Expected parts [Hello world], got %q", parts)
+	}
+
+	// A stale If-Range gets the whole file
+	w = download(map[string]string{"Range": "bytes=0-4", "If-Range": `"stale"`})
+	if w.Code != http.StatusOK || w.Body.String() != fileContent {
+		t.Errorf("Expected the full file for a stale If-Range, got %d", w.Code)
+	}
+
+	if w := download(map[string]string{"Range": "bytes=100-200"}); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+// eventHeartbeat keeps idle streams from being closed by proxies.
+const eventHeartbeat = 25 * time.Second
+
+type EventHandler struct {
+	broker *services.EventBroker
+}
+
+func NewEventHandler(broker *services.EventBroker) *EventHandler {
+	return &EventHandler{broker: broker}
+}
+
+// Stream godoc
+// @Summary Stream live events
+// @Description Server-sent events for the current user: documents or folders shared with them, revoked shares and renames by collaborators
+// @Tags events
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Success 200 {object} models.UserEvent
+// @Failure 401 {object} models.ErrorResponse
+// @Router /events [get]
+func (h *EventHandler) Stream(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	events, unsubscribe := h.broker.Subscribe(userID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+	c.Status(http.StatusOK)
+
+	// An initial comment commits the headers so clients see the stream open
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+// readEvent returns the type and data of the next event on an SSE stream,
+// skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (string, models.UserEvent) {
+	t.Helper()
+	var eventType string
+	var event models.UserEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+		case line == "" && eventType != "":
+			return eventType, event
+		}
+	}
+}
+
+func TestEvents_ShareAndRevokeAreStreamed(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, _, _, uploadDir := setupDocumentRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	broker := services.NewEventBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go broker.Listen(ctx, getTestDatabaseURL())
+
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+	router.GET("/events", authMiddleware.Authenticate(), NewEventHandler(broker).Stream)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ownerToken := registerAndLogin(router, "events-owner@example.com", "password123", "Owner")
+	viewerToken := registerAndLogin(router, "events-viewer@example.com", "password123", "Viewer")
+	doc := uploadTestDocument(router, ownerToken)
+
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	// The client timeout also bounds reads, so a missing event fails the test
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	// Give the listener time to start before notifying
+	time.Sleep(200 * time.Millisecond)
+
+	shareBody, _ := json.Marshal(models.ShareRequest{Email: "events-viewer@example.com", Permission: "view"})
+	req, _ = http.NewRequest("POST", "/documents/"+doc.ID.String()+"/share", bytes.NewBuffer(shareBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	eventType, event := readEvent(t, stream)
+	if eventType != services.UserEventDocumentShared || event.DocumentID == nil || *event.DocumentID != doc.ID {
+		t.Errorf("Expected document.shared for %s, got %s %+v", doc.ID, eventType, event)
+	}
+
+	var viewer models.User
+	db.QueryRow(`SELECT id FROM users WHERE email = $1`, "events-viewer@example.com").Scan(&viewer.ID)
+
+	req, _ = http.NewRequest("DELETE", "/documents/"+doc.ID.String()+"/share/"+viewer.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if eventType, _ := readEvent(t, stream); eventType != services.UserEventShareRevoked {
+		t.Errorf("Expected %s, got %s", services.UserEventShareRevoked, eventType)
+	}
+}
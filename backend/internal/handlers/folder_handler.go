@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+	"github.com/katim/secure-doc-vault/pkg/utils"
+)
+
+type FolderHandler struct {
+	folderService *services.FolderService
+	auditService  *services.AuditService
+}
+
+func NewFolderHandler(folderService *services.FolderService, auditService *services.AuditService) *FolderHandler {
+	return &FolderHandler{folderService: folderService, auditService: auditService}
+}
+
+// ListFolders godoc
+// @Summary List user's folders
+// @Description List the current user's folders at the root or under a parent folder
+// @Tags folders
+// @Security BearerAuth
+// @Produce json
+// @Param parent_id query string false "Parent folder ID (omit for top level)"
+// @Success 200 {array} models.Folder
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /folders [get]
+func (h *FolderHandler) ListFolders(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var parentID *uuid.UUID
+	if raw := c.Query("parent_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_id",
+				Message: "Invalid parent folder ID",
+			})
+			return
+		}
+		parentID = &id
+	}
+
+	folders, err := h.folderService.List(c.Request.Context(), userID, parentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to fetch folders",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, folders)
+}
+
+// ListSharedFolders godoc
+// @Summary List shared folders
+// @Description Get folders shared with the current user
+// @Tags folders
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Folder
+// @Failure 401 {object} models.ErrorResponse
+// @Router /folders/shared [get]
+func (h *FolderHandler) ListSharedFolders(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	folders, err := h.folderService.ListSharedWithUser(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to fetch shared folders",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, folders)
+}
+
+// CreateFolder godoc
+// @Summary Create a folder
+// @Description Create a folder at the root or inside one of the user's folders
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.CreateFolderRequest true "Folder details"
+// @Success 201 {object} models.Folder
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /folders [post]
+func (h *FolderHandler) CreateFolder(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	folder, err := h.folderService.Create(c.Request.Context(), userID, req.Name, req.ParentID)
+	if err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+// GetFolder godoc
+// @Summary Get folder contents
+// @Description Get a folder with its subfolders and documents
+// @Tags folders
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Success 200 {object} models.FolderContents
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /folders/{id} [get]
+func (h *FolderHandler) GetFolder(c *gin.Context) {
+	userID, folderID, ok := folderRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	contents, err := h.folderService.GetContents(c.Request.Context(), folderID, userID)
+	if err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contents)
+}
+
+// RenameFolder godoc
+// @Summary Rename a folder
+// @Description Update the name of a folder (owner or editor)
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Param request body object{name=string} true "New name"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /folders/{id} [patch]
+func (h *FolderHandler) RenameFolder(c *gin.Context) {
+	userID, folderID, ok := folderRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.folderService.Rename(c.Request.Context(), folderID, userID, req.Name); err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder renamed successfully"})
+}
+
+// MoveFolder godoc
+// @Summary Move a folder
+// @Description Move a folder under another folder, or to the root when parent_id is null
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Param request body models.MoveFolderRequest true "New parent"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /folders/{id}/move [post]
+func (h *FolderHandler) MoveFolder(c *gin.Context) {
+	userID, folderID, ok := folderRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.MoveFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.folderService.Move(c.Request.Context(), folderID, userID, req.ParentID); err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder moved successfully"})
+}
+
+// DeleteFolder godoc
+// @Summary Delete a folder
+// @Description Delete an empty folder (owner only)
+// @Tags folders
+// @Security BearerAuth
+// @Param id path string true "Folder ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /folders/{id} [delete]
+func (h *FolderHandler) DeleteFolder(c *gin.Context) {
+	userID, folderID, ok := folderRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	err := h.folderService.Delete(c.Request.Context(), folderID, userID)
+	recordAudit(c, h.auditService, models.AuditEntry{Action: services.AuditFolderDelete, TargetType: "folder", TargetID: &folderID}, err)
+	if err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ShareFolder godoc
+// @Summary Share a folder
+// @Description Share a folder, and everything inside it, with another user
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Param request body models.ShareRequest true "Share details"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /folders/{id}/share [post]
+func (h *FolderHandler) ShareFolder(c *gin.Context) {
+	userID, folderID, ok := folderRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.ShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := h.folderService.Share(c.Request.Context(), folderID, userID, req.Email, req.Permission)
+	recordAudit(c, h.auditService, models.AuditEntry{
+		Action:     services.AuditFolderShare,
+		TargetType: "folder",
+		TargetID:   &folderID,
+		Details:    map[string]string{"shared_with": req.Email, "permission": req.Permission},
+	}, err)
+	if err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder shared successfully"})
+}
+
+// RevokeFolderShare godoc
+// @Summary Revoke a folder share
+// @Description Remove a user's access to a shared folder and everything inside it
+// @Tags folders
+// @Security BearerAuth
+// @Param id path string true "Folder ID"
+// @Param user_id path string true "User the folder is shared with"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /folders/{id}/share/{user_id} [delete]
+func (h *FolderHandler) RevokeFolderShare(c *gin.Context) {
+	userID, folderID, ok := folderRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	sharedWithID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	err = h.folderService.RemoveShare(c.Request.Context(), folderID, userID, sharedWithID)
+	recordAudit(c, h.auditService, models.AuditEntry{
+		Action:     services.AuditFolderUnshare,
+		TargetType: "folder",
+		TargetID:   &folderID,
+		Details:    map[string]string{"shared_with_id": sharedWithID.String()},
+	}, err)
+	if err != nil {
+		respondFolderError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func folderRequestIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	folderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid folder ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, folderID, true
+}
+
+func respondFolderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrFolderNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "folder_not_found"})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User with this email not found",
+		})
+	case errors.Is(err, services.ErrShareNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "share_not_found"})
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "access_denied"})
+	case errors.Is(err, services.ErrFolderNotEmpty):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "folder_not_empty",
+			Message: "Move or delete the folder's contents first",
+		})
+	case errors.Is(err, services.ErrFolderCycle):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "invalid_move",
+			Message: "A folder cannot be moved into itself or one of its subfolders",
+		})
+	case errors.Is(err, utils.ErrInvalidFilename):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: "Invalid folder name",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupFolderRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, documentHandler, uploadDir := setupDocumentRouter(db)
+
+	folderHandler := NewFolderHandler(services.NewFolderService(db), services.NewAuditService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	router.PUT("/documents/:id/folder", authMiddleware.Authenticate(), documentHandler.MoveDocument)
+
+	folders := router.Group("/folders")
+	folders.Use(authMiddleware.Authenticate())
+	{
+		folders.GET("", folderHandler.ListFolders)
+		folders.POST("", folderHandler.CreateFolder)
+		folders.GET("/shared", folderHandler.ListSharedFolders)
+		folders.GET("/:id", folderHandler.GetFolder)
+		folders.PATCH("/:id", folderHandler.RenameFolder)
+		folders.DELETE("/:id", folderHandler.DeleteFolder)
+		folders.POST("/:id/move", folderHandler.MoveFolder)
+		folders.POST("/:id/share", folderHandler.ShareFolder)
+		folders.DELETE("/:id/share/:user_id", folderHandler.RevokeFolderShare)
+	}
+
+	return router, uploadDir
+}
+
+func createTestFolder(router *gin.Engine, token string, req models.CreateFolderRequest) models.Folder {
+	body, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest("POST", "/folders", bytes.NewBuffer(body))
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httpReq)
+
+	var folder models.Folder
+	json.Unmarshal(w.Body.Bytes(), &folder)
+	return folder
+}
+
+func TestFolderShare_GrantsAccessToNestedDocuments(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupFolderRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "folder-owner@example.com", "password123", "Owner")
+	viewerToken := registerAndLogin(router, "folder-viewer@example.com", "password123", "Viewer")
+
+	parent := createTestFolder(router, ownerToken, models.CreateFolderRequest{Name: "Clients"})
+	child := createTestFolder(router, ownerToken, models.CreateFolderRequest{Name: "Acme", ParentID: &parent.ID})
+	doc := uploadTestDocument(router, ownerToken)
+
+	// Move the document into the nested folder
+	moveBody, _ := json.Marshal(models.MoveDocumentRequest{FolderID: &child.ID})
+	req, _ := http.NewRequest("PUT", "/documents/"+doc.ID.String()+"/folder", bytes.NewBuffer(moveBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Viewer cannot see the document before the folder is shared
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d before sharing, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Share the top-level folder
+	shareBody, _ := json.Marshal(models.ShareRequest{Email: "folder-viewer@example.com", Permission: "view"})
+	req, _ = http.NewRequest("POST", "/folders/"+parent.ID.String()+"/share", bytes.NewBuffer(shareBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Access is inherited two levels down
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d after sharing, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteFolder_NotEmpty(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupFolderRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "folder-delete@example.com", "password123", "Owner")
+	parent := createTestFolder(router, token, models.CreateFolderRequest{Name: "Parent"})
+	createTestFolder(router, token, models.CreateFolderRequest{Name: "Child", ParentID: &parent.ID})
+
+	req, _ := http.NewRequest("DELETE", "/folders/"+parent.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestRevokeFolderShare_RemovesInheritedAccess(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupFolderRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "revoke-owner@example.com", "password123", "Owner")
+	viewerToken := registerAndLogin(router, "revoke-viewer@example.com", "password123", "Viewer")
+	var viewerID string
+	db.QueryRow(`SELECT id FROM users WHERE email = $1`, "revoke-viewer@example.com").Scan(&viewerID)
+
+	folder := createTestFolder(router, ownerToken, models.CreateFolderRequest{Name: "Clients"})
+	doc := uploadTestDocument(router, ownerToken)
+
+	moveBody, _ := json.Marshal(models.MoveDocumentRequest{FolderID: &folder.ID})
+	req, _ := http.NewRequest("PUT", "/documents/"+doc.ID.String()+"/folder", bytes.NewBuffer(moveBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	shareBody, _ := json.Marshal(models.ShareRequest{Email: "revoke-viewer@example.com", Permission: "view"})
+	req, _ = http.NewRequest("POST", "/folders/"+folder.ID.String()+"/share", bytes.NewBuffer(shareBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Only the owner can revoke
+	req, _ = http.NewRequest("DELETE", "/folders/"+folder.ID.String()+"/share/"+viewerID, nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for the sharee, got %d", http.StatusForbidden, w.Code)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/folders/"+folder.ID.String()+"/share/"+viewerID, nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	// The document inside the folder is no longer reachable
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d after revoking, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Nothing left to revoke
+	req, _ = http.NewRequest("DELETE", "/folders/"+folder.ID.String()+"/share/"+viewerID, nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = $1 AND target_id = $2`, services.AuditFolderUnshare, folder.ID).Scan(&count)
+	if count != 3 {
+		t.Errorf("audit entries = %d, want one per revoke attempt", count)
+	}
+}
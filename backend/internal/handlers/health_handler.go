@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+// HealthHandler answers liveness and readiness probes.
+type HealthHandler struct {
+	healthService *services.HealthService
+	draining      atomic.Bool
+}
+
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Drain makes the readiness check fail from now on, so load balancers take
+// this replica out of rotation before it stops accepting connections.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Livez godoc
+// @Summary Liveness check
+// @Description Reports that the process is up and serving HTTP. It checks no dependencies, so an outage elsewhere doesn't get the replica restarted
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Readyz godoc
+// @Summary Readiness check
+// @Description Checks the database, upload storage, free disk space and migrations, with a result per check; fails with 503 if any fails or the server is shutting down. Also served on /health
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.Readiness
+// @Failure 503 {object} models.Readiness
+// @Router /readyz [get]
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	report := h.healthService.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != services.ReadinessReady {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupHealthRouter(t *testing.T) (*gin.Engine, *HealthHandler, sqlmock.Sqlmock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	mock.MatchExpectationsInOrder(false)
+
+	db := &database.DB{DB: sqlDB}
+	handler := NewHealthHandler(services.NewHealthService(db, t.TempDir(), 0, time.Second))
+	router := gin.New()
+	router.GET("/livez", handler.Livez)
+	router.GET("/readyz", handler.Readyz)
+	router.GET("/health", handler.Readyz)
+	return router, handler, mock
+}
+
+// expectReadyDatabase expects a successful ping and every embedded
+// migration applied.
+func expectReadyDatabase(t *testing.T, mock sqlmock.Sqlmock, pingErr error) {
+	t.Helper()
+	mock.ExpectPing().WillReturnError(pingErr)
+
+	migrator, err := (&database.DB{}).NewMigrator()
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	rows := sqlmock.NewRows([]string{"version"})
+	for _, migration := range migrator.Migrations() {
+		rows.AddRow(migration.Version)
+	}
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func TestHealthHandler_Livez(t *testing.T) {
+	router, handler, _ := setupHealthRouter(t)
+	handler.Drain()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alive") {
+		t.Errorf("Livez() while draining = %d %s, want 200 alive", w.Code, w.Body.String())
+	}
+}
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	router, _, mock := setupHealthRouter(t)
+	expectReadyDatabase(t, mock, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	var report models.Readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Readyz() body %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusOK || report.Status != services.ReadinessReady {
+		t.Errorf("Readyz() = %d %s, want 200 ready", w.Code, w.Body.String())
+	}
+	if len(report.Checks) != 4 {
+		t.Errorf("Readyz() reported %d checks, want 4", len(report.Checks))
+	}
+}
+
+func TestHealthHandler_Readyz_DatabaseDown(t *testing.T) {
+	router, _, mock := setupHealthRouter(t)
+	expectReadyDatabase(t, mock, errors.New("connection refused"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+
+	var report models.Readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Readyz() body %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusServiceUnavailable || report.Status != services.ReadinessNotReady {
+		t.Errorf("Readyz() = %d %s, want 503 not_ready", w.Code, w.Body.String())
+	}
+	if database := report.Checks["database"]; database.Status != services.CheckFail || !strings.Contains(database.Error, "connection refused") {
+		t.Errorf("database check = %+v, want the ping failure", database)
+	}
+}
+
+func TestHealthHandler_Drain(t *testing.T) {
+	router, handler, _ := setupHealthRouter(t)
+	handler.Drain()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "draining") {
+		t.Errorf("Readyz() while draining = %d %s, want 503 draining", w.Code, w.Body.String())
+	}
+}
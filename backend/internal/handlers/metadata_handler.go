@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type MetadataHandler struct {
+	metadataService *services.MetadataService
+}
+
+func NewMetadataHandler(metadataService *services.MetadataService) *MetadataHandler {
+	return &MetadataHandler{metadataService: metadataService}
+}
+
+// GetTags godoc
+// @Summary Get document tags
+// @Description Get the tags attached to a document
+// @Tags metadata
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {object} models.TagsRequest
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/tags [get]
+func (h *MetadataHandler) GetTags(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.metadataService.GetTags(c.Request.Context(), docID, userID)
+	if err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// SetTags godoc
+// @Summary Replace document tags
+// @Description Replace the tags attached to a document (owner or editor)
+// @Tags metadata
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param request body models.TagsRequest true "Tags"
+// @Success 200 {object} models.TagsRequest
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/tags [put]
+func (h *MetadataHandler) SetTags(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.TagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	tags, err := h.metadataService.SetTags(c.Request.Context(), docID, userID, req.Tags)
+	if err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// SuggestTags godoc
+// @Summary Autocomplete tags
+// @Description Suggest existing tags from documents the user can access
+// @Tags metadata
+// @Security BearerAuth
+// @Produce json
+// @Param q query string false "Tag prefix"
+// @Param limit query int false "Maximum suggestions" default(10)
+// @Success 200 {array} models.TagSuggestion
+// @Failure 401 {object} models.ErrorResponse
+// @Router /tags [get]
+func (h *MetadataHandler) SuggestTags(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	suggestions, err := h.metadataService.SuggestTags(c.Request.Context(), userID, c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to fetch tags",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestions)
+}
+
+// GetMetadata godoc
+// @Summary Get document metadata
+// @Description Get the custom metadata fields of a document
+// @Tags metadata
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {array} models.MetadataField
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/metadata [get]
+func (h *MetadataHandler) GetMetadata(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	fields, err := h.metadataService.GetMetadata(c.Request.Context(), docID, userID)
+	if err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, fields)
+}
+
+// SetMetadata godoc
+// @Summary Set document metadata
+// @Description Create or update custom metadata fields on a document (owner or editor)
+// @Tags metadata
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param request body models.MetadataRequest true "Metadata fields"
+// @Success 200 {array} models.MetadataField
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/metadata [put]
+func (h *MetadataHandler) SetMetadata(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.MetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	fields, err := h.metadataService.SetMetadata(c.Request.Context(), docID, userID, req.Fields)
+	if err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, fields)
+}
+
+// DeleteMetadata godoc
+// @Summary Delete a metadata field
+// @Description Remove a custom metadata field from a document (owner or editor)
+// @Tags metadata
+// @Security BearerAuth
+// @Param id path string true "Document ID"
+// @Param key path string true "Metadata key"
+// @Success 204 "No Content"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/metadata/{key} [delete]
+func (h *MetadataHandler) DeleteMetadata(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.metadataService.DeleteMetadata(c.Request.Context(), docID, userID, c.Param("key")); err != nil {
+		respondMetadataError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// documentRequestIDs extracts the authenticated user and the ":id" document
+// path parameter, writing the error response itself when either is missing.
+func documentRequestIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	docID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid document ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, docID, true
+}
+
+func respondMetadataError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
+	case errors.Is(err, services.ErrMetadataNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "metadata_not_found"})
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "access_denied"})
+	case errors.Is(err, services.ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_tag",
+			Message: "Tags must be 1-64 characters of letters, digits, spaces, '.', '_' or '-'",
+		})
+	case errors.Is(err, services.ErrInvalidMetadata):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_metadata",
+			Message: "Metadata keys must be lower-case identifiers and values must match their type",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupMetadataRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	documentService := services.NewDocumentService(db, uploadDir)
+	metadataHandler := NewMetadataHandler(services.NewMetadataService(db, documentService))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	documents := router.Group("/documents")
+	documents.Use(authMiddleware.Authenticate())
+	{
+		documents.GET("/:id/tags", metadataHandler.GetTags)
+		documents.PUT("/:id/tags", metadataHandler.SetTags)
+		documents.GET("/:id/metadata", metadataHandler.GetMetadata)
+		documents.PUT("/:id/metadata", metadataHandler.SetMetadata)
+		documents.DELETE("/:id/metadata/:key", metadataHandler.DeleteMetadata)
+	}
+	router.GET("/tags", authMiddleware.Authenticate(), metadataHandler.SuggestTags)
+
+	return router, uploadDir
+}
+
+func TestTags_FilterAndAutocomplete(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupMetadataRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "tags@example.com", "password123", "Tagger")
+	tagged := uploadTestDocument(router, token)
+	uploadTestDocument(router, token)
+
+	body, _ := json.Marshal(models.TagsRequest{Tags: []string{"Invoice", "2024"}})
+	req, _ := http.NewRequest("PUT", "/documents/"+tagged.ID.String()+"/tags", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Listing filtered by tag only returns the tagged document
+	req, _ = http.NewRequest("GET", "/documents?tag=invoice", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.PaginatedResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Total != 1 {
+		t.Errorf("Expected 1 document tagged invoice, got %d", response.Total)
+	}
+
+	// Autocomplete suggests the stored tag
+	req, _ = http.NewRequest("GET", "/tags?q=inv", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var suggestions []models.TagSuggestion
+	json.Unmarshal(w.Body.Bytes(), &suggestions)
+	if len(suggestions) != 1 || suggestions[0].Tag != "invoice" {
+		t.Errorf("Expected suggestion [invoice], got %+v", suggestions)
+	}
+}
+
+func TestMetadata_InvalidValue(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupMetadataRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "meta@example.com", "password123", "Meta")
+	doc := uploadTestDocument(router, token)
+
+	body, _ := json.Marshal(models.MetadataRequest{Fields: []models.MetadataField{
+		{Key: "year", Type: "number", Value: "twenty"},
+	}})
+	req, _ := http.NewRequest("PUT", "/documents/"+doc.ID.String()+"/metadata", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type NotificationHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationHandler(notificationService *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationService: notificationService}
+}
+
+// ListNotifications godoc
+// @Summary List notifications
+// @Description List the current user's notifications, newest first, with the number still unread
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Items per page" default(20)
+// @Success 200 {object} models.NotificationList
+// @Failure 401 {object} models.ErrorResponse
+// @Router /notifications [get]
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	unreadOnly, _ := strconv.ParseBool(c.Query("unread"))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	notifications, info, unread, err := h.notificationService.List(c.Request.Context(), userID, unreadOnly, page, perPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to fetch notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NotificationList{
+		PaginatedResponse: paginatedResponse(notifications, info),
+		UnreadCount:       unread,
+	})
+}
+
+// MarkNotificationRead godoc
+// @Summary Mark a notification as read
+// @Tags notifications
+// @Security BearerAuth
+// @Param id path string true "Notification ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /notifications/{id}/read [post]
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid notification ID",
+		})
+		return
+	}
+
+	if err := h.notificationService.MarkRead(c.Request.Context(), id, userID); err != nil {
+		if errors.Is(err, services.ErrNotificationNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "notification_not_found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// MarkAllNotificationsRead godoc
+// @Summary Mark all notifications as read
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]int
+// @Failure 401 {object} models.ErrorResponse
+// @Router /notifications/read-all [post]
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	marked, err := h.notificationService.MarkAllRead(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
+
+// GetNotificationPreferences godoc
+// @Summary Get notification preferences
+// @Description Whether each notification type is also sent by email
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.NotificationPreference
+// @Failure 401 {object} models.ErrorResponse
+// @Router /notifications/preferences [get]
+func (h *NotificationHandler) GetNotificationPreferences(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	preferences, err := h.notificationService.Preferences(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// UpdateNotificationPreferences godoc
+// @Summary Update notification preferences
+// @Description Choose which notification types are also sent by email. Types left out keep their setting.
+// @Tags notifications
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.NotificationPreferencesRequest true "Email setting per type"
+// @Success 200 {array} models.NotificationPreference
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /notifications/preferences [put]
+func (h *NotificationHandler) UpdateNotificationPreferences(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.NotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.notificationService.SetPreferences(c.Request.Context(), userID, req.Preferences); err != nil {
+		if errors.Is(err, services.ErrInvalidNotificationType) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "validation_error",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	h.GetNotificationPreferences(c)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupNotificationRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	notificationHandler := NewNotificationHandler(services.NewNotificationService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	notifications := router.Group("/notifications")
+	notifications.Use(authMiddleware.Authenticate())
+	{
+		notifications.GET("", notificationHandler.ListNotifications)
+		notifications.POST("/read-all", notificationHandler.MarkAllNotificationsRead)
+		notifications.POST("/:id/read", notificationHandler.MarkNotificationRead)
+		notifications.GET("/preferences", notificationHandler.GetNotificationPreferences)
+		notifications.PUT("/preferences", notificationHandler.UpdateNotificationPreferences)
+	}
+
+	return router, uploadDir
+}
+
+func listNotifications(t *testing.T, router *gin.Engine, token string) models.NotificationList {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/notifications", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var list models.NotificationList
+	json.Unmarshal(w.Body.Bytes(), &list)
+	return list
+}
+
+func TestNotifications_ShareAppearsAndIsMarkedRead(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupNotificationRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "notify-owner@example.com", "password123", "Owner")
+	viewerToken := registerAndLogin(router, "notify-viewer@example.com", "password123", "Viewer")
+	doc := uploadTestDocument(router, ownerToken)
+
+	shareBody, _ := json.Marshal(models.ShareRequest{Email: "notify-viewer@example.com", Permission: "view"})
+	req, _ := http.NewRequest("POST", "/documents/"+doc.ID.String()+"/share", bytes.NewBuffer(shareBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	list := listNotifications(t, router, viewerToken)
+	if list.UnreadCount != 1 || list.Total != 1 {
+		t.Fatalf("Expected one unread notification, got %+v", list)
+	}
+	data, _ := json.Marshal(list.Data)
+	var notifications []models.Notification
+	json.Unmarshal(data, &notifications)
+	if n := notifications[0]; n.Type != services.NotificationDocumentShared || n.ActorName != "Owner" || *n.DocumentID != doc.ID {
+		t.Errorf("Expected a document.shared notification from Owner, got %+v", n)
+	}
+
+	// The owner isn't notified of their own share
+	if list := listNotifications(t, router, ownerToken); list.Total != 0 {
+		t.Errorf("Expected no notifications for the owner, got %d", list.Total)
+	}
+
+	// Only the recipient can mark it read
+	req, _ = http.NewRequest("POST", "/notifications/"+notifications[0].ID.String()+"/read", nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/notifications/"+notifications[0].ID.String()+"/read", nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if list := listNotifications(t, router, viewerToken); list.UnreadCount != 0 || list.Total != 1 {
+		t.Errorf("Expected one read notification, got %+v", list)
+	}
+}
+
+func TestNotifications_Preferences(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupNotificationRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "notify-prefs@example.com", "password123", "User")
+
+	update := func(prefs []models.NotificationPreference) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.NotificationPreferencesRequest{Preferences: prefs})
+		req, _ := http.NewRequest("PUT", "/notifications/preferences", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update([]models.NotificationPreference{{Type: services.NotificationDocumentShared, Email: false}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var preferences []models.NotificationPreference
+	json.Unmarshal(w.Body.Bytes(), &preferences)
+	for _, p := range preferences {
+		if p.Type == services.NotificationDocumentShared && p.Email {
+			t.Error("Expected document.shared emails to be turned off")
+		}
+		if p.Type == services.NotificationTransferOffered && !p.Email {
+			t.Error("Expected transfer.offered to keep its default")
+		}
+	}
+
+	if w := update([]models.NotificationPreference{{Type: "document.viewed", Email: true}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown type, got %d", http.StatusBadRequest, w.Code)
+	}
+}
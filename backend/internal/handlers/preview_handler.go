@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+// previewMaxAge is how long clients may reuse a preview without asking
+// again. Previews only change if they are regenerated, which changes the ETag.
+const previewMaxAge = 24 * 60 * 60
+
+// previewRetryAfter is the Retry-After hint, in seconds, while a preview is
+// still being generated.
+const previewRetryAfter = 5
+
+type PreviewHandler struct {
+	previewService *services.PreviewService
+}
+
+func NewPreviewHandler(previewService *services.PreviewService) *PreviewHandler {
+	return &PreviewHandler{previewService: previewService}
+}
+
+// GetThumbnail godoc
+// @Summary Get a document thumbnail
+// @Description Scaled-down JPEG or PNG of an image document (JPEG, PNG, GIF, WebP), at most 256 pixels on its longer side
+// @Tags documents
+// @Security BearerAuth
+// @Produce image/jpeg,image/png
+// @Param id path string true "Document ID"
+// @Success 200 {file} binary
+// @Success 202 {object} models.ErrorResponse "Still being generated; retry after Retry-After seconds"
+// @Success 304 "Not Modified"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/thumbnail [get]
+func (h *PreviewHandler) GetThumbnail(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.previewService.Thumbnail(c.Request.Context(), docID, userID)
+	if err != nil {
+		respondPreviewError(c, err)
+		return
+	}
+
+	servePreview(c, p)
+}
+
+// GetPreview godoc
+// @Summary Get a document text preview
+// @Description The first few kilobytes of a text, CSV, Markdown or JSON document. X-Preview-Truncated is true when the file continues.
+// @Tags documents
+// @Security BearerAuth
+// @Produce plain
+// @Param id path string true "Document ID"
+// @Success 200 {string} string
+// @Success 202 {object} models.ErrorResponse "Still being generated; retry after Retry-After seconds"
+// @Success 304 "Not Modified"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/preview [get]
+func (h *PreviewHandler) GetPreview(c *gin.Context) {
+	userID, docID, ok := documentRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.previewService.Text(c.Request.Context(), docID, userID)
+	if err != nil {
+		respondPreviewError(c, err)
+		return
+	}
+
+	c.Header("X-Preview-Truncated", strconv.FormatBool(p.Truncated))
+	servePreview(c, p)
+}
+
+// servePreview writes a generated preview with caching headers, answering
+// 304 when the client already holds this version.
+func servePreview(c *gin.Context, p *models.DocumentPreview) {
+	etag := fmt.Sprintf(`"%s-%x"`, c.Param("id"), p.GeneratedAt.UnixNano())
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", previewMaxAge))
+	c.Header("Last-Modified", p.GeneratedAt.UTC().Format(http.TimeFormat))
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, p.ContentType, p.Data)
+}
+
+func respondPreviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPreviewPending):
+		c.Header("Retry-After", strconv.Itoa(previewRetryAfter))
+		c.JSON(http.StatusAccepted, models.ErrorResponse{
+			Error:   "preview_pending",
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrPreviewUnavailable):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "preview_unavailable",
+			Message: err.Error(),
+		})
+	case errors.Is(err, services.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "not_found"})
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "access_denied"})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupPreviewRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	previewHandler := NewPreviewHandler(services.NewPreviewService(db, services.NewDocumentService(db, uploadDir)))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	documents := router.Group("/documents")
+	documents.Use(authMiddleware.Authenticate())
+	{
+		documents.GET("/:id/thumbnail", previewHandler.GetThumbnail)
+		documents.GET("/:id/preview", previewHandler.GetPreview)
+	}
+
+	return router, uploadDir
+}
+
+func TestPreview_GeneratedInBackgroundAndCached(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupPreviewRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "preview@example.com", "password123", "User")
+	doc := uploadTestDocument(router, token)
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/documents/"+doc.ID.String()+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/preview", "")
+	if w.Code != http.StatusAccepted || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected status %d with Retry-After before the worker runs, got %d", http.StatusAccepted, w.Code)
+	}
+
+	worker := services.NewPreviewWorker(db)
+	if _, err := worker.GenerateDue(context.Background()); err != nil {
+		t.Fatalf("GenerateDue() error = %v", err)
+	}
+
+	w = get("/preview", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Body.String() != "Test content" || w.Header().Get("X-Preview-Truncated") != "false" {
+		t.Errorf("Expected the whole file as the preview, got %q", w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") == "" {
+		t.Fatalf("Expected caching headers, got %v", w.Header())
+	}
+
+	if w := get("/preview", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for a matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	// A text file has no thumbnail
+	if w := get("/thumbnail", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a text thumbnail, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type SearchHandler struct {
+	searchService *services.SearchService
+}
+
+func NewSearchHandler(searchService *services.SearchService) *SearchHandler {
+	return &SearchHandler{searchService: searchService}
+}
+
+// Search godoc
+// @Summary Full-text search
+// @Description Search the names and content of documents the user can access. Supports quoted phrases, OR and -exclusion. Highlights are HTML-escaped with matches wrapped in <mark>.
+// @Tags search
+// @Security BearerAuth
+// @Produce json
+// @Param q query string true "Search query"
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Items per page" default(20)
+// @Success 200 {object} models.PaginatedResponse{data=[]models.SearchResult}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /search [get]
+func (h *SearchHandler) Search(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	results, total, err := h.searchService.Search(c.Request.Context(), userID, c.Query("q"), page, perPage)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptyQuery) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "validation_error",
+				Message: "Query parameter 'q' is required",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to search documents",
+		})
+		return
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	totalPages := (total + perPage - 1) / perPage
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data:       results,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupSearchRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	searchHandler := NewSearchHandler(services.NewSearchService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	router.GET("/search", authMiddleware.Authenticate(), searchHandler.Search)
+
+	return router, uploadDir
+}
+
+func searchDocuments(router *gin.Engine, token, query string) (int, []models.SearchResult) {
+	req, _ := http.NewRequest("GET", "/search?q="+url.QueryEscape(query), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response struct {
+		Data []models.SearchResult `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Data
+}
+
+func TestSearch_MatchesContentAndRespectsAccess(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupSearchRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "search-owner@example.com", "password123", "Owner")
+	viewerToken := registerAndLogin(router, "search-viewer@example.com", "password123", "Viewer")
+
+	body, contentType := createTestFile("The annual revenue forecast for the northern region")
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var doc models.Document
+	json.Unmarshal(w.Body.Bytes(), &doc)
+
+	// Owner finds the document by a stemmed word from its content
+	code, results := searchDocuments(router, ownerToken, "forecasts")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if len(results) != 1 || results[0].ID != doc.ID {
+		t.Fatalf("Expected the uploaded document, got %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, "<mark>forecast</mark>") {
+		t.Errorf("Expected highlighted snippet, got %q", results[0].Snippet)
+	}
+
+	// Another user sees nothing until the document is shared
+	if _, results := searchDocuments(router, viewerToken, "forecast"); len(results) != 0 {
+		t.Errorf("Expected no results before sharing, got %d", len(results))
+	}
+
+	shareBody, _ := json.Marshal(models.ShareRequest{Email: "search-viewer@example.com", Permission: "view"})
+	req, _ = http.NewRequest("POST", "/documents/"+doc.ID.String()+"/share", bytes.NewBuffer(shareBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	_, results = searchDocuments(router, viewerToken, "forecast")
+	if len(results) != 1 || results[0].Permission != "view" {
+		t.Errorf("Expected one view result after sharing, got %+v", results)
+	}
+}
+
+func TestSearch_EmptyQuery(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupSearchRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "search-empty@example.com", "password123", "User")
+
+	if code, _ := searchDocuments(router, token, " "); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+	}
+}
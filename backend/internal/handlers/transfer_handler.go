@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type TransferHandler struct {
+	transferService *services.TransferService
+	auditService    *services.AuditService
+}
+
+func NewTransferHandler(transferService *services.TransferService, auditService *services.AuditService) *TransferHandler {
+	return &TransferHandler{transferService: transferService, auditService: auditService}
+}
+
+// OfferTransfer godoc
+// @Summary Offer document ownership
+// @Description Offer ownership of a document to another user (owner only)
+// @Tags transfers
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param request body models.TransferRequest true "Recipient details"
+// @Success 201 {object} models.DocumentTransfer
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/{id}/transfer [post]
+func (h *TransferHandler) OfferTransfer(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	docID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid document ID",
+		})
+		return
+	}
+
+	var req models.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	transfer, err := h.transferService.Offer(c.Request.Context(), docID, userID, req.Email, req.KeepAccess)
+	recordAudit(c, h.auditService, documentAuditEntry(services.AuditTransferOffer, docID, map[string]string{
+		"to":          req.Email,
+		"keep_access": strconv.FormatBool(req.KeepAccess),
+	}), err)
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// OfferAllTransfers godoc
+// @Summary Offer ownership of all documents
+// @Description Offer ownership of every document the current user owns to another user
+// @Tags transfers
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.TransferRequest true "Recipient details"
+// @Success 201 {array} models.DocumentTransfer
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /transfers [post]
+func (h *TransferHandler) OfferAllTransfers(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	transfers, err := h.transferService.OfferAll(c.Request.Context(), userID, req.Email, req.KeepAccess)
+	if err != nil {
+		recordAudit(c, h.auditService, models.AuditEntry{
+			Action:  services.AuditTransferOffer,
+			Details: map[string]string{"to": req.Email},
+		}, err)
+		respondTransferError(c, err)
+		return
+	}
+	for _, transfer := range transfers {
+		recordAudit(c, h.auditService, documentAuditEntry(services.AuditTransferOffer, transfer.DocumentID, map[string]string{
+			"to":          req.Email,
+			"keep_access": strconv.FormatBool(req.KeepAccess),
+		}), nil)
+	}
+
+	c.JSON(http.StatusCreated, transfers)
+}
+
+// ListTransfers godoc
+// @Summary List incoming transfers
+// @Description Get pending ownership transfers offered to the current user
+// @Tags transfers
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.DocumentTransfer
+// @Failure 401 {object} models.ErrorResponse
+// @Router /transfers [get]
+func (h *TransferHandler) ListTransfers(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	transfers, err := h.transferService.ListPending(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to fetch transfers",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+// AcceptTransfer godoc
+// @Summary Accept a transfer
+// @Description Accept a pending ownership transfer offered to the current user
+// @Tags transfers
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Transfer ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /transfers/{id}/accept [post]
+func (h *TransferHandler) AcceptTransfer(c *gin.Context) {
+	h.respond(c, h.transferService.Accept, services.AuditTransferAccept, "Transfer accepted")
+}
+
+// DeclineTransfer godoc
+// @Summary Decline a transfer
+// @Description Decline a pending ownership transfer offered to the current user
+// @Tags transfers
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Transfer ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /transfers/{id}/decline [post]
+func (h *TransferHandler) DeclineTransfer(c *gin.Context) {
+	h.respond(c, h.transferService.Decline, services.AuditTransferDecline, "Transfer declined")
+}
+
+// CancelTransfer godoc
+// @Summary Cancel a transfer
+// @Description Withdraw a pending ownership transfer offered by the current user
+// @Tags transfers
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Transfer ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /transfers/{id} [delete]
+func (h *TransferHandler) CancelTransfer(c *gin.Context) {
+	h.respond(c, h.transferService.Cancel, services.AuditTransferCancel, "Transfer cancelled")
+}
+
+// AcceptAllTransfers godoc
+// @Summary Accept all transfers from a user
+// @Description Accept every pending transfer offered to the current user by the given sender
+// @Tags transfers
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body object{from_user_id=string} true "Sender"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /transfers/accept-all [post]
+func (h *TransferHandler) AcceptAllTransfers(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req struct {
+		FromUserID uuid.UUID `json:"from_user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	accepted, err := h.transferService.AcceptAll(c.Request.Context(), userID, req.FromUserID)
+	recordAudit(c, h.auditService, models.AuditEntry{
+		Action:  services.AuditTransferAccept,
+		Details: map[string]string{"from_user_id": req.FromUserID.String(), "accepted": strconv.Itoa(accepted)},
+	}, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": accepted})
+}
+
+func (h *TransferHandler) respond(c *gin.Context, action func(ctx context.Context, transferID, userID uuid.UUID) error, auditAction, message string) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	transferID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid transfer ID",
+		})
+		return
+	}
+
+	err = action(c.Request.Context(), transferID, userID)
+	recordAudit(c, h.auditService, models.AuditEntry{Action: auditAction, TargetType: "transfer", TargetID: &transferID}, err)
+	if err != nil {
+		respondTransferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func respondTransferError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "document_not_found"})
+	case errors.Is(err, services.ErrTransferNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "transfer_not_found"})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "user_not_found",
+			Message: "User with this email not found",
+		})
+	case errors.Is(err, services.ErrTransferToSelf):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_recipient",
+			Message: "You already own this document",
+		})
+	case errors.Is(err, services.ErrTransferStale):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "transfer_stale",
+			Message: "The document changed owner since this transfer was offered",
+		})
+	case errors.Is(err, services.ErrAccessDenied):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "access_denied",
+			Message: "Only the document owner can transfer it",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+	}
+}
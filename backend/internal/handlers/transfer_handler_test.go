@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupTransferRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	documentService := services.NewDocumentService(db, uploadDir)
+	transferHandler := NewTransferHandler(services.NewTransferService(db, documentService), services.NewAuditService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	router.POST("/documents/:id/transfer", authMiddleware.Authenticate(), transferHandler.OfferTransfer)
+
+	transfers := router.Group("/transfers")
+	transfers.Use(authMiddleware.Authenticate())
+	{
+		transfers.GET("", transferHandler.ListTransfers)
+		transfers.POST("", transferHandler.OfferAllTransfers)
+		transfers.POST("/accept-all", transferHandler.AcceptAllTransfers)
+		transfers.POST("/:id/accept", transferHandler.AcceptTransfer)
+		transfers.POST("/:id/decline", transferHandler.DeclineTransfer)
+		transfers.DELETE("/:id", transferHandler.CancelTransfer)
+	}
+
+	return router, uploadDir
+}
+
+func uploadTestDocument(router *gin.Engine, token string) models.Document {
+	body, contentType := createTestFile("Test content")
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var doc models.Document
+	json.Unmarshal(w.Body.Bytes(), &doc)
+	return doc
+}
+
+func TestTransferDocument_AcceptKeepsAccess(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupTransferRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "transfer-owner@example.com", "password123", "Owner")
+	recipientToken := registerAndLogin(router, "transfer-recipient@example.com", "password123", "Recipient")
+	doc := uploadTestDocument(router, ownerToken)
+
+	// Offer the document
+	offerBody, _ := json.Marshal(models.TransferRequest{Email: "transfer-recipient@example.com", KeepAccess: true})
+	req, _ := http.NewRequest("POST", "/documents/"+doc.ID.String()+"/transfer", bytes.NewBuffer(offerBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var transfer models.DocumentTransfer
+	json.Unmarshal(w.Body.Bytes(), &transfer)
+
+	// Recipient sees and accepts the offer
+	req, _ = http.NewRequest("GET", "/transfers", nil)
+	req.Header.Set("Authorization", "Bearer "+recipientToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var pending []models.DocumentTransfer
+	json.Unmarshal(w.Body.Bytes(), &pending)
+	if len(pending) != 1 {
+		t.Fatalf("Expected 1 pending transfer, got %d", len(pending))
+	}
+
+	req, _ = http.NewRequest("POST", "/transfers/"+transfer.ID.String()+"/accept", nil)
+	req.Header.Set("Authorization", "Bearer "+recipientToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Previous owner keeps access but can no longer delete
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected previous owner to keep access, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestTransferDocument_NotOwner(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupTransferRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "transfer-owner2@example.com", "password123", "Owner")
+	otherToken := registerAndLogin(router, "transfer-other@example.com", "password123", "Other")
+	doc := uploadTestDocument(router, ownerToken)
+
+	offerBody, _ := json.Marshal(models.TransferRequest{Email: "transfer-other@example.com"})
+	req, _ := http.NewRequest("POST", "/documents/"+doc.ID.String()+"/transfer", bytes.NewBuffer(offerBody))
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestTransferDocument_LeavesSharedFolder(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupFolderRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	documentService := services.NewDocumentService(db, uploadDir)
+	transferHandler := NewTransferHandler(services.NewTransferService(db, documentService), services.NewAuditService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+	router.POST("/documents/:id/transfer", authMiddleware.Authenticate(), transferHandler.OfferTransfer)
+	router.POST("/transfers/:id/accept", authMiddleware.Authenticate(), transferHandler.AcceptTransfer)
+
+	ownerToken := registerAndLogin(router, "transfer-folder-owner@example.com", "password123", "Owner")
+	recipientToken := registerAndLogin(router, "transfer-folder-recipient@example.com", "password123", "Recipient")
+	viewerToken := registerAndLogin(router, "transfer-folder-viewer@example.com", "password123", "Viewer")
+
+	// The document sits in a folder the owner has shared
+	folder := createTestFolder(router, ownerToken, models.CreateFolderRequest{Name: "Shared"})
+	doc := uploadTestDocument(router, ownerToken)
+
+	moveBody, _ := json.Marshal(models.MoveDocumentRequest{FolderID: &folder.ID})
+	req, _ := http.NewRequest("PUT", "/documents/"+doc.ID.String()+"/folder", bytes.NewBuffer(moveBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	shareBody, _ := json.Marshal(models.ShareRequest{Email: "transfer-folder-viewer@example.com", Permission: "view"})
+	req, _ = http.NewRequest("POST", "/folders/"+folder.ID.String()+"/share", bytes.NewBuffer(shareBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d through the folder share, got %d", http.StatusOK, w.Code)
+	}
+
+	// Hand the document over
+	offerBody, _ := json.Marshal(models.TransferRequest{Email: "transfer-folder-recipient@example.com"})
+	req, _ = http.NewRequest("POST", "/documents/"+doc.ID.String()+"/transfer", bytes.NewBuffer(offerBody))
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var transfer models.DocumentTransfer
+	json.Unmarshal(w.Body.Bytes(), &transfer)
+
+	req, _ = http.NewRequest("POST", "/transfers/"+transfer.ID.String()+"/accept", nil)
+	req.Header.Set("Authorization", "Bearer "+recipientToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The previous owner's folder share no longer reaches it
+	req, _ = http.NewRequest("GET", "/documents/"+doc.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+viewerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d after the transfer, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// Nor is it listed in that folder any more
+	req, _ = http.NewRequest("GET", "/folders/"+folder.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var contents models.FolderContents
+	json.Unmarshal(w.Body.Bytes(), &contents)
+	if len(contents.Documents) != 0 {
+		t.Errorf("folder still lists %d documents after the transfer", len(contents.Documents))
+	}
+
+	var folderID *string
+	db.QueryRow(`SELECT folder_id FROM documents WHERE id = $1`, doc.ID).Scan(&folderID)
+	if folderID != nil {
+		t.Errorf("folder_id = %s, want the new owner's root", *folderID)
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description List the current user's webhook subscriptions
+// @Tags webhooks
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Webhook
+// @Failure 401 {object} models.ErrorResponse
+// @Router /webhooks [get]
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	webhooks, err := h.webhookService.List(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "internal_error",
+			Message: "Failed to fetch webhooks",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook godoc
+// @Summary Register a webhook
+// @Description Subscribe a URL to events for the current user's documents. The signing secret is only returned here.
+// @Tags webhooks
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.WebhookRequest true "Webhook URL and event types (empty for all)"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Router /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	h.create(c, false)
+}
+
+// CreateGlobalWebhook godoc
+// @Summary Register a global webhook
+// @Description Subscribe a URL to events for every document (admins only)
+// @Tags webhooks
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body models.WebhookRequest true "Webhook URL and event types (empty for all)"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/webhooks [post]
+func (h *WebhookHandler) CreateGlobalWebhook(c *gin.Context) {
+	h.create(c, true)
+}
+
+func (h *WebhookHandler) create(c *gin.Context, global bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	webhook, err := h.webhookService.Create(c.Request.Context(), userID, req.URL, req.EventTypes, global)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Remove a webhook subscription and its delivery history
+// @Tags webhooks
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID, webhookID, ok := webhookRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(c.Request.Context(), webhookID, userID); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries godoc
+// @Summary List webhook deliveries
+// @Description List the most recent deliveries of a webhook, newest first
+// @Tags webhooks
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param status query string false "pending, delivered or dead"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	userID, webhookID, ok := webhookRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(c.Request.Context(), webhookID, userID, c.Query("status"))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayDeliveries godoc
+// @Summary Replay dead deliveries
+// @Description Queue every dead-lettered delivery of a webhook for another round of attempts
+// @Tags webhooks
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} map[string]int
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id}/replay [post]
+func (h *WebhookHandler) ReplayDeliveries(c *gin.Context) {
+	userID, webhookID, ok := webhookRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	replayed, err := h.webhookService.Replay(c.Request.Context(), webhookID, userID, nil)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed})
+}
+
+// ReplayDelivery godoc
+// @Summary Replay a delivery
+// @Description Queue a single delivery, in any state, to be sent again
+// @Tags webhooks
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	userID, webhookID, ok := webhookRequestIDs(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("delivery_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid delivery ID",
+		})
+		return
+	}
+
+	replayed, err := h.webhookService.Replay(c.Request.Context(), webhookID, userID, &deliveryID)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed})
+}
+
+func webhookRequestIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_id",
+			Message: "Invalid webhook ID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, webhookID, true
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "webhook_not_found"})
+	case errors.Is(err, services.ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "delivery_not_found"})
+	case errors.Is(err, services.ErrInvalidWebhookURL), errors.Is(err, services.ErrInvalidEventType),
+		errors.Is(err, services.ErrWebhookAddress), errors.Is(err, services.ErrWebhookHostUnresolved):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "validation_error",
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "internal_error"})
+	}
+}
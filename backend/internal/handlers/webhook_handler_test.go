@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/middleware"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/services"
+)
+
+func setupWebhookRouter(db *database.DB) (*gin.Engine, string) {
+	router, _, _, uploadDir := setupDocumentRouter(db)
+
+	webhookHandler := NewWebhookHandler(services.NewWebhookService(db))
+	authMiddleware := middleware.NewAuthMiddleware("test-secret")
+
+	webhooks := router.Group("/webhooks")
+	webhooks.Use(authMiddleware.Authenticate())
+	{
+		webhooks.GET("", webhookHandler.ListWebhooks)
+		webhooks.POST("", webhookHandler.CreateWebhook)
+		webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+		webhooks.POST("/:id/replay", webhookHandler.ReplayDeliveries)
+		webhooks.POST("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayDelivery)
+	}
+
+	return router, uploadDir
+}
+
+func createWebhook(router *gin.Engine, token string, req models.WebhookRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest("POST", "/webhooks", bytes.NewBuffer(body))
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httpReq)
+	return w
+}
+
+func TestWebhooks_QueueDeliveryOnUpload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupWebhookRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	ownerToken := registerAndLogin(router, "hook-owner@example.com", "password123", "Owner")
+	otherToken := registerAndLogin(router, "hook-other@example.com", "password123", "Other")
+
+	w := createWebhook(router, ownerToken, models.WebhookRequest{
+		URL:        "https://203.0.113.10/vault",
+		EventTypes: []string{services.EventDocumentCreated},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var webhook models.Webhook
+	json.Unmarshal(w.Body.Bytes(), &webhook)
+	if webhook.Secret == "" {
+		t.Error("Expected the signing secret on creation")
+	}
+
+	uploadTestDocument(router, ownerToken)
+	// Another user's upload doesn't reach this webhook
+	uploadTestDocument(router, otherToken)
+
+	req, _ := http.NewRequest("GET", "/webhooks/"+webhook.ID.String()+"/deliveries", nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var deliveries []models.WebhookDelivery
+	json.Unmarshal(w.Body.Bytes(), &deliveries)
+	if len(deliveries) != 1 || deliveries[0].EventType != services.EventDocumentCreated || deliveries[0].Status != services.DeliveryPending {
+		t.Errorf("Expected one pending document.created delivery, got %+v", deliveries)
+	}
+
+	// The secret is never listed again
+	req, _ = http.NewRequest("GET", "/webhooks", nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var listed []models.Webhook
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].Secret != "" {
+		t.Errorf("Expected one webhook without its secret, got %+v", listed)
+	}
+
+	// Other users can't see or replay it
+	req, _ = http.NewRequest("POST", "/webhooks/"+webhook.ID.String()+"/replay", nil)
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestWebhooks_InvalidRequest(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	router, uploadDir := setupWebhookRouter(db)
+	defer os.RemoveAll(uploadDir)
+
+	token := registerAndLogin(router, "hook-invalid@example.com", "password123", "User")
+
+	tests := []struct {
+		name string
+		req  models.WebhookRequest
+	}{
+		{"non-http URL", models.WebhookRequest{URL: "ftp://example.com/hook"}},
+		{"unknown event", models.WebhookRequest{URL: "https://203.0.113.10/hook", EventTypes: []string{"document.viewed"}}},
+		{"loopback URL", models.WebhookRequest{URL: "http://127.0.0.1:8080/hook"}},
+		{"metadata URL", models.WebhookRequest{URL: "http://169.254.169.254/latest/meta-data/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := createWebhook(router, token, tt.req); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
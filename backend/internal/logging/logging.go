@@ -0,0 +1,129 @@
+// Package logging configures the server's structured JSON logs. Records
+// logged with a request's context carry its request ID, route, user and
+// trace, and sensitive values are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of every sensitive attribute.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values never reach the logs,
+// compared in lower case with separators removed. Keys ending in token,
+// password, secret or API key are redacted too.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"setcookie":     true,
+	"encryptionkey": true,
+	"filepath":      true,
+	"passwordhash":  true,
+}
+
+var sensitiveSuffixes = []string{"token", "password", "secret", "apikey"}
+
+// sensitiveHeaders are redacted when a whole http.Header is logged.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// New returns a logger writing JSON records at level and above to w.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(&contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})})
+}
+
+// Sensitive reports whether values logged under key are redacted.
+func Sensitive(key string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(strings.ToLower(key))
+	if sensitiveKeys[normalized] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if Sensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if header, ok := a.Value.Any().(http.Header); ok {
+		header = header.Clone()
+		for _, name := range sensitiveHeaders {
+			if header.Get(name) != "" {
+				header.Set(name, Redacted)
+			}
+		}
+		return slog.Any(a.Key, header)
+	}
+	return a
+}
+
+type contextKey struct{}
+
+// requestFields are what a request's records are tagged with.
+type requestFields struct {
+	requestID string
+	route     string
+	userID    string
+}
+
+// WithRequest returns ctx tagged with the request's ID and route pattern.
+func WithRequest(ctx context.Context, requestID, route string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestFields{requestID: requestID, route: route})
+}
+
+// WithUserID returns ctx tagged with the authenticated user as well.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	fields, _ := ctx.Value(contextKey{}).(requestFields)
+	fields.userID = userID
+	return context.WithValue(ctx, contextKey{}, fields)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "".
+func RequestID(ctx context.Context) string {
+	fields, _ := ctx.Value(contextKey{}).(requestFields)
+	return fields.requestID
+}
+
+// contextHandler adds the request fields and trace ID from the context a
+// record was logged with.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields, ok := ctx.Value(contextKey{}).(requestFields); ok {
+		r.AddAttrs(slog.String("request_id", fields.requestID))
+		if fields.route != "" {
+			r.AddAttrs(slog.String("route", fields.route))
+		}
+		if fields.userID != "" {
+			r.AddAttrs(slog.String("user_id", fields.userID))
+		}
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log output %q is not JSON: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestNew_RedactsSensitiveAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.Info("login",
+		"email", "alice@example.com",
+		"password", "hunter2",
+		"Authorization", "Bearer abc",
+		"refresh_token", "def",
+		"EncryptionKey", "k",
+		"file_path", "/uploads/x",
+		slog.Group("user", "password_hash", "$2a$"),
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "Bearer abc", "def", `"k"`, "/uploads/x", "$2a$"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %q: %s", secret, out)
+		}
+	}
+	record := decode(t, &buf)
+	if record["email"] != "alice@example.com" || record["password"] != Redacted {
+		t.Errorf("record = %v, want email kept and password redacted", record)
+	}
+}
+
+func TestNew_RedactsHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	header := http.Header{"Authorization": {"Bearer abc"}, "Accept": {"application/json"}}
+
+	New(&buf, slog.LevelInfo).Info("request", "headers", header)
+
+	if strings.Contains(buf.String(), "Bearer abc") || !strings.Contains(buf.String(), "application/json") {
+		t.Errorf("log output = %s, want Authorization redacted and Accept kept", buf.String())
+	}
+	if header.Get("Authorization") != "Bearer abc" {
+		t.Error("redaction modified the caller's header")
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn)
+
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("info record written at warn level: %s", buf.String())
+	}
+	logger.Warn("kept")
+	if decode(t, &buf)["level"] != "WARN" {
+		t.Errorf("log output = %s, want a WARN record", buf.String())
+	}
+}
+
+func TestNew_AddsRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID,
+	}))
+	ctx = WithUserID(WithRequest(ctx, "req-1", "/documents/:id"), "user-1")
+
+	logger.With("component", "test").InfoContext(ctx, "handled")
+
+	record := decode(t, &buf)
+	want := map[string]string{
+		"request_id": "req-1",
+		"route":      "/documents/:id",
+		"user_id":    "user-1",
+		"trace_id":   traceID.String(),
+		"component":  "test",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %q", key, record[key], value)
+		}
+	}
+	if RequestID(ctx) != "req-1" {
+		t.Errorf("RequestID() = %q, want req-1", RequestID(ctx))
+	}
+}
+
+func TestNew_WithoutRequest(t *testing.T) {
+	var buf bytes.Buffer
+
+	New(&buf, slog.LevelInfo).InfoContext(context.Background(), "startup")
+
+	record := decode(t, &buf)
+	for _, key := range []string{"request_id", "user_id", "route", "trace_id"} {
+		if _, ok := record[key]; ok {
+			t.Errorf("record has %s outside a request: %v", key, record)
+		}
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	tests := map[string]bool{
+		"password":       true,
+		"new_password":   true,
+		"X-Api-Key":      true,
+		"access_token":   true,
+		"client_secret":  true,
+		"set-cookie":     true,
+		"email":          false,
+		"document_id":    false,
+		"token_count_ok": false,
+	}
+	for key, want := range tests {
+		if got := Sensitive(key); got != want {
+			t.Errorf("Sensitive(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Package mailer sends plain-text notification emails. The Mailer interface
+// lets deployments swap SMTP for another transport; without SMTP settings
+// emails are written to the log instead.
+package mailer
+
+import (
+	"log/slog"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+)
+
+// Message is a single plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. A returned error means the message was not sent
+// and may be retried.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New builds the mailer enabled in the configuration.
+func New(cfg *config.Config) Mailer {
+	if cfg.SMTPAddr == "" {
+		return LogMailer{}
+	}
+	return NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+}
+
+// LogMailer logs messages instead of sending them, for development setups
+// without a mail server.
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Message) error {
+	slog.Info("mail not sent, no SMTP server configured", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"testing"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	if _, ok := New(&config.Config{}).(LogMailer); !ok {
+		t.Error("New() without SMTP_ADDR should log messages")
+	}
+
+	if _, ok := New(&config.Config{SMTPAddr: "127.0.0.1:25", MailFrom: "vault@example.com"}).(*SMTPMailer); !ok {
+		t.Error("New() with SMTP_ADDR should send over SMTP")
+	}
+}
+
+func TestLogMailer_Send(t *testing.T) {
+	if err := (LogMailer{}).Send(Message{To: "user@example.com", Subject: "Hello"}); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends through an SMTP relay, upgrading to TLS when the server
+// offers STARTTLS.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for the relay at addr ("host:port"). A
+// username enables PLAIN authentication, which net/smtp only performs over
+// TLS or to localhost.
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, m.render(msg)); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+func (m *SMTPMailer) render(msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(m.from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// headerValue drops line breaks so user-supplied text such as document
+// names can't inject extra headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpServer accepts one session and returns the envelope recipient and the
+// message data through the channel.
+func smtpServer(t *testing.T) (string, <-chan [2]string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan [2]string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+
+		var rcpt, data string
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO", "MAIL":
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				rcpt = line
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 Go ahead")
+				lines, _ := tp.ReadDotLines()
+				data = strings.Join(lines, "\n")
+				tp.PrintfLine("250 Queued")
+			case "QUIT":
+				tp.PrintfLine("221 Bye")
+				received <- [2]string{rcpt, data}
+				return
+			default:
+				tp.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	addr, received := smtpServer(t)
+	m := NewSMTPMailer(addr, "", "", "vault@example.com")
+
+	err := m.Send(Message{
+		To:      "user@example.com",
+		Subject: "Shared: résumé.pdf\r\nBcc: attacker@example.com",
+		Body:    "Line one\nLine two",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := <-received
+	if !strings.Contains(got[0], "<user@example.com>") {
+		t.Errorf("RCPT = %q, want user@example.com", got[0])
+	}
+
+	data := got[1]
+	for _, want := range []string{"From: vault@example.com", "To: user@example.com", "Subject: =?utf-8?q?", "Line one\nLine two"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(data, "\nBcc:") {
+		t.Errorf("subject injected a header:\n%s", data)
+	}
+}
+
+func TestSMTPMailer_Send_Unreachable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if err := NewSMTPMailer(addr, "", "", "vault@example.com").Send(Message{To: "user@example.com"}); err == nil {
+		t.Error("Send() to a closed port should fail")
+	}
+}
@@ -0,0 +1,114 @@
+// Package metrics holds the server's Prometheus metrics and serves them on
+// /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "docvault"
+
+// Job outcomes for JobRuns.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+var (
+	// HTTPRequests and HTTPDuration are labelled by method, route pattern
+	// (such as /documents/:id) and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method, route and status.",
+		// Uploads and archives run for minutes
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 600},
+	}, []string{"method", "route", "status"})
+
+	UploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes of document content received in uploads.",
+	})
+	DownloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes of document content sent in downloads and archives.",
+	})
+
+	// LoginFailures is labelled "invalid_credentials" or "error".
+	LoginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Failed login attempts, by reason.",
+	}, []string{"reason"})
+
+	// RateLimited counts requests refused for exceeding a rate limit.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused by rate limiting, by limit group.",
+	}, []string{"group"})
+
+	// JobRuns counts passes of each background job; JobItems counts the
+	// deliveries, emails, files and so on those passes handled.
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Background job passes, by job and outcome.",
+	}, []string{"job", "outcome"})
+	JobItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_items_total",
+		Help:      "Items handled by background job passes, by job.",
+	}, []string{"job"})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration,
+		UploadedBytes, DownloadedBytes,
+		LoginFailures, RateLimited,
+		JobRuns, JobItems,
+	)
+}
+
+// RegisterDatabase exports the connection pool statistics and the stored
+// document totals. Call it once at startup.
+func RegisterDatabase(db *database.DB) {
+	registry.MustRegister(
+		collectors.NewDBStatsCollector(db.DB, "docvault"),
+		newStorageCollector(db),
+	)
+}
+
+// ObserveJob records one pass of a background job that handled n items.
+func ObserveJob(job string, n int, err error) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeError
+	}
+	JobRuns.WithLabelValues(job, outcome).Inc()
+	if n > 0 {
+		JobItems.WithLabelValues(job).Add(float64(n))
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
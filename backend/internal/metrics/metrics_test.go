@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveJob(t *testing.T) {
+	runs := func(outcome string) float64 {
+		return testutil.ToFloat64(JobRuns.WithLabelValues("test_job", outcome))
+	}
+	successes, failures := runs(OutcomeSuccess), runs(OutcomeError)
+	items := testutil.ToFloat64(JobItems.WithLabelValues("test_job"))
+
+	ObserveJob("test_job", 3, nil)
+	ObserveJob("test_job", 0, errors.New("failed"))
+
+	if got := runs(OutcomeSuccess) - successes; got != 1 {
+		t.Errorf("successful runs grew by %v, want 1", got)
+	}
+	if got := runs(OutcomeError) - failures; got != 1 {
+		t.Errorf("failed runs grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(JobItems.WithLabelValues("test_job")) - items; got != 3 {
+		t.Errorf("items grew by %v, want 3", got)
+	}
+}
+
+func TestStorageCollector(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\), COALESCE\(SUM\(size\), 0\),.+FROM documents WHERE deleted_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "bytes", "stored"}).AddRow(4, 4096, 3072))
+
+	expected := `
+# HELP docvault_documents Documents stored, excluding deleted ones.
+# TYPE docvault_documents gauge
+docvault_documents 4
+# HELP docvault_document_bytes Total size of the stored documents.
+# TYPE docvault_document_bytes gauge
+docvault_document_bytes 4096
+# HELP docvault_stored_bytes Bytes on disk after identical uploads are stored once.
+# TYPE docvault_stored_bytes gauge
+docvault_stored_bytes 3072
+`
+	collector := newStorageCollector(&database.DB{DB: sqlDB})
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStorageCollector_QueryFails(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM documents`).WillReturnError(errors.New("connection refused"))
+
+	// The scrape still succeeds, without the storage gauges
+	if n := testutil.CollectAndCount(newStorageCollector(&database.DB{DB: sqlDB})); n != 0 {
+		t.Errorf("collected %d metrics, want none", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	UploadedBytes.Add(10)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, name := range []string{"docvault_uploaded_bytes_total", "go_goroutines"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("metrics output is missing %s", name)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireEmail only lets authenticated users whose email is in the
+// comma-separated allow-list through. An empty list denies everyone.
+func RequireEmail(allowedEmails string) gin.HandlerFunc {
+	allowed := make(map[string]bool)
+	for _, e := range strings.Split(allowedEmails, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			allowed[e] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		email, ok := GetUserEmail(c)
+		if !ok || !allowed[strings.ToLower(email)] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
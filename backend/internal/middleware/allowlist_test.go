@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		allowedEmails string
+		email         string
+		expectStatus  int
+	}{
+		{"listed email", "audit@example.com", "audit@example.com", http.StatusOK},
+		{"case and spaces ignored", "other@example.com, Audit@Example.com", "audit@example.com", http.StatusOK},
+		{"unlisted email", "audit@example.com", "user@example.com", http.StatusForbidden},
+		{"empty list denies all", "", "audit@example.com", http.StatusForbidden},
+		{"unauthenticated", "audit@example.com", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.email != "" {
+					c.Set("user_email", tt.email)
+				}
+				c.Next()
+			})
+			router.Use(RequireEmail(tt.allowedEmails))
+			router.GET("/audit", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/audit", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.expectStatus)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/logging"
 )
 
 var (
@@ -99,6 +100,7 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), claims.UserID.String()))
 		c.Next()
 	}
 }
@@ -22,7 +22,9 @@ func CORS(allowedOrigins string) gin.HandlerFunc {
 		}
 
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, Range, If-None-Match, If-Range, X-Request-ID")
+		// Let browsers read the headers that make ranged, cached downloads work
+		c.Header("Access-Control-Expose-Headers", "ETag, Accept-Ranges, Content-Range, Content-Disposition, Retry-After, X-Preview-Truncated, X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Max-Age", "86400")
 
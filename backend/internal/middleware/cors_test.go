@@ -107,7 +107,8 @@ func TestCORS_Headers(t *testing.T) {
 	// Check all CORS headers are set
 	expectedHeaders := map[string]string{
 		"Access-Control-Allow-Methods":     "GET, POST, PUT, PATCH, DELETE, OPTIONS",
-		"Access-Control-Allow-Headers":     "Origin, Content-Type, Accept, Authorization",
+		"Access-Control-Allow-Headers":     "Origin, Content-Type, Accept, Authorization, Range, If-None-Match, If-Range, X-Request-ID",
+		"Access-Control-Expose-Headers":    "ETag, Accept-Ranges, Content-Range, Content-Disposition, Retry-After, X-Preview-Truncated, X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset",
 		"Access-Control-Allow-Credentials": "true",
 		"Access-Control-Max-Age":           "86400",
 	}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/logging"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits which incoming IDs are trusted, so callers can't
+// inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID tags each request with an ID, keeping the caller's X-Request-ID
+// when it is well formed and generating one otherwise. The ID is echoed in
+// the response and added to every record logged with the request's context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, id)
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		c.Request = c.Request.WithContext(logging.WithRequest(c.Request.Context(), id, route))
+		c.Next()
+	}
+}
+
+// RequestLogger logs one record per request once it has been handled: at
+// error level for 5xx responses, warn for 4xx and info otherwise. The query
+// string is left out, as it may carry tokens.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns a panicking handler into a 500 and logs the panic with its
+// stack trace.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "handler panicked",
+			"panic", recovered,
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/logging"
+)
+
+// captureLogs sends the default logger's records to a buffer for the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func loggedRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func newLoggingRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), RequestLogger(), Recovery())
+	return router
+}
+
+func TestRequestID(t *testing.T) {
+	router := newLoggingRouter()
+	var seen string
+	router.GET("/ping", func(c *gin.Context) {
+		seen = logging.RequestID(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"propagated", "abc-123.def:1", true},
+		{"unsafe characters", "abc\ninjected", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ping", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got != seen {
+				t.Errorf("response ID %q differs from the context's %q", got, seen)
+			}
+			if tt.keep && got != tt.incoming {
+				t.Errorf("%s = %q, want the caller's %q", RequestIDHeader, got, tt.incoming)
+			}
+			if !tt.keep {
+				if _, err := uuid.Parse(got); err != nil {
+					t.Errorf("%s = %q, want a generated UUID", RequestIDHeader, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	buf := captureLogs(t)
+	router := newLoggingRouter()
+	auth := NewAuthMiddleware("test-secret")
+	userID := uuid.New()
+	router.GET("/documents/:id", auth.Authenticate(), func(c *gin.Context) {
+		c.String(http.StatusNotFound, "missing")
+	})
+
+	token, err := auth.GenerateToken(userID, "alice@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	req := httptest.NewRequest("GET", "/documents/42?token=secret", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(RequestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := loggedRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("logged %d records, want 1: %s", len(records), buf.String())
+	}
+	record := records[0]
+	want := map[string]any{
+		"level":      "WARN",
+		"msg":        "request",
+		"method":     "GET",
+		"route":      "/documents/:id",
+		"path":       "/documents/42",
+		"status":     float64(http.StatusNotFound),
+		"bytes":      float64(len("missing")),
+		"request_id": "req-1",
+		"user_id":    userID.String(),
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), token) {
+		t.Errorf("request log leaks credentials: %s", buf.String())
+	}
+}
+
+func TestRequestLogger_Levels(t *testing.T) {
+	buf := captureLogs(t)
+	router := newLoggingRouter()
+	router.GET("/status/:code", func(c *gin.Context) {
+		switch c.Param("code") {
+		case "500":
+			c.Status(http.StatusInternalServerError)
+		default:
+			c.Status(http.StatusOK)
+		}
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status/200", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status/500", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nowhere", nil))
+
+	records := loggedRecords(t, buf)
+	if len(records) != 3 {
+		t.Fatalf("logged %d records, want 3: %s", len(records), buf.String())
+	}
+	for i, want := range []string{"INFO", "ERROR", "WARN"} {
+		if records[i]["level"] != want {
+			t.Errorf("record %d level = %v, want %s", i, records[i]["level"], want)
+		}
+	}
+	if records[2]["route"] != unmatchedRoute {
+		t.Errorf("unmatched route = %v, want %q", records[2]["route"], unmatchedRoute)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	buf := captureLogs(t)
+	router := newLoggingRouter()
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	records := loggedRecords(t, buf)
+	if len(records) != 2 || records[0]["msg"] != "handler panicked" || records[0]["panic"] != "boom" {
+		t.Fatalf("records = %v, want the panic then the request", records)
+	}
+	if stack, _ := records[0]["stack"].(string); !strings.Contains(stack, "TestRecovery") {
+		t.Errorf("panic record has no stack trace: %v", records[0])
+	}
+	if records[0]["request_id"] == nil || records[0]["request_id"] != records[1]["request_id"] {
+		t.Errorf("panic and request records don't share a request ID: %v", records)
+	}
+}
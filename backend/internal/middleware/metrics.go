@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+)
+
+// unmatchedRoute labels requests for paths with no route, so probes for
+// random URLs all land in one series.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts requests and times them by method, route pattern and
+// status.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
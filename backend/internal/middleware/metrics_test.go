@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_LabelsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/documents/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	count := func(route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", route, status))
+	}
+	matched, unmatched := count("/documents/:id", "204"), count(unmatchedRoute, "404")
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/documents/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/documents/2", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-admin", nil))
+
+	if got := count("/documents/:id", "204") - matched; got != 2 {
+		t.Errorf("requests to /documents/:id grew by %v, want 2", got)
+	}
+	if got := count(unmatchedRoute, "404") - unmatched; got != 1 {
+		t.Errorf("unmatched requests grew by %v, want 1", got)
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/ratelimit"
+)
+
+// RateLimit throttles each client of a route group to limit, using a token
+// bucket per group and client from store. Authenticated requests are keyed
+// by user ID, so it belongs after Authenticate; others by client IP, which
+// is only taken from X-Forwarded-For when the router trusts the proxy.
+//
+// Every response carries the bucket's X-RateLimit-Limit, -Remaining and
+// -Reset (seconds until full) headers; a refused request gets 429 with
+// Retry-After. If the store fails the request is let through, as an outage
+// of the limiter shouldn't take the API down with it.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit.Unlimited() {
+			c.Next()
+			return
+		}
+
+		key := group + ":ip:" + c.ClientIP()
+		if userID, ok := GetUserID(c); ok {
+			key = group + ":user:" + userID.String()
+		}
+
+		result, err := store.Take(c.Request.Context(), key, limit)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limit check failed", "group", group, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", ceilSeconds(result.Reset))
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(group).Inc()
+			c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error:   "rate_limited",
+				Message: "Too many requests; retry after the number of seconds in Retry-After",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
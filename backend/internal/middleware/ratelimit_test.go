@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/ratelimit"
+)
+
+// failingStore is a rate limit store whose database is down.
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func newRateLimitRouter(store ratelimit.Store, limit ratelimit.Limit, userID *uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if userID != nil {
+		router.Use(func(c *gin.Context) {
+			c.Set("user_id", *userID)
+		})
+	}
+	router.Use(RateLimit(store, "api", limit))
+	router.GET("/documents", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func get(router *gin.Engine, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/documents", nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_ByIP(t *testing.T) {
+	router := newRateLimitRouter(ratelimit.NewMemoryStore(), ratelimit.Limit{Requests: 2, Period: time.Minute}, nil)
+
+	w := get(router, "10.0.0.1:1234")
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", w.Code)
+	}
+	if w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != "1" || w.Header().Get("X-RateLimit-Reset") != "30" {
+		t.Errorf("headers = %v, want limit 2, 1 remaining, full in 30s", w.Header())
+	}
+
+	get(router, "10.0.0.1:1234")
+	w = get(router, "10.0.0.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("headers = %v, want Retry-After 30 and none remaining", w.Header())
+	}
+
+	if w := get(router, "10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("request from another IP = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimit_ByUser(t *testing.T) {
+	userID := uuid.New()
+	router := newRateLimitRouter(ratelimit.NewMemoryStore(), ratelimit.Limit{Requests: 1, Period: time.Minute}, &userID)
+
+	if w := get(router, "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", w.Code)
+	}
+	// Changing address doesn't get a user a fresh bucket
+	if w := get(router, "10.0.0.2:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second request from another IP = %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimit_Unlimited(t *testing.T) {
+	router := newRateLimitRouter(failingStore{}, ratelimit.Limit{}, nil)
+
+	w := get(router, "10.0.0.1:1234")
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("unlimited request = %d %v, want 200 without rate limit headers", w.Code, w.Header())
+	}
+}
+
+func TestRateLimit_StoreFailureLetsRequestsThrough(t *testing.T) {
+	router := newRateLimitRouter(failingStore{}, ratelimit.Limit{Requests: 1, Period: time.Minute}, nil)
+
+	for i := 0; i < 3; i++ {
+		if w := get(router, "10.0.0.1:1234"); w.Code != http.StatusOK {
+			t.Fatalf("request %d with the store down = %d, want 200", i, w.Code)
+		}
+	}
+}
+
+func TestRateLimit_SpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// As configured with TRUSTED_PROXIES=10.0.0.1
+	if err := router.SetTrustedProxies([]string{"10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	router.Use(RateLimit(ratelimit.NewMemoryStore(), "auth", ratelimit.Limit{Requests: 1, Period: time.Minute}))
+	router.POST("/auth/login", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	login := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/auth/login", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A client connecting directly can't pick a fresh bucket per request
+	if code := login("198.51.100.7:1234", "203.0.113.1"); code != http.StatusOK {
+		t.Fatalf("first login = %d, want 200", code)
+	}
+	if code := login("198.51.100.7:1234", "203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Errorf("login with a new spoofed X-Forwarded-For = %d, want 429", code)
+	}
+
+	// Behind the trusted proxy, each forwarded client has its own bucket
+	if code := login("10.0.0.1:1234", "203.0.113.3"); code != http.StatusOK {
+		t.Errorf("login through the proxy = %d, want 200", code)
+	}
+	if code := login("10.0.0.1:1234", "203.0.113.3"); code != http.StatusTooManyRequests {
+		t.Errorf("second login through the proxy = %d, want 429", code)
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutBody replaces the error a handler writes once its deadline passed
+var timeoutBody = []byte(`{"error":"timeout","message":"The request took too long and was cancelled"}`)
+
+// Timeout gives each request a deadline on its context, which the services
+// pass to every SQL call. Routes are looked up by method and pattern, such
+// as "GET /documents/:id"; the others get fallback. A timeout of zero or
+// less means no deadline, for streams and other long-lived requests.
+//
+// A handler that fails because the deadline passed answers 503 with a
+// timeout error instead of its own 5xx.
+func Timeout(fallback time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := routes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			timeout = fallback
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+
+		c.Next()
+	}
+}
+
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+	replaced bool
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+		code = http.StatusServiceUnavailable
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if !w.timedOut {
+		return w.ResponseWriter.Write(data)
+	}
+	// The handler's body describes some other failure; send ours once
+	if !w.replaced {
+		w.replaced = true
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := w.ResponseWriter.Write(timeoutBody); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeout_SetsRouteDeadlines(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Timeout(time.Minute, map[string]time.Duration{
+		"GET /documents/:id/download": time.Hour,
+		"GET /events":                 0,
+	}))
+
+	var remaining time.Duration
+	var hasDeadline bool
+	record := func(c *gin.Context) {
+		var deadline time.Time
+		deadline, hasDeadline = c.Request.Context().Deadline()
+		remaining = time.Until(deadline)
+		c.Status(http.StatusOK)
+	}
+	router.GET("/documents/:id", record)
+	router.GET("/documents/:id/download", record)
+	router.GET("/events", record)
+
+	tests := []struct {
+		path         string
+		wantDeadline bool
+		wantAbout    time.Duration
+	}{
+		{"/documents/1", true, time.Minute},
+		{"/documents/1/download", true, time.Hour},
+		{"/events", false, 0},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		if hasDeadline != tt.wantDeadline {
+			t.Errorf("%s has deadline = %v, want %v", tt.path, hasDeadline, tt.wantDeadline)
+		}
+		if tt.wantDeadline && (remaining > tt.wantAbout || remaining < tt.wantAbout-time.Second) {
+			t.Errorf("%s deadline in %v, want about %v", tt.path, remaining, tt.wantAbout)
+		}
+	}
+}
+
+func TestTimeout_ReplacesErrorsAfterDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Timeout(10*time.Millisecond, nil))
+	router.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	})
+	router.GET("/broken", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"error":"timeout"`) {
+		t.Errorf("timed out request = %d %s, want 503 with a timeout error", w.Code, w.Body.String())
+	}
+
+	// Failures before the deadline are left alone
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/broken", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "internal_error") {
+		t.Errorf("failed request = %d %s, want the handler's 500", w.Code, w.Body.String())
+	}
+}
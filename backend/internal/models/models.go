@@ -26,6 +26,8 @@ type Document struct {
 	EncryptionAlgo string     `json:"encryption_algo"`
 	FilePath       string     `json:"-"` // Internal path, not exposed
 	IsEncrypted    bool       `json:"is_encrypted"`
+	SHA256         string     `json:"sha256,omitempty"` // Hex digest of the content; empty for old uploads until first download
+	FolderID       *uuid.UUID `json:"folder_id"`        // nil when the document sits at the root
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
@@ -41,6 +43,68 @@ type DocumentShare struct {
 	CreatedAt    time.Time  `json:"created_at"`
 }
 
+type Folder struct {
+	ID        uuid.UUID  `json:"id"`
+	OwnerID   uuid.UUID  `json:"owner_id"`
+	ParentID  *uuid.UUID `json:"parent_id"` // nil for top-level folders
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type FolderShare struct {
+	ID           uuid.UUID  `json:"id"`
+	FolderID     uuid.UUID  `json:"folder_id"`
+	SharedByID   uuid.UUID  `json:"shared_by_id"`
+	SharedWithID uuid.UUID  `json:"shared_with_id"`
+	Permission   string     `json:"permission"` // "view" or "edit", inherited by everything inside
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// MetadataField is a typed key/value pair attached to a document. Values are
+// stored in a normalised text form so they can be compared when filtering.
+type MetadataField struct {
+	Key       string    `json:"key" binding:"required,max=64"`
+	Type      string    `json:"type" binding:"required,oneof=string number date boolean"`
+	Value     string    `json:"value" binding:"required,max=1000"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DocumentFilter narrows an owner's document listing. Zero values mean "no
+// constraint".
+type DocumentFilter struct {
+	FolderID      *uuid.UUID        // Only documents inside this folder
+	InRoot        bool              // Only documents outside any folder (ignored when FolderID is set)
+	Tags          []string          // Documents must carry every tag
+	Metadata      map[string]string // Documents must have each key set to the given value
+	MimeType      string            // Exact MIME type, or a "type/*" wildcard
+	MinSize       *int64            // Size in bytes, inclusive
+	MaxSize       *int64            // Size in bytes, inclusive
+	CreatedAfter  *time.Time        // Created at or after this time
+	CreatedBefore *time.Time        // Created strictly before this time
+	NamePrefix    string            // Case-insensitive prefix of the document name
+}
+
+// ListOptions controls the order and paging of a document listing. A
+// non-empty Cursor switches from offset to keyset paging and Page is ignored.
+type ListOptions struct {
+	Sort    string // created_at, updated_at, name or size; shared listings also accept shared_at
+	Order   string // asc or desc
+	Page    int
+	PerPage int
+	Cursor  string
+}
+
+// PageInfo describes the page a listing returned. NextCursor is empty on the
+// last page.
+type PageInfo struct {
+	Total      int
+	Page       int
+	PerPage    int
+	NextCursor string
+}
+
 // Request/Response DTOs
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -65,10 +129,21 @@ type ShareRequest struct {
 
 type DocumentResponse struct {
 	Document
-	OwnerName  string `json:"owner_name,omitempty"`
+	OwnerName  string           `json:"owner_name,omitempty"`
 	SharedWith []SharedUserInfo `json:"shared_with,omitempty"`
 }
 
+// SearchResult is a document matching a full-text query. NameHighlight and
+// Snippet are HTML-escaped with matches wrapped in <mark> tags.
+type SearchResult struct {
+	Document
+	OwnerName     string  `json:"owner_name"`
+	Permission    string  `json:"permission"`
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
 type SharedUserInfo struct {
 	Email      string `json:"email"`
 	Name       string `json:"name"`
@@ -86,4 +161,269 @@ type PaginatedResponse struct {
 	Page       int         `json:"page"`
 	PerPage    int         `json:"per_page"`
 	TotalPages int         `json:"total_pages"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type DocumentTransfer struct {
+	ID           uuid.UUID  `json:"id"`
+	DocumentID   uuid.UUID  `json:"document_id"`
+	FromUserID   uuid.UUID  `json:"from_user_id"`
+	ToUserID     uuid.UUID  `json:"to_user_id"`
+	KeepAccess   bool       `json:"keep_access"` // Previous owner keeps "edit" access after acceptance
+	Status       string     `json:"status"`      // "pending", "accepted", "declined" or "cancelled"
+	CreatedAt    time.Time  `json:"created_at"`
+	RespondedAt  *time.Time `json:"responded_at,omitempty"`
+	DocumentName string     `json:"document_name,omitempty"`
+	FromUserName string     `json:"from_user_name,omitempty"`
+}
+
+type TransferRequest struct {
+	Email      string `json:"email" binding:"required,email"`
+	KeepAccess bool   `json:"keep_access"`
+}
+
+type CreateFolderRequest struct {
+	Name     string     `json:"name" binding:"required,min=1"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type MoveFolderRequest struct {
+	ParentID *uuid.UUID `json:"parent_id"` // null moves the folder to the root
+}
+
+type MoveDocumentRequest struct {
+	FolderID *uuid.UUID `json:"folder_id"` // null moves the document to the root
+}
+
+type FolderContents struct {
+	Folder
+	Permission string     `json:"permission"`
+	Folders    []Folder   `json:"folders"`
+	Documents  []Document `json:"documents"`
+}
+
+type TagsRequest struct {
+	Tags []string `json:"tags" binding:"max=50"`
+}
+
+// BatchRequest selects the documents a bulk operation applies to.
+type BatchRequest struct {
+	IDs []uuid.UUID `json:"ids" binding:"required,min=1,max=100"`
+}
+
+type BatchMoveRequest struct {
+	IDs      []uuid.UUID `json:"ids" binding:"required,min=1,max=100"`
+	FolderID *uuid.UUID  `json:"folder_id"` // null moves the documents to the root
+}
+
+type BatchShareRequest struct {
+	IDs        []uuid.UUID `json:"ids" binding:"required,min=1,max=100"`
+	Email      string      `json:"email" binding:"required,email"`
+	Permission string      `json:"permission" binding:"required,oneof=view edit"`
+}
+
+// BatchTagsRequest adds and removes tags on every selected document, leaving
+// their other tags alone.
+type BatchTagsRequest struct {
+	IDs    []uuid.UUID `json:"ids" binding:"required,min=1,max=100"`
+	Add    []string    `json:"add" binding:"max=50"`
+	Remove []string    `json:"remove" binding:"max=50"`
+}
+
+// BatchResult is the outcome of a bulk operation for one document or, for
+// uploads, one file. Status is the HTTP status the single-item endpoint
+// would have returned.
+type BatchResult struct {
+	ID       *uuid.UUID `json:"id,omitempty"`
+	Filename string     `json:"filename,omitempty"`
+	Status   int        `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Document *Document  `json:"document,omitempty"`
+	Tags     []string   `json:"tags,omitempty"`
+}
+
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
+
+type TagSuggestion struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type MetadataRequest struct {
+	Fields []MetadataField `json:"fields" binding:"required,min=1,max=50,dive"`
+}
+
+// AuditEntry is one link of the hash-chained audit log. Hash covers every
+// other field plus PrevHash, the hash of the entry before it.
+type AuditEntry struct {
+	Seq        int64             `json:"seq"`
+	ID         uuid.UUID         `json:"id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Action     string            `json:"action"`
+	Outcome    string            `json:"outcome"`
+	ActorID    *uuid.UUID        `json:"actor_id,omitempty"`
+	ActorEmail string            `json:"actor_email,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   *uuid.UUID        `json:"target_id,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+type AuditFilter struct {
+	ActorID  *uuid.UUID
+	Action   string // Exact action, or a "family.*" wildcard
+	Outcome  string
+	TargetID *uuid.UUID
+	Since    *time.Time // Inclusive
+	Until    *time.Time // Exclusive
+}
+
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	HeadHash string `json:"head_hash"`
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
+
+// Webhook is a subscription to document events. Owner webhooks receive events
+// for the owner's documents; global ones, registered by an admin, receive all.
+type Webhook struct {
+	ID         uuid.UUID `json:"id"`
+	OwnerID    uuid.UUID `json:"owner_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // Only returned when the webhook is created
+	EventTypes []string  `json:"event_types"`      // Empty means every event
+	IsGlobal   bool      `json:"is_global"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types"`
+}
+
+// WebhookEvent is the JSON body POSTed to subscribers.
+type WebhookEvent struct {
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	DocumentID uuid.UUID              `json:"document_id"`
+	ActorID    uuid.UUID              `json:"actor_id"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	WebhookID      uuid.UUID  `json:"webhook_id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"` // "pending", "delivered" or "dead"
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// UserEvent is a live notification pushed to a user's /events stream.
+type UserEvent struct {
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	ActorID    uuid.UUID              `json:"actor_id"`
+	DocumentID *uuid.UUID             `json:"document_id,omitempty"`
+	FolderID   *uuid.UUID             `json:"folder_id,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// Comment is a remark on a document. Top-level comments start a thread and
+// may be anchored to a page or version; replies carry the thread's ParentID.
+type Comment struct {
+	ID         uuid.UUID  `json:"id"`
+	DocumentID uuid.UUID  `json:"document_id"`
+	ParentID   *uuid.UUID `json:"parent_id,omitempty"`
+	AuthorID   uuid.UUID  `json:"author_id"`
+	AuthorName string     `json:"author_name"`
+	Body       string     `json:"body"`
+	Page       *int       `json:"page,omitempty"`
+	Version    *int       `json:"version,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"` // Only set on top-level comments
+	ResolvedBy *uuid.UUID `json:"resolved_by,omitempty"`
+	Deleted    bool       `json:"deleted,omitempty"` // Kept with an empty body because it has replies
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Replies    []Comment  `json:"replies,omitempty"`
+}
+
+type CommentRequest struct {
+	Body     string     `json:"body" binding:"required,max=10000"`
+	ParentID *uuid.UUID `json:"parent_id"` // Reply to this top-level comment
+	Page     *int       `json:"page" binding:"omitempty,min=1"`
+	Version  *int       `json:"version" binding:"omitempty,min=1"`
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
+
+// Notification is an entry in a user's inbox. Data carries display details,
+// such as the document name, captured when the notification was created.
+type Notification struct {
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	ActorID    *uuid.UUID             `json:"actor_id,omitempty"`
+	ActorName  string                 `json:"actor_name,omitempty"`
+	DocumentID *uuid.UUID             `json:"document_id,omitempty"`
+	FolderID   *uuid.UUID             `json:"folder_id,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	ReadAt     *time.Time             `json:"read_at,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type NotificationList struct {
+	PaginatedResponse
+	UnreadCount int `json:"unread_count"`
+}
+
+// NotificationPreference says whether a notification type is also emailed.
+type NotificationPreference struct {
+	Type  string `json:"type" binding:"required"`
+	Email bool   `json:"email"`
+}
+
+type NotificationPreferencesRequest struct {
+	Preferences []NotificationPreference `json:"preferences" binding:"required,min=1,dive"`
+}
+
+// DocumentPreview is a generated thumbnail or text preview, served as-is
+// rather than as JSON.
+type DocumentPreview struct {
+	ContentType string
+	Data        []byte
+	Truncated   bool // Text previews only: the file continues past Data
+	GeneratedAt time.Time
+}
+
+// Readiness is the /readyz report: Status is "ready" only if every check
+// passed.
+type Readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of one readiness check. Details carries
+// figures such as free disk space or pending migrations.
+type CheckResult struct {
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs float64                `json:"duration_ms"`
+	Details    map[string]interface{} `json:"details,omitempty"`
 }
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often idle buckets are dropped.
+const memorySweepInterval = time.Minute
+
+// MemoryStore keeps buckets in this process, so each replica enforces its
+// own limits. Use PostgresStore to share them.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// full is when the bucket will have refilled, after which it is no
+	// different from a missing one
+	full time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket), now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		s.sweep(now)
+	}
+
+	tokens := float64(limit.Requests)
+	if b, ok := s.buckets[key]; ok {
+		tokens = min(tokens, b.tokens+now.Sub(b.updatedAt).Seconds()*limit.perSecond())
+	}
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	result := newResult(limit, tokens, allowed)
+	s.buckets[key] = &memoryBucket{tokens: tokens, updatedAt: now, full: now.Add(result.Reset)}
+	return result, nil
+}
+
+// sweep drops the buckets that have refilled.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
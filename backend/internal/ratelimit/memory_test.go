@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestMemoryStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store, now := newTestMemoryStore()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take(ctx, "user", limit)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if !result.Allowed || result.Remaining != i || result.Limit != 3 {
+			t.Errorf("Take() = %+v, want allowed with %d remaining", result, i)
+		}
+	}
+
+	result, _ := store.Take(ctx, "user", limit)
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("Take() on an empty bucket = %+v, want refused", result)
+	}
+	if result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Errorf("Take() = %+v, want a token in 1s and full in 3s", result)
+	}
+
+	// Other keys have their own buckets
+	if result, _ := store.Take(ctx, "other", limit); !result.Allowed {
+		t.Errorf("Take() for another key = %+v, want allowed", result)
+	}
+
+	*now = now.Add(time.Second)
+	if result, _ := store.Take(ctx, "user", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Take() after refilling one token = %+v, want allowed with none left", result)
+	}
+
+	// Refilling stops at the limit
+	*now = now.Add(time.Hour)
+	if result, _ := store.Take(ctx, "user", limit); result.Remaining != 2 {
+		t.Errorf("Take() after a long idle = %+v, want 2 remaining", result)
+	}
+}
+
+func TestMemoryStore_SweepsRefilledBuckets(t *testing.T) {
+	store, now := newTestMemoryStore()
+	limit := Limit{Requests: 10, Period: time.Minute}
+	ctx := context.Background()
+
+	store.Take(ctx, "idle", limit)
+	*now = now.Add(2 * time.Minute)
+	store.Take(ctx, "busy", limit)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("refilled bucket was kept")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("bucket in use was dropped")
+	}
+}
+
+func TestLimit_Unlimited(t *testing.T) {
+	tests := map[Limit]bool{
+		{Requests: 10, Period: time.Minute}: false,
+		{Requests: 0, Period: time.Minute}:  true,
+		{Requests: 10}:                      true,
+	}
+	for limit, want := range tests {
+		if got := limit.Unlimited(); got != want {
+			t.Errorf("%+v.Unlimited() = %v, want %v", limit, got, want)
+		}
+	}
+}
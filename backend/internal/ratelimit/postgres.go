@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+)
+
+const (
+	prunePollInterval = 10 * time.Minute
+	// pruneIdle is how long a bucket is kept after its last request. It
+	// must exceed the longest configured period, or pruning would refill
+	// buckets early.
+	pruneIdle = 24 * time.Hour
+)
+
+// PostgresStore keeps buckets in the rate_limits table, so every replica
+// enforces the same limits. Each request is one upsert, which locks the
+// bucket's row while it refills and spends it.
+type PostgresStore struct {
+	db *database.DB
+}
+
+func NewPostgresStore(db *database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// A new bucket starts full, less this request. An existing one refills
+	// for the time since its last request, using the database clock so
+	// replicas agree, and is spent if it has a whole token.
+	var tokens float64
+	var allowed bool
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO rate_limits (key, tokens, allowed, updated_at)
+		 VALUES ($1, $2::float8 - 1, true, NOW())
+		 ON CONFLICT (key) DO UPDATE SET (tokens, allowed, updated_at) = (
+			SELECT CASE WHEN refilled >= 1 THEN refilled - 1 ELSE refilled END, refilled >= 1, NOW()
+			FROM (SELECT LEAST($2::float8,
+				rate_limits.tokens + GREATEST(EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at)::float8, 0) * $3::float8
+			) AS refilled) AS bucket
+		 )
+		 RETURNING tokens, allowed`,
+		key, limit.Requests, limit.perSecond(),
+	).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, tokens, allowed), nil
+}
+
+// Run prunes idle buckets until ctx is cancelled.
+func (s *PostgresStore) Run(ctx context.Context) {
+	for {
+		pruned, err := s.Prune(ctx)
+		metrics.ObserveJob("rate_limit_prune", int(pruned), err)
+		if err != nil {
+			slog.ErrorContext(ctx, "rate limit pruning failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(prunePollInterval):
+		}
+	}
+}
+
+// Prune deletes the buckets unused for a day, which have long since
+// refilled, and returns how many it deleted.
+func (s *PostgresStore) Prune(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE updated_at < $1`, time.Now().Add(-pruneIdle))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/katim/secure-doc-vault/internal/database"
+)
+
+func newMockDB(t *testing.T) (*database.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &database.DB{DB: db}, mock
+}
+
+func TestPostgresStore_Take(t *testing.T) {
+	db, mock := newMockDB(t)
+	store := NewPostgresStore(db)
+	limit := Limit{Requests: 60, Period: time.Minute}
+
+	mock.ExpectQuery(`INSERT INTO rate_limits`).
+		WithArgs("api:user:1", 60, 1.0).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "allowed"}).AddRow(0.25, false))
+
+	result, err := store.Take(context.Background(), "api:user:1", limit)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	want := Result{Allowed: false, Limit: 60, Remaining: 0, RetryAfter: 750 * time.Millisecond, Reset: 59750 * time.Millisecond}
+	if result != want {
+		t.Errorf("Take() = %+v, want %+v", result, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_Take_Error(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`INSERT INTO rate_limits`).WillReturnError(errors.New("connection refused"))
+
+	if _, err := NewPostgresStore(db).Take(context.Background(), "key", Limit{Requests: 1, Period: time.Second}); err == nil {
+		t.Error("Take() error = nil, want the query error")
+	}
+}
+
+func TestPostgresStore_Prune(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectExec(`DELETE FROM rate_limits WHERE updated_at < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	pruned, err := NewPostgresStore(db).Prune(context.Background())
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if pruned != 4 {
+		t.Errorf("Prune() = %d, want 4", pruned)
+	}
+}
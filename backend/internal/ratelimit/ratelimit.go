@@ -0,0 +1,68 @@
+// Package ratelimit implements token buckets for throttling clients. Each
+// bucket holds up to Limit.Requests tokens and refills at Requests per
+// Period; a request takes one token and is refused when none is left.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Requests per Period, all of which may arrive at once. A
+// Limit with no Requests or Period is unlimited.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Unlimited reports whether the limit lets everything through.
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// perSecond is the refill rate in tokens per second.
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Limit is the bucket's capacity and Remaining the whole tokens left.
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a token is available again, zero when
+	// one already is, and Reset how long until the bucket is full.
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Store holds the buckets.
+type Store interface {
+	// Take spends a token from key's bucket if one is available. A bucket
+	// that doesn't exist yet starts full.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult describes a bucket left with tokens after a request.
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.perSecond()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Max(math.Floor(tokens), 0)),
+		Reset:     seconds((float64(limit.Requests) - tokens) / rate),
+	}
+	if tokens < 1 {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
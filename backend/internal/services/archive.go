@@ -0,0 +1,69 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/pkg/utils"
+)
+
+// WriteArchive streams a ZIP of the documents' files to w. Each file is
+// copied straight from disk into the archive, so nothing is staged in
+// memory or on disk however large the selection.
+func WriteArchive(w io.Writer, docs []*models.Document) error {
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+
+	for _, doc := range docs {
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     archiveEntryName(doc, used),
+			Method:   zip.Deflate,
+			Modified: doc.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(doc.FilePath)
+		if err != nil {
+			return fmt.Errorf("document %s: %w", doc.ID, err)
+		}
+		_, err = io.Copy(entry, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("document %s: %w", doc.ID, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// archiveEntryName names a document's entry after the document, keeping the
+// uploaded file's extension and numbering repeats as "name (2).ext".
+// Renames accept any string, so directories are stripped from the name to
+// keep every entry at the top of the archive; a name with nothing left is
+// replaced by the document's ID.
+func archiveEntryName(doc *models.Document, used map[string]bool) string {
+	name := doc.Name
+	if filepath.Ext(name) == "" {
+		name += filepath.Ext(doc.OriginalName)
+	}
+	name, err := utils.SanitizeFilename(strings.ReplaceAll(name, `\`, "/"))
+	if err != nil {
+		name = doc.ID.String()
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
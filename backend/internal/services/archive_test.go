@@ -0,0 +1,101 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0600)
+		return path
+	}
+
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	docs := []*models.Document{
+		{ID: uuid.New(), Name: "Report", OriginalName: "report.pdf", FilePath: write("a", "first"), UpdatedAt: modified},
+		{ID: uuid.New(), Name: "report.pdf", OriginalName: "other.pdf", FilePath: write("b", "second"), UpdatedAt: modified},
+		{ID: uuid.New(), Name: "notes.txt", OriginalName: "notes.txt", FilePath: write("c", "third"), UpdatedAt: modified},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, docs); err != nil {
+		t.Fatalf("WriteArchive() error = %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("archive doesn't open: %v", err)
+	}
+
+	want := []struct{ name, content string }{
+		{"Report.pdf", "first"},
+		{"report (2).pdf", "second"},
+		{"notes.txt", "third"},
+	}
+	if len(archive.File) != len(want) {
+		t.Fatalf("archive has %d entries, want %d", len(archive.File), len(want))
+	}
+	for i, f := range archive.File {
+		r, _ := f.Open()
+		content, _ := io.ReadAll(r)
+		r.Close()
+		if f.Name != want[i].name || string(content) != want[i].content {
+			t.Errorf("entry %d = %q with %q, want %q with %q", i, f.Name, content, want[i].name, want[i].content)
+		}
+		if !f.Modified.Equal(modified) {
+			t.Errorf("entry %d modified = %v, want %v", i, f.Modified, modified)
+		}
+	}
+}
+
+func TestWriteArchive_TraversalNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a")
+	os.WriteFile(path, []byte("content"), 0600)
+
+	dotsID := uuid.New()
+	docs := []*models.Document{
+		{ID: uuid.New(), Name: "../../.bashrc", OriginalName: "notes.txt", FilePath: path},
+		{ID: uuid.New(), Name: `..\..\evil.txt`, OriginalName: "evil.txt", FilePath: path},
+		{ID: uuid.New(), Name: "/etc/passwd", OriginalName: "passwd.txt", FilePath: path},
+		{ID: dotsID, Name: "..", FilePath: path},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, docs); err != nil {
+		t.Fatalf("WriteArchive() error = %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("archive doesn't open: %v", err)
+	}
+
+	want := []string{".bashrc", "evil.txt", "passwd.txt", dotsID.String()}
+	if len(archive.File) != len(want) {
+		t.Fatalf("archive has %d entries, want %d", len(archive.File), len(want))
+	}
+	for i, f := range archive.File {
+		if f.Name != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, f.Name, want[i])
+		}
+	}
+}
+
+func TestWriteArchive_MissingFile(t *testing.T) {
+	docs := []*models.Document{{ID: uuid.New(), Name: "gone.txt", FilePath: filepath.Join(t.TempDir(), "gone")}}
+
+	if err := WriteArchive(io.Discard, docs); err == nil {
+		t.Error("WriteArchive() = nil for a missing file")
+	}
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+)
+
+// Audit actions
+const (
+	AuditRegister         = "auth.register"
+	AuditLogin            = "auth.login"
+	AuditDocumentUpload   = "document.upload"
+	AuditDocumentDownload = "document.download"
+	AuditDocumentRename   = "document.rename"
+	AuditDocumentMove     = "document.move"
+	AuditDocumentShare    = "document.share"
+	AuditDocumentUnshare  = "document.unshare"
+	AuditDocumentDelete   = "document.delete"
+	AuditFileDeleteFailed = "document.file_delete_failed"
+	AuditIntegrityFailed  = "document.integrity_failed"
+	AuditTransferOffer    = "transfer.offer"
+	AuditTransferAccept   = "transfer.accept"
+	AuditTransferDecline  = "transfer.decline"
+	AuditTransferCancel   = "transfer.cancel"
+	AuditFolderShare      = "folder.share"
+	AuditFolderUnshare    = "folder.unshare"
+	AuditFolderDelete     = "folder.delete"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// auditGenesisHash is the previous hash of the first entry in the chain.
+var auditGenesisHash = strings.Repeat("0", 64)
+
+// auditChainLock is the advisory lock key serializing appends, so every entry
+// links to the one committed immediately before it.
+const auditChainLock = 0x617564697400 // "audit"
+
+const auditColumns = `seq, id, occurred_at, action, outcome, actor_id, actor_email, ip, user_agent, target_type, target_id, details, prev_hash, hash`
+
+type AuditService struct {
+	db *database.DB
+}
+
+func NewAuditService(db *database.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record appends an entry to the audit log, linking it to the previous entry
+// by hash. ID, OccurredAt, Seq and the hashes are filled in on entry.
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditEntry) error {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	entry.ID = uuid.New()
+	// Postgres keeps microseconds; truncating up front keeps the hash stable
+	// across a round trip through the database
+	entry.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+	if entry.Outcome == "" {
+		entry.Outcome = AuditSuccess
+	}
+	if len(entry.Details) == 0 {
+		entry.Details = nil
+	}
+
+	var details interface{}
+	if entry.Details != nil {
+		data, err := json.Marshal(entry.Details)
+		if err != nil {
+			return err
+		}
+		details = string(data)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY seq DESC LIMIT 1`).Scan(&entry.PrevHash)
+	if err == sql.ErrNoRows {
+		entry.PrevHash = auditGenesisHash
+	} else if err != nil {
+		return err
+	}
+	entry.Hash = hashAuditEntry(entry)
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO audit_log (id, occurred_at, action, outcome, actor_id, actor_email, ip, user_agent, target_type, target_id, details, prev_hash, hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		 RETURNING seq`,
+		entry.ID, entry.OccurredAt, entry.Action, entry.Outcome, entry.ActorID, entry.ActorEmail,
+		entry.IP, entry.UserAgent, entry.TargetType, entry.TargetID, details, entry.PrevHash, entry.Hash,
+	).Scan(&entry.Seq)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListForDocument returns a page of the document's audit trail, newest first.
+// Only the current owner may read it, including after deletion.
+func (s *AuditService) ListForDocument(ctx context.Context, documentID, userID uuid.UUID, page, perPage int) ([]models.AuditEntry, int, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ListForDocument")
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	offset := (page - 1) * perPage
+
+	var ownerID uuid.UUID
+	err := s.db.QueryRowContext(ctx, `SELECT owner_id FROM documents WHERE id = $1`, documentID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if ownerID != userID {
+		return nil, 0, ErrAccessDenied
+	}
+
+	var total int
+	err = s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM audit_log WHERE target_type = 'document' AND target_id = $1`,
+		documentID,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+auditColumns+` FROM audit_log
+		 WHERE target_type = 'document' AND target_id = $1
+		 ORDER BY seq DESC LIMIT $2 OFFSET $3`,
+		documentID, perPage, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// Export streams the entries matching the filter to fn in chain order.
+func (s *AuditService) Export(ctx context.Context, filter models.AuditFilter, fn func(*models.AuditEntry) error) error {
+	ctx, span := tracing.Start(ctx, "AuditService.Export")
+	defer span.End()
+
+	q := &documentQuery{}
+	if filter.ActorID != nil {
+		q.where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		// A trailing ".*" selects a whole family, e.g. "document.*"
+		if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+			q.where(`action LIKE ? ESCAPE '\'`, escapeLike(prefix)+"%")
+		} else {
+			q.where("action = ?", filter.Action)
+		}
+	}
+	if filter.Outcome != "" {
+		q.where("outcome = ?", filter.Outcome)
+	}
+	if filter.TargetID != nil {
+		q.where("target_id = ?", *filter.TargetID)
+	}
+	if filter.Since != nil {
+		q.where("occurred_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		q.where("occurred_at < ?", *filter.Until)
+	}
+
+	where := ""
+	if len(q.conditions) > 0 {
+		where = "WHERE " + q.clause()
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+auditColumns+` FROM audit_log `+where+` ORDER BY seq`,
+		q.args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Verify walks the whole chain, recomputing every hash and link. It reports
+// the first entry that doesn't match; an intact chain's head hash can be
+// recorded elsewhere to also detect truncation later.
+func (s *AuditService) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Verify")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &models.AuditVerification{Valid: true, HeadHash: auditGenesisHash}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if entry.PrevHash != result.HeadHash || entry.Hash != hashAuditEntry(entry) {
+			result.Valid = false
+			result.BrokenAt = &entry.Seq
+			return result, nil
+		}
+		result.Entries++
+		result.HeadHash = entry.Hash
+	}
+	return result, rows.Err()
+}
+
+// hashAuditEntry hashes the entry's content together with the previous hash.
+// Fields are serialized in a fixed order; map keys are sorted by encoding/json.
+func hashAuditEntry(entry *models.AuditEntry) string {
+	content := struct {
+		ID         string            `json:"id"`
+		OccurredAt string            `json:"occurred_at"`
+		Action     string            `json:"action"`
+		Outcome    string            `json:"outcome"`
+		ActorID    string            `json:"actor_id"`
+		ActorEmail string            `json:"actor_email"`
+		IP         string            `json:"ip"`
+		UserAgent  string            `json:"user_agent"`
+		TargetType string            `json:"target_type"`
+		TargetID   string            `json:"target_id"`
+		Details    map[string]string `json:"details"`
+		PrevHash   string            `json:"prev_hash"`
+	}{
+		ID:         entry.ID.String(),
+		OccurredAt: entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		Action:     entry.Action,
+		Outcome:    entry.Outcome,
+		ActorEmail: entry.ActorEmail,
+		IP:         entry.IP,
+		UserAgent:  entry.UserAgent,
+		TargetType: entry.TargetType,
+		Details:    entry.Details,
+		PrevHash:   entry.PrevHash,
+	}
+	if entry.ActorID != nil {
+		content.ActorID = entry.ActorID.String()
+	}
+	if entry.TargetID != nil {
+		content.TargetID = entry.TargetID.String()
+	}
+
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func scanAuditEntry(rows *sql.Rows) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var actorEmail, ip, userAgent, targetType sql.NullString
+	var details []byte
+	if err := rows.Scan(&entry.Seq, &entry.ID, &entry.OccurredAt, &entry.Action, &entry.Outcome,
+		&entry.ActorID, &actorEmail, &ip, &userAgent, &targetType, &entry.TargetID,
+		&details, &entry.PrevHash, &entry.Hash); err != nil {
+		return nil, err
+	}
+	entry.OccurredAt = entry.OccurredAt.UTC()
+	entry.ActorEmail = actorEmail.String
+	entry.IP = ip.String
+	entry.UserAgent = userAgent.String
+	entry.TargetType = targetType.String
+	if len(details) > 0 {
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
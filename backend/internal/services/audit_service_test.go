@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+var auditRowColumns = []string{
+	"seq", "id", "occurred_at", "action", "outcome", "actor_id", "actor_email", "ip",
+	"user_agent", "target_type", "target_id", "details", "prev_hash", "hash",
+}
+
+// chainEntries builds n linked entries as Record would have stored them.
+func chainEntries(n int) []*models.AuditEntry {
+	entries := make([]*models.AuditEntry, n)
+	prev := auditGenesisHash
+	for i := range entries {
+		actorID := uuid.New()
+		entry := &models.AuditEntry{
+			Seq:        int64(i + 1),
+			ID:         uuid.New(),
+			OccurredAt: time.Now().UTC().Truncate(time.Microsecond),
+			Action:     AuditDocumentDownload,
+			Outcome:    AuditSuccess,
+			ActorID:    &actorID,
+			ActorEmail: "user@example.com",
+			Details:    map[string]string{"n": string(rune('a' + i))},
+			PrevHash:   prev,
+		}
+		entry.Hash = hashAuditEntry(entry)
+		prev = entry.Hash
+		entries[i] = entry
+	}
+	return entries
+}
+
+func auditRows(entries []*models.AuditEntry) *sqlmock.Rows {
+	rows := sqlmock.NewRows(auditRowColumns)
+	for _, e := range entries {
+		details := `{"n":"` + e.Details["n"] + `"}`
+		rows.AddRow(e.Seq, e.ID, e.OccurredAt, e.Action, e.Outcome, *e.ActorID, e.ActorEmail,
+			"", "", "", nil, []byte(details), e.PrevHash, e.Hash)
+	}
+	return rows
+}
+
+func TestAuditService_Record_LinksToPreviousHash(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	prev := chainEntries(1)[0]
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+		WithArgs(auditChainLock).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT hash FROM audit_log ORDER BY seq DESC LIMIT 1`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow(prev.Hash))
+	mock.ExpectQuery(`INSERT INTO audit_log`).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(2))
+	mock.ExpectCommit()
+
+	docID := uuid.New()
+	entry := &models.AuditEntry{Action: AuditDocumentDelete, TargetType: "document", TargetID: &docID}
+	if err := service.Record(context.Background(), entry); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if entry.Seq != 2 || entry.PrevHash != prev.Hash {
+		t.Errorf("Record() seq = %d prev = %s, want 2 linked to %s", entry.Seq, entry.PrevHash, prev.Hash)
+	}
+	if entry.Outcome != AuditSuccess {
+		t.Errorf("Outcome = %q, want default %q", entry.Outcome, AuditSuccess)
+	}
+	if entry.Hash != hashAuditEntry(entry) {
+		t.Error("Hash does not match the entry content")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAuditService_Record_FirstEntryUsesGenesis(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT hash FROM audit_log`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+	mock.ExpectQuery(`INSERT INTO audit_log`).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(1))
+	mock.ExpectCommit()
+
+	entry := &models.AuditEntry{Action: AuditLogin}
+	if err := service.Record(context.Background(), entry); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if entry.PrevHash != auditGenesisHash {
+		t.Errorf("PrevHash = %s, want genesis hash", entry.PrevHash)
+	}
+}
+
+func TestAuditService_Verify_IntactChain(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	entries := chainEntries(3)
+	mock.ExpectQuery(`SELECT .+ FROM audit_log ORDER BY seq`).WillReturnRows(auditRows(entries))
+
+	result, err := service.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if !result.Valid || result.Entries != 3 || result.HeadHash != entries[2].Hash {
+		t.Errorf("Verify() = %+v, want valid chain of 3", result)
+	}
+}
+
+func TestAuditService_Verify_DetectsTampering(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	entries := chainEntries(3)
+	entries[1].ActorEmail = "someone-else@example.com"
+	mock.ExpectQuery(`SELECT .+ FROM audit_log ORDER BY seq`).WillReturnRows(auditRows(entries))
+
+	result, err := service.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if result.Valid || result.BrokenAt == nil || *result.BrokenAt != 2 {
+		t.Errorf("Verify() = %+v, want broken at seq 2", result)
+	}
+}
+
+func TestAuditService_Verify_DetectsRemovedEntry(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	entries := chainEntries(3)
+	mock.ExpectQuery(`SELECT .+ FROM audit_log ORDER BY seq`).
+		WillReturnRows(auditRows([]*models.AuditEntry{entries[0], entries[2]}))
+
+	result, err := service.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if result.Valid || result.BrokenAt == nil || *result.BrokenAt != 3 {
+		t.Errorf("Verify() = %+v, want broken at seq 3", result)
+	}
+}
+
+func TestAuditService_ListForDocument_NotOwner(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	docID := uuid.New()
+	mock.ExpectQuery(`SELECT owner_id FROM documents WHERE id = \$1`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(uuid.New()))
+
+	if _, _, err := service.ListForDocument(context.Background(), docID, uuid.New(), 1, 20); err != ErrAccessDenied {
+		t.Errorf("ListForDocument() error = %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestAuditService_Export_ActionWildcard(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewAuditService(db)
+
+	entries := chainEntries(2)
+	mock.ExpectQuery(`FROM audit_log WHERE action LIKE \$1 ESCAPE '\\' AND outcome = \$2 ORDER BY seq`).
+		WithArgs("document.%", AuditSuccess).
+		WillReturnRows(auditRows(entries))
+
+	var got []uuid.UUID
+	err := service.Export(context.Background(), models.AuditFilter{Action: "document.*", Outcome: AuditSuccess}, func(e *models.AuditEntry) error {
+		got = append(got, e.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	if len(got) != 2 || got[0] != entries[0].ID {
+		t.Errorf("Export() streamed %v, want both entries in order", got)
+	}
+}
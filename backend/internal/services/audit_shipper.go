@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/audit"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+const (
+	auditShipBatchSize  = 100
+	auditShipInterval   = time.Second
+	auditShipMaxBackoff = time.Minute
+)
+
+// AuditShipper forwards the audit log to external sinks. It tails audit_log
+// from each sink's saved offset, so the table itself is the buffer: requests
+// only ever write to the database, a slow or unreachable sink just falls
+// behind, and nothing is lost across restarts. Delivery is at least once.
+type AuditShipper struct {
+	db    *database.DB
+	sinks []audit.Sink
+}
+
+func NewAuditShipper(db *database.DB, sinks []audit.Sink) *AuditShipper {
+	return &AuditShipper{db: db, sinks: sinks}
+}
+
+// Run ships to every sink until ctx is cancelled, then closes the sinks.
+// Each sink has its own loop so one can't hold up another.
+func (s *AuditShipper) Run(ctx context.Context) {
+	done := make(chan struct{}, len(s.sinks))
+	for _, sink := range s.sinks {
+		go func(sink audit.Sink) {
+			s.run(ctx, sink)
+			done <- struct{}{}
+		}(sink)
+	}
+	for range s.sinks {
+		<-done
+	}
+}
+
+func (s *AuditShipper) run(ctx context.Context, sink audit.Sink) {
+	defer sink.Close()
+
+	backoff := auditShipInterval
+	for {
+		shipped, err := s.ShipBatch(ctx, sink)
+		metrics.ObserveJob("audit_ship", shipped, err)
+		wait := auditShipInterval
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "audit shipping failed", "sink", sink.Name(), "retry_in", backoff, "error", err)
+			wait = backoff
+			backoff = min(backoff*2, auditShipMaxBackoff)
+		case shipped == auditShipBatchSize:
+			// Still catching up
+			backoff = auditShipInterval
+			wait = 0
+		default:
+			backoff = auditShipInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ShipBatch delivers the next batch of entries after the sink's offset and
+// advances the offset. It returns how many entries were delivered.
+func (s *AuditShipper) ShipBatch(ctx context.Context, sink audit.Sink) (int, error) {
+	var offset int64
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO audit_sink_offsets (sink) VALUES ($1)
+		 ON CONFLICT (sink) DO UPDATE SET sink = EXCLUDED.sink
+		 RETURNING seq`,
+		sink.Name(),
+	).Scan(&offset)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+auditColumns+` FROM audit_log WHERE seq > $1 ORDER BY seq LIMIT $2`,
+		offset, auditShipBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	if err := sink.Write(entries); err != nil {
+		return 0, err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE audit_sink_offsets SET seq = $1, updated_at = CURRENT_TIMESTAMP WHERE sink = $2`,
+		entries[len(entries)-1].Seq, sink.Name(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+type recordingSink struct {
+	batches [][]models.AuditEntry
+	err     error
+}
+
+func (s *recordingSink) Name() string { return "test" }
+
+func (s *recordingSink) Write(entries []models.AuditEntry) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, entries)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestAuditShipper_ShipBatch_AdvancesOffset(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	sink := &recordingSink{}
+	shipper := NewAuditShipper(db, nil)
+	entries := chainEntries(3)
+
+	mock.ExpectQuery(`INSERT INTO audit_sink_offsets .+ RETURNING seq`).
+		WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(1))
+	mock.ExpectQuery(`FROM audit_log WHERE seq > \$1 ORDER BY seq LIMIT \$2`).
+		WithArgs(int64(1), auditShipBatchSize).
+		WillReturnRows(auditRows(entries[1:]))
+	mock.ExpectExec(`UPDATE audit_sink_offsets SET seq = \$1`).
+		WithArgs(int64(3), "test").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	shipped, err := shipper.ShipBatch(context.Background(), sink)
+	if err != nil {
+		t.Fatalf("ShipBatch() error = %v", err)
+	}
+
+	if shipped != 2 || len(sink.batches) != 1 || sink.batches[0][0].Seq != 2 {
+		t.Errorf("ShipBatch() shipped %d in %d batches, want entries 2 and 3 in one", shipped, len(sink.batches))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAuditShipper_ShipBatch_SinkFailureKeepsOffset(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	sink := &recordingSink{err: errors.New("connection refused")}
+	shipper := NewAuditShipper(db, nil)
+
+	mock.ExpectQuery(`INSERT INTO audit_sink_offsets`).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(0))
+	mock.ExpectQuery(`FROM audit_log WHERE seq > \$1`).
+		WillReturnRows(auditRows(chainEntries(2)))
+
+	if _, err := shipper.ShipBatch(context.Background(), sink); err == nil {
+		t.Fatal("ShipBatch() should return the sink error")
+	}
+
+	// No UPDATE of the offset was expected, so the batch is retried
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAuditShipper_ShipBatch_NothingNew(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	sink := &recordingSink{}
+	shipper := NewAuditShipper(db, nil)
+
+	mock.ExpectQuery(`INSERT INTO audit_sink_offsets`).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(5))
+	mock.ExpectQuery(`FROM audit_log WHERE seq > \$1`).
+		WillReturnRows(sqlmock.NewRows(auditRowColumns))
+
+	shipped, err := shipper.ShipBatch(context.Background(), sink)
+	if err != nil || shipped != 0 || len(sink.batches) != 0 {
+		t.Errorf("ShipBatch() = %d, %v; want nothing shipped", shipped, err)
+	}
+}
@@ -0,0 +1,19 @@
+package services
+
+import "time"
+
+// Retry delays shared by the background workers that reschedule failed work.
+const (
+	retryBaseBackoff = 30 * time.Second
+	retryMaxBackoff  = 6 * time.Hour
+)
+
+// retryBackoff is the delay before retrying after the given number of failed
+// attempts: 30s, 1m, 2m, ... capped at 6h.
+func retryBackoff(attempts int) time.Duration {
+	backoff := retryBaseBackoff
+	for i := 1; i < attempts && backoff < retryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, retryMaxBackoff)
+}
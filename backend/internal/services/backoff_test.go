@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
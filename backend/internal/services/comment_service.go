@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+)
+
+var (
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrEmptyComment         = errors.New("comment body is empty")
+	ErrInvalidCommentParent = errors.New("replies must answer a top-level comment on the same document")
+	ErrNotCommentThread     = errors.New("only top-level comments can be resolved")
+)
+
+// commentExcerptLength caps how much of a comment is copied into
+// notifications.
+const commentExcerptLength = 140
+
+const commentColumns = `c.id, c.document_id, c.parent_id, c.author_id, COALESCE(u.name, ''), c.body, c.page, c.version,
+	c.resolved_at, c.resolved_by, c.created_at, c.updated_at, c.deleted_at IS NOT NULL`
+
+type CommentService struct {
+	db              *database.DB
+	documentService *DocumentService
+	notifications   *NotificationService
+}
+
+func NewCommentService(db *database.DB, documentService *DocumentService) *CommentService {
+	return &CommentService{db: db, documentService: documentService, notifications: NewNotificationService(db)}
+}
+
+// List returns the document's comment threads, oldest first, each with its
+// replies. Deleted comments only appear when they still have replies.
+func (s *CommentService) List(ctx context.Context, documentID, userID uuid.UUID) ([]models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentService.List")
+	defer span.End()
+
+	if _, err := s.requireAccess(ctx, documentID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+commentColumns+`
+		 FROM document_comments c
+		 LEFT JOIN users u ON c.author_id = u.id
+		 WHERE c.document_id = $1
+		 ORDER BY c.created_at, c.id`,
+		documentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var threads []models.Comment
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		if comment.ParentID == nil {
+			index[comment.ID] = len(threads)
+			threads = append(threads, *comment)
+		} else if i, ok := index[*comment.ParentID]; ok && !comment.Deleted {
+			threads[i].Replies = append(threads[i].Replies, *comment)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	visible := []models.Comment{}
+	for _, thread := range threads {
+		if !thread.Deleted || len(thread.Replies) > 0 {
+			visible = append(visible, thread)
+		}
+	}
+	return visible, nil
+}
+
+// Create adds a comment, or a reply when req.ParentID is set, and notifies
+// the document owner and everyone else in the thread.
+func (s *CommentService) Create(ctx context.Context, documentID, userID uuid.UUID, req models.CommentRequest) (*models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentService.Create")
+	defer span.End()
+
+	if _, err := s.requireAccess(ctx, documentID, userID); err != nil {
+		return nil, err
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return nil, ErrEmptyComment
+	}
+
+	page, version := req.Page, req.Version
+	if req.ParentID != nil {
+		var parentDocument uuid.UUID
+		var grandparent *uuid.UUID
+		var deleted bool
+		err := s.db.QueryRowContext(ctx,
+			`SELECT document_id, parent_id, deleted_at IS NOT NULL FROM document_comments WHERE id = $1`,
+			*req.ParentID,
+		).Scan(&parentDocument, &grandparent, &deleted)
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidCommentParent
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parentDocument != documentID || grandparent != nil || deleted {
+			return nil, ErrInvalidCommentParent
+		}
+		// The anchor belongs to the thread
+		page, version = nil, nil
+	}
+
+	now := time.Now()
+	comment := &models.Comment{
+		ID:         uuid.New(),
+		DocumentID: documentID,
+		ParentID:   req.ParentID,
+		AuthorID:   userID,
+		Body:       body,
+		Page:       page,
+		Version:    version,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO document_comments (id, document_id, parent_id, author_id, body, page, version, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		 RETURNING (SELECT name FROM users WHERE id = $4)`,
+		comment.ID, documentID, comment.ParentID, userID, body, page, version, now,
+	).Scan(&comment.AuthorName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyParticipants(ctx, comment)
+
+	return comment, nil
+}
+
+// Update replaces the body of the user's own comment.
+func (s *CommentService) Update(ctx context.Context, documentID, commentID, userID uuid.UUID, body string) (*models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentService.Update")
+	defer span.End()
+
+	comment, _, err := s.load(ctx, documentID, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.AuthorID != userID {
+		return nil, ErrAccessDenied
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, ErrEmptyComment
+	}
+
+	comment.Body = body
+	comment.UpdatedAt = time.Now()
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE document_comments SET body = $1, updated_at = $2 WHERE id = $3`,
+		comment.Body, comment.UpdatedAt, commentID,
+	); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Delete removes the user's own comment. A top-level comment with replies is
+// blanked instead so the rest of the thread survives.
+func (s *CommentService) Delete(ctx context.Context, documentID, commentID, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "CommentService.Delete")
+	defer span.End()
+
+	comment, _, err := s.load(ctx, documentID, commentID, userID)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorID != userID {
+		return ErrAccessDenied
+	}
+
+	var hasReplies bool
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM document_comments WHERE parent_id = $1 AND deleted_at IS NULL)`,
+		commentID,
+	).Scan(&hasReplies); err != nil {
+		return err
+	}
+
+	if hasReplies {
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE document_comments SET body = '', deleted_at = $1 WHERE id = $2`,
+			time.Now(), commentID,
+		)
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM document_comments WHERE id = $1`, commentID)
+	return err
+}
+
+// SetResolved resolves or reopens a thread. The thread's author, the
+// document owner and editors may do so.
+func (s *CommentService) SetResolved(ctx context.Context, documentID, commentID, userID uuid.UUID, resolved bool) (*models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentService.SetResolved")
+	defer span.End()
+
+	comment, permission, err := s.load(ctx, documentID, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ParentID != nil {
+		return nil, ErrNotCommentThread
+	}
+	if comment.AuthorID != userID && permission != "owner" && permission != "edit" {
+		return nil, ErrAccessDenied
+	}
+
+	comment.ResolvedAt, comment.ResolvedBy = nil, nil
+	if resolved {
+		now := time.Now()
+		comment.ResolvedAt, comment.ResolvedBy = &now, &userID
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE document_comments SET resolved_at = $1, resolved_by = $2 WHERE id = $3`,
+		comment.ResolvedAt, comment.ResolvedBy, commentID,
+	); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// requireAccess returns the user's permission on the document; anyone who
+// can see a document may comment on it.
+func (s *CommentService) requireAccess(ctx context.Context, documentID, userID uuid.UUID) (string, error) {
+	canAccess, permission, err := s.documentService.CanAccess(ctx, documentID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !canAccess {
+		return "", ErrAccessDenied
+	}
+	return permission, nil
+}
+
+// load fetches a live comment on the document after checking the user can
+// access the document.
+func (s *CommentService) load(ctx context.Context, documentID, commentID, userID uuid.UUID) (*models.Comment, string, error) {
+	permission, err := s.requireAccess(ctx, documentID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+commentColumns+`
+		 FROM document_comments c
+		 LEFT JOIN users u ON c.author_id = u.id
+		 WHERE c.id = $1 AND c.document_id = $2 AND c.deleted_at IS NULL`,
+		commentID, documentID,
+	)
+	comment, err := scanComment(row)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return comment, permission, nil
+}
+
+// notifyParticipants tells the document owner and the thread's other
+// authors about a new comment. Participants who have since lost access to
+// the document are skipped.
+func (s *CommentService) notifyParticipants(ctx context.Context, comment *models.Comment) {
+	threadID := comment.ID
+	if comment.ParentID != nil {
+		threadID = *comment.ParentID
+	}
+
+	doc, err := s.documentService.GetByID(ctx, comment.DocumentID)
+	if err != nil {
+		logNotifyError(NotificationCommentAdded, err)
+		return
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT author_id FROM document_comments WHERE id = $1 OR parent_id = $1`,
+		threadID,
+	)
+	if err != nil {
+		logNotifyError(NotificationCommentAdded, err)
+		return
+	}
+	recipients := []uuid.UUID{doc.OwnerID}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			logNotifyError(NotificationCommentAdded, err)
+			return
+		}
+		if id != doc.OwnerID {
+			recipients = append(recipients, id)
+		}
+	}
+	rows.Close()
+
+	notification := models.Notification{
+		Type:       NotificationCommentAdded,
+		ActorID:    &comment.AuthorID,
+		DocumentID: &comment.DocumentID,
+		Data: map[string]interface{}{
+			"name":       doc.Name,
+			"comment_id": comment.ID,
+			"thread_id":  threadID,
+			"excerpt":    excerpt(comment.Body, commentExcerptLength),
+		},
+	}
+	for _, userID := range recipients {
+		if userID == comment.AuthorID {
+			continue
+		}
+		if userID != doc.OwnerID {
+			if canAccess, _, err := s.documentService.CanAccess(ctx, comment.DocumentID, userID); err != nil || !canAccess {
+				continue
+			}
+		}
+		logNotifyError(NotificationCommentAdded, s.notifications.Notify(ctx, userID, notification))
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanComment(row rowScanner) (*models.Comment, error) {
+	var c models.Comment
+	err := row.Scan(&c.ID, &c.DocumentID, &c.ParentID, &c.AuthorID, &c.AuthorName, &c.Body, &c.Page, &c.Version,
+		&c.ResolvedAt, &c.ResolvedBy, &c.CreatedAt, &c.UpdatedAt, &c.Deleted)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// excerpt shortens s to at most n runes, marking the cut with an ellipsis.
+func excerpt(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+var commentRowColumns = []string{
+	"id", "document_id", "parent_id", "author_id", "author_name", "body", "page", "version",
+	"resolved_at", "resolved_by", "created_at", "updated_at", "deleted",
+}
+
+// expectDocumentAccess expects a CanAccess check by userID on a document
+// owned by ownerID. permission is the user's share, "" for none.
+func expectDocumentAccess(mock sqlmock.Sqlmock, docID, ownerID, userID uuid.UUID, permission string) {
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Plan.pdf", "plan.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, ""))
+	if userID == ownerID {
+		return
+	}
+	rows := sqlmock.NewRows([]string{"permission"})
+	if permission != "" {
+		rows.AddRow(permission)
+	}
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, userID).
+		WillReturnRows(rows)
+}
+
+func expectCommentLoad(mock sqlmock.Sqlmock, commentID, docID, authorID uuid.UUID, parentID *uuid.UUID) {
+	mock.ExpectQuery(`SELECT .+ FROM document_comments c\s+LEFT JOIN users u .+WHERE c.id = \$1 AND c.document_id = \$2 AND c.deleted_at IS NULL`).
+		WithArgs(commentID, docID).
+		WillReturnRows(sqlmock.NewRows(commentRowColumns).
+			AddRow(commentID, docID, parentID, authorID, "Author", "Looks good", nil, nil, nil, nil, time.Now(), time.Now(), false))
+}
+
+func TestCommentService_Create_ReplyNotifiesThread(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	rootAuthorID := uuid.New()
+	replierID := uuid.New()
+	rootID := uuid.New()
+	page := 3
+
+	expectDocumentAccess(mock, docID, ownerID, replierID, "view")
+	mock.ExpectQuery(`SELECT document_id, parent_id, deleted_at IS NOT NULL FROM document_comments WHERE id = \$1`).
+		WithArgs(rootID).
+		WillReturnRows(sqlmock.NewRows([]string{"document_id", "parent_id", "deleted"}).AddRow(docID, nil, false))
+	// Replies don't carry the anchor
+	mock.ExpectQuery(`INSERT INTO document_comments .+RETURNING \(SELECT name FROM users WHERE id = \$4\)`).
+		WithArgs(sqlmock.AnyArg(), docID, rootID.String(), replierID, "Agreed", nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Replier"))
+
+	// Owner and the thread's author are notified; the replier isn't
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Plan.pdf", "plan.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, ""))
+	mock.ExpectQuery(`SELECT DISTINCT author_id FROM document_comments WHERE id = \$1 OR parent_id = \$1`).
+		WithArgs(rootID).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(rootAuthorID).AddRow(replierID))
+	expectNotification(mock, NotificationCommentAdded)
+	expectDocumentAccess(mock, docID, ownerID, rootAuthorID, "edit")
+	expectNotification(mock, NotificationCommentAdded)
+
+	comment, err := service.Create(context.Background(), docID, replierID, models.CommentRequest{Body: "  Agreed ", ParentID: &rootID, Page: &page})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if comment.Body != "Agreed" || comment.AuthorName != "Replier" || comment.Page != nil {
+		t.Errorf("Create() = %+v", comment)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCommentService_Create_ReplyToReply(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	replyID := uuid.New()
+
+	expectDocumentAccess(mock, docID, ownerID, ownerID, "")
+	mock.ExpectQuery(`SELECT document_id, parent_id`).
+		WithArgs(replyID).
+		WillReturnRows(sqlmock.NewRows([]string{"document_id", "parent_id", "deleted"}).AddRow(docID, uuid.New(), false))
+
+	_, err := service.Create(context.Background(), docID, ownerID, models.CommentRequest{Body: "Nested", ParentID: &replyID})
+	if err != ErrInvalidCommentParent {
+		t.Errorf("Create() error = %v, want ErrInvalidCommentParent", err)
+	}
+}
+
+func TestCommentService_Create_NoAccess(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	strangerID := uuid.New()
+	expectDocumentAccess(mock, docID, uuid.New(), strangerID, "")
+
+	_, err := service.Create(context.Background(), docID, strangerID, models.CommentRequest{Body: "Hello"})
+	if err != ErrAccessDenied {
+		t.Errorf("Create() error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCommentService_Update_NotAuthor(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	commentID := uuid.New()
+
+	// Even the owner can't edit someone else's words
+	expectDocumentAccess(mock, docID, ownerID, ownerID, "")
+	expectCommentLoad(mock, commentID, docID, uuid.New(), nil)
+
+	if _, err := service.Update(context.Background(), docID, commentID, ownerID, "Rewritten"); err != ErrAccessDenied {
+		t.Errorf("Update() error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCommentService_Delete_ThreadWithRepliesIsBlanked(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	authorID := uuid.New()
+	commentID := uuid.New()
+
+	expectDocumentAccess(mock, docID, ownerID, authorID, "view")
+	expectCommentLoad(mock, commentID, docID, authorID, nil)
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM document_comments WHERE parent_id = \$1`).
+		WithArgs(commentID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`UPDATE document_comments SET body = '', deleted_at = \$1 WHERE id = \$2`).
+		WithArgs(sqlmock.AnyArg(), commentID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := service.Delete(context.Background(), docID, commentID, authorID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCommentService_SetResolved(t *testing.T) {
+	docID := uuid.New()
+	ownerID := uuid.New()
+	authorID := uuid.New()
+
+	tests := []struct {
+		name       string
+		permission string
+		wantErr    error
+	}{
+		{"editor", "edit", nil},
+		{"viewer who didn't start the thread", "view", ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			defer db.Close()
+			service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+			userID := uuid.New()
+			commentID := uuid.New()
+			expectDocumentAccess(mock, docID, ownerID, userID, tt.permission)
+			expectCommentLoad(mock, commentID, docID, authorID, nil)
+			if tt.wantErr == nil {
+				mock.ExpectExec(`UPDATE document_comments SET resolved_at = \$1, resolved_by = \$2 WHERE id = \$3`).
+					WithArgs(sqlmock.AnyArg(), userID.String(), commentID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			comment, err := service.SetResolved(context.Background(), docID, commentID, userID, true)
+			if err != tt.wantErr {
+				t.Fatalf("SetResolved() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (comment.ResolvedAt == nil || *comment.ResolvedBy != userID) {
+				t.Errorf("SetResolved() = %+v, want resolved by %s", comment, userID)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestCommentService_SetResolved_Reply(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	replyID := uuid.New()
+	rootID := uuid.New()
+
+	expectDocumentAccess(mock, docID, ownerID, ownerID, "")
+	expectCommentLoad(mock, replyID, docID, ownerID, &rootID)
+
+	if _, err := service.SetResolved(context.Background(), docID, replyID, ownerID, true); err != ErrNotCommentThread {
+		t.Errorf("SetResolved() error = %v, want ErrNotCommentThread", err)
+	}
+}
+
+func TestCommentService_List_BuildsThreads(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewCommentService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	first, second, gone := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+
+	expectDocumentAccess(mock, docID, ownerID, ownerID, "")
+	mock.ExpectQuery(`SELECT .+ FROM document_comments c\s+LEFT JOIN users u .+WHERE c.document_id = \$1`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows(commentRowColumns).
+			AddRow(first, docID, nil, ownerID, "Owner", "", 2, nil, nil, nil, now, now, true).
+			AddRow(gone, docID, nil, ownerID, "Owner", "", nil, nil, nil, nil, now, now, true).
+			AddRow(uuid.New(), docID, first, ownerID, "Owner", "Reply", nil, nil, nil, nil, now, now, false).
+			AddRow(second, docID, nil, ownerID, "Owner", "Second", nil, nil, nil, nil, now, now, false))
+
+	threads, err := service.List(context.Background(), docID, ownerID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	// The deleted thread with a reply stays; the one without disappears
+	if len(threads) != 2 || threads[0].ID != first || threads[1].ID != second {
+		t.Fatalf("List() = %+v, want the first and second threads", threads)
+	}
+	if len(threads[0].Replies) != 1 || *threads[0].Page != 2 || !threads[0].Deleted {
+		t.Errorf("threads[0] = %+v, want a deleted page 2 thread with one reply", threads[0])
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := excerpt("short", 10); got != "short" {
+		t.Errorf("excerpt() = %q, want unchanged", got)
+	}
+
+	got := excerpt(strings.Repeat("é", 20), 10)
+	if got != strings.Repeat("é", 9)+"…" {
+		t.Errorf("excerpt() = %q, want 9 runes and an ellipsis", got)
+	}
+}
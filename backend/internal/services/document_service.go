@@ -1,43 +1,95 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
 	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"github.com/katim/secure-doc-vault/pkg/extract"
 	"github.com/katim/secure-doc-vault/pkg/utils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
 	ErrDocumentNotFound = errors.New("document not found")
 	ErrAccessDenied     = errors.New("access denied")
 	ErrShareNotFound    = errors.New("share not found")
+	ErrInvalidSort      = errors.New("invalid sort")
+	ErrInvalidCursor    = errors.New("invalid pagination cursor")
+	ErrInvalidDigest    = errors.New("expected digest must be 64 hex characters")
+	ErrDigestMismatch   = errors.New("content does not match the expected SHA-256 digest")
 )
 
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
 type DocumentService struct {
-	db        *database.DB
-	uploadDir string
+	documents     DocumentRepository
+	shares        ShareRepository
+	uploadDir     string
+	audit         *AuditService
+	webhooks      *WebhookService
+	events        *EventService
+	notifications *NotificationService
 }
 
 func NewDocumentService(db *database.DB, uploadDir string) *DocumentService {
+	s := NewDocumentServiceFromRepositories(NewPostgresRepositories(db), uploadDir)
+	s.audit = NewAuditService(db)
+	s.webhooks = NewWebhookService(db)
+	s.events = NewEventService(db)
+	s.notifications = NewNotificationService(db)
+	return s
+}
+
+// NewDocumentServiceFromRepositories returns a service storing documents in
+// repos, such as the in-memory store. Audit records, webhooks, live events
+// and notifications need the database and are skipped.
+func NewDocumentServiceFromRepositories(repos Repositories, uploadDir string) *DocumentService {
 	// Ensure upload directory exists
 	os.MkdirAll(uploadDir, 0755)
-	return &DocumentService{db: db, uploadDir: uploadDir}
+	return &DocumentService{
+		documents: repos.Documents,
+		shares:    repos.Shares,
+		uploadDir: uploadDir,
+	}
 }
 
-func (s *DocumentService) Create(ownerID uuid.UUID, name, originalName, mimeType string, size int64, fileData io.Reader) (*models.Document, error) {
+// Create stores an upload as a new document. When expectedSHA256 is set the
+// upload is rejected unless its content hashes to it. Content the owner has
+// already uploaded is stored once and shared between their documents.
+func (s *DocumentService) Create(ctx context.Context, ownerID uuid.UUID, name, originalName, mimeType string, size int64, fileData io.Reader, expectedSHA256 string) (*models.Document, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.Create")
+	defer span.End()
+
 	// Validate content type
 	if err := utils.ValidateContentType(mimeType); err != nil {
 		return nil, fmt.Errorf("invalid file type: %w", err)
 	}
 
+	expectedSHA256 = strings.ToLower(strings.TrimSpace(expectedSHA256))
+	if expectedSHA256 != "" && !sha256Pattern.MatchString(expectedSHA256) {
+		return nil, ErrInvalidDigest
+	}
+
 	// Sanitize filenames to prevent path traversal and other attacks
 	sanitizedOriginalName, err := utils.SanitizeFilename(originalName)
 	if err != nil {
@@ -68,153 +120,452 @@ func (s *DocumentService) Create(ownerID uuid.UUID, name, originalName, mimeType
 	}
 
 	// Create file path using UUID only (never user input)
-	doc.FilePath = filepath.Join(s.uploadDir, doc.ID.String())
+	uploadPath := filepath.Join(s.uploadDir, doc.ID.String())
+	doc.FilePath = uploadPath
 
-	// Save file to disk first
-	file, err := os.Create(doc.FilePath)
+	// Save file to disk first; the span includes reading the upload off
+	// the network
+	_, writeSpan := tracing.Start(ctx, "storage.Write")
+	file, err := os.Create(uploadPath)
 	if err != nil {
+		writeSpan.End()
 		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
 
-	if _, err := io.Copy(file, fileData); err != nil {
-		os.Remove(doc.FilePath) // Clean up on failure
+	// Hash while writing; the digest identifies this content
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), fileData)
+	file.Close()
+	writeSpan.SetAttributes(attribute.Int64("storage.bytes", written))
+	writeSpan.End()
+	metrics.UploadedBytes.Add(float64(written))
+	if err != nil {
+		os.Remove(uploadPath) // Clean up on failure
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
+	doc.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if expectedSHA256 != "" && doc.SHA256 != expectedSHA256 {
+		os.Remove(uploadPath)
+		return nil, ErrDigestMismatch
+	}
+
+	// Index the file's text for search; extraction failures only mean the
+	// document is searchable by name alone
+	var contentText string
+	if extract.Supported(mimeType) {
+		contentText, _ = extract.File(uploadPath, mimeType)
+	}
 
 	// Save to database (if this fails, file is cleaned up)
-	_, err = s.db.Exec(
-		`INSERT INTO documents (id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		doc.ID, doc.OwnerID, doc.Name, doc.OriginalName, doc.Size, doc.MimeType,
-		doc.EncryptionAlgo, doc.FilePath, doc.IsEncrypted, doc.CreatedAt, doc.UpdatedAt,
-	)
-	if err != nil {
-		os.Remove(doc.FilePath) // Clean up file if DB insert fails
+	event := s.webhookEvent(EventDocumentCreated, doc.ID, ownerID, map[string]interface{}{
+		"name":      doc.Name,
+		"size":      doc.Size,
+		"mime_type": doc.MimeType,
+	})
+	if err := s.insert(ctx, doc, contentText, event); err != nil {
+		os.Remove(uploadPath)
 		return nil, fmt.Errorf("failed to save document metadata: %w", err)
 	}
+	// The owner already had this content; the upload was a duplicate
+	if doc.FilePath != uploadPath {
+		os.Remove(uploadPath)
+	}
 
 	return doc, nil
 }
 
-func (s *DocumentService) GetByID(id uuid.UUID) (*models.Document, error) {
-	doc := &models.Document{}
-	err := s.db.QueryRow(
-		`SELECT id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at, deleted_at
-		 FROM documents WHERE id = $1 AND deleted_at IS NULL`,
-		id,
-	).Scan(&doc.ID, &doc.OwnerID, &doc.Name, &doc.OriginalName, &doc.Size, &doc.MimeType,
-		&doc.EncryptionAlgo, &doc.FilePath, &doc.IsEncrypted, &doc.CreatedAt, &doc.UpdatedAt, &doc.DeletedAt)
+// insert records a freshly written upload and the blob holding it. If the
+// owner already has a blob with the same content, the document points at
+// that blob's file instead and doc.FilePath is updated to match. A non-nil
+// event is queued with the document.
+func (s *DocumentService) insert(ctx context.Context, doc *models.Document, contentText string, event *models.WebhookEvent) error {
+	uploadPath := doc.FilePath
+	return s.documents.Insert(ctx, doc, contentText, func(blobPath string) error {
+		// The new upload is a good copy of the damaged content; put it in
+		// place so every document sharing the blob is repaired
+		return os.Rename(uploadPath, blobPath)
+	}, event)
+}
 
-	if err == sql.ErrNoRows {
-		return nil, ErrDocumentNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-	return doc, nil
+func (s *DocumentService) GetByID(ctx context.Context, id uuid.UUID) (*models.Document, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.GetByID")
+	defer span.End()
+
+	return s.documents.GetByID(ctx, id)
 }
 
-func (s *DocumentService) GetByOwner(ownerID uuid.UUID, page, perPage int) ([]models.Document, int, error) {
-	if page < 1 {
-		page = 1
-	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 20
-	}
-	offset := (page - 1) * perPage
+func (s *DocumentService) GetByOwner(ctx context.Context, ownerID uuid.UUID, page, perPage int) ([]models.Document, int, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.GetByOwner")
+	defer span.End()
 
-	// Get total count
-	var total int
-	err := s.db.QueryRow(
-		`SELECT COUNT(*) FROM documents WHERE owner_id = $1 AND deleted_at IS NULL`,
-		ownerID,
-	).Scan(&total)
-	if err != nil {
-		return nil, 0, err
-	}
+	documents, info, err := s.List(ctx, ownerID, models.DocumentFilter{}, models.ListOptions{Page: page, PerPage: perPage})
+	return documents, info.Total, err
+}
 
-	// Get documents
-	rows, err := s.db.Query(
-		`SELECT id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at
-		 FROM documents WHERE owner_id = $1 AND deleted_at IS NULL
-		 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
-		ownerID, perPage, offset,
-	)
-	if err != nil {
-		return nil, 0, err
+// GetByFolder lists the owner's documents inside a folder, or at the root
+// when folderID is nil.
+func (s *DocumentService) GetByFolder(ctx context.Context, ownerID uuid.UUID, folderID *uuid.UUID, page, perPage int) ([]models.Document, int, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.GetByFolder")
+	defer span.End()
+
+	filter := models.DocumentFilter{FolderID: folderID, InRoot: folderID == nil}
+	documents, info, err := s.List(ctx, ownerID, filter, models.ListOptions{Page: page, PerPage: perPage})
+	return documents, info.Total, err
+}
+
+// List returns a page of the owner's documents matching the filter.
+func (s *DocumentService) List(ctx context.Context, ownerID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.Document, models.PageInfo, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.List")
+	defer span.End()
+
+	return s.documents.List(ctx, ownerID, filter, opts)
+}
+
+// documentQuery accumulates AND-ed conditions written with "?" placeholders
+// and renumbers them into Postgres "$n" parameters.
+type documentQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *documentQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, q.placeholders(condition, args...))
+}
+
+// placeholders rewrites each "?" in fragment to the next parameter number and
+// records its argument.
+func (q *documentQuery) placeholders(fragment string, args ...interface{}) string {
+	var b strings.Builder
+	for _, r := range fragment {
+		if r == '?' {
+			q.args = append(q.args, args[0])
+			args = args[1:]
+			fmt.Fprintf(&b, "$%d", len(q.args))
+			continue
+		}
+		b.WriteRune(r)
 	}
-	defer rows.Close()
+	return b.String()
+}
+
+func (q *documentQuery) clause() string {
+	return strings.Join(q.conditions, " AND ")
+}
 
+func scanDocuments(rows *sql.Rows) ([]models.Document, error) {
 	var documents []models.Document
 	for rows.Next() {
 		var doc models.Document
 		if err := rows.Scan(&doc.ID, &doc.OwnerID, &doc.Name, &doc.OriginalName, &doc.Size, &doc.MimeType,
-			&doc.EncryptionAlgo, &doc.FilePath, &doc.IsEncrypted, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
-			return nil, 0, err
+			&doc.EncryptionAlgo, &doc.FilePath, &doc.IsEncrypted, &doc.CreatedAt, &doc.UpdatedAt, &doc.FolderID); err != nil {
+			return nil, err
 		}
 		documents = append(documents, doc)
 	}
+	return documents, rows.Err()
+}
+
+func (s *DocumentService) GetSharedWithUser(ctx context.Context, userID uuid.UUID, page, perPage int) ([]models.DocumentResponse, int, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.GetSharedWithUser")
+	defer span.End()
+
+	documents, info, err := s.ListShared(ctx, userID, models.DocumentFilter{}, models.ListOptions{Page: page, PerPage: perPage})
+	return documents, info.Total, err
+}
+
+// ListShared returns a page of the documents shared directly with the user
+// that match the filter, most recently shared first by default. Folder
+// filters don't apply: shared documents live in their owner's folders.
+func (s *DocumentService) ListShared(ctx context.Context, userID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.DocumentResponse, models.PageInfo, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.ListShared")
+	defer span.End()
+
+	return s.shares.ListShared(ctx, userID, filter, opts)
+}
+
+// sharedDocument is a row of a shared listing, which can be ordered by when
+// the document was shared.
+type sharedDocument struct {
+	doc      models.DocumentResponse
+	sharedAt time.Time
+}
+
+func sharedResponses(shared []sharedDocument) []models.DocumentResponse {
+	var documents []models.DocumentResponse
+	for _, row := range shared {
+		documents = append(documents, row.doc)
+	}
+	return documents
+}
 
-	return documents, total, nil
+// Sortable columns of each listing, keyed by the public sort name
+var (
+	ownerSortColumns = map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"name":       "name",
+		"size":       "size",
+	}
+	sharedSortColumns = map[string]string{
+		"shared_at":  "ds.created_at",
+		"created_at": "d.created_at",
+		"updated_at": "d.updated_at",
+		"name":       "d.name",
+		"size":       "d.size",
+	}
+)
+
+// applyDocumentFilter adds the optional filter conditions. alias qualifies
+// the documents columns when the query joins other tables.
+func applyDocumentFilter(q *documentQuery, filter models.DocumentFilter, alias string) {
+	table := "documents"
+	col := func(name string) string { return name }
+	if alias != "" {
+		table = alias
+		col = func(name string) string { return alias + "." + name }
+	}
+
+	for _, tag := range filter.Tags {
+		q.where("EXISTS (SELECT 1 FROM document_tags t WHERE t.document_id = "+table+".id AND t.tag = ?)", normalizeTag(tag))
+	}
+	// Sorted so the generated SQL is stable for a given filter
+	keys := make([]string, 0, len(filter.Metadata))
+	for key := range filter.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		match, args := metadataValueCondition(filter.Metadata[key])
+		q.where("EXISTS (SELECT 1 FROM document_metadata m WHERE m.document_id = "+table+".id AND m.key = ? AND "+match+")",
+			append([]interface{}{key}, args...)...)
+	}
+
+	if mimeType := strings.ToLower(strings.TrimSpace(filter.MimeType)); mimeType != "" {
+		if prefix, ok := strings.CutSuffix(mimeType, "/*"); ok {
+			q.where(col("mime_type")+` LIKE ? ESCAPE '\'`, escapeLike(prefix)+"/%")
+		} else {
+			q.where(col("mime_type")+" = ?", mimeType)
+		}
+	}
+	if filter.MinSize != nil {
+		q.where(col("size")+" >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		q.where(col("size")+" <= ?", *filter.MaxSize)
+	}
+	if filter.CreatedAfter != nil {
+		q.where(col("created_at")+" >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		q.where(col("created_at")+" < ?", *filter.CreatedBefore)
+	}
+	if filter.NamePrefix != "" {
+		q.where(col("name")+` ILIKE ? ESCAPE '\'`, escapeLike(filter.NamePrefix)+"%")
+	}
 }
 
-func (s *DocumentService) GetSharedWithUser(userID uuid.UUID, page, perPage int) ([]models.DocumentResponse, int, error) {
-	if page < 1 {
-		page = 1
+// metadataValueCondition matches stored metadata against a filter value in
+// the canonical form each type is stored in, for every type the value is
+// valid as, so "2024.0" finds the number 2024.
+func metadataValueCondition(value string) (string, []interface{}) {
+	var matches []string
+	var args []interface{}
+	for _, valueType := range metadataValueTypes {
+		normalized, err := NormalizeMetadataValue(valueType, value)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, "(m.value_type = ? AND m.value = ?)")
+		args = append(args, valueType, normalized)
 	}
-	if perPage < 1 || perPage > 100 {
-		perPage = 20
+	if len(matches) == 0 {
+		return "FALSE", nil
 	}
-	offset := (page - 1) * perPage
+	return "(" + strings.Join(matches, " OR ") + ")", args
+}
 
-	// Get total count
-	var total int
-	err := s.db.QueryRow(
-		`SELECT COUNT(*) FROM document_shares ds
-		 JOIN documents d ON ds.document_id = d.id
-		 WHERE ds.shared_with_id = $1 AND d.deleted_at IS NULL
-		 AND (ds.expires_at IS NULL OR ds.expires_at > NOW())`,
-		userID,
-	).Scan(&total)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Get shared documents with owner info
-	rows, err := s.db.Query(
-		`SELECT d.id, d.owner_id, d.name, d.original_name, d.size, d.mime_type, d.encryption_algo,
-		        d.is_encrypted, d.created_at, d.updated_at, u.name as owner_name, ds.permission
-		 FROM document_shares ds
-		 JOIN documents d ON ds.document_id = d.id
-		 JOIN users u ON d.owner_id = u.id
-		 WHERE ds.shared_with_id = $1 AND d.deleted_at IS NULL
-		 AND (ds.expires_at IS NULL OR ds.expires_at > NOW())
-		 ORDER BY ds.created_at DESC LIMIT $2 OFFSET $3`,
-		userID, perPage, offset,
-	)
+// documentCursor is the position after the last item of a page. It is handed
+// to clients base64-encoded and only ever compared against the sort it was
+// issued for.
+type documentCursor struct {
+	Sort  string    `json:"s"`
+	Desc  bool      `json:"d"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func (c documentCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeDocumentCursor(s string) (*documentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
 	if err != nil {
-		return nil, 0, err
+		return nil, ErrInvalidCursor
+	}
+	var c documentCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
 	}
-	defer rows.Close()
+	return &c, nil
+}
 
-	var documents []models.DocumentResponse
-	for rows.Next() {
-		var doc models.DocumentResponse
-		var permission string
-		if err := rows.Scan(&doc.ID, &doc.OwnerID, &doc.Name, &doc.OriginalName, &doc.Size, &doc.MimeType,
-			&doc.EncryptionAlgo, &doc.IsEncrypted, &doc.CreatedAt, &doc.UpdatedAt, &doc.OwnerName, &permission); err != nil {
-			return nil, 0, err
+// listing resolves ListOptions against the sortable columns of one query.
+type listing struct {
+	sort     string
+	column   string
+	idColumn string
+	desc     bool
+	page     int
+	perPage  int
+	cursor   *documentCursor
+	after    interface{} // Typed cursor value for the sort column
+}
+
+func newListing(opts models.ListOptions, columns map[string]string, defaultSort, idColumn string) (*listing, error) {
+	l := &listing{idColumn: idColumn, page: opts.Page, perPage: opts.PerPage}
+	if l.page < 1 {
+		l.page = 1
+	}
+	if l.perPage < 1 || l.perPage > 100 {
+		l.perPage = 20
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodeDocumentCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
 		}
-		documents = append(documents, doc)
+		// The cursor carries its own ordering; explicit options must agree
+		if opts.Sort == "" {
+			opts.Sort = cursor.Sort
+		}
+		if opts.Order == "" {
+			opts.Order = "asc"
+			if cursor.Desc {
+				opts.Order = "desc"
+			}
+		}
+		l.cursor = cursor
+	}
+
+	l.sort = opts.Sort
+	if l.sort == "" {
+		l.sort = defaultSort
+	}
+	column, ok := columns[l.sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	l.column = column
+
+	switch strings.ToLower(opts.Order) {
+	case "", "desc":
+		// Names read naturally A-Z; everything else newest/largest first
+		l.desc = opts.Order != "" || l.sort != "name"
+	case "asc":
+		l.desc = false
+	default:
+		return nil, ErrInvalidSort
 	}
 
-	return documents, total, nil
+	if l.cursor != nil {
+		if l.cursor.Sort != l.sort || l.cursor.Desc != l.desc {
+			return nil, ErrInvalidCursor
+		}
+		after, err := l.cursorValue()
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		l.after = after
+	}
+	return l, nil
 }
 
-func (s *DocumentService) Delete(id, userID uuid.UUID) error {
+// seek restricts the query to rows after the cursor, if there is one.
+func (l *listing) seek(q *documentQuery) {
+	if l.cursor == nil {
+		return
+	}
+	op := ">"
+	if l.desc {
+		op = "<"
+	}
+	q.where(fmt.Sprintf("(%s, %s) %s (?, ?)", l.column, l.idColumn, op), l.after, l.cursor.ID)
+}
+
+func (l *listing) cursorValue() (interface{}, error) {
+	switch l.sort {
+	case "name":
+		return l.cursor.Value, nil
+	case "size":
+		return strconv.ParseInt(l.cursor.Value, 10, 64)
+	default:
+		return time.Parse(time.RFC3339Nano, l.cursor.Value)
+	}
+}
+
+// tail renders ORDER BY and LIMIT. Keyset pages fetch one extra row so
+// paginate can tell whether another page follows.
+func (l *listing) tail(q *documentQuery) string {
+	dir := "ASC"
+	if l.desc {
+		dir = "DESC"
+	}
+	order := fmt.Sprintf("ORDER BY %s %s, %s %s ", l.column, dir, l.idColumn, dir)
+	if l.cursor != nil {
+		return order + q.placeholders("LIMIT ?", l.perPage+1)
+	}
+	return order + q.placeholders("LIMIT ? OFFSET ?", l.perPage, (l.page-1)*l.perPage)
+}
+
+// paginate trims the look-ahead row of a keyset page and issues the cursor
+// for the next page. Offset pages get a cursor too, so clients can switch.
+func paginate[T any](l *listing, items []T, total int, key func(T) (string, uuid.UUID)) ([]T, models.PageInfo) {
+	info := models.PageInfo{Total: total, PerPage: l.perPage}
+
+	more := false
+	if l.cursor != nil {
+		more = len(items) > l.perPage
+		if more {
+			items = items[:l.perPage]
+		}
+	} else {
+		info.Page = l.page
+		more = (l.page-1)*l.perPage+len(items) < total
+	}
+
+	if more && len(items) > 0 {
+		value, id := key(items[len(items)-1])
+		info.NextCursor = documentCursor{Sort: l.sort, Desc: l.desc, Value: value, ID: id}.encode()
+	}
+	return items, info
+}
+
+// documentSortValue renders the value a document is ordered by for a cursor.
+func documentSortValue(field string, doc *models.Document, sharedAt time.Time) string {
+	switch field {
+	case "name":
+		return doc.Name
+	case "size":
+		return strconv.FormatInt(doc.Size, 10)
+	case "updated_at":
+		return doc.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case "shared_at":
+		return sharedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return doc.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func (s *DocumentService) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "DocumentService.Delete")
+	defer span.End()
+
 	// Check ownership
-	doc, err := s.GetByID(id)
+	doc, err := s.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -222,31 +573,54 @@ func (s *DocumentService) Delete(id, userID uuid.UUID) error {
 		return ErrAccessDenied
 	}
 
-	// Mark as deleted in database (soft delete for referential integrity)
-	now := time.Now()
-	_, err = s.db.Exec(
-		`UPDATE documents SET deleted_at = $1 WHERE id = $2`,
-		now, id,
-	)
+	// Mark as deleted in database (soft delete for referential integrity).
+	// An orphaned file is queued for removal in the same transaction.
+	event := s.webhookEvent(EventDocumentDeleted, id, userID, nil)
+	deletion, err := s.documents.Delete(ctx, id, userID, time.Now(), event)
 	if err != nil {
 		return err
 	}
 
-	// Delete the actual file from disk
-	// Note: If this fails, file remains but document is marked deleted
-	// A cleanup job could handle orphaned files
-	if err := os.Remove(doc.FilePath); err != nil && !os.IsNotExist(err) {
-		// Log the error but don't fail the operation
-		// In production, you'd want proper logging here
-		fmt.Printf("Warning: failed to delete file %s: %v\n", doc.FilePath, err)
+	// Only now that the delete has committed is it safe to remove the file
+	if deletion != nil {
+		s.removeFile(ctx, id, deletion, userID)
 	}
 
 	return nil
 }
 
-func (s *DocumentService) Share(documentID, ownerID uuid.UUID, sharedWithEmail, permission string) error {
+// removeFile deletes a queued file and drops it from the queue. On failure
+// the queue entry is left for the file reaper to retry, with an audit
+// record.
+func (s *DocumentService) removeFile(ctx context.Context, documentID uuid.UUID, deletion *FileDeletion, userID uuid.UUID) {
+	_, span := tracing.Start(ctx, "storage.Remove")
+	err := os.Remove(deletion.FilePath)
+	span.End()
+	if err != nil && !os.IsNotExist(err) {
+		if s.audit != nil {
+			s.audit.Record(ctx, &models.AuditEntry{
+				Action:     AuditFileDeleteFailed,
+				Outcome:    AuditFailure,
+				ActorID:    &userID,
+				TargetType: "document",
+				TargetID:   &documentID,
+				Details:    map[string]string{"error": err.Error()},
+			})
+		}
+		return
+	}
+	if err := s.documents.FileDeleted(ctx, deletion.ID); err != nil {
+		// The reaper will find the file gone and drop the entry itself
+		slog.ErrorContext(ctx, "failed to dequeue file removal", "deletion_id", deletion.ID, "error", err)
+	}
+}
+
+func (s *DocumentService) Share(ctx context.Context, documentID, ownerID uuid.UUID, sharedWithEmail, permission string) error {
+	ctx, span := tracing.Start(ctx, "DocumentService.Share")
+	defer span.End()
+
 	// Verify ownership
-	doc, err := s.GetByID(documentID)
+	doc, err := s.GetByID(ctx, documentID)
 	if err != nil {
 		return err
 	}
@@ -254,29 +628,41 @@ func (s *DocumentService) Share(documentID, ownerID uuid.UUID, sharedWithEmail,
 		return ErrAccessDenied
 	}
 
-	// Get shared user
-	var sharedWithID uuid.UUID
-	err = s.db.QueryRow(`SELECT id FROM users WHERE email = $1`, sharedWithEmail).Scan(&sharedWithID)
-	if err == sql.ErrNoRows {
-		return ErrUserNotFound
-	}
+	// The repository adds the grantee's ID once it has looked them up
+	event := s.webhookEvent(EventDocumentShared, documentID, ownerID, map[string]interface{}{
+		"permission": permission,
+	})
+	sharedWithID, err := s.shares.Share(ctx, documentID, ownerID, sharedWithEmail, permission, event)
 	if err != nil {
 		return err
 	}
 
-	// Create share
-	_, err = s.db.Exec(
-		`INSERT INTO document_shares (document_id, shared_by_id, shared_with_id, permission)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (document_id, shared_with_id) DO UPDATE SET permission = $4`,
-		documentID, ownerID, sharedWithID, permission,
-	)
-	return err
+	if s.events != nil {
+		logPublishError(UserEventDocumentShared, s.events.Notify(ctx, []uuid.UUID{sharedWithID}, models.UserEvent{
+			Type:       UserEventDocumentShared,
+			ActorID:    ownerID,
+			DocumentID: &documentID,
+			Data:       map[string]interface{}{"name": doc.Name, "permission": permission},
+		}))
+	}
+	if s.notifications != nil {
+		logNotifyError(NotificationDocumentShared, s.notifications.Notify(ctx, sharedWithID, models.Notification{
+			Type:       NotificationDocumentShared,
+			ActorID:    &ownerID,
+			DocumentID: &documentID,
+			Data:       map[string]interface{}{"name": doc.Name, "permission": permission},
+		}))
+	}
+
+	return nil
 }
 
-func (s *DocumentService) RemoveShare(documentID, ownerID, sharedWithID uuid.UUID) error {
+func (s *DocumentService) RemoveShare(ctx context.Context, documentID, ownerID, sharedWithID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "DocumentService.RemoveShare")
+	defer span.End()
+
 	// Verify ownership
-	doc, err := s.GetByID(documentID)
+	doc, err := s.GetByID(ctx, documentID)
 	if err != nil {
 		return err
 	}
@@ -284,24 +670,27 @@ func (s *DocumentService) RemoveShare(documentID, ownerID, sharedWithID uuid.UUI
 		return ErrAccessDenied
 	}
 
-	result, err := s.db.Exec(
-		`DELETE FROM document_shares WHERE document_id = $1 AND shared_with_id = $2`,
-		documentID, sharedWithID,
-	)
-	if err != nil {
+	if err := s.shares.Remove(ctx, documentID, sharedWithID); err != nil {
 		return err
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return ErrShareNotFound
+	if s.events != nil {
+		logPublishError(UserEventShareRevoked, s.events.Notify(ctx, []uuid.UUID{sharedWithID}, models.UserEvent{
+			Type:       UserEventShareRevoked,
+			ActorID:    ownerID,
+			DocumentID: &documentID,
+			Data:       map[string]interface{}{"name": doc.Name},
+		}))
 	}
 
 	return nil
 }
 
-func (s *DocumentService) GetFilePath(id, userID uuid.UUID) (string, error) {
-	doc, err := s.GetByID(id)
+func (s *DocumentService) GetFilePath(ctx context.Context, id, userID uuid.UUID) (string, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.GetFilePath")
+	defer span.End()
+
+	doc, err := s.GetByID(ctx, id)
 	if err != nil {
 		return "", err
 	}
@@ -311,26 +700,84 @@ func (s *DocumentService) GetFilePath(id, userID uuid.UUID) (string, error) {
 		return doc.FilePath, nil
 	}
 
-	// Check if document is shared with user
-	var count int
-	err = s.db.QueryRow(
-		`SELECT COUNT(*) FROM document_shares
-		 WHERE document_id = $1 AND shared_with_id = $2
-		 AND (expires_at IS NULL OR expires_at > NOW())`,
-		id, userID,
-	).Scan(&count)
+	// Check if document is shared with user, directly or through a folder
+	permission, err := s.sharedPermission(ctx, id, userID)
 	if err != nil {
 		return "", err
 	}
-	if count == 0 {
+	if permission == "" {
 		return "", ErrAccessDenied
 	}
 
 	return doc.FilePath, nil
 }
 
-func (s *DocumentService) CanAccess(documentID, userID uuid.UUID) (bool, string, error) {
-	doc, err := s.GetByID(documentID)
+// Readable returns the listed documents the user owns or has been shared,
+// in the order given. Missing and inaccessible documents are left out.
+func (s *DocumentService) Readable(ctx context.Context, ids []uuid.UUID, userID uuid.UUID) ([]*models.Document, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.Readable")
+	defer span.End()
+
+	var docs []*models.Document
+	for _, id := range ids {
+		doc, err := s.GetByID(ctx, id)
+		if err == ErrDocumentNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if doc.OwnerID != userID {
+			permission, err := s.sharedPermission(ctx, id, userID)
+			if err != nil {
+				return nil, err
+			}
+			if permission == "" {
+				continue
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// ContentHash returns the hex SHA-256 of the document's content. Documents
+// uploaded before hashes were recorded are hashed on first use.
+func (s *DocumentService) ContentHash(ctx context.Context, doc *models.Document) (string, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.ContentHash")
+	defer span.End()
+
+	if doc.SHA256 != "" {
+		return doc.SHA256, nil
+	}
+
+	_, hashSpan := tracing.Start(ctx, "storage.Hash")
+	defer hashSpan.End()
+
+	file, err := os.Open(doc.FilePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	doc.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := s.documents.SetSHA256(ctx, doc.ID, doc.SHA256); err != nil {
+		return "", err
+	}
+	return doc.SHA256, nil
+}
+
+func (s *DocumentService) CanAccess(ctx context.Context, documentID, userID uuid.UUID) (bool, string, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.CanAccess")
+	defer span.End()
+
+	doc, err := s.GetByID(ctx, documentID)
 	if err != nil {
 		return false, "", err
 	}
@@ -341,25 +788,30 @@ func (s *DocumentService) CanAccess(documentID, userID uuid.UUID) (bool, string,
 	}
 
 	// Check share permissions
-	var permission string
-	err = s.db.QueryRow(
-		`SELECT permission FROM document_shares
-		 WHERE document_id = $1 AND shared_with_id = $2
-		 AND (expires_at IS NULL OR expires_at > NOW())`,
-		documentID, userID,
-	).Scan(&permission)
-	if err == sql.ErrNoRows {
-		return false, "", nil
-	}
+	permission, err := s.sharedPermission(ctx, documentID, userID)
 	if err != nil {
 		return false, "", err
 	}
+	if permission == "" {
+		return false, "", nil
+	}
 
 	return true, permission, nil
 }
 
-func (s *DocumentService) Rename(id, userID uuid.UUID, newName string) error {
-	canAccess, permission, err := s.CanAccess(id, userID)
+// sharedPermission returns "" when the user holds no share on the document.
+func (s *DocumentService) sharedPermission(ctx context.Context, documentID, userID uuid.UUID) (string, error) {
+	ctx, span := tracing.Start(ctx, "DocumentService.sharedPermission")
+	defer span.End()
+
+	return s.shares.Permission(ctx, documentID, userID)
+}
+
+func (s *DocumentService) Rename(ctx context.Context, id, userID uuid.UUID, newName string) error {
+	ctx, span := tracing.Start(ctx, "DocumentService.Rename")
+	defer span.End()
+
+	canAccess, permission, err := s.CanAccess(ctx, id, userID)
 	if err != nil {
 		return err
 	}
@@ -367,9 +819,55 @@ func (s *DocumentService) Rename(id, userID uuid.UUID, newName string) error {
 		return ErrAccessDenied
 	}
 
-	_, err = s.db.Exec(
-		`UPDATE documents SET name = $1, updated_at = $2 WHERE id = $3`,
-		newName, time.Now(), id,
-	)
-	return err
+	event := s.webhookEvent(EventDocumentRenamed, id, userID, map[string]interface{}{"name": newName})
+	if err := s.documents.Rename(ctx, id, newName, time.Now(), event); err != nil {
+		return err
+	}
+
+	if s.events != nil {
+		logPublishError(UserEventDocumentRenamed, s.events.NotifyCollaborators(ctx, id, models.UserEvent{
+			Type:    UserEventDocumentRenamed,
+			ActorID: userID,
+			Data:    map[string]interface{}{"name": newName},
+		}))
+	}
+
+	return nil
+}
+
+// Move places a document into one of the owner's folders, or back at the root
+// when folderID is nil.
+func (s *DocumentService) Move(ctx context.Context, id, userID uuid.UUID, folderID *uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "DocumentService.Move")
+	defer span.End()
+
+	doc, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if doc.OwnerID != userID {
+		return ErrAccessDenied
+	}
+
+	if folderID != nil {
+		folderOwner, err := s.documents.FolderOwner(ctx, *folderID)
+		if err != nil {
+			return err
+		}
+		// Documents only live in their owner's tree so folder shares stay meaningful
+		if folderOwner != userID {
+			return ErrAccessDenied
+		}
+	}
+
+	return s.documents.Move(ctx, id, folderID, time.Now())
+}
+
+// webhookEvent describes a change for the repository to queue alongside it,
+// or returns nil when the service has no webhooks.
+func (s *DocumentService) webhookEvent(eventType string, documentID, actorID uuid.UUID, data map[string]interface{}) *models.WebhookEvent {
+	if s.webhooks == nil {
+		return nil
+	}
+	return newWebhookEvent(eventType, documentID, actorID, data)
 }
@@ -2,17 +2,73 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// documentColumns mirrors the column list selected by DocumentService.GetByID
+var documentColumns = []string{
+	"id", "owner_id", "name", "original_name", "size", "mime_type",
+	"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at", "folder_id", "sha256",
+}
+
+var blobUpsertColumns = []string{"id", "file_path", "inserted", "corrupted"}
+
+// expectNewBlob expects an upload whose content the owner doesn't have yet.
+func expectNewBlob(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO blobs .+ON CONFLICT \(owner_id, sha256\) DO UPDATE SET ref_count = blobs.ref_count \+ 1`).
+		WillReturnRows(sqlmock.NewRows(blobUpsertColumns).AddRow(uuid.New(), "", true, false))
+}
+
+// expectDeleteLock expects Delete to open its transaction and lock the
+// document.
+func expectDeleteLock(mock sqlmock.Sqlmock, docID, ownerID uuid.UUID, filePath string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT owner_id, file_path FROM documents WHERE id = \$1 AND deleted_at IS NULL FOR UPDATE`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "file_path"}).AddRow(ownerID, filePath))
+}
+
+// expectFileQueued expects an orphaned file to be queued and the delete to
+// commit.
+func expectFileQueued(mock sqlmock.Sqlmock, docID uuid.UUID, filePath string) {
+	mock.ExpectExec(`INSERT INTO file_deletions \(id, document_id, file_path\)`).
+		WithArgs(sqlmock.AnyArg(), docID, filePath).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// expectShareLock expects Share to open its transaction and lock the
+// document.
+func expectShareLock(mock sqlmock.Sqlmock, docID, ownerID uuid.UUID) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT owner_id FROM documents WHERE id = \$1 AND deleted_at IS NULL FOR SHARE`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+}
+
+// documentListColumns mirrors the column list selected by the listing queries
+var documentListColumns = []string{
+	"id", "owner_id", "name", "original_name", "size", "mime_type",
+	"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "folder_id",
+}
+
 func TestNewDocumentService(t *testing.T) {
 	db, _ := newMockDB(t)
 	defer db.Close()
@@ -24,8 +80,8 @@ func TestNewDocumentService(t *testing.T) {
 		t.Fatal("NewDocumentService returned nil")
 	}
 
-	if service.db != db {
-		t.Error("DocumentService.db not set correctly")
+	if documents, ok := service.documents.(*postgresDocumentRepository); !ok || documents.db != db {
+		t.Error("DocumentService.documents not backed by the database")
 	}
 
 	if service.uploadDir != tempDir {
@@ -56,6 +112,7 @@ func TestNewDocumentService_CreatesDirectory(t *testing.T) {
 }
 
 func TestDocumentService_Create_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -69,6 +126,7 @@ func TestDocumentService_Create_Success(t *testing.T) {
 	fileContent := []byte("test file content")
 	fileData := bytes.NewReader(fileContent)
 
+	expectNewBlob(mock)
 	mock.ExpectExec(`INSERT INTO documents`).
 		WithArgs(
 			sqlmock.AnyArg(), // id
@@ -82,10 +140,15 @@ func TestDocumentService_Create_Success(t *testing.T) {
 			false,
 			sqlmock.AnyArg(), // created_at
 			sqlmock.AnyArg(), // updated_at
+			"",               // content_text
+			"60f5237ed4049f0382661ef009d2bc42e48c3ceb3edb6600f7024e7ab3b838f3", // sha256
+			sqlmock.AnyArg(), // blob_id
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhookEmit(mock, EventDocumentCreated)
+	mock.ExpectCommit()
 
-	doc, err := service.Create(ownerID, name, originalName, mimeType, int64(len(fileContent)), fileData)
+	doc, err := service.Create(ctx, ownerID, name, originalName, mimeType, int64(len(fileContent)), fileData, "")
 	if err != nil {
 		t.Fatalf("Create() error = %v", err)
 	}
@@ -132,7 +195,41 @@ func TestDocumentService_Create_Success(t *testing.T) {
 	os.Remove(doc.FilePath)
 }
 
+func TestDocumentService_Create_IndexesText(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	fileContent := []byte("Quarterly   revenue\nforecast")
+
+	expectNewBlob(mock)
+	mock.ExpectExec(`INSERT INTO documents .+content_text`).
+		WithArgs(
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			"Quarterly revenue forecast", sqlmock.AnyArg(), sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// Text files get a preview, queued with the document
+	mock.ExpectExec(`INSERT INTO document_previews \(document_id\) VALUES \(\$1\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhookEmit(mock, EventDocumentCreated)
+	mock.ExpectCommit()
+
+	if _, err := service.Create(ctx, uuid.New(), "", "notes.txt", "text/plain", int64(len(fileContent)), bytes.NewReader(fileContent), ""); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
 func TestDocumentService_Create_InvalidContentType(t *testing.T) {
+	ctx := context.Background()
 	db, _ := newMockDB(t)
 	defer db.Close()
 
@@ -142,7 +239,7 @@ func TestDocumentService_Create_InvalidContentType(t *testing.T) {
 	ownerID := uuid.New()
 	fileData := bytes.NewReader([]byte("test"))
 
-	_, err := service.Create(ownerID, "test", "test.exe", "application/x-executable", 4, fileData)
+	_, err := service.Create(ctx, ownerID, "test", "test.exe", "application/x-executable", 4, fileData, "")
 
 	if err == nil {
 		t.Error("Create() should reject invalid content type")
@@ -150,6 +247,7 @@ func TestDocumentService_Create_InvalidContentType(t *testing.T) {
 }
 
 func TestDocumentService_Create_InvalidFilename(t *testing.T) {
+	ctx := context.Background()
 	db, _ := newMockDB(t)
 	defer db.Close()
 
@@ -160,7 +258,7 @@ func TestDocumentService_Create_InvalidFilename(t *testing.T) {
 	fileData := bytes.NewReader([]byte("test"))
 
 	// Test with empty original filename
-	_, err := service.Create(ownerID, "test", "", "application/pdf", 4, fileData)
+	_, err := service.Create(ctx, ownerID, "test", "", "application/pdf", 4, fileData, "")
 
 	if err == nil {
 		t.Error("Create() should reject empty filename")
@@ -168,6 +266,7 @@ func TestDocumentService_Create_InvalidFilename(t *testing.T) {
 }
 
 func TestDocumentService_Create_PathTraversalPrevention(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -179,10 +278,13 @@ func TestDocumentService_Create_PathTraversalPrevention(t *testing.T) {
 	fileContent := []byte("test")
 	fileData := bytes.NewReader(fileContent)
 
+	expectNewBlob(mock)
 	mock.ExpectExec(`INSERT INTO documents`).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhookEmit(mock, EventDocumentCreated)
+	mock.ExpectCommit()
 
-	doc, err := service.Create(ownerID, maliciousName, "test.pdf", "application/pdf", int64(len(fileContent)), fileData)
+	doc, err := service.Create(ctx, ownerID, maliciousName, "test.pdf", "application/pdf", int64(len(fileContent)), fileData, "")
 	if err != nil {
 		t.Fatalf("Create() error = %v", err)
 	}
@@ -202,6 +304,7 @@ func TestDocumentService_Create_PathTraversalPrevention(t *testing.T) {
 }
 
 func TestDocumentService_Create_DBError_CleansUpFile(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -213,10 +316,12 @@ func TestDocumentService_Create_DBError_CleansUpFile(t *testing.T) {
 	fileData := bytes.NewReader(fileContent)
 
 	dbError := errors.New("database error")
+	expectNewBlob(mock)
 	mock.ExpectExec(`INSERT INTO documents`).
 		WillReturnError(dbError)
+	mock.ExpectRollback()
 
-	_, err := service.Create(ownerID, "test", "test.pdf", "application/pdf", int64(len(fileContent)), fileData)
+	_, err := service.Create(ctx, ownerID, "test", "test.pdf", "application/pdf", int64(len(fileContent)), fileData, "")
 
 	if err == nil {
 		t.Error("Create() should return error on DB failure")
@@ -229,7 +334,135 @@ func TestDocumentService_Create_DBError_CleansUpFile(t *testing.T) {
 	}
 }
 
+func TestDocumentService_Create_DigestMismatch(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	service := NewDocumentService(db, tempDir)
+
+	fileContent := []byte("test file content")
+	wrong := strings.Repeat("ab", 32)
+
+	_, err := service.Create(ctx, uuid.New(), "test", "test.pdf", "application/pdf", int64(len(fileContent)), bytes.NewReader(fileContent), wrong)
+	if err != ErrDigestMismatch {
+		t.Fatalf("Create() error = %v, want ErrDigestMismatch", err)
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Error("Rejected upload should be removed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Create_InvalidDigest(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	for _, digest := range []string{"abc123", strings.Repeat("zz", 32), strings.Repeat("a", 65)} {
+		_, err := service.Create(ctx, uuid.New(), "test", "test.pdf", "application/pdf", 4, bytes.NewReader([]byte("test")), digest)
+		if err != ErrInvalidDigest {
+			t.Errorf("Create(%q) error = %v, want ErrInvalidDigest", digest, err)
+		}
+	}
+}
+
+func TestDocumentService_Create_DeduplicatesContent(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	service := NewDocumentService(db, tempDir)
+
+	ownerID := uuid.New()
+	fileContent := []byte("test file content")
+	// The expected digest is accepted in upper case too
+	digest := "60F5237ED4049F0382661EF009D2BC42E48C3CEB3EDB6600F7024E7AB3B838F3"
+	blobID := uuid.New()
+	blobPath := filepath.Join(tempDir, "existing")
+	os.WriteFile(blobPath, fileContent, 0600)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO blobs`).
+		WithArgs(sqlmock.AnyArg(), ownerID, strings.ToLower(digest), int64(len(fileContent)), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(blobUpsertColumns).AddRow(blobID, blobPath, false, false))
+	mock.ExpectExec(`INSERT INTO documents`).
+		WithArgs(
+			sqlmock.AnyArg(), ownerID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			blobPath, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), strings.ToLower(digest), blobID,
+		).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhookEmit(mock, EventDocumentCreated)
+	mock.ExpectCommit()
+
+	doc, err := service.Create(ctx, ownerID, "copy", "copy.pdf", "application/pdf", int64(len(fileContent)), bytes.NewReader(fileContent), digest)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if doc.FilePath != blobPath {
+		t.Errorf("doc.FilePath = %q, want the existing blob %q", doc.FilePath, blobPath)
+	}
+
+	// Only the original file is left
+	files, _ := os.ReadDir(tempDir)
+	if len(files) != 1 || files[0].Name() != "existing" {
+		t.Errorf("Duplicate upload should be removed, found %v", files)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Create_RepairsCorruptedBlob(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	service := NewDocumentService(db, tempDir)
+
+	fileContent := []byte("test file content")
+	blobID := uuid.New()
+	blobPath := filepath.Join(tempDir, "existing")
+	os.WriteFile(blobPath, []byte("bit rot"), 0600)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO blobs`).
+		WillReturnRows(sqlmock.NewRows(blobUpsertColumns).AddRow(blobID, blobPath, false, true))
+	mock.ExpectExec(`UPDATE blobs SET corrupted_at = NULL, verified_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(blobID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO documents`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhookEmit(mock, EventDocumentCreated)
+	mock.ExpectCommit()
+
+	if _, err := service.Create(ctx, uuid.New(), "copy", "copy.pdf", "application/pdf", int64(len(fileContent)), bytes.NewReader(fileContent), ""); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if data, _ := os.ReadFile(blobPath); string(data) != string(fileContent) {
+		t.Errorf("blob content = %q, want the fresh upload", data)
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 1 {
+		t.Errorf("Expected only the repaired blob on disk, found %d files", len(files))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
 func TestDocumentService_GetByID_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -238,19 +471,16 @@ func TestDocumentService_GetByID_Success(t *testing.T) {
 	docID := uuid.New()
 	ownerID := uuid.New()
 
-	rows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(
+	rows := sqlmock.NewRows(documentColumns).AddRow(
 		docID, ownerID, "Test Doc", "test.pdf", 1024, "application/pdf",
-		"AES-256-GCM", "/path/to/file", false, time.Now(), time.Now(), nil,
+		"AES-256-GCM", "/path/to/file", false, time.Now(), time.Now(), nil, nil, "",
 	)
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(rows)
 
-	doc, err := service.GetByID(docID)
+	doc, err := service.GetByID(ctx, docID)
 	if err != nil {
 		t.Fatalf("GetByID() error = %v", err)
 	}
@@ -265,6 +495,7 @@ func TestDocumentService_GetByID_Success(t *testing.T) {
 }
 
 func TestDocumentService_GetByID_NotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -275,7 +506,7 @@ func TestDocumentService_GetByID_NotFound(t *testing.T) {
 		WithArgs(docID).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err := service.GetByID(docID)
+	_, err := service.GetByID(ctx, docID)
 
 	if err != ErrDocumentNotFound {
 		t.Errorf("GetByID() error = %v, want ErrDocumentNotFound", err)
@@ -286,7 +517,29 @@ func TestDocumentService_GetByID_NotFound(t *testing.T) {
 	}
 }
 
+func TestDocumentService_GetByID_Cancelled(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewDocumentService(db, t.TempDir())
+
+	// The client went away while the query was running
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows(documentColumns))
+
+	start := time.Now()
+	if _, err := service.GetByID(ctx, uuid.New()); err == nil {
+		t.Fatal("GetByID() error = nil, want the cancellation")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("GetByID() returned after %v, want it to stop at the deadline", elapsed)
+	}
+}
+
 func TestDocumentService_GetByOwner_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -300,18 +553,15 @@ func TestDocumentService_GetByOwner_Success(t *testing.T) {
 		WillReturnRows(countRows)
 
 	// Mock documents query
-	docRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at",
-	}).
-		AddRow(uuid.New(), ownerID, "Doc 1", "doc1.pdf", 1024, "application/pdf", "AES-256-GCM", "/path/1", false, time.Now(), time.Now()).
-		AddRow(uuid.New(), ownerID, "Doc 2", "doc2.pdf", 2048, "application/pdf", "AES-256-GCM", "/path/2", false, time.Now(), time.Now())
+	docRows := sqlmock.NewRows(documentListColumns).
+		AddRow(uuid.New(), ownerID, "Doc 1", "doc1.pdf", 1024, "application/pdf", "AES-256-GCM", "/path/1", false, time.Now(), time.Now(), nil).
+		AddRow(uuid.New(), ownerID, "Doc 2", "doc2.pdf", 2048, "application/pdf", "AES-256-GCM", "/path/2", false, time.Now(), time.Now(), nil)
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL`).
 		WithArgs(ownerID, 20, 0).
 		WillReturnRows(docRows)
 
-	docs, total, err := service.GetByOwner(ownerID, 1, 20)
+	docs, total, err := service.GetByOwner(ctx, ownerID, 1, 20)
 	if err != nil {
 		t.Fatalf("GetByOwner() error = %v", err)
 	}
@@ -330,6 +580,7 @@ func TestDocumentService_GetByOwner_Success(t *testing.T) {
 }
 
 func TestDocumentService_GetByOwner_Pagination(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -357,16 +608,13 @@ func TestDocumentService_GetByOwner_Pagination(t *testing.T) {
 				WithArgs(ownerID).
 				WillReturnRows(countRows)
 
-			docRows := sqlmock.NewRows([]string{
-				"id", "owner_id", "name", "original_name", "size", "mime_type",
-				"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at",
-			})
+			docRows := sqlmock.NewRows(documentListColumns)
 
 			mock.ExpectQuery(`SELECT .+ FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL`).
 				WithArgs(ownerID, tt.expectedLimit, tt.expectedOffset).
 				WillReturnRows(docRows)
 
-			_, _, err := service.GetByOwner(ownerID, tt.page, tt.perPage)
+			_, _, err := service.GetByOwner(ctx, ownerID, tt.page, tt.perPage)
 			if err != nil {
 				t.Fatalf("GetByOwner() error = %v", err)
 			}
@@ -379,6 +627,7 @@ func TestDocumentService_GetByOwner_Pagination(t *testing.T) {
 }
 
 func TestDocumentService_Delete_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -393,21 +642,30 @@ func TestDocumentService_Delete_Success(t *testing.T) {
 	os.WriteFile(filePath, []byte("test"), 0644)
 
 	// Mock GetByID
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", filePath, false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", filePath, false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	// Mock soft delete
-	mock.ExpectExec(`UPDATE documents SET deleted_at = \$1 WHERE id = \$2`).
+	// Mock soft delete, releasing the last reference to the blob
+	expectDeleteLock(mock, docID, ownerID, filePath)
+	expectWebhookEmit(mock, EventDocumentDeleted)
+	blobID := uuid.New()
+	mock.ExpectQuery(`UPDATE documents SET deleted_at = \$1 WHERE id = \$2 RETURNING blob_id\)\s+UPDATE blobs SET ref_count = ref_count - 1`).
 		WithArgs(sqlmock.AnyArg(), docID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ref_count"}).AddRow(blobID, 0))
+	mock.ExpectQuery(`DELETE FROM blobs WHERE id = \$1 AND ref_count <= 0`).
+		WithArgs(blobID).
+		WillReturnRows(sqlmock.NewRows([]string{"orphaned"}).AddRow(true))
+	expectFileQueued(mock, docID, filePath)
+
+	// The file is gone, so the queued removal is dropped
+	mock.ExpectExec(`DELETE FROM file_deletions WHERE id = \$1`).
+		WithArgs(sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := service.Delete(docID, ownerID)
+	err := service.Delete(ctx, docID, ownerID)
 	if err != nil {
 		t.Fatalf("Delete() error = %v", err)
 	}
@@ -422,7 +680,152 @@ func TestDocumentService_Delete_Success(t *testing.T) {
 	}
 }
 
+func TestDocumentService_Delete_KeepsSharedBlob(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	service := NewDocumentService(db, tempDir)
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	filePath := filepath.Join(tempDir, "blob")
+	os.WriteFile(filePath, []byte("test"), 0644)
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", filePath, false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	// Another document still has the same content
+	expectDeleteLock(mock, docID, ownerID, filePath)
+	expectWebhookEmit(mock, EventDocumentDeleted)
+	mock.ExpectQuery(`UPDATE blobs SET ref_count = ref_count - 1`).
+		WithArgs(sqlmock.AnyArg(), docID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ref_count"}).AddRow(uuid.New(), 1))
+	mock.ExpectCommit()
+
+	if err := service.Delete(ctx, docID, ownerID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("Shared file should be kept: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Delete_LegacyDocument(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	service := NewDocumentService(db, tempDir)
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	filePath := filepath.Join(tempDir, docID.String())
+	os.WriteFile(filePath, []byte("test"), 0644)
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", filePath, false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	// No blob row: the document predates deduplication
+	expectDeleteLock(mock, docID, ownerID, filePath)
+	expectWebhookEmit(mock, EventDocumentDeleted)
+	mock.ExpectQuery(`UPDATE blobs SET ref_count = ref_count - 1`).
+		WithArgs(sqlmock.AnyArg(), docID).
+		WillReturnError(sql.ErrNoRows)
+	expectFileQueued(mock, docID, filePath)
+	mock.ExpectExec(`DELETE FROM file_deletions WHERE id = \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := service.Delete(ctx, docID, ownerID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Error("File should be deleted from disk")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Delete_CommitFails(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	tempDir := t.TempDir()
+	service := NewDocumentService(db, tempDir)
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	filePath := filepath.Join(tempDir, docID.String())
+	os.WriteFile(filePath, []byte("test"), 0644)
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", filePath, false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	expectDeleteLock(mock, docID, ownerID, filePath)
+	expectWebhookEmit(mock, EventDocumentDeleted)
+	mock.ExpectQuery(`UPDATE blobs SET ref_count = ref_count - 1`).
+		WithArgs(sqlmock.AnyArg(), docID).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`INSERT INTO file_deletions`).
+		WithArgs(sqlmock.AnyArg(), docID, filePath).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	if err := service.Delete(ctx, docID, ownerID); err == nil {
+		t.Fatal("Delete() error = nil, want the commit failure")
+	}
+	// The document is still there, so its file must be too
+	if _, err := os.Stat(filePath); err != nil {
+		t.Errorf("File should be kept when the delete doesn't commit: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Delete_TransferredMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	// A transfer committed after the first read
+	expectDeleteLock(mock, docID, uuid.New(), "/path")
+	mock.ExpectRollback()
+
+	if err := service.Delete(ctx, docID, ownerID); err != ErrAccessDenied {
+		t.Errorf("Delete() after a transfer error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
 func TestDocumentService_Delete_NotOwner(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -432,16 +835,13 @@ func TestDocumentService_Delete_NotOwner(t *testing.T) {
 	ownerID := uuid.New()
 	otherUserID := uuid.New()
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	err := service.Delete(docID, otherUserID)
+	err := service.Delete(ctx, docID, otherUserID)
 
 	if err != ErrAccessDenied {
 		t.Errorf("Delete() by non-owner error = %v, want ErrAccessDenied", err)
@@ -453,6 +853,7 @@ func TestDocumentService_Delete_NotOwner(t *testing.T) {
 }
 
 func TestDocumentService_Share_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -464,16 +865,14 @@ func TestDocumentService_Share_Success(t *testing.T) {
 	sharedWithEmail := "shared@example.com"
 
 	// Mock GetByID
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
 	// Mock get shared user
+	expectShareLock(mock, docID, ownerID)
 	userRows := sqlmock.NewRows([]string{"id"}).AddRow(sharedWithID)
 	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
 		WithArgs(sharedWithEmail).
@@ -483,8 +882,12 @@ func TestDocumentService_Share_Success(t *testing.T) {
 	mock.ExpectExec(`INSERT INTO document_shares`).
 		WithArgs(docID, ownerID, sharedWithID, "view").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhookEmit(mock, EventDocumentShared)
+	mock.ExpectCommit()
+	expectUserEvent(mock)
+	expectNotification(mock, NotificationDocumentShared)
 
-	err := service.Share(docID, ownerID, sharedWithEmail, "view")
+	err := service.Share(ctx, docID, ownerID, sharedWithEmail, "view")
 	if err != nil {
 		t.Fatalf("Share() error = %v", err)
 	}
@@ -495,6 +898,7 @@ func TestDocumentService_Share_Success(t *testing.T) {
 }
 
 func TestDocumentService_Share_UserNotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -504,21 +908,20 @@ func TestDocumentService_Share_UserNotFound(t *testing.T) {
 	ownerID := uuid.New()
 
 	// Mock GetByID
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
 	// Mock user not found
+	expectShareLock(mock, docID, ownerID)
 	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
 		WithArgs("nonexistent@example.com").
 		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
 
-	err := service.Share(docID, ownerID, "nonexistent@example.com", "view")
+	err := service.Share(ctx, docID, ownerID, "nonexistent@example.com", "view")
 
 	if err != ErrUserNotFound {
 		t.Errorf("Share() with non-existent user error = %v, want ErrUserNotFound", err)
@@ -529,7 +932,35 @@ func TestDocumentService_Share_UserNotFound(t *testing.T) {
 	}
 }
 
+func TestDocumentService_Share_TransferredMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	// A transfer committed after the first read
+	expectShareLock(mock, docID, uuid.New())
+	mock.ExpectRollback()
+
+	if err := service.Share(ctx, docID, ownerID, "shared@example.com", "view"); err != ErrAccessDenied {
+		t.Errorf("Share() after a transfer error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
 func TestDocumentService_Share_NotOwner(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -539,16 +970,13 @@ func TestDocumentService_Share_NotOwner(t *testing.T) {
 	ownerID := uuid.New()
 	otherUserID := uuid.New()
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	err := service.Share(docID, otherUserID, "test@example.com", "view")
+	err := service.Share(ctx, docID, otherUserID, "test@example.com", "view")
 
 	if err != ErrAccessDenied {
 		t.Errorf("Share() by non-owner error = %v, want ErrAccessDenied", err)
@@ -560,6 +988,7 @@ func TestDocumentService_Share_NotOwner(t *testing.T) {
 }
 
 func TestDocumentService_CanAccess_Owner(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -568,16 +997,13 @@ func TestDocumentService_CanAccess_Owner(t *testing.T) {
 	docID := uuid.New()
 	ownerID := uuid.New()
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	canAccess, permission, err := service.CanAccess(docID, ownerID)
+	canAccess, permission, err := service.CanAccess(ctx, docID, ownerID)
 	if err != nil {
 		t.Fatalf("CanAccess() error = %v", err)
 	}
@@ -596,6 +1022,7 @@ func TestDocumentService_CanAccess_Owner(t *testing.T) {
 }
 
 func TestDocumentService_CanAccess_SharedUser(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -605,10 +1032,7 @@ func TestDocumentService_CanAccess_SharedUser(t *testing.T) {
 	ownerID := uuid.New()
 	sharedUserID := uuid.New()
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
@@ -620,7 +1044,7 @@ func TestDocumentService_CanAccess_SharedUser(t *testing.T) {
 		WithArgs(docID, sharedUserID).
 		WillReturnRows(shareRows)
 
-	canAccess, permission, err := service.CanAccess(docID, sharedUserID)
+	canAccess, permission, err := service.CanAccess(ctx, docID, sharedUserID)
 	if err != nil {
 		t.Fatalf("CanAccess() error = %v", err)
 	}
@@ -639,6 +1063,7 @@ func TestDocumentService_CanAccess_SharedUser(t *testing.T) {
 }
 
 func TestDocumentService_CanAccess_NoAccess(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -648,10 +1073,7 @@ func TestDocumentService_CanAccess_NoAccess(t *testing.T) {
 	ownerID := uuid.New()
 	otherUserID := uuid.New()
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
@@ -662,7 +1084,7 @@ func TestDocumentService_CanAccess_NoAccess(t *testing.T) {
 		WithArgs(docID, otherUserID).
 		WillReturnError(sql.ErrNoRows)
 
-	canAccess, permission, err := service.CanAccess(docID, otherUserID)
+	canAccess, permission, err := service.CanAccess(ctx, docID, otherUserID)
 	if err != nil {
 		t.Fatalf("CanAccess() error = %v", err)
 	}
@@ -681,6 +1103,7 @@ func TestDocumentService_CanAccess_NoAccess(t *testing.T) {
 }
 
 func TestDocumentService_Rename_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -691,21 +1114,27 @@ func TestDocumentService_Rename_Success(t *testing.T) {
 	newName := "New Document Name"
 
 	// Mock GetByID for CanAccess
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Old Name", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Old Name", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	// Mock update
+	// Mock update, queueing the webhook in the same transaction
+	mock.ExpectBegin()
 	mock.ExpectExec(`UPDATE documents SET name = \$1, updated_at = \$2 WHERE id = \$3`).
 		WithArgs(newName, sqlmock.AnyArg(), docID).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectWebhookEmit(mock, EventDocumentRenamed)
+	mock.ExpectCommit()
+
+	// The owner renamed it, so only the collaborator is notified
+	mock.ExpectQuery(`WITH RECURSIVE ancestors .+ SELECT owner_id FROM documents WHERE id = \$1\s+UNION\s+SELECT shared_with_id FROM document_shares .+ SELECT fs.shared_with_id FROM folder_shares fs`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(ownerID).AddRow(uuid.New()))
+	expectUserEvent(mock)
 
-	err := service.Rename(docID, ownerID, newName)
+	err := service.Rename(ctx, docID, ownerID, newName)
 	if err != nil {
 		t.Fatalf("Rename() error = %v", err)
 	}
@@ -716,6 +1145,7 @@ func TestDocumentService_Rename_Success(t *testing.T) {
 }
 
 func TestDocumentService_Rename_NoEditPermission(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -726,10 +1156,7 @@ func TestDocumentService_Rename_NoEditPermission(t *testing.T) {
 	viewerID := uuid.New()
 
 	// Mock GetByID for CanAccess
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Old Name", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Old Name", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
@@ -741,7 +1168,7 @@ func TestDocumentService_Rename_NoEditPermission(t *testing.T) {
 		WithArgs(docID, viewerID).
 		WillReturnRows(shareRows)
 
-	err := service.Rename(docID, viewerID, "New Name")
+	err := service.Rename(ctx, docID, viewerID, "New Name")
 
 	if err != ErrAccessDenied {
 		t.Errorf("Rename() with view permission error = %v, want ErrAccessDenied", err)
@@ -753,6 +1180,7 @@ func TestDocumentService_Rename_NoEditPermission(t *testing.T) {
 }
 
 func TestDocumentService_GetFilePath_Owner(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -762,16 +1190,13 @@ func TestDocumentService_GetFilePath_Owner(t *testing.T) {
 	ownerID := uuid.New()
 	expectedPath := "/uploads/test-file"
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", expectedPath, false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", expectedPath, false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	filePath, err := service.GetFilePath(docID, ownerID)
+	filePath, err := service.GetFilePath(ctx, docID, ownerID)
 	if err != nil {
 		t.Fatalf("GetFilePath() error = %v", err)
 	}
@@ -786,6 +1211,7 @@ func TestDocumentService_GetFilePath_Owner(t *testing.T) {
 }
 
 func TestDocumentService_GetFilePath_NoAccess(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -795,22 +1221,18 @@ func TestDocumentService_GetFilePath_NoAccess(t *testing.T) {
 	ownerID := uuid.New()
 	otherUserID := uuid.New()
 
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
 
-	// Mock no share
-	countRows := sqlmock.NewRows([]string{"count"}).AddRow(0)
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM document_shares`).
+	// Mock no share, direct or inherited
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
 		WithArgs(docID, otherUserID).
-		WillReturnRows(countRows)
+		WillReturnError(sql.ErrNoRows)
 
-	_, err := service.GetFilePath(docID, otherUserID)
+	_, err := service.GetFilePath(ctx, docID, otherUserID)
 
 	if err != ErrAccessDenied {
 		t.Errorf("GetFilePath() without access error = %v, want ErrAccessDenied", err)
@@ -821,42 +1243,95 @@ func TestDocumentService_GetFilePath_NoAccess(t *testing.T) {
 	}
 }
 
-func TestDocumentService_RemoveShare_Success(t *testing.T) {
+func TestDocumentService_GetFilePath_Spans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	provider := tracing.Install("test", 1, sdktrace.NewSimpleSpanProcessor(exporter))
+	defer func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	}()
+
 	db, mock := newMockDB(t)
 	defer db.Close()
 
 	service := NewDocumentService(db, t.TempDir())
 
 	docID := uuid.New()
-	ownerID := uuid.New()
-	sharedWithID := uuid.New()
-
-	// Mock GetByID
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	readerID := uuid.New()
 
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, uuid.New(), "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
 		WillReturnRows(getRows)
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, readerID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("view"))
 
-	// Mock delete share
-	mock.ExpectExec(`DELETE FROM document_shares WHERE document_id = \$1 AND shared_with_id = \$2`).
-		WithArgs(docID, sharedWithID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-
-	err := service.RemoveShare(docID, ownerID, sharedWithID)
-	if err != nil {
-		t.Fatalf("RemoveShare() error = %v", err)
+	ctx, request := tracing.Start(context.Background(), "GET /documents/:id/download")
+	if _, err := service.GetFilePath(ctx, docID, readerID); err != nil {
+		t.Fatalf("GetFilePath() error = %v", err)
 	}
+	request.End()
 
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("Unfulfilled expectations: %v", err)
+	// The lookup and the access check each show up under the request
+	parents := make(map[string]string)
+	ids := make(map[trace.SpanID]string)
+	for _, span := range exporter.GetSpans() {
+		ids[span.SpanContext.SpanID()] = span.Name
+	}
+	for _, span := range exporter.GetSpans() {
+		parents[span.Name] = ids[span.Parent.SpanID()]
+	}
+	want := map[string]string{
+		"DocumentService.GetFilePath":      "GET /documents/:id/download",
+		"DocumentService.GetByID":          "DocumentService.GetFilePath",
+		"DocumentService.sharedPermission": "DocumentService.GetFilePath",
+	}
+	for name, parent := range want {
+		if got, ok := parents[name]; !ok || got != parent {
+			t.Errorf("span %s has parent %q (recorded %v), want %q", name, got, ok, parent)
+		}
+	}
+}
+
+func TestDocumentService_RemoveShare_Success(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	sharedWithID := uuid.New()
+
+	// Mock GetByID
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	// Mock delete share
+	mock.ExpectExec(`DELETE FROM document_shares WHERE document_id = \$1 AND shared_with_id = \$2`).
+		WithArgs(docID, sharedWithID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectUserEvent(mock)
+
+	err := service.RemoveShare(ctx, docID, ownerID, sharedWithID)
+	if err != nil {
+		t.Fatalf("RemoveShare() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
 	}
 }
 
 func TestDocumentService_RemoveShare_NotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 
@@ -867,10 +1342,7 @@ func TestDocumentService_RemoveShare_NotFound(t *testing.T) {
 	sharedWithID := uuid.New()
 
 	// Mock GetByID
-	getRows := sqlmock.NewRows([]string{
-		"id", "owner_id", "name", "original_name", "size", "mime_type",
-		"encryption_algo", "file_path", "is_encrypted", "created_at", "updated_at", "deleted_at",
-	}).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil)
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
 
 	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
 		WithArgs(docID).
@@ -881,7 +1353,7 @@ func TestDocumentService_RemoveShare_NotFound(t *testing.T) {
 		WithArgs(docID, sharedWithID).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := service.RemoveShare(docID, ownerID, sharedWithID)
+	err := service.RemoveShare(ctx, docID, ownerID, sharedWithID)
 
 	if err != ErrShareNotFound {
 		t.Errorf("RemoveShare() for non-existent share error = %v, want ErrShareNotFound", err)
@@ -891,3 +1363,476 @@ func TestDocumentService_RemoveShare_NotFound(t *testing.T) {
 		t.Errorf("Unfulfilled expectations: %v", err)
 	}
 }
+
+func TestDocumentService_CanAccess_InheritedFromFolder(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	folderID := uuid.New()
+	sharedUserID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, folderID, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	// The grant comes from a share on an ancestor folder
+	mock.ExpectQuery(`WITH RECURSIVE ancestors .+ FROM folder_shares fs`).
+		WithArgs(docID, sharedUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("edit"))
+
+	canAccess, permission, err := service.CanAccess(ctx, docID, sharedUserID)
+	if err != nil {
+		t.Fatalf("CanAccess() error = %v", err)
+	}
+
+	if !canAccess || permission != "edit" {
+		t.Errorf("CanAccess() = %v, %q, want true, %q", canAccess, permission, "edit")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_GetByFolder_Root(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	ownerID := uuid.New()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM documents WHERE owner_id = \$1 AND folder_id IS NULL`).
+		WithArgs(ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE owner_id = \$1 AND folder_id IS NULL .+ LIMIT \$2 OFFSET \$3`).
+		WithArgs(ownerID, 20, 0).
+		WillReturnRows(sqlmock.NewRows(documentListColumns).
+			AddRow(uuid.New(), ownerID, "Doc 1", "doc1.pdf", 1024, "application/pdf", "AES-256-GCM", "/path/1", false, time.Now(), time.Now(), nil))
+
+	docs, total, err := service.GetByFolder(ctx, ownerID, nil, 1, 20)
+	if err != nil {
+		t.Fatalf("GetByFolder() error = %v", err)
+	}
+
+	if total != 1 || len(docs) != 1 {
+		t.Errorf("GetByFolder() = %d docs, total %d, want 1, 1", len(docs), total)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_GetByFolder_Folder(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	ownerID := uuid.New()
+	folderID := uuid.New()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM documents WHERE owner_id = \$1 AND folder_id = \$2`).
+		WithArgs(ownerID, folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE owner_id = \$1 AND folder_id = \$2 .+ LIMIT \$3 OFFSET \$4`).
+		WithArgs(ownerID, folderID, 10, 10).
+		WillReturnRows(sqlmock.NewRows(documentListColumns))
+
+	if _, _, err := service.GetByFolder(ctx, ownerID, &folderID, 2, 10); err != nil {
+		t.Fatalf("GetByFolder() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Move_Success(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	folderID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	mock.ExpectQuery(`SELECT owner_id FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+
+	mock.ExpectExec(`UPDATE documents SET folder_id = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(&folderID, sqlmock.AnyArg(), docID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := service.Move(ctx, docID, ownerID, &folderID); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Move_ForeignFolder(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	folderID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	mock.ExpectQuery(`SELECT owner_id FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(uuid.New()))
+
+	err := service.Move(ctx, docID, ownerID, &folderID)
+
+	if err != ErrAccessDenied {
+		t.Errorf("Move() into another user's folder error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_List_TagAndMetadataFilters(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	ownerID := uuid.New()
+
+	filter := models.DocumentFilter{
+		Tags:     []string{"Contract"},
+		Metadata: map[string]string{"year": "2024.0", "client": "acme", "signed": "yes"},
+	}
+
+	// Values are compared in stored form for each type they are valid as;
+	// one valid as none matches nothing
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL AND EXISTS .+ document_tags .+ t.tag = \$2\)`+
+		`.+m.key = \$3 AND \(\(m.value_type = \$4 AND m.value = \$5\)\)\)`+
+		`.+m.key = \$6 AND \(\(m.value_type = \$7 AND m.value = \$8\)\)\)`+
+		`.+m.key = \$9 AND \(\(m.value_type = \$10 AND m.value = \$11\) OR \(m.value_type = \$12 AND m.value = \$13\)\)\)`).
+		WithArgs(ownerID, "contract", "client", "string", "acme", "signed", "string", "yes",
+			"year", "string", "2024.0", "number", "2024").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE owner_id = \$1 .+ LIMIT \$14 OFFSET \$15`).
+		WithArgs(ownerID, "contract", "client", "string", "acme", "signed", "string", "yes",
+			"year", "string", "2024.0", "number", "2024", 20, 0).
+		WillReturnRows(sqlmock.NewRows(documentListColumns))
+
+	if _, _, err := service.List(ctx, ownerID, filter, models.ListOptions{Page: 1, PerPage: 20}); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_List_FiltersAndSort(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	ownerID := uuid.New()
+
+	minSize, maxSize := int64(100), int64(5000)
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	filter := models.DocumentFilter{
+		MimeType:      "image/*",
+		MinSize:       &minSize,
+		MaxSize:       &maxSize,
+		CreatedAfter:  &after,
+		CreatedBefore: &before,
+		NamePrefix:    "100%_",
+	}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL AND mime_type LIKE \$2 .+ AND size >= \$3 AND size <= \$4 AND created_at >= \$5 AND created_at < \$6 AND name ILIKE \$7`).
+		WithArgs(ownerID, "image/%", minSize, maxSize, after, before, `100\%\_%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE .+ ORDER BY name ASC, id ASC LIMIT \$8 OFFSET \$9`).
+		WithArgs(ownerID, "image/%", minSize, maxSize, after, before, `100\%\_%`, 20, 0).
+		WillReturnRows(sqlmock.NewRows(documentListColumns))
+
+	if _, _, err := service.List(ctx, ownerID, filter, models.ListOptions{Sort: "name"}); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_List_CursorPaging(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	ownerID := uuid.New()
+
+	// First page by offset hands out a cursor for the rest of the listing
+	newest := time.Date(2024, 3, 3, 12, 0, 0, 123456000, time.UTC)
+	lastID := uuid.New()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM documents`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE .+ ORDER BY size DESC, id DESC LIMIT \$2 OFFSET \$3`).
+		WithArgs(ownerID, 1, 0).
+		WillReturnRows(sqlmock.NewRows(documentListColumns).
+			AddRow(lastID, ownerID, "Big", "big.pdf", 4096, "application/pdf", "AES-256-GCM", "/path/1", false, newest, newest, nil))
+
+	docs, info, err := service.List(ctx, ownerID, models.DocumentFilter{}, models.ListOptions{Sort: "size", PerPage: 1})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(docs) != 1 || info.NextCursor == "" {
+		t.Fatalf("List() = %d docs, cursor %q, want 1 doc and a cursor", len(docs), info.NextCursor)
+	}
+
+	// The cursor seeks past the last row and fetches one extra to detect more
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL$`).
+		WithArgs(ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE .+ AND \(size, id\) < \(\$2, \$3\)\s+ORDER BY size DESC, id DESC LIMIT \$4`).
+		WithArgs(ownerID, int64(4096), lastID, 2).
+		WillReturnRows(sqlmock.NewRows(documentListColumns).
+			AddRow(uuid.New(), ownerID, "Mid", "mid.pdf", 2048, "application/pdf", "AES-256-GCM", "/path/2", false, newest, newest, nil).
+			AddRow(uuid.New(), ownerID, "Small", "small.pdf", 1024, "application/pdf", "AES-256-GCM", "/path/3", false, newest, newest, nil))
+
+	docs, info, err = service.List(ctx, ownerID, models.DocumentFilter{}, models.ListOptions{PerPage: 1, Cursor: info.NextCursor})
+	if err != nil {
+		t.Fatalf("List() with cursor error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].Name != "Mid" {
+		t.Errorf("List() with cursor = %+v, want the look-ahead row trimmed", docs)
+	}
+	if info.NextCursor == "" || info.Total != 3 {
+		t.Errorf("List() with cursor info = %+v, want a next cursor and total 3", info)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_List_InvalidOptions(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	nameCursor := documentCursor{Sort: "name", Value: "a", ID: uuid.New()}.encode()
+
+	tests := []struct {
+		name string
+		opts models.ListOptions
+		want error
+	}{
+		{"unknown sort", models.ListOptions{Sort: "owner_id"}, ErrInvalidSort},
+		{"unknown order", models.ListOptions{Order: "sideways"}, ErrInvalidSort},
+		{"shared-only sort", models.ListOptions{Sort: "shared_at"}, ErrInvalidSort},
+		{"garbage cursor", models.ListOptions{Cursor: "not-a-cursor"}, ErrInvalidCursor},
+		{"cursor for another sort", models.ListOptions{Sort: "size", Cursor: nameCursor}, ErrInvalidCursor},
+		{"cursor with bad value", models.ListOptions{Cursor: documentCursor{Sort: "size", Desc: true, Value: "big", ID: uuid.New()}.encode()}, ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := service.List(ctx, uuid.New(), models.DocumentFilter{}, tt.opts); err != tt.want {
+				t.Errorf("List() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentService_ListShared_DefaultsToShareOrder(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewDocumentService(db, t.TempDir())
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM document_shares ds .+ AND d.name ILIKE \$2`).
+		WithArgs(userID, "rep%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`FROM document_shares ds .+ ORDER BY ds.created_at DESC, d.id DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs(userID, "rep%", 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if _, _, err := service.ListShared(ctx, userID, models.DocumentFilter{NamePrefix: "rep"}, models.ListOptions{}); err != nil {
+		t.Fatalf("ListShared() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_ContentHash(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewDocumentService(db, t.TempDir())
+
+	// Hashed at upload; neither the file nor the database is touched
+	doc := &models.Document{ID: uuid.New(), SHA256: "abc123"}
+
+	digest, err := service.ContentHash(ctx, doc)
+	if err != nil || digest != "abc123" {
+		t.Errorf("ContentHash() = %q, %v; want the stored hash", digest, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_ContentHash_BackfillsLegacyDocument(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewDocumentService(db, t.TempDir())
+
+	doc := &models.Document{ID: uuid.New(), FilePath: filepath.Join(t.TempDir(), "legacy")}
+	os.WriteFile(doc.FilePath, []byte("test file content"), 0600)
+	want := "60f5237ed4049f0382661ef009d2bc42e48c3ceb3edb6600f7024e7ab3b838f3"
+
+	mock.ExpectExec(`UPDATE documents SET sha256 = \$1 WHERE id = \$2 AND sha256 IS NULL`).
+		WithArgs(want, doc.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	digest, err := service.ContentHash(ctx, doc)
+	if err != nil || digest != want {
+		t.Errorf("ContentHash() = %q, %v; want %q", digest, err, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_Readable(t *testing.T) {
+	ctx := context.Background()
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewDocumentService(db, t.TempDir())
+
+	userID := uuid.New()
+	ownedID, sharedID, privateID, missingID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	expectDocument := func(id, ownerID uuid.UUID) {
+		mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(documentColumns).AddRow(id, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, ""))
+	}
+
+	expectDocument(ownedID, userID)
+	expectDocument(sharedID, uuid.New())
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(sharedID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("view"))
+	expectDocument(privateID, uuid.New())
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(privateID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}))
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(missingID).
+		WillReturnError(sql.ErrNoRows)
+
+	docs, err := service.Readable(ctx, []uuid.UUID{ownedID, sharedID, privateID, missingID}, userID)
+	if err != nil {
+		t.Fatalf("Readable() error = %v", err)
+	}
+	if len(docs) != 2 || docs[0].ID != ownedID || docs[1].ID != sharedID {
+		t.Errorf("Readable() returned %d documents, want the owned and shared ones in order", len(docs))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDocumentService_MemoryRepositories(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryRepositories()
+	users := NewUserServiceFromRepository(repos.Users)
+	service := NewDocumentServiceFromRepositories(repos, t.TempDir())
+
+	owner, _ := users.Create(ctx, "owner@example.com", "securepassword123", "Owner")
+	reader, _ := users.Create(ctx, "reader@example.com", "securepassword123", "Reader")
+
+	first, err := service.Create(ctx, owner.ID, "first.txt", "first.txt", "text/plain", 5, strings.NewReader("hello"), "")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second, err := service.Create(ctx, owner.ID, "second.txt", "second.txt", "text/plain", 5, strings.NewReader("hello"), "")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if second.FilePath != first.FilePath {
+		t.Errorf("duplicate upload stored at %q, want the first copy at %q", second.FilePath, first.FilePath)
+	}
+
+	if err := service.Share(ctx, first.ID, owner.ID, reader.Email, "view"); err != nil {
+		t.Fatalf("Share() error = %v", err)
+	}
+	if ok, permission, err := service.CanAccess(ctx, first.ID, reader.ID); err != nil || !ok || permission != "view" {
+		t.Errorf("CanAccess() = %v, %q, %v; want view access", ok, permission, err)
+	}
+	if err := service.Rename(ctx, first.ID, reader.ID, "renamed.txt"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Rename() by a viewer error = %v, want ErrAccessDenied", err)
+	}
+	if _, err := service.GetFilePath(ctx, second.ID, reader.ID); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("GetFilePath() of an unshared document error = %v, want ErrAccessDenied", err)
+	}
+
+	// The file survives until its last document is deleted
+	if err := service.Delete(ctx, first.ID, owner.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(second.FilePath); err != nil {
+		t.Errorf("shared content removed with the first document: %v", err)
+	}
+	if err := service.Delete(ctx, second.ID, owner.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(second.FilePath); !os.IsNotExist(err) {
+		t.Errorf("content kept after its last document was deleted: %v", err)
+	}
+}
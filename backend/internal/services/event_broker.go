@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// eventSubscriberBuffer is how many events a slow stream may fall behind
+	// before further events to it are dropped.
+	eventSubscriberBuffer = 32
+	eventListenerMinRetry = 5 * time.Second
+	eventListenerMaxRetry = time.Minute
+)
+
+// EventBroker receives user events from Postgres and fans them out to the
+// streams connected to this replica.
+type EventBroker struct {
+	mu     sync.RWMutex
+	subs   map[uuid.UUID]map[chan models.UserEvent]struct{}
+	closed bool
+}
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subs: make(map[uuid.UUID]map[chan models.UserEvent]struct{})}
+}
+
+// Subscribe registers a stream for the user's events. The returned function
+// unsubscribes and closes the channel.
+func (b *EventBroker) Subscribe(userID uuid.UUID) (<-chan models.UserEvent, func()) {
+	ch := make(chan models.UserEvent, eventSubscriberBuffer)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[chan models.UserEvent]struct{})
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			// Close may have got here first
+			if _, ok := b.subs[userID][ch]; !ok {
+				return
+			}
+			delete(b.subs[userID], ch)
+			if len(b.subs[userID]) == 0 {
+				delete(b.subs, userID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Close ends every stream by closing its channel, and any stream opened
+// afterwards, so a shutting-down server isn't held open by clients that
+// would otherwise stay connected forever.
+func (b *EventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for userID, chans := range b.subs {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(b.subs, userID)
+	}
+}
+
+// Listen relays notifications from Postgres until ctx is cancelled. The
+// listener reconnects on its own; events sent while disconnected are lost,
+// which is acceptable for live updates that clients can refetch.
+func (b *EventBroker) Listen(ctx context.Context, databaseURL string) error {
+	listener := pq.NewListener(databaseURL, eventListenerMinRetry, eventListenerMaxRetry,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				slog.WarnContext(ctx, "event listener connection problem", "event", event, "error", err)
+			}
+		})
+	defer listener.Close()
+
+	if err := listener.Listen(userEventsChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil after a reconnect
+			if n != nil {
+				b.dispatch(n.Extra)
+			}
+		case <-time.After(90 * time.Second):
+			// Detect dead connections the driver hasn't noticed
+			go listener.Ping()
+		}
+	}
+}
+
+// dispatch delivers a NOTIFY payload to the recipients' streams. A stream
+// whose buffer is full misses the event rather than blocking the others.
+func (b *EventBroker) dispatch(payload string) {
+	var n userEventNotification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		slog.Warn("event listener received an invalid payload", "error", err)
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, userID := range n.UserIDs {
+		for ch := range b.subs[userID] {
+			select {
+			case ch <- n.Event:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+func notificationPayload(t *testing.T, userIDs []uuid.UUID, eventType string) string {
+	t.Helper()
+	data, err := json.Marshal(userEventNotification{
+		UserIDs: userIDs,
+		Event:   models.UserEvent{ID: uuid.New(), Type: eventType},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEventBroker_FansOutToRecipients(t *testing.T) {
+	broker := NewEventBroker()
+
+	alice, bob := uuid.New(), uuid.New()
+	aliceTab1, unsub1 := broker.Subscribe(alice)
+	defer unsub1()
+	aliceTab2, unsub2 := broker.Subscribe(alice)
+	defer unsub2()
+	bobStream, unsub3 := broker.Subscribe(bob)
+	defer unsub3()
+
+	broker.dispatch(notificationPayload(t, []uuid.UUID{alice}, UserEventDocumentShared))
+
+	for i, ch := range []<-chan models.UserEvent{aliceTab1, aliceTab2} {
+		select {
+		case event := <-ch:
+			if event.Type != UserEventDocumentShared {
+				t.Errorf("stream %d got %s, want %s", i, event.Type, UserEventDocumentShared)
+			}
+		default:
+			t.Errorf("stream %d received nothing", i)
+		}
+	}
+
+	select {
+	case event := <-bobStream:
+		t.Errorf("bob received %+v, want nothing", event)
+	default:
+	}
+}
+
+func TestEventBroker_SlowSubscriberDoesNotBlock(t *testing.T) {
+	broker := NewEventBroker()
+
+	userID := uuid.New()
+	stream, unsubscribe := broker.Subscribe(userID)
+	defer unsubscribe()
+
+	payload := notificationPayload(t, []uuid.UUID{userID}, UserEventDocumentRenamed)
+	for i := 0; i < eventSubscriberBuffer+10; i++ {
+		broker.dispatch(payload)
+	}
+
+	if len(stream) != eventSubscriberBuffer {
+		t.Errorf("buffered %d events, want %d with the rest dropped", len(stream), eventSubscriberBuffer)
+	}
+}
+
+func TestEventBroker_Unsubscribe(t *testing.T) {
+	broker := NewEventBroker()
+
+	userID := uuid.New()
+	stream, unsubscribe := broker.Subscribe(userID)
+	unsubscribe()
+	unsubscribe() // safe to call twice
+
+	if _, open := <-stream; open {
+		t.Error("stream should be closed after unsubscribing")
+	}
+
+	// Dispatching to a user with no streams is a no-op
+	broker.dispatch(notificationPayload(t, []uuid.UUID{userID}, UserEventShareRevoked))
+	if len(broker.subs) != 0 {
+		t.Errorf("broker still tracks %d users", len(broker.subs))
+	}
+}
+
+func TestEventBroker_Close(t *testing.T) {
+	broker := NewEventBroker()
+
+	stream, unsubscribe := broker.Subscribe(uuid.New())
+	broker.Close()
+
+	if _, open := <-stream; open {
+		t.Error("stream should be closed when the broker closes")
+	}
+	unsubscribe() // safe after Close
+
+	// Streams opened while shutting down end straight away
+	late, _ := broker.Subscribe(uuid.New())
+	if _, open := <-late; open {
+		t.Error("stream opened after Close should be closed")
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+)
+
+// User event types
+const (
+	UserEventDocumentShared  = "document.shared"
+	UserEventShareRevoked    = "document.share_revoked"
+	UserEventDocumentRenamed = "document.renamed"
+	UserEventFolderShared    = "folder.shared"
+	UserEventFolderUnshared  = "folder.share_revoked"
+)
+
+// userEventsChannel is the Postgres NOTIFY channel every replica listens on.
+const userEventsChannel = "user_events"
+
+// userEventNotification is the NOTIFY payload. Postgres caps payloads at
+// 8000 bytes, so events carry IDs and names rather than whole documents.
+type userEventNotification struct {
+	UserIDs []uuid.UUID      `json:"user_ids"`
+	Event   models.UserEvent `json:"event"`
+}
+
+// EventService publishes live user events. Publishing goes through Postgres
+// NOTIFY so subscribers connected to any replica receive them.
+type EventService struct {
+	db *database.DB
+}
+
+func NewEventService(db *database.DB) *EventService {
+	return &EventService{db: db}
+}
+
+// Notify publishes an event to the given users, skipping the actor.
+func (s *EventService) Notify(ctx context.Context, userIDs []uuid.UUID, event models.UserEvent) error {
+	ctx, span := tracing.Start(ctx, "EventService.Notify")
+	defer span.End()
+
+	recipients := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != event.ActorID {
+			recipients = append(recipients, id)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	event.ID = uuid.New()
+	event.OccurredAt = time.Now().UTC()
+
+	payload, err := json.Marshal(userEventNotification{UserIDs: recipients, Event: event})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, userEventsChannel, string(payload))
+	return err
+}
+
+// NotifyCollaborators publishes a document event to its owner and everyone
+// who can access it, whether through a direct share or a share on one of its
+// owner's folders above it, except the actor.
+func (s *EventService) NotifyCollaborators(ctx context.Context, documentID uuid.UUID, event models.UserEvent) error {
+	ctx, span := tracing.Start(ctx, "EventService.NotifyCollaborators")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx,
+		`WITH RECURSIVE ancestors AS (
+			SELECT f.id, f.parent_id FROM folders f
+			JOIN documents d ON d.folder_id = f.id AND f.owner_id = d.owner_id WHERE d.id = $1
+			UNION
+			SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT owner_id FROM documents WHERE id = $1
+		UNION
+		SELECT shared_with_id FROM document_shares
+		WHERE document_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		UNION
+		SELECT fs.shared_with_id FROM folder_shares fs
+		JOIN ancestors a ON fs.folder_id = a.id
+		WHERE fs.expires_at IS NULL OR fs.expires_at > NOW()`,
+		documentID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	event.DocumentID = &documentID
+	return s.Notify(ctx, userIDs, event)
+}
+
+// logPublishError logs a failed publish. Live events are best effort, so the
+// change that triggered them still succeeds.
+func logPublishError(eventType string, err error) {
+	if err != nil {
+		slog.Error("failed to publish event", "event", eventType, "error", err)
+	}
+}
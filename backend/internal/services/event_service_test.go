@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// expectUserEvent expects one live event to be published.
+func expectUserEvent(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).
+		WithArgs(userEventsChannel, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// notificationArg captures and decodes the NOTIFY payload argument.
+type notificationArg struct {
+	n userEventNotification
+}
+
+func (a *notificationArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && json.Unmarshal([]byte(s), &a.n) == nil
+}
+
+func TestEventService_Notify_SkipsActor(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewEventService(db)
+
+	actorID := uuid.New()
+	recipientID := uuid.New()
+	docID := uuid.New()
+
+	var payload notificationArg
+	mock.ExpectExec(`SELECT pg_notify`).
+		WithArgs(userEventsChannel, &payload).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := service.Notify(context.Background(), []uuid.UUID{actorID, recipientID}, models.UserEvent{
+		Type:       UserEventDocumentShared,
+		ActorID:    actorID,
+		DocumentID: &docID,
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if len(payload.n.UserIDs) != 1 || payload.n.UserIDs[0] != recipientID {
+		t.Errorf("recipients = %v, want only %s", payload.n.UserIDs, recipientID)
+	}
+	if payload.n.Event.ID == uuid.Nil || payload.n.Event.Type != UserEventDocumentShared {
+		t.Errorf("event = %+v, want an identified document.shared event", payload.n.Event)
+	}
+}
+
+func TestEventService_Notify_OnlyActor(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewEventService(db)
+
+	actorID := uuid.New()
+	if err := service.Notify(context.Background(), []uuid.UUID{actorID}, models.UserEvent{Type: UserEventDocumentRenamed, ActorID: actorID}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	// Nothing to publish
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
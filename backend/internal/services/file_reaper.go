@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+)
+
+const (
+	reapBatchSize    = 20
+	reapPollInterval = time.Minute
+	// reapLease keeps a claimed removal from being attempted twice by
+	// concurrent reapers.
+	reapLease = 5 * time.Minute
+)
+
+// FileReaper removes the files queued in file_deletions that the request
+// deleting their document didn't manage to remove, such as after a crash
+// or a permissions problem, retrying with backoff.
+type FileReaper struct {
+	db *database.DB
+}
+
+func NewFileReaper(db *database.DB) *FileReaper {
+	return &FileReaper{db: db}
+}
+
+type queuedDeletion struct {
+	id       uuid.UUID
+	filePath string
+	attempts int
+}
+
+// Run removes queued files until ctx is cancelled.
+func (r *FileReaper) Run(ctx context.Context) {
+	for {
+		reaped, err := r.ReapDue(ctx)
+		metrics.ObserveJob("file_reap", reaped, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "file reaping failed", "error", err)
+		}
+
+		wait := reapPollInterval
+		if reaped == reapBatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ReapDue claims a batch of due removals and attempts each once. It returns
+// how many were attempted.
+func (r *FileReaper) ReapDue(ctx context.Context) (int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE file_deletions SET next_attempt_at = $2
+		 WHERE id IN (
+			SELECT id FROM file_deletions
+			WHERE next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, file_path, attempts`,
+		reapBatchSize, time.Now().Add(reapLease),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []queuedDeletion
+	for rows.Next() {
+		var d queuedDeletion
+		if err := rows.Scan(&d.id, &d.filePath, &d.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range batch {
+		if err := r.attempt(ctx, d); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// attempt removes one file and records the outcome. Only a failure to
+// record is returned; removal failures are stored on the row.
+func (r *FileReaper) attempt(ctx context.Context, d queuedDeletion) error {
+	removeErr := os.Remove(d.filePath)
+	if removeErr == nil || os.IsNotExist(removeErr) {
+		_, err := r.db.ExecContext(ctx, `DELETE FROM file_deletions WHERE id = $1`, d.id)
+		return err
+	}
+
+	attempts := d.attempts + 1
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE file_deletions SET attempts = $1, next_attempt_at = $2, last_error = $3 WHERE id = $4`,
+		attempts, time.Now().Add(retryBackoff(attempts)), removeErr.Error(), d.id,
+	)
+	return err
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var claimedDeletionColumns = []string{"id", "file_path", "attempts"}
+
+func TestFileReaper_ReapDue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	stalePath := filepath.Join(dir, "stale")
+	os.WriteFile(stalePath, []byte("test"), 0600)
+	// A non-empty directory can't be removed
+	stuckPath := filepath.Join(dir, "stuck")
+	os.MkdirAll(filepath.Join(stuckPath, "child"), 0700)
+
+	staleID, goneID, stuckID := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectQuery(`UPDATE file_deletions SET next_attempt_at = \$2\s+WHERE id IN .+FOR UPDATE SKIP LOCKED`).
+		WithArgs(reapBatchSize, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(claimedDeletionColumns).
+			AddRow(staleID, stalePath, 0).
+			AddRow(goneID, filepath.Join(dir, "gone"), 1).
+			AddRow(stuckID, stuckPath, 2))
+
+	mock.ExpectExec(`DELETE FROM file_deletions WHERE id = \$1`).
+		WithArgs(staleID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Already removed counts as done
+	mock.ExpectExec(`DELETE FROM file_deletions WHERE id = \$1`).
+		WithArgs(goneID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE file_deletions SET attempts = \$1, next_attempt_at = \$2, last_error = \$3`).
+		WithArgs(3, sqlmock.AnyArg(), sqlmock.AnyArg(), stuckID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	reaped, err := NewFileReaper(db).ReapDue(context.Background())
+	if err != nil || reaped != 3 {
+		t.Errorf("ReapDue() = %d, %v; want 3", reaped, err)
+	}
+	if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+		t.Error("Queued file should be removed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFileReaper_ReapDue_Empty(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`UPDATE file_deletions SET next_attempt_at`).
+		WithArgs(reapBatchSize, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(claimedDeletionColumns))
+
+	reaped, err := NewFileReaper(db).ReapDue(context.Background())
+	if err != nil || reaped != 0 {
+		t.Errorf("ReapDue() = %d, %v; want 0", reaped, err)
+	}
+}
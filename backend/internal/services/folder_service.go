@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"github.com/katim/secure-doc-vault/pkg/utils"
+)
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+	ErrFolderCycle    = errors.New("folder cannot be moved into itself or a descendant")
+)
+
+type FolderService struct {
+	db            *database.DB
+	events        *EventService
+	notifications *NotificationService
+}
+
+func NewFolderService(db *database.DB) *FolderService {
+	return &FolderService{db: db, events: NewEventService(db), notifications: NewNotificationService(db)}
+}
+
+func (s *FolderService) Create(ctx context.Context, ownerID uuid.UUID, name string, parentID *uuid.UUID) (*models.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.Create")
+	defer span.End()
+
+	sanitizedName, err := utils.SanitizeFilename(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder name: %w", err)
+	}
+
+	if parentID != nil {
+		if err := s.requireOwner(ctx, *parentID, ownerID); err != nil {
+			return nil, err
+		}
+	}
+
+	folder := &models.Folder{
+		ID:        uuid.New(),
+		OwnerID:   ownerID,
+		ParentID:  parentID,
+		Name:      sanitizedName,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO folders (id, owner_id, parent_id, name, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		folder.ID, folder.OwnerID, folder.ParentID, folder.Name, folder.CreatedAt, folder.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save folder: %w", err)
+	}
+
+	return folder, nil
+}
+
+func (s *FolderService) GetByID(ctx context.Context, id uuid.UUID) (*models.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.GetByID")
+	defer span.End()
+
+	folder := &models.Folder{}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, owner_id, parent_id, name, created_at, updated_at FROM folders WHERE id = $1`,
+		id,
+	).Scan(&folder.ID, &folder.OwnerID, &folder.ParentID, &folder.Name, &folder.CreatedAt, &folder.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// List returns the owner's folders directly under parentID, or the top-level
+// folders when parentID is nil.
+func (s *FolderService) List(ctx context.Context, ownerID uuid.UUID, parentID *uuid.UUID) ([]models.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.List")
+	defer span.End()
+
+	query := `SELECT id, owner_id, parent_id, name, created_at, updated_at
+		 FROM folders WHERE owner_id = $1 AND parent_id IS NULL ORDER BY name`
+	args := []interface{}{ownerID}
+	if parentID != nil {
+		query = `SELECT id, owner_id, parent_id, name, created_at, updated_at
+		 FROM folders WHERE owner_id = $1 AND parent_id = $2 ORDER BY name`
+		args = append(args, *parentID)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFolders(rows)
+}
+
+// ListSharedWithUser returns the folders shared directly with the user.
+func (s *FolderService) ListSharedWithUser(ctx context.Context, userID uuid.UUID) ([]models.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.ListSharedWithUser")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT f.id, f.owner_id, f.parent_id, f.name, f.created_at, f.updated_at
+		 FROM folder_shares fs
+		 JOIN folders f ON fs.folder_id = f.id
+		 WHERE fs.shared_with_id = $1
+		 AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+		 ORDER BY f.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFolders(rows)
+}
+
+// GetContents returns a folder together with its subfolders and documents,
+// provided the user owns it or holds a share on it or any folder above it.
+func (s *FolderService) GetContents(ctx context.Context, id, userID uuid.UUID) (*models.FolderContents, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.GetContents")
+	defer span.End()
+
+	canAccess, permission, err := s.CanAccess(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	folder, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	subfolders, err := s.List(ctx, folder.OwnerID, &folder.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &models.FolderContents{
+		Folder:     *folder,
+		Permission: permission,
+		Folders:    subfolders,
+		Documents:  []models.Document{},
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at, folder_id
+		 FROM documents WHERE folder_id = $1 AND owner_id = $2 AND deleted_at IS NULL
+		 ORDER BY name`,
+		id, folder.OwnerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents, err := scanDocuments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if documents != nil {
+		contents.Documents = documents
+	}
+
+	return contents, nil
+}
+
+// CanAccess mirrors DocumentService.CanAccess for folders: owners get "owner",
+// everyone else inherits the strongest share on the folder or an ancestor.
+// The ancestor walk deduplicates with UNION, so a looping tree can't hang it.
+func (s *FolderService) CanAccess(ctx context.Context, id, userID uuid.UUID) (bool, string, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.CanAccess")
+	defer span.End()
+
+	folder, err := s.GetByID(ctx, id)
+	if err != nil {
+		return false, "", err
+	}
+
+	if folder.OwnerID == userID {
+		return true, "owner", nil
+	}
+
+	var permission string
+	err = s.db.QueryRowContext(ctx,
+		`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = $1
+			UNION
+			SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT fs.permission FROM folder_shares fs
+		JOIN ancestors a ON fs.folder_id = a.id
+		WHERE fs.shared_with_id = $2
+		AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+		ORDER BY CASE fs.permission WHEN 'edit' THEN 0 ELSE 1 END
+		LIMIT 1`,
+		id, userID,
+	).Scan(&permission)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	return true, permission, nil
+}
+
+func (s *FolderService) Rename(ctx context.Context, id, userID uuid.UUID, name string) error {
+	ctx, span := tracing.Start(ctx, "FolderService.Rename")
+	defer span.End()
+
+	canAccess, permission, err := s.CanAccess(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !canAccess || (permission != "owner" && permission != "edit") {
+		return ErrAccessDenied
+	}
+
+	sanitizedName, err := utils.SanitizeFilename(name)
+	if err != nil {
+		return fmt.Errorf("invalid folder name: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE folders SET name = $1, updated_at = $2 WHERE id = $3`,
+		sanitizedName, time.Now(), id,
+	)
+	return err
+}
+
+// Move re-parents a folder within the owner's tree. A nil parentID moves it to
+// the root.
+func (s *FolderService) Move(ctx context.Context, id, ownerID uuid.UUID, parentID *uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "FolderService.Move")
+	defer span.End()
+
+	return s.db.InTx(ctx, func(tx *sql.Tx) error {
+		// Lock the owner's whole tree rather than just the two rows: moves
+		// touching disjoint folders can still close a loop between them
+		if _, err := tx.ExecContext(ctx,
+			`SELECT id FROM folders WHERE owner_id = $1 ORDER BY id FOR UPDATE`,
+			ownerID,
+		); err != nil {
+			return err
+		}
+
+		if err := requireFolderOwner(ctx, tx, id, ownerID); err != nil {
+			return err
+		}
+
+		if parentID != nil {
+			if err := requireFolderOwner(ctx, tx, *parentID, ownerID); err != nil {
+				return err
+			}
+
+			// Reject moves that would make the folder its own ancestor
+			var cycle bool
+			err := tx.QueryRowContext(ctx,
+				`WITH RECURSIVE descendants AS (
+					SELECT id FROM folders WHERE id = $1
+					UNION
+					SELECT f.id FROM folders f JOIN descendants d ON f.parent_id = d.id
+				)
+				SELECT EXISTS (SELECT 1 FROM descendants WHERE id = $2)`,
+				id, *parentID,
+			).Scan(&cycle)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return ErrFolderCycle
+			}
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`UPDATE folders SET parent_id = $1, updated_at = $2 WHERE id = $3`,
+			parentID, time.Now(), id,
+		)
+		return err
+	})
+}
+
+// Delete removes an empty folder. Folders that still hold documents or
+// subfolders are rejected so nothing disappears by accident.
+func (s *FolderService) Delete(ctx context.Context, id, ownerID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "FolderService.Delete")
+	defer span.End()
+
+	if err := s.requireOwner(ctx, id, ownerID); err != nil {
+		return err
+	}
+
+	var inUse bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM folders WHERE parent_id = $1)
+		 OR EXISTS (SELECT 1 FROM documents WHERE folder_id = $1 AND deleted_at IS NULL)`,
+		id,
+	).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrFolderNotEmpty
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM folders WHERE id = $1`, id)
+	return err
+}
+
+// Share grants a user access to the folder and, by inheritance, to every
+// folder and document inside it.
+func (s *FolderService) Share(ctx context.Context, id, ownerID uuid.UUID, sharedWithEmail, permission string) error {
+	ctx, span := tracing.Start(ctx, "FolderService.Share")
+	defer span.End()
+
+	folder, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if folder.OwnerID != ownerID {
+		return ErrAccessDenied
+	}
+
+	var sharedWithID uuid.UUID
+	err = s.db.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1`, sharedWithEmail).Scan(&sharedWithID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO folder_shares (folder_id, shared_by_id, shared_with_id, permission)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (folder_id, shared_with_id) DO UPDATE SET permission = $4`,
+		id, ownerID, sharedWithID, permission,
+	)
+	if err != nil {
+		return err
+	}
+
+	logPublishError(UserEventFolderShared, s.events.Notify(ctx, []uuid.UUID{sharedWithID}, models.UserEvent{
+		Type:     UserEventFolderShared,
+		ActorID:  ownerID,
+		FolderID: &id,
+		Data:     map[string]interface{}{"permission": permission},
+	}))
+	logNotifyError(NotificationFolderShared, s.notifications.Notify(ctx, sharedWithID, models.Notification{
+		Type:     NotificationFolderShared,
+		ActorID:  &ownerID,
+		FolderID: &id,
+		Data:     map[string]interface{}{"name": folder.Name, "permission": permission},
+	}))
+
+	return nil
+}
+
+// RemoveShare revokes a user's access to the folder and everything inside
+// it that they hold through the folder.
+func (s *FolderService) RemoveShare(ctx context.Context, id, ownerID, sharedWithID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "FolderService.RemoveShare")
+	defer span.End()
+
+	folder, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if folder.OwnerID != ownerID {
+		return ErrAccessDenied
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM folder_shares WHERE folder_id = $1 AND shared_with_id = $2`,
+		id, sharedWithID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrShareNotFound
+	}
+
+	logPublishError(UserEventFolderUnshared, s.events.Notify(ctx, []uuid.UUID{sharedWithID}, models.UserEvent{
+		Type:     UserEventFolderUnshared,
+		ActorID:  ownerID,
+		FolderID: &id,
+		Data:     map[string]interface{}{"name": folder.Name},
+	}))
+
+	return nil
+}
+
+func (s *FolderService) requireOwner(ctx context.Context, id, ownerID uuid.UUID) error {
+	folder, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if folder.OwnerID != ownerID {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// requireFolderOwner is requireOwner for callers already inside a transaction.
+func requireFolderOwner(ctx context.Context, tx *sql.Tx, id, ownerID uuid.UUID) error {
+	var folderOwnerID uuid.UUID
+	err := tx.QueryRowContext(ctx, `SELECT owner_id FROM folders WHERE id = $1`, id).Scan(&folderOwnerID)
+	if err == sql.ErrNoRows {
+		return ErrFolderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if folderOwnerID != ownerID {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+func scanFolders(rows *sql.Rows) ([]models.Folder, error) {
+	folders := []models.Folder{}
+	for rows.Next() {
+		var folder models.Folder
+		if err := rows.Scan(&folder.ID, &folder.OwnerID, &folder.ParentID, &folder.Name,
+			&folder.CreatedAt, &folder.UpdatedAt); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var folderColumns = []string{"id", "owner_id", "parent_id", "name", "created_at", "updated_at"}
+
+func TestFolderService_Create_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	ownerID := uuid.New()
+
+	mock.ExpectExec(`INSERT INTO folders`).
+		WithArgs(sqlmock.AnyArg(), ownerID, nil, "Contracts", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	folder, err := service.Create(context.Background(), ownerID, "Contracts", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if folder.Name != "Contracts" {
+		t.Errorf("folder.Name = %q, want %q", folder.Name, "Contracts")
+	}
+
+	if folder.ParentID != nil {
+		t.Errorf("folder.ParentID = %v, want nil", folder.ParentID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_Create_ParentNotOwned(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	parentID := uuid.New()
+
+	mock.ExpectQuery(`SELECT .+ FROM folders WHERE id = \$1`).
+		WithArgs(parentID).
+		WillReturnRows(sqlmock.NewRows(folderColumns).AddRow(parentID, uuid.New(), nil, "Theirs", time.Now(), time.Now()))
+
+	_, err := service.Create(context.Background(), uuid.New(), "Mine", &parentID)
+
+	if err != ErrAccessDenied {
+		t.Errorf("Create() under another user's folder error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_Create_InvalidName(t *testing.T) {
+	db, _ := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	if _, err := service.Create(context.Background(), uuid.New(), "..", nil); err == nil {
+		t.Error("Create() should reject invalid folder names")
+	}
+}
+
+func TestFolderService_GetByID_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	folderID := uuid.New()
+
+	mock.ExpectQuery(`SELECT .+ FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err := service.GetByID(context.Background(), folderID)
+
+	if err != ErrFolderNotFound {
+		t.Errorf("GetByID() error = %v, want ErrFolderNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_CanAccess_InheritedShare(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	folderID := uuid.New()
+	parentID := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT .+ FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows(folderColumns).AddRow(folderID, uuid.New(), parentID, "Child", time.Now(), time.Now()))
+
+	mock.ExpectQuery(`WITH RECURSIVE ancestors .+ FROM folder_shares fs`).
+		WithArgs(folderID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("view"))
+
+	canAccess, permission, err := service.CanAccess(context.Background(), folderID, userID)
+	if err != nil {
+		t.Fatalf("CanAccess() error = %v", err)
+	}
+
+	if !canAccess || permission != "view" {
+		t.Errorf("CanAccess() = %v, %q, want true, %q", canAccess, permission, "view")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_Move_IntoDescendant(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	ownerID := uuid.New()
+	folderID := uuid.New()
+	childID := uuid.New()
+
+	mock.ExpectBegin()
+	expectFolderTreeLock(mock, ownerID)
+	mock.ExpectQuery(`SELECT owner_id FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+	mock.ExpectQuery(`SELECT owner_id FROM folders WHERE id = \$1`).
+		WithArgs(childID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+	mock.ExpectQuery(`WITH RECURSIVE descendants`).
+		WithArgs(folderID, childID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	err := service.Move(context.Background(), folderID, ownerID, &childID)
+
+	if err != ErrFolderCycle {
+		t.Errorf("Move() into descendant error = %v, want ErrFolderCycle", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_Move_ToRoot(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	ownerID := uuid.New()
+	folderID := uuid.New()
+
+	mock.ExpectBegin()
+	expectFolderTreeLock(mock, ownerID)
+	mock.ExpectQuery(`SELECT owner_id FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+	mock.ExpectExec(`UPDATE folders SET parent_id = \$1, updated_at = \$2 WHERE id = \$3`).
+		WithArgs(nil, sqlmock.AnyArg(), folderID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := service.Move(context.Background(), folderID, ownerID, nil); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_Move_OtherOwnersFolder(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	ownerID := uuid.New()
+	folderID := uuid.New()
+
+	mock.ExpectBegin()
+	expectFolderTreeLock(mock, ownerID)
+	mock.ExpectQuery(`SELECT owner_id FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(uuid.New()))
+	mock.ExpectRollback()
+
+	if err := service.Move(context.Background(), folderID, ownerID, nil); err != ErrAccessDenied {
+		t.Errorf("Move() error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func expectFolderTreeLock(mock sqlmock.Sqlmock, ownerID uuid.UUID) {
+	mock.ExpectExec(`SELECT id FROM folders WHERE owner_id = \$1 ORDER BY id FOR UPDATE`).
+		WithArgs(ownerID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestFolderService_Delete_NotEmpty(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	ownerID := uuid.New()
+	folderID := uuid.New()
+
+	mock.ExpectQuery(`SELECT .+ FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows(folderColumns).AddRow(folderID, ownerID, nil, "Full", time.Now(), time.Now()))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows([]string{"in_use"}).AddRow(true))
+
+	err := service.Delete(context.Background(), folderID, ownerID)
+
+	if err != ErrFolderNotEmpty {
+		t.Errorf("Delete() of non-empty folder error = %v, want ErrFolderNotEmpty", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestFolderService_Share_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewFolderService(db)
+
+	ownerID := uuid.New()
+	folderID := uuid.New()
+	sharedWithID := uuid.New()
+
+	mock.ExpectQuery(`SELECT .+ FROM folders WHERE id = \$1`).
+		WithArgs(folderID).
+		WillReturnRows(sqlmock.NewRows(folderColumns).AddRow(folderID, ownerID, nil, "Shared", time.Now(), time.Now()))
+	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
+		WithArgs("shared@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(sharedWithID))
+	mock.ExpectExec(`INSERT INTO folder_shares`).
+		WithArgs(folderID, ownerID, sharedWithID, "edit").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectUserEvent(mock)
+	expectNotification(mock, NotificationFolderShared)
+
+	if err := service.Share(context.Background(), folderID, ownerID, "shared@example.com", "edit"); err != nil {
+		t.Fatalf("Share() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
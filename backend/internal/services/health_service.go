@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// Readiness and check statuses
+const (
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// errDiskSpaceUnsupported is returned by freeDiskSpace on platforms it
+// can't measure; the disk check is skipped there.
+var errDiskSpaceUnsupported = errors.New("free disk space is not available on this platform")
+
+// HealthService checks whether this replica can serve requests: the
+// database answers, the upload directory is writable with enough free
+// space, and the schema is up to date.
+type HealthService struct {
+	db           *database.DB
+	uploadDir    string
+	minFreeBytes int64
+	timeout      time.Duration
+}
+
+// NewHealthService returns a service whose checks each give up after
+// timeout and that wants at least minFreeBytes free in uploadDir.
+func NewHealthService(db *database.DB, uploadDir string, minFreeBytes int64, timeout time.Duration) *HealthService {
+	return &HealthService{db: db, uploadDir: uploadDir, minFreeBytes: minFreeBytes, timeout: timeout}
+}
+
+type healthCheck func(ctx context.Context) (map[string]interface{}, error)
+
+// Readiness runs every check concurrently and reports each outcome. The
+// replica is ready only if none failed.
+func (s *HealthService) Readiness(ctx context.Context) *models.Readiness {
+	checks := map[string]healthCheck{
+		"database":   s.checkDatabase,
+		"storage":    s.checkStorage,
+		"disk":       s.checkDisk,
+		"migrations": s.checkMigrations,
+	}
+
+	report := &models.Readiness{Status: ReadinessReady, Checks: make(map[string]models.CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+			result := s.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status == CheckFail {
+				report.Status = ReadinessNotReady
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// run gives check the service's timeout. A check stuck on a hung disk or
+// connection is abandoned when it runs out rather than waited for.
+func (s *HealthService) run(ctx context.Context, check healthCheck) models.CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		o.err = fmt.Errorf("timed out after %v", s.timeout)
+	}
+
+	result := models.CheckResult{
+		Status:     CheckPass,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Details:    o.details,
+	}
+	switch {
+	case errors.Is(o.err, errDiskSpaceUnsupported):
+		result.Status = CheckSkip
+		result.Error = o.err.Error()
+	case o.err != nil:
+		result.Status = CheckFail
+		result.Error = o.err.Error()
+	}
+	return result
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) (map[string]interface{}, error) {
+	return nil, s.db.PingContext(ctx)
+}
+
+// checkStorage writes and removes a small file in the upload directory.
+func (s *HealthService) checkStorage(ctx context.Context) (map[string]interface{}, error) {
+	file, err := os.CreateTemp(s.uploadDir, ".readyz-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write([]byte("ok")); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return nil, file.Close()
+}
+
+func (s *HealthService) checkDisk(ctx context.Context) (map[string]interface{}, error) {
+	free, err := freeDiskSpace(s.uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]interface{}{"free_bytes": free, "min_free_bytes": s.minFreeBytes}
+	if free < uint64(s.minFreeBytes) {
+		return details, fmt.Errorf("%d bytes free, below the %d byte minimum", free, s.minFreeBytes)
+	}
+	return details, nil
+}
+
+// checkMigrations fails while any migration in this build is unapplied,
+// such as when another replica is still migrating.
+func (s *HealthService) checkMigrations(ctx context.Context) (map[string]interface{}, error) {
+	migrator, err := s.db.NewMigrator()
+	if err != nil {
+		return nil, err
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	versions := make([]int64, len(pending))
+	for i, migration := range pending {
+		versions[i] = migration.Version
+	}
+	return map[string]interface{}{"pending": versions}, fmt.Errorf("%d migrations pending", len(pending))
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/katim/secure-doc-vault/internal/database"
+)
+
+// newHealthMockDB returns a mock database that expects pings.
+func newHealthMockDB(t *testing.T) (*database.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &database.DB{DB: db}, mock
+}
+
+// expectMigrated expects the migration check, finding every migration in
+// the build applied except the skipped versions.
+func expectMigrated(t *testing.T, db *database.DB, mock sqlmock.Sqlmock, skip ...int64) {
+	t.Helper()
+	migrator, err := db.NewMigrator()
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	skipped := make(map[int64]bool)
+	for _, version := range skip {
+		skipped[version] = true
+	}
+
+	rows := sqlmock.NewRows([]string{"version"})
+	for _, migration := range migrator.Migrations() {
+		if !skipped[migration.Version] {
+			rows.AddRow(migration.Version)
+		}
+	}
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func TestHealthService_Ready(t *testing.T) {
+	db, mock := newHealthMockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectPing()
+	expectMigrated(t, db, mock)
+
+	service := NewHealthService(db, t.TempDir(), 0, time.Second)
+	report := service.Readiness(context.Background())
+
+	if report.Status != ReadinessReady {
+		t.Errorf("Readiness() = %+v, want ready", report)
+	}
+	for _, name := range []string{"database", "storage", "disk", "migrations"} {
+		if result, ok := report.Checks[name]; !ok || result.Status == CheckFail {
+			t.Errorf("check %s = %+v, want it to pass", name, result)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestHealthService_Failures(t *testing.T) {
+	db, mock := newHealthMockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	expectMigrated(t, db, mock, 2)
+
+	// A file where the directory should be can't be written into
+	uploadDir := filepath.Join(t.TempDir(), "uploads")
+	if err := os.WriteFile(uploadDir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewHealthService(db, uploadDir, math.MaxInt64, time.Second)
+	report := service.Readiness(context.Background())
+
+	if report.Status != ReadinessNotReady {
+		t.Errorf("Readiness() status = %q, want %q", report.Status, ReadinessNotReady)
+	}
+	for _, name := range []string{"database", "storage", "disk", "migrations"} {
+		if result := report.Checks[name]; result.Status != CheckFail || result.Error == "" {
+			t.Errorf("check %s = %+v, want a failure with its error", name, result)
+		}
+	}
+	if pending, _ := report.Checks["migrations"].Details["pending"].([]int64); len(pending) != 1 || pending[0] != 2 {
+		t.Errorf("pending migrations = %v, want [2]", pending)
+	}
+}
+
+func TestHealthService_LowDiskSpace(t *testing.T) {
+	db, _ := newHealthMockDB(t)
+	service := NewHealthService(db, t.TempDir(), math.MaxInt64, time.Second)
+
+	details, err := service.checkDisk(context.Background())
+	if err == nil {
+		t.Fatal("checkDisk() error = nil, want a failure below the minimum")
+	}
+	if details["min_free_bytes"] != int64(math.MaxInt64) {
+		t.Errorf("checkDisk() details = %v, want the minimum reported", details)
+	}
+}
+
+func TestHealthService_CheckTimesOut(t *testing.T) {
+	db, _ := newHealthMockDB(t)
+	service := NewHealthService(db, t.TempDir(), 0, 10*time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+	result := service.run(context.Background(), func(ctx context.Context) (map[string]interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	if result.Status != CheckFail || result.Error == "" {
+		t.Errorf("run() of a hung check = %+v, want a timeout failure", result)
+	}
+}
+
+func TestHealthService_StorageLeavesNoFiles(t *testing.T) {
+	db, _ := newHealthMockDB(t)
+	uploadDir := t.TempDir()
+	service := NewHealthService(db, uploadDir, 0, time.Second)
+
+	if _, err := service.checkStorage(context.Background()); err != nil {
+		t.Fatalf("checkStorage() error = %v", err)
+	}
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("checkStorage() left %d files behind", len(entries))
+	}
+}
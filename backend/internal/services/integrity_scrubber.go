@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+const (
+	scrubBatchSize    = 10
+	scrubPollInterval = time.Minute
+)
+
+// IntegrityScrubber periodically re-hashes stored blobs and flags the ones
+// whose content no longer matches the digest taken at upload.
+type IntegrityScrubber struct {
+	db       *database.DB
+	audit    *AuditService
+	interval time.Duration
+}
+
+// NewIntegrityScrubber returns a scrubber that verifies every blob at least
+// once per interval.
+func NewIntegrityScrubber(db *database.DB, interval time.Duration) *IntegrityScrubber {
+	return &IntegrityScrubber{db: db, audit: NewAuditService(db), interval: interval}
+}
+
+type storedBlob struct {
+	id        uuid.UUID
+	sha256    string
+	filePath  string
+	corrupted bool
+}
+
+// Run verifies blobs as they come due until ctx is cancelled.
+func (s *IntegrityScrubber) Run(ctx context.Context) {
+	for {
+		scrubbed, err := s.ScrubDue(ctx)
+		metrics.ObserveJob("integrity_scrub", scrubbed, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "integrity scrub failed", "error", err)
+		}
+
+		wait := scrubPollInterval
+		if scrubbed == scrubBatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ScrubDue claims a batch of blobs that haven't been verified within the
+// interval and re-hashes each. It returns how many were checked.
+func (s *IntegrityScrubber) ScrubDue(ctx context.Context) (int, error) {
+	// Claiming stamps verified_at, so another replica won't pick the same
+	// blobs up while these are being hashed
+	rows, err := s.db.QueryContext(ctx,
+		`UPDATE blobs SET verified_at = NOW()
+		 WHERE id IN (
+			SELECT id FROM blobs
+			WHERE ref_count > 0 AND (verified_at IS NULL OR verified_at < $2)
+			ORDER BY verified_at NULLS FIRST
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, sha256, file_path, corrupted_at IS NOT NULL`,
+		scrubBatchSize, time.Now().Add(-s.interval),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []storedBlob
+	for rows.Next() {
+		var b storedBlob
+		if err := rows.Scan(&b.id, &b.sha256, &b.filePath, &b.corrupted); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, b := range batch {
+		if err := s.verify(ctx, b); err != nil {
+			slog.Error("integrity scrub of blob failed", "blob_id", b.id, "error", err)
+		}
+	}
+	return len(batch), nil
+}
+
+// verify re-hashes one blob and records a change in its state.
+func (s *IntegrityScrubber) verify(ctx context.Context, b storedBlob) error {
+	problem := checkDigest(b.filePath, b.sha256)
+	switch {
+	case problem == nil && b.corrupted:
+		// Someone restored the file by hand
+		_, err := s.db.ExecContext(ctx, `UPDATE blobs SET corrupted_at = NULL WHERE id = $1`, b.id)
+		return err
+	case problem == nil || b.corrupted:
+		// Healthy, or already flagged
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, `UPDATE blobs SET corrupted_at = NOW() WHERE id = $1`, b.id); err != nil {
+		return err
+	}
+	slog.Error("blob failed its integrity check", "blob_id", b.id, "problem", problem)
+
+	// Leave the failure in the audit trail of every document using the blob
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM documents WHERE blob_id = $1 AND deleted_at IS NULL`, b.id)
+	if err != nil {
+		return err
+	}
+	var documentIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		documentIDs = append(documentIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range documentIDs {
+		if err := s.audit.Record(ctx, &models.AuditEntry{
+			Action:     AuditIntegrityFailed,
+			Outcome:    AuditFailure,
+			TargetType: "document",
+			TargetID:   &documentIDs[i],
+			Details:    map[string]string{"error": problem.Error()},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDigest reports why the file at path doesn't hash to want, or nil if
+// it does.
+func checkDigest(path, want string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("content hashes to %s, expected %s", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var claimedBlobColumns = []string{"id", "sha256", "file_path", "corrupted"}
+
+// sha256 of "test file content"
+const testContentDigest = "60f5237ed4049f0382661ef009d2bc42e48c3ceb3edb6600f7024e7ab3b838f3"
+
+func TestIntegrityScrubber_ScrubDue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	goodPath := filepath.Join(dir, "good")
+	os.WriteFile(goodPath, []byte("test file content"), 0600)
+	rottenPath := filepath.Join(dir, "rotten")
+	os.WriteFile(rottenPath, []byte("test file c0ntent"), 0600)
+	restoredPath := filepath.Join(dir, "restored")
+	os.WriteFile(restoredPath, []byte("test file content"), 0600)
+
+	goodID, rottenID, missingID, flaggedID, restoredID := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	docID := uuid.New()
+
+	mock.ExpectQuery(`UPDATE blobs SET verified_at = NOW\(\)\s+WHERE id IN .+FOR UPDATE SKIP LOCKED`).
+		WithArgs(scrubBatchSize, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(claimedBlobColumns).
+			AddRow(goodID, testContentDigest, goodPath, false).
+			AddRow(rottenID, testContentDigest, rottenPath, false).
+			AddRow(missingID, testContentDigest, filepath.Join(dir, "gone"), false).
+			AddRow(flaggedID, testContentDigest, rottenPath, true).
+			AddRow(restoredID, testContentDigest, restoredPath, true))
+
+	// Changed content is flagged and audited against its documents
+	mock.ExpectExec(`UPDATE blobs SET corrupted_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(rottenID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT id FROM documents WHERE blob_id = \$1 AND deleted_at IS NULL`).
+		WithArgs(rottenID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(docID))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT hash FROM audit_log`).WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+	mock.ExpectQuery(`INSERT INTO audit_log`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), AuditIntegrityFailed, AuditFailure, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), "document", &docID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"seq"}).AddRow(1))
+	mock.ExpectCommit()
+
+	// So is a missing file; without live documents nothing is audited
+	mock.ExpectExec(`UPDATE blobs SET corrupted_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(missingID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT id FROM documents WHERE blob_id = \$1`).
+		WithArgs(missingID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// An already flagged blob isn't reported again, and a repaired one is cleared
+	mock.ExpectExec(`UPDATE blobs SET corrupted_at = NULL WHERE id = \$1`).
+		WithArgs(restoredID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	scrubbed, err := NewIntegrityScrubber(db, 24*time.Hour).ScrubDue(context.Background())
+	if err != nil || scrubbed != 5 {
+		t.Errorf("ScrubDue() = %d, %v; want 5", scrubbed, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, []byte("test file content"), 0600)
+
+	if err := checkDigest(path, testContentDigest); err != nil {
+		t.Errorf("checkDigest() = %v for matching content", err)
+	}
+	if err := checkDigest(path, "00"); err == nil {
+		t.Error("checkDigest() = nil for a different digest")
+	}
+	if err := checkDigest(path+".missing", testContentDigest); err == nil {
+		t.Error("checkDigest() = nil for a missing file")
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidTag       = errors.New("invalid tag")
+	ErrInvalidMetadata  = errors.New("invalid metadata value")
+	ErrMetadataNotFound = errors.New("metadata field not found")
+)
+
+// Tags and metadata keys are restricted to a small, URL-safe alphabet so they
+// can be passed around as query parameters without escaping surprises.
+var (
+	tagPattern         = regexp.MustCompile(`^[a-z0-9][a-z0-9 _.-]{0,63}$`)
+	metadataKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+)
+
+type MetadataService struct {
+	db              *database.DB
+	documentService *DocumentService
+}
+
+func NewMetadataService(db *database.DB, documentService *DocumentService) *MetadataService {
+	return &MetadataService{db: db, documentService: documentService}
+}
+
+func (s *MetadataService) GetTags(ctx context.Context, documentID, userID uuid.UUID) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "MetadataService.GetTags")
+	defer span.End()
+
+	if err := s.requireAccess(ctx, documentID, userID, false); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT tag FROM document_tags WHERE document_id = $1 ORDER BY tag`,
+		documentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// SetTags replaces the document's tags with the given set. Tags are
+// lower-cased and de-duplicated before being stored.
+func (s *MetadataService) SetTags(ctx context.Context, documentID, userID uuid.UUID, tags []string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "MetadataService.SetTags")
+	defer span.End()
+
+	if err := s.requireAccess(ctx, documentID, userID, true); err != nil {
+		return nil, err
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if !tagPattern.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_tags WHERE document_id = $1`, documentID); err != nil {
+		return nil, err
+	}
+	for _, tag := range normalized {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO document_tags (document_id, tag) VALUES ($1, $2)`,
+			documentID, tag,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// UpdateTags adds and removes tags on the document, keeping its other tags,
+// and returns the resulting set. A tag in both lists ends up removed.
+func (s *MetadataService) UpdateTags(ctx context.Context, documentID, userID uuid.UUID, add, remove []string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "MetadataService.UpdateTags")
+	defer span.End()
+
+	if err := s.requireAccess(ctx, documentID, userID, true); err != nil {
+		return nil, err
+	}
+
+	normalize := func(tags []string) ([]string, error) {
+		normalized := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			tag = normalizeTag(tag)
+			if !tagPattern.MatchString(tag) {
+				return nil, ErrInvalidTag
+			}
+			normalized = append(normalized, tag)
+		}
+		return normalized, nil
+	}
+	added, err := normalize(add)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := normalize(remove)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, tag := range added {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO document_tags (document_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			documentID, tag,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM document_tags WHERE document_id = $1 AND tag = ANY($2)`,
+			documentID, pq.Array(removed),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT tag FROM document_tags WHERE document_id = $1 ORDER BY tag`, documentID)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// SuggestTags returns existing tags starting with prefix, drawn from the
+// documents the user owns or has been shared, most used first.
+func (s *MetadataService) SuggestTags(ctx context.Context, userID uuid.UUID, prefix string, limit int) ([]models.TagSuggestion, error) {
+	ctx, span := tracing.Start(ctx, "MetadataService.SuggestTags")
+	defer span.End()
+
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	// Tags come from every document the user can read, including those
+	// reached through a shared folder
+	rows, err := s.db.QueryContext(ctx,
+		accessibleDocumentsCTE+`
+		SELECT t.tag, COUNT(*) FROM document_tags t
+		JOIN accessible a ON a.document_id = t.document_id
+		JOIN documents d ON t.document_id = d.id
+		WHERE d.deleted_at IS NULL
+		AND t.tag LIKE $2 ESCAPE '\'
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag
+		LIMIT $3`,
+		userID, escapeLike(normalizeTag(prefix))+"%", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []models.TagSuggestion{}
+	for rows.Next() {
+		var suggestion models.TagSuggestion
+		if err := rows.Scan(&suggestion.Tag, &suggestion.Count); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
+
+func (s *MetadataService) GetMetadata(ctx context.Context, documentID, userID uuid.UUID) ([]models.MetadataField, error) {
+	ctx, span := tracing.Start(ctx, "MetadataService.GetMetadata")
+	defer span.End()
+
+	if err := s.requireAccess(ctx, documentID, userID, false); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT key, value_type, value, updated_at FROM document_metadata WHERE document_id = $1 ORDER BY key`,
+		documentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []models.MetadataField{}
+	for rows.Next() {
+		var field models.MetadataField
+		if err := rows.Scan(&field.Key, &field.Type, &field.Value, &field.UpdatedAt); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, rows.Err()
+}
+
+// SetMetadata creates or updates the given fields, leaving any others on the
+// document untouched. Values are validated against their declared type.
+func (s *MetadataService) SetMetadata(ctx context.Context, documentID, userID uuid.UUID, fields []models.MetadataField) ([]models.MetadataField, error) {
+	ctx, span := tracing.Start(ctx, "MetadataService.SetMetadata")
+	defer span.End()
+
+	if err := s.requireAccess(ctx, documentID, userID, true); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	normalized := make([]models.MetadataField, 0, len(fields))
+	for _, field := range fields {
+		key := strings.ToLower(strings.TrimSpace(field.Key))
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, ErrInvalidMetadata
+		}
+		value, err := NormalizeMetadataValue(field.Type, field.Value)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, models.MetadataField{Key: key, Type: field.Type, Value: value, UpdatedAt: now})
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, field := range normalized {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO document_metadata (document_id, key, value_type, value, updated_at)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (document_id, key) DO UPDATE SET value_type = $3, value = $4, updated_at = $5`,
+			documentID, field.Key, field.Type, field.Value, field.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func (s *MetadataService) DeleteMetadata(ctx context.Context, documentID, userID uuid.UUID, key string) error {
+	ctx, span := tracing.Start(ctx, "MetadataService.DeleteMetadata")
+	defer span.End()
+
+	if err := s.requireAccess(ctx, documentID, userID, true); err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM document_metadata WHERE document_id = $1 AND key = $2`,
+		documentID, strings.ToLower(key),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrMetadataNotFound
+	}
+	return nil
+}
+
+// metadataValueTypes are the types a metadata field can hold.
+var metadataValueTypes = []string{"string", "number", "date", "boolean"}
+
+// NormalizeMetadataValue validates value against valueType and returns the
+// canonical text form stored in the database.
+func NormalizeMetadataValue(valueType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch valueType {
+	case "string":
+		if value == "" {
+			return "", ErrInvalidMetadata
+		}
+		return value, nil
+	case "number":
+		// NaN and the infinities parse, but don't compare or sort as numbers
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", ErrInvalidMetadata
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case "date":
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return "", ErrInvalidMetadata
+		}
+		return d.Format("2006-01-02"), nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", ErrInvalidMetadata
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		return "", ErrInvalidMetadata
+	}
+}
+
+// requireAccess checks that the user can read the document, and when write is
+// set, that they are its owner or an editor.
+func (s *MetadataService) requireAccess(ctx context.Context, documentID, userID uuid.UUID, write bool) error {
+	canAccess, permission, err := s.documentService.CanAccess(ctx, documentID, userID)
+	if err != nil {
+		return err
+	}
+	if !canAccess || (write && permission != "owner" && permission != "edit") {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
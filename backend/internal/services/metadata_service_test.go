@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+func TestMetadataService_SetTags_NormalizesAndDeduplicates(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM document_tags WHERE document_id = \$1`).
+		WithArgs(docID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO document_tags`).
+		WithArgs(docID, "contract").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO document_tags`).
+		WithArgs(docID, "acme corp").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tags, err := service.SetTags(context.Background(), docID, ownerID, []string{"Contract", " contract ", "Acme Corp"})
+	if err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+
+	if len(tags) != 2 || tags[0] != "contract" || tags[1] != "acme corp" {
+		t.Errorf("SetTags() = %v, want [contract acme corp]", tags)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMetadataService_UpdateTags(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	editorID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, uuid.New(), "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, editorID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("edit"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO document_tags \(document_id, tag\) VALUES \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+		WithArgs(docID, "q3").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM document_tags WHERE document_id = \$1 AND tag = ANY\(\$2\)`).
+		WithArgs(docID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT tag FROM document_tags WHERE document_id = \$1`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"tag"}).AddRow("finance").AddRow("q3"))
+	mock.ExpectCommit()
+
+	tags, err := service.UpdateTags(context.Background(), docID, editorID, []string{" Q3 "}, []string{"draft"})
+	if err != nil {
+		t.Fatalf("UpdateTags() error = %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "finance" || tags[1] != "q3" {
+		t.Errorf("UpdateTags() = %v, want [finance q3]", tags)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMetadataService_UpdateTags_ViewerDenied(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	viewerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, uuid.New(), "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, viewerID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("view"))
+
+	if _, err := service.UpdateTags(context.Background(), docID, viewerID, []string{"q3"}, nil); err != ErrAccessDenied {
+		t.Errorf("UpdateTags() error = %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestMetadataService_SetTags_InvalidTag(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	_, err := service.SetTags(context.Background(), docID, ownerID, []string{"100%"})
+
+	if err != ErrInvalidTag {
+		t.Errorf("SetTags() error = %v, want ErrInvalidTag", err)
+	}
+}
+
+func TestMetadataService_SetTags_ViewerDenied(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	viewerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, uuid.New(), "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, viewerID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("view"))
+
+	_, err := service.SetTags(context.Background(), docID, viewerID, []string{"draft"})
+
+	if err != ErrAccessDenied {
+		t.Errorf("SetTags() by viewer error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMetadataService_SuggestTags_EscapesPrefix(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+	userID := uuid.New()
+
+	mock.ExpectQuery(`WITH RECURSIVE shared_folders .+ SELECT t.tag, COUNT\(\*\) FROM document_tags t\s+JOIN accessible a`).
+		WithArgs(userID, `tax\_%`, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "count"}).AddRow("tax_2024", 3))
+
+	suggestions, err := service.SuggestTags(context.Background(), userID, "Tax_", 0)
+	if err != nil {
+		t.Fatalf("SuggestTags() error = %v", err)
+	}
+
+	if len(suggestions) != 1 || suggestions[0].Tag != "tax_2024" || suggestions[0].Count != 3 {
+		t.Errorf("SuggestTags() = %+v", suggestions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMetadataService_SetMetadata_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewMetadataService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO document_metadata`).
+		WithArgs(docID, "year", "number", "2024", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO document_metadata`).
+		WithArgs(docID, "client", "string", "Acme", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	fields, err := service.SetMetadata(context.Background(), docID, ownerID, []models.MetadataField{
+		{Key: "Year", Type: "number", Value: "2024.0"},
+		{Key: "client", Type: "string", Value: " Acme "},
+	})
+	if err != nil {
+		t.Fatalf("SetMetadata() error = %v", err)
+	}
+
+	if len(fields) != 2 {
+		t.Errorf("len(fields) = %d, want 2", len(fields))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNormalizeMetadataValue(t *testing.T) {
+	tests := []struct {
+		valueType string
+		value     string
+		want      string
+		wantErr   bool
+	}{
+		{"string", "hello", "hello", false},
+		{"string", "   ", "", true},
+		{"number", "42", "42", false},
+		{"number", "1.50", "1.5", false},
+		{"number", "abc", "", true},
+		{"number", "NaN", "", true},
+		{"number", "Inf", "", true},
+		{"number", "-infinity", "", true},
+		{"number", "1e400", "", true},
+		{"date", "2024-03-01", "2024-03-01", false},
+		{"date", "01/03/2024", "", true},
+		{"boolean", "TRUE", "true", false},
+		{"boolean", "yes", "", true},
+		{"unknown", "x", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeMetadataValue(tt.valueType, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeMetadataValue(%q, %q) error = %v, wantErr %v", tt.valueType, tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeMetadataValue(%q, %q) = %q, want %q", tt.valueType, tt.value, got, tt.want)
+		}
+	}
+}
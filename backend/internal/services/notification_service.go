@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+)
+
+var (
+	ErrNotificationNotFound    = errors.New("notification not found")
+	ErrInvalidNotificationType = errors.New("invalid notification type")
+)
+
+// Notification types
+const (
+	NotificationDocumentShared   = "document.shared"
+	NotificationFolderShared     = "folder.shared"
+	NotificationShareExpired     = "share.expired"
+	NotificationTransferOffered  = "transfer.offered"
+	NotificationTransferAccepted = "transfer.accepted"
+	NotificationTransferDeclined = "transfer.declined"
+	NotificationCommentAdded     = "comment.added"
+)
+
+// notificationTypes lists every type in the order preferences are shown,
+// with whether it is emailed when the user hasn't chosen.
+var notificationTypes = []models.NotificationPreference{
+	{Type: NotificationDocumentShared, Email: true},
+	{Type: NotificationFolderShared, Email: true},
+	{Type: NotificationShareExpired, Email: false},
+	{Type: NotificationTransferOffered, Email: true},
+	{Type: NotificationTransferAccepted, Email: false},
+	{Type: NotificationTransferDeclined, Email: false},
+	{Type: NotificationCommentAdded, Email: true},
+}
+
+func emailByDefault(notificationType string) (bool, bool) {
+	for _, p := range notificationTypes {
+		if p.Type == notificationType {
+			return p.Email, true
+		}
+	}
+	return false, false
+}
+
+// NotificationService maintains each user's notification inbox. Whether a
+// notification is also emailed is decided when it is created; the
+// NotificationWorker sends the email later.
+type NotificationService struct {
+	db *database.DB
+}
+
+func NewNotificationService(db *database.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// Notify adds a notification to the user's inbox. Users aren't notified of
+// their own actions.
+func (s *NotificationService) Notify(ctx context.Context, userID uuid.UUID, n models.Notification) error {
+	ctx, span := tracing.Start(ctx, "NotificationService.Notify")
+	defer span.End()
+
+	if n.ActorID != nil && *n.ActorID == userID {
+		return nil
+	}
+
+	email, ok := emailByDefault(n.Type)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidNotificationType, n.Type)
+	}
+
+	data, err := notificationData(n.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO notifications (id, user_id, type, actor_id, document_id, folder_id, data, email_pending, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7,
+		         COALESCE((SELECT email FROM notification_preferences WHERE user_id = $2 AND type = $3), $8), $9)`,
+		uuid.New(), userID, n.Type, n.ActorID, n.DocumentID, n.FolderID, data, email, time.Now(),
+	)
+	return err
+}
+
+// List returns a page of the user's notifications, newest first, along with
+// the total matching and the number unread.
+func (s *NotificationService) List(ctx context.Context, userID uuid.UUID, unreadOnly bool, page, perPage int) ([]models.Notification, models.PageInfo, int, error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.List")
+	defer span.End()
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	info := models.PageInfo{Page: page, PerPage: perPage}
+
+	var unread int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE read_at IS NULL) FROM notifications WHERE user_id = $1`,
+		userID,
+	).Scan(&info.Total, &unread)
+	if err != nil {
+		return nil, info, 0, err
+	}
+	if unreadOnly {
+		info.Total = unread
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT n.id, n.type, n.actor_id, COALESCE(u.name, ''), n.document_id, n.folder_id, n.data, n.read_at, n.created_at
+		 FROM notifications n
+		 LEFT JOIN users u ON n.actor_id = u.id
+		 WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		 ORDER BY n.created_at DESC, n.id DESC
+		 LIMIT $3 OFFSET $4`,
+		userID, unreadOnly, perPage, (page-1)*perPage,
+	)
+	if err != nil {
+		return nil, info, 0, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.Type, &n.ActorID, &n.ActorName, &n.DocumentID, &n.FolderID,
+			&data, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, info, 0, err
+		}
+		if len(data) > 0 {
+			json.Unmarshal(data, &n.Data)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, info, 0, err
+	}
+
+	return notifications, info, unread, nil
+}
+
+// MarkRead marks one of the user's notifications as read. Marking an already
+// read notification keeps its original read time.
+func (s *NotificationService) MarkRead(ctx context.Context, id, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "NotificationService.MarkRead")
+	defer span.End()
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = COALESCE(read_at, $1) WHERE id = $2 AND user_id = $3`,
+		time.Now(), id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user as read and
+// returns how many there were.
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.MarkAllRead")
+	defer span.End()
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL`,
+		time.Now(), userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Preferences returns the user's email setting for every notification type,
+// falling back to the defaults for types they haven't set.
+func (s *NotificationService) Preferences(ctx context.Context, userID uuid.UUID) ([]models.NotificationPreference, error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.Preferences")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT type, email FROM notification_preferences WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chosen := make(map[string]bool)
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Type, &p.Email); err != nil {
+			return nil, err
+		}
+		chosen[p.Type] = p.Email
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]models.NotificationPreference, len(notificationTypes))
+	for i, p := range notificationTypes {
+		if email, ok := chosen[p.Type]; ok {
+			p.Email = email
+		}
+		preferences[i] = p
+	}
+	return preferences, nil
+}
+
+// SetPreferences stores the user's email choices. Types not mentioned keep
+// their current setting.
+func (s *NotificationService) SetPreferences(ctx context.Context, userID uuid.UUID, preferences []models.NotificationPreference) error {
+	ctx, span := tracing.Start(ctx, "NotificationService.SetPreferences")
+	defer span.End()
+
+	for _, p := range preferences {
+		if _, ok := emailByDefault(p.Type); !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidNotificationType, p.Type)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range preferences {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO notification_preferences (user_id, type, email) VALUES ($1, $2, $3)
+			 ON CONFLICT (user_id, type) DO UPDATE SET email = $3`,
+			userID, p.Type, p.Email,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// NotifyExpiredShares notifies recipients whose document or folder share has
+// expired since the last sweep, and returns how many were notified. Each
+// share is flagged in the same statement, so it is notified only once even
+// with several replicas sweeping.
+func (s *NotificationService) NotifyExpiredShares(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.NotifyExpiredShares")
+	defer span.End()
+
+	email, _ := emailByDefault(NotificationShareExpired)
+
+	sweeps := []string{
+		`WITH expired AS (
+			UPDATE document_shares ds SET expiry_notified = true
+			FROM documents d
+			WHERE d.id = ds.document_id AND d.deleted_at IS NULL
+			  AND ds.expires_at <= NOW() AND NOT ds.expiry_notified
+			RETURNING ds.shared_with_id, ds.shared_by_id, ds.document_id, d.name
+		)
+		INSERT INTO notifications (user_id, type, actor_id, document_id, data, email_pending)
+		SELECT e.shared_with_id, $1, e.shared_by_id, e.document_id, jsonb_build_object('name', e.name), COALESCE(p.email, $2)
+		FROM expired e
+		LEFT JOIN notification_preferences p ON p.user_id = e.shared_with_id AND p.type = $1`,
+		`WITH expired AS (
+			UPDATE folder_shares fs SET expiry_notified = true
+			FROM folders f
+			WHERE f.id = fs.folder_id
+			  AND fs.expires_at <= NOW() AND NOT fs.expiry_notified
+			RETURNING fs.shared_with_id, fs.shared_by_id, fs.folder_id, f.name
+		)
+		INSERT INTO notifications (user_id, type, actor_id, folder_id, data, email_pending)
+		SELECT e.shared_with_id, $1, e.shared_by_id, e.folder_id, jsonb_build_object('name', e.name), COALESCE(p.email, $2)
+		FROM expired e
+		LEFT JOIN notification_preferences p ON p.user_id = e.shared_with_id AND p.type = $1`,
+	}
+
+	var notified int64
+	for _, sweep := range sweeps {
+		result, err := s.db.ExecContext(ctx, sweep, NotificationShareExpired, email)
+		if err != nil {
+			return notified, err
+		}
+		n, _ := result.RowsAffected()
+		notified += n
+	}
+	return notified, nil
+}
+
+func notificationData(data map[string]interface{}) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// logNotifyError logs a failed notification. The inbox is secondary to the
+// change that triggered it, which still succeeds.
+func logNotifyError(notificationType string, err error) {
+	if err != nil {
+		slog.Error("failed to record notification", "type", notificationType, "error", err)
+	}
+}
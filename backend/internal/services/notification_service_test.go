@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// expectNotification expects one notification of the given type to be
+// recorded.
+func expectNotification(mock sqlmock.Sqlmock, notificationType string) {
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), notificationType, sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+var notificationColumns = []string{"id", "type", "actor_id", "actor_name", "document_id", "folder_id", "data", "read_at", "created_at"}
+
+func TestNotificationService_Notify_UsesDefaultEmailPreference(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	userID := uuid.New()
+	actorID := uuid.New()
+	docID := uuid.New()
+
+	mock.ExpectExec(`INSERT INTO notifications .+COALESCE\(\(SELECT email FROM notification_preferences`).
+		WithArgs(sqlmock.AnyArg(), userID, NotificationDocumentShared, actorID.String(), docID.String(), nil,
+			`{"name":"Report"}`, true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := service.Notify(context.Background(), userID, models.Notification{
+		Type:       NotificationDocumentShared,
+		ActorID:    &actorID,
+		DocumentID: &docID,
+		Data:       map[string]interface{}{"name": "Report"},
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationService_Notify_SkipsOwnActions(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	userID := uuid.New()
+	if err := service.Notify(context.Background(), userID, models.Notification{Type: NotificationDocumentShared, ActorID: &userID}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationService_Notify_UnknownType(t *testing.T) {
+	db, _ := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	err := service.Notify(context.Background(), uuid.New(), models.Notification{Type: "document.viewed"})
+	if !errors.Is(err, ErrInvalidNotificationType) {
+		t.Errorf("Notify() error = %v, want ErrInvalidNotificationType", err)
+	}
+}
+
+func TestNotificationService_List_UnreadOnly(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	userID := uuid.New()
+	actorID := uuid.New()
+	docID := uuid.New()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\), COUNT\(\*\) FILTER \(WHERE read_at IS NULL\) FROM notifications`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "unread"}).AddRow(7, 2))
+	mock.ExpectQuery(`SELECT .+ FROM notifications n\s+LEFT JOIN users u`).
+		WithArgs(userID, true, 20, 0).
+		WillReturnRows(sqlmock.NewRows(notificationColumns).
+			AddRow(uuid.New(), NotificationDocumentShared, actorID, "Alice", docID, nil, []byte(`{"name":"Report"}`), nil, time.Now()).
+			AddRow(uuid.New(), NotificationShareExpired, nil, "", nil, nil, nil, nil, time.Now()))
+
+	notifications, info, unread, err := service.List(context.Background(), userID, true, 0, 0)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if unread != 2 || info.Total != 2 {
+		t.Errorf("unread = %d, total = %d, want 2 and 2", unread, info.Total)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("len(notifications) = %d, want 2", len(notifications))
+	}
+	if n := notifications[0]; n.ActorName != "Alice" || n.Data["name"] != "Report" || *n.DocumentID != docID {
+		t.Errorf("notifications[0] = %+v", n)
+	}
+	if notifications[1].ActorID != nil || notifications[1].Data != nil {
+		t.Errorf("notifications[1] = %+v, want no actor or data", notifications[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationService_MarkRead_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	id := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectExec(`UPDATE notifications SET read_at = COALESCE\(read_at, \$1\) WHERE id = \$2 AND user_id = \$3`).
+		WithArgs(sqlmock.AnyArg(), id, userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := service.MarkRead(context.Background(), id, userID); err != ErrNotificationNotFound {
+		t.Errorf("MarkRead() error = %v, want ErrNotificationNotFound", err)
+	}
+}
+
+func TestNotificationService_MarkAllRead(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	userID := uuid.New()
+	mock.ExpectExec(`UPDATE notifications SET read_at = \$1 WHERE user_id = \$2 AND read_at IS NULL`).
+		WithArgs(sqlmock.AnyArg(), userID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	marked, err := service.MarkAllRead(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("MarkAllRead() error = %v", err)
+	}
+	if marked != 3 {
+		t.Errorf("MarkAllRead() = %d, want 3", marked)
+	}
+}
+
+func TestNotificationService_Preferences_MergesDefaults(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT type, email FROM notification_preferences WHERE user_id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "email"}).
+			AddRow(NotificationDocumentShared, false).
+			AddRow(NotificationShareExpired, true))
+
+	preferences, err := service.Preferences(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Preferences() error = %v", err)
+	}
+
+	if len(preferences) != len(notificationTypes) {
+		t.Fatalf("len(preferences) = %d, want %d", len(preferences), len(notificationTypes))
+	}
+	got := make(map[string]bool)
+	for _, p := range preferences {
+		got[p.Type] = p.Email
+	}
+	if got[NotificationDocumentShared] || !got[NotificationShareExpired] || !got[NotificationTransferOffered] {
+		t.Errorf("preferences = %v, want overrides applied over defaults", got)
+	}
+}
+
+func TestNotificationService_SetPreferences(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	userID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO notification_preferences .+ON CONFLICT`).
+		WithArgs(userID, NotificationTransferAccepted, true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := service.SetPreferences(context.Background(), userID, []models.NotificationPreference{{Type: NotificationTransferAccepted, Email: true}})
+	if err != nil {
+		t.Fatalf("SetPreferences() error = %v", err)
+	}
+
+	// Unknown types are rejected before anything is written
+	err = service.SetPreferences(context.Background(), userID, []models.NotificationPreference{{Type: "document.viewed", Email: true}})
+	if !errors.Is(err, ErrInvalidNotificationType) {
+		t.Errorf("SetPreferences() error = %v, want ErrInvalidNotificationType", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationService_NotifyExpiredShares(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewNotificationService(db)
+
+	mock.ExpectExec(`WITH expired AS \(\s+UPDATE document_shares ds SET expiry_notified = true.+INSERT INTO notifications`).
+		WithArgs(NotificationShareExpired, false).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`WITH expired AS \(\s+UPDATE folder_shares fs SET expiry_notified = true.+INSERT INTO notifications`).
+		WithArgs(NotificationShareExpired, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	notified, err := service.NotifyExpiredShares(context.Background())
+	if err != nil {
+		t.Fatalf("NotifyExpiredShares() error = %v", err)
+	}
+	if notified != 3 {
+		t.Errorf("NotifyExpiredShares() = %d, want 3", notified)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/mailer"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+)
+
+const (
+	notificationBatchSize    = 20
+	notificationPollInterval = 5 * time.Second
+	// notificationLease keeps a claimed email from being sent by another
+	// worker while this one is talking to the mail server.
+	notificationLease = time.Minute
+	// notificationMaxAttempts is how many failed sends make a notification
+	// stay in the inbox only.
+	notificationMaxAttempts = 5
+)
+
+// NotificationWorker turns expired shares into notifications and emails the
+// notifications their recipients asked to receive by email.
+type NotificationWorker struct {
+	db            *database.DB
+	notifications *NotificationService
+	mailer        mailer.Mailer
+}
+
+func NewNotificationWorker(db *database.DB, m mailer.Mailer) *NotificationWorker {
+	return &NotificationWorker{db: db, notifications: NewNotificationService(db), mailer: m}
+}
+
+type pendingEmail struct {
+	id        uuid.UUID
+	kind      string
+	data      []byte
+	attempts  int
+	to        string
+	actorName string
+}
+
+// Run sweeps and sends until ctx is cancelled.
+func (w *NotificationWorker) Run(ctx context.Context) {
+	for {
+		notified, err := w.notifications.NotifyExpiredShares(ctx)
+		metrics.ObserveJob("share_expiry_sweep", int(notified), err)
+		if err != nil {
+			slog.ErrorContext(ctx, "share expiry sweep failed", "error", err)
+		}
+
+		sent, err := w.SendDue(ctx)
+		metrics.ObserveJob("notification_email", sent, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "notification email failed", "error", err)
+		}
+
+		wait := notificationPollInterval
+		if sent == notificationBatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// SendDue claims a batch of notifications waiting to be emailed and sends
+// each once. It returns how many were attempted.
+func (w *NotificationWorker) SendDue(ctx context.Context) (int, error) {
+	rows, err := w.db.QueryContext(ctx,
+		`UPDATE notifications n
+		 SET email_next_attempt_at = $2
+		 FROM users u
+		 WHERE u.id = n.user_id AND n.id IN (
+			SELECT id FROM notifications
+			WHERE email_pending AND email_next_attempt_at <= NOW()
+			ORDER BY email_next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING n.id, n.type, n.data, n.email_attempts, u.email,
+		           COALESCE((SELECT name FROM users WHERE id = n.actor_id), '')`,
+		notificationBatchSize, time.Now().Add(notificationLease),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []pendingEmail
+	for rows.Next() {
+		var p pendingEmail
+		if err := rows.Scan(&p.id, &p.kind, &p.data, &p.attempts, &p.to, &p.actorName); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range batch {
+		if err := w.attempt(ctx, p); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// attempt sends one email and records the outcome. Only a failure to record
+// is returned.
+func (w *NotificationWorker) attempt(ctx context.Context, p pendingEmail) error {
+	sendErr := w.mailer.Send(notificationEmail(p))
+	if sendErr == nil {
+		_, err := w.db.ExecContext(ctx,
+			`UPDATE notifications SET email_pending = false, email_attempts = email_attempts + 1, emailed_at = NOW()
+			 WHERE id = $1`,
+			p.id,
+		)
+		return err
+	}
+
+	attempts := p.attempts + 1
+	if attempts >= notificationMaxAttempts {
+		slog.Warn("giving up emailing notification", "notification_id", p.id, "error", sendErr)
+	}
+	_, err := w.db.ExecContext(ctx,
+		`UPDATE notifications SET email_pending = $1, email_attempts = $2, email_next_attempt_at = $3
+		 WHERE id = $4`,
+		attempts < notificationMaxAttempts, attempts, time.Now().Add(retryBackoff(attempts)), p.id,
+	)
+	return err
+}
+
+// notificationEmail renders the message for a notification.
+func notificationEmail(p pendingEmail) mailer.Message {
+	var data map[string]interface{}
+	json.Unmarshal(p.data, &data)
+	name, _ := data["name"].(string)
+
+	actor := p.actorName
+	if actor == "" {
+		actor = "Someone"
+	}
+
+	var subject string
+	switch p.kind {
+	case NotificationDocumentShared:
+		subject = fmt.Sprintf("%s shared %q with you", actor, name)
+	case NotificationFolderShared:
+		subject = fmt.Sprintf("%s shared the folder %q with you", actor, name)
+	case NotificationShareExpired:
+		subject = fmt.Sprintf("Your access to %q has expired", name)
+	case NotificationTransferOffered:
+		if count, ok := data["count"].(float64); ok {
+			subject = fmt.Sprintf("%s wants to transfer %d documents to you", actor, int(count))
+		} else {
+			subject = fmt.Sprintf("%s wants to transfer %q to you", actor, name)
+		}
+	case NotificationTransferAccepted:
+		subject = fmt.Sprintf("%s accepted ownership of %q", actor, name)
+	case NotificationTransferDeclined:
+		subject = fmt.Sprintf("%s declined ownership of %q", actor, name)
+	case NotificationCommentAdded:
+		subject = fmt.Sprintf("%s commented on %q", actor, name)
+	default:
+		subject = "You have a new notification"
+	}
+
+	return mailer.Message{
+		To:      p.to,
+		Subject: subject,
+		Body:    subject + ".\n\nSign in to SecureVault to see your notifications.\n",
+	}
+}
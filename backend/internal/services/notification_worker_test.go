@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/mailer"
+)
+
+// recordingMailer keeps sent messages and fails when err is set.
+type recordingMailer struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var claimedEmailColumns = []string{"id", "type", "data", "email_attempts", "email", "actor_name"}
+
+func TestNotificationWorker_SendDue_EmailsRecipient(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	m := &recordingMailer{}
+	worker := NewNotificationWorker(db, m)
+
+	id := uuid.New()
+	mock.ExpectQuery(`UPDATE notifications n.+FOR UPDATE SKIP LOCKED.+RETURNING`).
+		WithArgs(notificationBatchSize, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(claimedEmailColumns).
+			AddRow(id, NotificationDocumentShared, []byte(`{"name":"Report.pdf"}`), 0, "bob@example.com", "Alice"))
+	mock.ExpectExec(`UPDATE notifications SET email_pending = false`).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sent, err := worker.SendDue(context.Background())
+	if err != nil {
+		t.Fatalf("SendDue() error = %v", err)
+	}
+	if sent != 1 || len(m.sent) != 1 {
+		t.Fatalf("SendDue() = %d with %d emails, want 1", sent, len(m.sent))
+	}
+
+	msg := m.sent[0]
+	if msg.To != "bob@example.com" || msg.Subject != `Alice shared "Report.pdf" with you` {
+		t.Errorf("sent %+v", msg)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationWorker_SendDue_FailureSchedulesRetry(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	worker := NewNotificationWorker(db, &recordingMailer{err: errors.New("connection refused")})
+
+	id := uuid.New()
+	mock.ExpectQuery(`UPDATE notifications n`).
+		WillReturnRows(sqlmock.NewRows(claimedEmailColumns).
+			AddRow(id, NotificationTransferOffered, []byte(`{"count":3}`), 1, "bob@example.com", "Alice"))
+	mock.ExpectExec(`UPDATE notifications SET email_pending = \$1, email_attempts = \$2`).
+		WithArgs(true, 2, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := worker.SendDue(context.Background()); err != nil {
+		t.Fatalf("SendDue() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationWorker_SendDue_GivesUp(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	worker := NewNotificationWorker(db, &recordingMailer{err: errors.New("mailbox unavailable")})
+
+	id := uuid.New()
+	mock.ExpectQuery(`UPDATE notifications n`).
+		WillReturnRows(sqlmock.NewRows(claimedEmailColumns).
+			AddRow(id, NotificationShareExpired, nil, notificationMaxAttempts-1, "bob@example.com", ""))
+	mock.ExpectExec(`UPDATE notifications SET email_pending = \$1`).
+		WithArgs(false, notificationMaxAttempts, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := worker.SendDue(context.Background()); err != nil {
+		t.Fatalf("SendDue() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNotificationEmail(t *testing.T) {
+	tests := []struct {
+		kind, data, actor, want string
+	}{
+		{NotificationFolderShared, `{"name":"Invoices"}`, "Alice", `Alice shared the folder "Invoices" with you`},
+		{NotificationShareExpired, `{"name":"Report.pdf"}`, "", `Your access to "Report.pdf" has expired`},
+		{NotificationTransferOffered, `{"count":3}`, "Alice", "Alice wants to transfer 3 documents to you"},
+		{NotificationTransferAccepted, `{"name":"Contract"}`, "", `Someone accepted ownership of "Contract"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			msg := notificationEmail(pendingEmail{kind: tt.kind, data: []byte(tt.data), actorName: tt.actor, to: "bob@example.com"})
+			if msg.Subject != tt.want {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.want)
+			}
+			if !strings.HasPrefix(msg.Body, tt.want) {
+				t.Errorf("Body = %q, want it to start with the subject", msg.Body)
+			}
+		})
+	}
+}
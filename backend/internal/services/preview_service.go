@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"github.com/katim/secure-doc-vault/pkg/preview"
+)
+
+var (
+	ErrPreviewPending     = errors.New("preview is still being generated")
+	ErrPreviewUnavailable = errors.New("no preview is available for this document")
+)
+
+// Preview states. A document whose type can be previewed starts pending
+// until the PreviewWorker renders it.
+const (
+	PreviewPending = "pending"
+	PreviewReady   = "ready"
+	PreviewFailed  = "failed"
+)
+
+type PreviewService struct {
+	db              *database.DB
+	documentService *DocumentService
+}
+
+func NewPreviewService(db *database.DB, documentService *DocumentService) *PreviewService {
+	return &PreviewService{db: db, documentService: documentService}
+}
+
+// Thumbnail returns the scaled-down image generated for an image document.
+func (s *PreviewService) Thumbnail(ctx context.Context, documentID, userID uuid.UUID) (*models.DocumentPreview, error) {
+	ctx, span := tracing.Start(ctx, "PreviewService.Thumbnail")
+	defer span.End()
+
+	doc, err := s.authorize(ctx, documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !preview.Thumbnailable(doc.MimeType) {
+		return nil, ErrPreviewUnavailable
+	}
+
+	p := &models.DocumentPreview{}
+	var contentType sql.NullString
+	if err := s.load(ctx, documentID, p, `thumbnail, thumbnail_type`, &p.Data, &contentType); err != nil {
+		return nil, err
+	}
+	p.ContentType = contentType.String
+	return p, nil
+}
+
+// Text returns the opening text generated for a plain-text document.
+func (s *PreviewService) Text(ctx context.Context, documentID, userID uuid.UUID) (*models.DocumentPreview, error) {
+	ctx, span := tracing.Start(ctx, "PreviewService.Text")
+	defer span.End()
+
+	doc, err := s.authorize(ctx, documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !preview.Textual(doc.MimeType) {
+		return nil, ErrPreviewUnavailable
+	}
+
+	p := &models.DocumentPreview{ContentType: "text/plain; charset=utf-8"}
+	var text sql.NullString
+	if err := s.load(ctx, documentID, p, `preview_text, preview_truncated`, &text, &p.Truncated); err != nil {
+		return nil, err
+	}
+	p.Data = []byte(text.String)
+	return p, nil
+}
+
+// authorize returns the document when the user may read it.
+func (s *PreviewService) authorize(ctx context.Context, documentID, userID uuid.UUID) (*models.Document, error) {
+	doc, err := s.documentService.GetByID(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if doc.OwnerID == userID {
+		return doc, nil
+	}
+
+	permission, err := s.documentService.sharedPermission(ctx, documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if permission == "" {
+		return nil, ErrAccessDenied
+	}
+	return doc, nil
+}
+
+// load scans the given preview columns into dest once the preview is ready,
+// and fills in p.GeneratedAt.
+func (s *PreviewService) load(ctx context.Context, documentID uuid.UUID, p *models.DocumentPreview, columns string, dest ...interface{}) error {
+	var status string
+	var generatedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT status, generated_at, `+columns+` FROM document_previews WHERE document_id = $1`,
+		documentID,
+	).Scan(append([]interface{}{&status, &generatedAt}, dest...)...)
+	// The worker hasn't picked up a new upload yet
+	if err == sql.ErrNoRows {
+		return ErrPreviewPending
+	}
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case PreviewReady:
+		p.GeneratedAt = generatedAt.Time
+		return nil
+	case PreviewPending:
+		return ErrPreviewPending
+	default:
+		return ErrPreviewUnavailable
+	}
+}
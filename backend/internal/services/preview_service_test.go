@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func expectPreviewDocument(mock sqlmock.Sqlmock, docID, ownerID uuid.UUID, mimeType string) {
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "file", "file", 1024, mimeType, "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, ""))
+}
+
+func TestPreviewService_Thumbnail_Ready(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewPreviewService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	viewerID := uuid.New()
+	generatedAt := time.Now().Add(-time.Hour)
+
+	expectPreviewDocument(mock, docID, uuid.New(), "image/png")
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, viewerID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("view"))
+	mock.ExpectQuery(`SELECT status, generated_at, thumbnail, thumbnail_type FROM document_previews WHERE document_id = \$1`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "generated_at", "thumbnail", "thumbnail_type"}).
+			AddRow(PreviewReady, generatedAt, []byte("png bytes"), "image/png"))
+
+	p, err := service.Thumbnail(context.Background(), docID, viewerID)
+	if err != nil {
+		t.Fatalf("Thumbnail() error = %v", err)
+	}
+	if string(p.Data) != "png bytes" || p.ContentType != "image/png" || !p.GeneratedAt.Equal(generatedAt) {
+		t.Errorf("Thumbnail() = %+v", p)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPreviewService_Text_States(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string // "" for no preview row yet
+		wantErr error
+	}{
+		{"not queued yet", "", ErrPreviewPending},
+		{"pending", PreviewPending, ErrPreviewPending},
+		{"failed", PreviewFailed, ErrPreviewUnavailable},
+		{"ready", PreviewReady, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			defer db.Close()
+			service := NewPreviewService(db, NewDocumentService(db, t.TempDir()))
+
+			docID := uuid.New()
+			ownerID := uuid.New()
+			expectPreviewDocument(mock, docID, ownerID, "text/csv")
+
+			query := mock.ExpectQuery(`SELECT status, generated_at, preview_text, preview_truncated FROM document_previews`).WithArgs(docID)
+			if tt.status == "" {
+				query.WillReturnError(sql.ErrNoRows)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"status", "generated_at", "preview_text", "preview_truncated"}).
+					AddRow(tt.status, time.Now(), "a,b\n1,2\n", true))
+			}
+
+			p, err := service.Text(context.Background(), docID, ownerID)
+			if err != tt.wantErr {
+				t.Fatalf("Text() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (string(p.Data) != "a,b\n1,2\n" || !p.Truncated || p.ContentType != "text/plain; charset=utf-8") {
+				t.Errorf("Text() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestPreviewService_WrongKind(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewPreviewService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	// A PDF has neither, so no preview lookup is made
+	expectPreviewDocument(mock, docID, ownerID, "application/pdf")
+	if _, err := service.Thumbnail(context.Background(), docID, ownerID); err != ErrPreviewUnavailable {
+		t.Errorf("Thumbnail() error = %v, want ErrPreviewUnavailable", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPreviewService_NoAccess(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewPreviewService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	strangerID := uuid.New()
+
+	expectPreviewDocument(mock, docID, uuid.New(), "text/plain")
+	mock.ExpectQuery(`SELECT permission FROM document_shares`).
+		WithArgs(docID, strangerID).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}))
+
+	if _, err := service.Text(context.Background(), docID, strangerID); err != ErrAccessDenied {
+		t.Errorf("Text() error = %v, want ErrAccessDenied", err)
+	}
+}
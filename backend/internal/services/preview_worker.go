@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+	"github.com/katim/secure-doc-vault/pkg/preview"
+	"github.com/lib/pq"
+)
+
+const (
+	previewBatchSize    = 10
+	previewPollInterval = 5 * time.Second
+	// previewLease keeps a claimed document from being rendered twice while
+	// a large image is being scaled.
+	previewLease = 5 * time.Minute
+	// previewMaxAttempts is how many failures mark a preview as failed. A
+	// file that can't be decoded won't decode on a retry either.
+	previewMaxAttempts = 3
+)
+
+// PreviewWorker renders thumbnails and text previews for documents whose
+// MIME type supports one, including documents uploaded before previews
+// existed.
+type PreviewWorker struct {
+	db *database.DB
+}
+
+func NewPreviewWorker(db *database.DB) *PreviewWorker {
+	return &PreviewWorker{db: db}
+}
+
+type pendingPreview struct {
+	documentID uuid.UUID
+	attempts   int
+	mimeType   string
+	filePath   string
+}
+
+// renderedPreview is what one document's preview run produced; only the
+// fields for its kind are set.
+type renderedPreview struct {
+	thumbnail     []byte
+	thumbnailType string
+	text          string
+	truncated     bool
+}
+
+// Run renders queued previews until ctx is cancelled. Uploads queue their
+// own previews; documents from before that are backfilled once at start.
+func (w *PreviewWorker) Run(ctx context.Context) {
+	queued, err := w.Backfill(ctx)
+	metrics.ObserveJob("preview_backfill", int(queued), err)
+	if err != nil {
+		slog.ErrorContext(ctx, "preview backfill failed", "error", err)
+	}
+
+	for {
+		rendered, err := w.GenerateDue(ctx)
+		metrics.ObserveJob("preview_render", rendered, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "preview generation failed", "error", err)
+		}
+
+		wait := previewPollInterval
+		if rendered == previewBatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Backfill adds a pending preview for every live document of a previewable
+// type that doesn't have one yet. It returns how many were added.
+func (w *PreviewWorker) Backfill(ctx context.Context) (int64, error) {
+	result, err := w.db.ExecContext(ctx,
+		`INSERT INTO document_previews (document_id)
+		 SELECT d.id FROM documents d
+		 WHERE d.deleted_at IS NULL
+		 AND lower(trim(split_part(d.mime_type, ';', 1))) = ANY($1)
+		 AND NOT EXISTS (SELECT 1 FROM document_previews p WHERE p.document_id = d.id)
+		 ON CONFLICT (document_id) DO NOTHING`,
+		pq.Array(preview.Types()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GenerateDue claims a batch of pending previews and renders each once. It
+// returns how many were attempted.
+func (w *PreviewWorker) GenerateDue(ctx context.Context) (int, error) {
+	rows, err := w.db.QueryContext(ctx,
+		`UPDATE document_previews p
+		 SET next_attempt_at = $2
+		 FROM documents d
+		 WHERE d.id = p.document_id AND p.document_id IN (
+			SELECT document_id FROM document_previews
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING p.document_id, p.attempts, d.mime_type, d.file_path`,
+		previewBatchSize, time.Now().Add(previewLease),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []pendingPreview
+	for rows.Next() {
+		var p pendingPreview
+		if err := rows.Scan(&p.documentID, &p.attempts, &p.mimeType, &p.filePath); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range batch {
+		if err := w.attempt(ctx, p); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// attempt renders one preview and records the outcome. Only a failure to
+// record is returned; rendering failures are stored on the row.
+func (w *PreviewWorker) attempt(ctx context.Context, p pendingPreview) error {
+	rendered, renderErr := renderPreview(p.filePath, p.mimeType)
+	if renderErr == nil {
+		_, err := w.db.ExecContext(ctx,
+			`UPDATE document_previews
+			 SET status = 'ready', thumbnail = NULLIF($1, ''::bytea), thumbnail_type = NULLIF($2, ''),
+			     preview_text = NULLIF($3, ''), preview_truncated = $4,
+			     attempts = attempts + 1, last_error = NULL, generated_at = NOW()
+			 WHERE document_id = $5`,
+			rendered.thumbnail, rendered.thumbnailType, rendered.text, rendered.truncated, p.documentID,
+		)
+		return err
+	}
+
+	attempts := p.attempts + 1
+	status := PreviewPending
+	if attempts >= previewMaxAttempts {
+		status = PreviewFailed
+		slog.Warn("giving up on preview", "document_id", p.documentID, "error", renderErr)
+	}
+	_, err := w.db.ExecContext(ctx,
+		`UPDATE document_previews SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4
+		 WHERE document_id = $5`,
+		status, attempts, time.Now().Add(retryBackoff(attempts)), renderErr.Error(), p.documentID,
+	)
+	return err
+}
+
+// renderPreview produces the thumbnail or text preview for the file.
+func renderPreview(path, mimeType string) (*renderedPreview, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r renderedPreview
+	if preview.Thumbnailable(mimeType) {
+		r.thumbnail, r.thumbnailType, err = preview.Thumbnail(f, preview.ThumbnailSize)
+	} else {
+		r.text, r.truncated, err = preview.Text(f, preview.MaxTextBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var claimedPreviewColumns = []string{"document_id", "attempts", "mime_type", "file_path"}
+
+func TestPreviewWorker_Backfill(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO document_previews \(document_id\)\s+SELECT d.id FROM documents d .+ON CONFLICT \(document_id\) DO NOTHING`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	added, err := NewPreviewWorker(db).Backfill(context.Background())
+	if err != nil || added != 3 {
+		t.Errorf("Backfill() = %d, %v; want 3", added, err)
+	}
+}
+
+func TestPreviewWorker_GenerateDue(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "image")
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 512, 512)))
+	os.WriteFile(imagePath, buf.Bytes(), 0600)
+	textPath := filepath.Join(dir, "text")
+	os.WriteFile(textPath, []byte("# Notes\n"), 0600)
+
+	imageID, textID, missingID := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectQuery(`UPDATE document_previews p\s+SET next_attempt_at = \$2`).
+		WithArgs(previewBatchSize, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(claimedPreviewColumns).
+			AddRow(imageID, 0, "image/png", imagePath).
+			AddRow(textID, 0, "text/markdown", textPath).
+			AddRow(missingID, 2, "text/plain", filepath.Join(dir, "gone")))
+
+	mock.ExpectExec(`UPDATE document_previews\s+SET status = 'ready'`).
+		WithArgs(sqlmock.AnyArg(), "image/png", "", false, imageID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE document_previews\s+SET status = 'ready'`).
+		WithArgs([]byte(nil), "", "# Notes\n", false, textID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The third failure gives up
+	mock.ExpectExec(`UPDATE document_previews SET status = \$1, attempts = \$2`).
+		WithArgs(PreviewFailed, 3, sqlmock.AnyArg(), sqlmock.AnyArg(), missingID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rendered, err := NewPreviewWorker(db).GenerateDue(context.Background())
+	if err != nil || rendered != 3 {
+		t.Errorf("GenerateDue() = %d, %v; want 3", rendered, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRenderPreview_Thumbnail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image")
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 600, 300)))
+	os.WriteFile(path, buf.Bytes(), 0600)
+
+	r, err := renderPreview(path, "image/png")
+	if err != nil {
+		t.Fatalf("renderPreview() error = %v", err)
+	}
+
+	thumb, _, err := image.Decode(bytes.NewReader(r.thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail doesn't decode: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 256 || b.Dy() != 128 || r.text != "" {
+		t.Errorf("renderPreview() = %dx%d thumbnail, text %q", b.Dx(), b.Dy(), r.text)
+	}
+}
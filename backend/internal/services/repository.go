@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// UserRepository stores user accounts.
+type UserRepository interface {
+	// Create saves a new user, or returns ErrUserExists when the email is taken.
+	Create(ctx context.Context, user *models.User) error
+	// GetByID and GetByEmail return ErrUserNotFound for unknown users.
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// UpdateName returns ErrUserNotFound for unknown users.
+	UpdateName(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time) error
+}
+
+// DocumentRepository stores documents and the deduplicated blobs holding
+// their content. Methods taking a webhook event queue it for delivery in the
+// same transaction as the change; a nil event queues nothing.
+type DocumentRepository interface {
+	// Insert saves a new document with its extracted text. When the owner
+	// already has a blob with the same SHA-256, doc.FilePath is pointed at
+	// that blob's file; if the blob is marked corrupted, repair is called to
+	// put the new upload in its place before the blob is marked healthy.
+	Insert(ctx context.Context, doc *models.Document, contentText string, repair func(blobPath string) error, event *models.WebhookEvent) error
+	// GetByID returns ErrDocumentNotFound for unknown and deleted documents.
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Document, error)
+	// List returns a page of the owner's live documents matching the filter.
+	List(ctx context.Context, ownerID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.Document, models.PageInfo, error)
+	// Delete soft-deletes a document owned by ownerID and releases its blob,
+	// returning ErrDocumentNotFound or ErrAccessDenied otherwise. When the
+	// document's file is no longer used, the same transaction queues it for
+	// removal and the returned FileDeletion says which file; the caller
+	// removes it and then calls FileDeleted.
+	Delete(ctx context.Context, id, ownerID uuid.UUID, deletedAt time.Time, event *models.WebhookEvent) (*FileDeletion, error)
+	// FileDeleted drops a queued removal once its file is gone.
+	FileDeleted(ctx context.Context, id uuid.UUID) error
+	// SetSHA256 records the digest of a document uploaded before digests
+	// were; documents that already have one are left alone.
+	SetSHA256(ctx context.Context, id uuid.UUID, sha256 string) error
+	Rename(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time, event *models.WebhookEvent) error
+	// Move files a document into a folder, or at the root when folderID is nil.
+	Move(ctx context.Context, id uuid.UUID, folderID *uuid.UUID, updatedAt time.Time) error
+	// FolderOwner returns ErrFolderNotFound for unknown folders.
+	FolderOwner(ctx context.Context, folderID uuid.UUID) (uuid.UUID, error)
+}
+
+// FileDeletion is a file queued for removal after the document using it was
+// deleted.
+type FileDeletion struct {
+	ID       uuid.UUID
+	FilePath string
+}
+
+// ShareRepository stores the grants letting users open each other's
+// documents.
+type ShareRepository interface {
+	// Share grants the user registered under email a permission on a
+	// document owned by ownerID, replacing any earlier one, and returns
+	// their ID. Ownership is checked in the same transaction, returning
+	// ErrDocumentNotFound or ErrAccessDenied; unknown emails return
+	// ErrUserNotFound. A non-nil webhook event is queued in the same
+	// transaction, with the grantee's ID added to its data as
+	// shared_with_id.
+	Share(ctx context.Context, documentID, ownerID uuid.UUID, email, permission string, event *models.WebhookEvent) (uuid.UUID, error)
+	// Remove returns ErrShareNotFound when there is nothing to revoke.
+	Remove(ctx context.Context, documentID, sharedWithID uuid.UUID) error
+	// Permission returns the strongest unexpired grant the user holds on the
+	// document, or "" when there is none.
+	Permission(ctx context.Context, documentID, userID uuid.UUID) (string, error)
+	// ListShared returns a page of the live documents shared with the user.
+	ListShared(ctx context.Context, userID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.DocumentResponse, models.PageInfo, error)
+}
+
+// Repositories is the storage UserService and DocumentService run on.
+type Repositories struct {
+	Users     UserRepository
+	Documents DocumentRepository
+	Shares    ShareRepository
+}
@@ -0,0 +1,477 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// NewMemoryRepositories returns repositories that keep everything in
+// memory, for tests and local demos without a database. The store has no
+// folders, tags, metadata or webhooks: filters on tags or metadata match
+// nothing, every folder is unknown and webhook events are dropped.
+func NewMemoryRepositories() Repositories {
+	store := &memoryStore{
+		users:     make(map[uuid.UUID]*models.User),
+		documents: make(map[uuid.UUID]*memoryDocument),
+		blobs:     make(map[memoryBlobKey]*memoryBlob),
+		shares:    make(map[memoryShareKey]*memoryShare),
+	}
+	return Repositories{
+		Users:     &memoryUserRepository{store},
+		Documents: &memoryDocumentRepository{store},
+		Shares:    &memoryShareRepository{store},
+	}
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	users     map[uuid.UUID]*models.User
+	documents map[uuid.UUID]*memoryDocument // Deleted documents included
+	blobs     map[memoryBlobKey]*memoryBlob
+	shares    map[memoryShareKey]*memoryShare
+}
+
+type memoryDocument struct {
+	doc  models.Document
+	blob memoryBlobKey
+}
+
+type memoryBlobKey struct {
+	ownerID uuid.UUID
+	sha256  string
+}
+
+type memoryBlob struct {
+	filePath string
+	refs     int
+}
+
+type memoryShareKey struct {
+	documentID   uuid.UUID
+	sharedWithID uuid.UUID
+}
+
+type memoryShare struct {
+	permission string
+	expiresAt  *time.Time
+	createdAt  time.Time
+}
+
+// live returns a document that hasn't been deleted. Callers hold the lock.
+func (s *memoryStore) live(id uuid.UUID) (*memoryDocument, bool) {
+	d, ok := s.documents[id]
+	if !ok || d.doc.DeletedAt != nil {
+		return nil, false
+	}
+	return d, true
+}
+
+type memoryUserRepository struct {
+	*memoryStore
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return ErrUserExists
+		}
+	}
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *memoryUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *memoryUserRepository) UpdateName(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Name = name
+	user.UpdatedAt = updatedAt
+	return nil
+}
+
+type memoryDocumentRepository struct {
+	*memoryStore
+}
+
+// Insert never calls repair: nothing scrubs the memory store, so its blobs
+// are never marked corrupted.
+func (r *memoryDocumentRepository) Insert(ctx context.Context, doc *models.Document, contentText string, repair func(blobPath string) error, event *models.WebhookEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := memoryBlobKey{ownerID: doc.OwnerID, sha256: doc.SHA256}
+	if blob, ok := r.blobs[key]; ok {
+		blob.refs++
+		doc.FilePath = blob.filePath
+	} else {
+		r.blobs[key] = &memoryBlob{filePath: doc.FilePath, refs: 1}
+	}
+
+	r.documents[doc.ID] = &memoryDocument{doc: *doc, blob: key}
+	return nil
+}
+
+func (r *memoryDocumentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.live(id)
+	if !ok {
+		return nil, ErrDocumentNotFound
+	}
+	doc := d.doc
+	return &doc, nil
+}
+
+func (r *memoryDocumentRepository) List(ctx context.Context, ownerID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.Document, models.PageInfo, error) {
+	l, err := newListing(opts, ownerSortColumns, "created_at", "id")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	r.mu.Lock()
+	var documents []models.Document
+	for _, d := range r.documents {
+		doc := d.doc
+		if doc.OwnerID != ownerID || doc.DeletedAt != nil || !matchesDocumentFilter(&doc, filter) {
+			continue
+		}
+		if filter.FolderID != nil && (doc.FolderID == nil || *doc.FolderID != *filter.FolderID) {
+			continue
+		}
+		if filter.FolderID == nil && filter.InRoot && doc.FolderID != nil {
+			continue
+		}
+		// Listings don't carry the digest
+		doc.SHA256 = ""
+		documents = append(documents, doc)
+	}
+	r.mu.Unlock()
+
+	documents, info := memoryPage(l, documents, func(doc models.Document) (*models.Document, time.Time) {
+		return &doc, time.Time{}
+	})
+	return documents, info, nil
+}
+
+func (r *memoryDocumentRepository) Delete(ctx context.Context, id, ownerID uuid.UUID, deletedAt time.Time, event *models.WebhookEvent) (*FileDeletion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.live(id)
+	if !ok {
+		return nil, ErrDocumentNotFound
+	}
+	if d.doc.OwnerID != ownerID {
+		return nil, ErrAccessDenied
+	}
+	d.doc.DeletedAt = &deletedAt
+
+	blob := r.blobs[d.blob]
+	blob.refs--
+	if blob.refs > 0 {
+		return nil, nil
+	}
+	delete(r.blobs, d.blob)
+	return &FileDeletion{ID: uuid.New(), FilePath: blob.filePath}, nil
+}
+
+// FileDeleted has nothing to do: nothing outlives the process to retry a
+// removal later.
+func (r *memoryDocumentRepository) FileDeleted(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (r *memoryDocumentRepository) SetSHA256(ctx context.Context, id uuid.UUID, sha256 string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.documents[id]; ok && d.doc.SHA256 == "" {
+		d.doc.SHA256 = sha256
+	}
+	return nil
+}
+
+func (r *memoryDocumentRepository) Rename(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time, event *models.WebhookEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.documents[id]; ok {
+		d.doc.Name = name
+		d.doc.UpdatedAt = updatedAt
+	}
+	return nil
+}
+
+func (r *memoryDocumentRepository) Move(ctx context.Context, id uuid.UUID, folderID *uuid.UUID, updatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.documents[id]; ok {
+		d.doc.FolderID = folderID
+		d.doc.UpdatedAt = updatedAt
+	}
+	return nil
+}
+
+func (r *memoryDocumentRepository) FolderOwner(ctx context.Context, folderID uuid.UUID) (uuid.UUID, error) {
+	return uuid.Nil, ErrFolderNotFound
+}
+
+type memoryShareRepository struct {
+	*memoryStore
+}
+
+func (r *memoryShareRepository) Share(ctx context.Context, documentID, ownerID uuid.UUID, email, permission string, event *models.WebhookEvent) (uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.live(documentID)
+	if !ok {
+		return uuid.Nil, ErrDocumentNotFound
+	}
+	if d.doc.OwnerID != ownerID {
+		return uuid.Nil, ErrAccessDenied
+	}
+
+	var sharedWithID uuid.UUID
+	for _, user := range r.users {
+		if user.Email == email {
+			sharedWithID = user.ID
+		}
+	}
+	if sharedWithID == uuid.Nil {
+		return uuid.Nil, ErrUserNotFound
+	}
+
+	key := memoryShareKey{documentID: documentID, sharedWithID: sharedWithID}
+	if share, ok := r.shares[key]; ok {
+		share.permission = permission
+	} else {
+		r.shares[key] = &memoryShare{permission: permission, createdAt: time.Now()}
+	}
+	return sharedWithID, nil
+}
+
+func (r *memoryShareRepository) Remove(ctx context.Context, documentID, sharedWithID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := memoryShareKey{documentID: documentID, sharedWithID: sharedWithID}
+	if _, ok := r.shares[key]; !ok {
+		return ErrShareNotFound
+	}
+	delete(r.shares, key)
+	return nil
+}
+
+func (r *memoryShareRepository) Permission(ctx context.Context, documentID, userID uuid.UUID) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	share, ok := r.shares[memoryShareKey{documentID: documentID, sharedWithID: userID}]
+	if !ok || share.expired() {
+		return "", nil
+	}
+	return share.permission, nil
+}
+
+func (r *memoryShareRepository) ListShared(ctx context.Context, userID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.DocumentResponse, models.PageInfo, error) {
+	l, err := newListing(opts, sharedSortColumns, "shared_at", "d.id")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	r.mu.Lock()
+	var shared []sharedDocument
+	for key, share := range r.shares {
+		if key.sharedWithID != userID || share.expired() {
+			continue
+		}
+		d, ok := r.live(key.documentID)
+		if !ok || !matchesDocumentFilter(&d.doc, filter) {
+			continue
+		}
+
+		// Shared listings don't carry the file path or digest
+		doc := d.doc
+		doc.FilePath = ""
+		doc.SHA256 = ""
+		row := sharedDocument{doc: models.DocumentResponse{Document: doc}, sharedAt: share.createdAt}
+		if owner, ok := r.users[doc.OwnerID]; ok {
+			row.doc.OwnerName = owner.Name
+		}
+		shared = append(shared, row)
+	}
+	r.mu.Unlock()
+
+	shared, info := memoryPage(l, shared, func(row sharedDocument) (*models.Document, time.Time) {
+		return &row.doc.Document, row.sharedAt
+	})
+	return sharedResponses(shared), info, nil
+}
+
+func (s *memoryShare) expired() bool {
+	return s.expiresAt != nil && !s.expiresAt.After(time.Now())
+}
+
+// matchesDocumentFilter applies the conditions applyDocumentFilter adds to
+// the Postgres queries. Folder conditions are left to the caller.
+func matchesDocumentFilter(doc *models.Document, filter models.DocumentFilter) bool {
+	if len(filter.Tags) > 0 || len(filter.Metadata) > 0 {
+		return false
+	}
+
+	if mimeType := strings.ToLower(strings.TrimSpace(filter.MimeType)); mimeType != "" {
+		if prefix, ok := strings.CutSuffix(mimeType, "/*"); ok {
+			if !strings.HasPrefix(doc.MimeType, prefix+"/") {
+				return false
+			}
+		} else if doc.MimeType != mimeType {
+			return false
+		}
+	}
+	if filter.MinSize != nil && doc.Size < *filter.MinSize {
+		return false
+	}
+	if filter.MaxSize != nil && doc.Size > *filter.MaxSize {
+		return false
+	}
+	if filter.CreatedAfter != nil && doc.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !doc.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	if filter.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(doc.Name), strings.ToLower(filter.NamePrefix)) {
+		return false
+	}
+	return true
+}
+
+// memoryPage orders items the way the listing asks, applies its cursor or
+// offset and paginates them like the Postgres queries do.
+func memoryPage[T any](l *listing, items []T, document func(T) (*models.Document, time.Time)) ([]T, models.PageInfo) {
+	total := len(items)
+
+	key := func(item T) (interface{}, uuid.UUID) {
+		doc, sharedAt := document(item)
+		return documentSortKey(l.sort, doc, sharedAt), doc.ID
+	}
+	// compare orders a before b, or after it when the listing is descending
+	compare := func(aValue interface{}, aID uuid.UUID, bValue interface{}, bID uuid.UUID) int {
+		c := compareSortKeys(aValue, bValue)
+		if c == 0 {
+			c = bytes.Compare(aID[:], bID[:])
+		}
+		if l.desc {
+			return -c
+		}
+		return c
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		iValue, iID := key(items[i])
+		jValue, jID := key(items[j])
+		return compare(iValue, iID, jValue, jID) < 0
+	})
+
+	if l.cursor != nil {
+		start := sort.Search(len(items), func(i int) bool {
+			value, id := key(items[i])
+			return compare(value, id, l.after, l.cursor.ID) > 0
+		})
+		items = items[start:]
+		if len(items) > l.perPage+1 {
+			items = items[:l.perPage+1]
+		}
+	} else {
+		offset := (l.page - 1) * l.perPage
+		if offset > len(items) {
+			offset = len(items)
+		}
+		items = items[offset:]
+		if len(items) > l.perPage {
+			items = items[:l.perPage]
+		}
+	}
+
+	return paginate(l, items, total, func(item T) (string, uuid.UUID) {
+		doc, sharedAt := document(item)
+		return documentSortValue(l.sort, doc, sharedAt), doc.ID
+	})
+}
+
+// documentSortKey returns the value a document is ordered by, typed like
+// listing.cursorValue.
+func documentSortKey(field string, doc *models.Document, sharedAt time.Time) interface{} {
+	switch field {
+	case "name":
+		return doc.Name
+	case "size":
+		return doc.Size
+	case "updated_at":
+		return doc.UpdatedAt
+	case "shared_at":
+		return sharedAt
+	default:
+		return doc.CreatedAt
+	}
+}
+
+func compareSortKeys(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		switch b := b.(int64); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	default:
+		return a.(time.Time).Compare(b.(time.Time))
+	}
+}
@@ -0,0 +1,531 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/pkg/preview"
+	"github.com/lib/pq"
+)
+
+// NewPostgresRepositories returns repositories backed by the database.
+func NewPostgresRepositories(db *database.DB) Repositories {
+	return Repositories{
+		Users:     &postgresUserRepository{db: db},
+		Documents: &postgresDocumentRepository{db: db},
+		Shares:    &postgresShareRepository{db: db},
+	}
+}
+
+type postgresUserRepository struct {
+	db *database.DB
+}
+
+func (r *postgresUserRepository) Create(ctx context.Context, user *models.User) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO users (id, email, password, name, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		user.ID, user.Email, user.Password, user.Name, user.CreatedAt, user.UpdatedAt,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+		return ErrUserExists
+	}
+	return err
+}
+
+func (r *postgresUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, email, password, name, created_at, updated_at FROM users WHERE id = $1`,
+		id,
+	).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *postgresUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, email, password, name, created_at, updated_at FROM users WHERE email = $1`,
+		email,
+	).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *postgresUserRepository) UpdateName(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE users SET name = $1, updated_at = $2 WHERE id = $3`,
+		name, updatedAt, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+type postgresDocumentRepository struct {
+	db *database.DB
+}
+
+func (r *postgresDocumentRepository) Insert(ctx context.Context, doc *models.Document, contentText string, repair func(blobPath string) error, event *models.WebhookEvent) error {
+	return r.db.InTx(ctx, func(tx *sql.Tx) error {
+		// xmax is 0 only on a row this statement inserted
+		var blobID uuid.UUID
+		var blobPath string
+		var inserted, corrupted bool
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO blobs (id, owner_id, sha256, size, file_path)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (owner_id, sha256) DO UPDATE SET ref_count = blobs.ref_count + 1
+			 RETURNING id, file_path, xmax = 0, corrupted_at IS NOT NULL`,
+			uuid.New(), doc.OwnerID, doc.SHA256, doc.Size, doc.FilePath,
+		).Scan(&blobID, &blobPath, &inserted, &corrupted)
+		if err != nil {
+			return err
+		}
+
+		if !inserted && corrupted {
+			if err := repair(blobPath); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE blobs SET corrupted_at = NULL, verified_at = NOW() WHERE id = $1`, blobID); err != nil {
+				return err
+			}
+		}
+		if !inserted {
+			doc.FilePath = blobPath
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO documents (id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at, content_text, sha256, blob_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+			doc.ID, doc.OwnerID, doc.Name, doc.OriginalName, doc.Size, doc.MimeType,
+			doc.EncryptionAlgo, doc.FilePath, doc.IsEncrypted, doc.CreatedAt, doc.UpdatedAt, contentText, doc.SHA256, blobID,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Queue the preview with the document so the worker only has to
+		// look at pending rows
+		if preview.Supported(doc.MimeType) {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO document_previews (document_id) VALUES ($1)`,
+				doc.ID,
+			); err != nil {
+				return err
+			}
+		}
+		return queueEvent(ctx, tx, event)
+	})
+}
+
+// queueEvent queues a webhook event in tx unless there is none.
+func queueEvent(ctx context.Context, tx *sql.Tx, event *models.WebhookEvent) error {
+	if event == nil {
+		return nil
+	}
+	return queueWebhookEvent(ctx, tx, event)
+}
+
+func (r *postgresDocumentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Document, error) {
+	doc := &models.Document{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at, deleted_at, folder_id,
+		        COALESCE(sha256, '')
+		 FROM documents WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+	).Scan(&doc.ID, &doc.OwnerID, &doc.Name, &doc.OriginalName, &doc.Size, &doc.MimeType,
+		&doc.EncryptionAlgo, &doc.FilePath, &doc.IsEncrypted, &doc.CreatedAt, &doc.UpdatedAt, &doc.DeletedAt, &doc.FolderID,
+		&doc.SHA256)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *postgresDocumentRepository) List(ctx context.Context, ownerID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.Document, models.PageInfo, error) {
+	l, err := newListing(opts, ownerSortColumns, "created_at", "id")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	q := &documentQuery{}
+	q.where("owner_id = ?", ownerID)
+	// NULL never compares equal, so the root needs its own predicate
+	if filter.FolderID != nil {
+		q.where("folder_id = ?", *filter.FolderID)
+	} else if filter.InRoot {
+		q.where("folder_id IS NULL")
+	}
+	q.where("deleted_at IS NULL")
+	applyDocumentFilter(q, filter, "")
+
+	// Get total count
+	var total int
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM documents WHERE `+q.clause(),
+		q.args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	// Get documents
+	l.seek(q)
+	where := q.clause()
+	tail := l.tail(q)
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, owner_id, name, original_name, size, mime_type, encryption_algo, file_path, is_encrypted, created_at, updated_at, folder_id
+		 FROM documents WHERE `+where+`
+		 `+tail,
+		q.args...,
+	)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	defer rows.Close()
+
+	documents, err := scanDocuments(rows)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	documents, info := paginate(l, documents, total, func(doc models.Document) (string, uuid.UUID) {
+		return documentSortValue(l.sort, &doc, time.Time{}), doc.ID
+	})
+	return documents, info, nil
+}
+
+func (r *postgresDocumentRepository) Delete(ctx context.Context, id, ownerID uuid.UUID, deletedAt time.Time, event *models.WebhookEvent) (*FileDeletion, error) {
+	var deletion *FileDeletion
+	err := r.db.InTx(ctx, func(tx *sql.Tx) error {
+		// Lock the row so a transfer can't hand the document over meanwhile
+		var currentOwner uuid.UUID
+		var filePath string
+		err := tx.QueryRowContext(ctx,
+			`SELECT owner_id, file_path FROM documents WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+			id,
+		).Scan(&currentOwner, &filePath)
+		if err == sql.ErrNoRows {
+			return ErrDocumentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if currentOwner != ownerID {
+			return ErrAccessDenied
+		}
+
+		// Queued while the row is locked, so the event goes to the webhooks
+		// of the owner who deleted it
+		if err := queueEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		orphaned, err := releaseDocument(ctx, tx, id, deletedAt)
+		if err != nil || !orphaned {
+			return err
+		}
+
+		deletion = &FileDeletion{ID: uuid.New(), FilePath: filePath}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO file_deletions (id, document_id, file_path) VALUES ($1, $2, $3)`,
+			deletion.ID, id, filePath,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+// releaseDocument soft-deletes a document and releases its blob, reporting
+// whether the document's file is no longer used.
+func releaseDocument(ctx context.Context, tx *sql.Tx, id uuid.UUID, deletedAt time.Time) (bool, error) {
+	// Previews go with the file, and the document stops counting towards
+	// its blob
+	var blobID uuid.UUID
+	var refs int
+	err := tx.QueryRowContext(ctx,
+		`WITH previews AS (DELETE FROM document_previews WHERE document_id = $2),
+		 doc AS (UPDATE documents SET deleted_at = $1 WHERE id = $2 RETURNING blob_id)
+		 UPDATE blobs SET ref_count = ref_count - 1 FROM doc WHERE blobs.id = doc.blob_id
+		 RETURNING blobs.id, blobs.ref_count`,
+		deletedAt, id,
+	).Scan(&blobID, &refs)
+	switch {
+	case err == sql.ErrNoRows:
+		// Documents uploaded before blobs existed own their file outright
+		return true, nil
+	case err != nil:
+		return false, err
+	case refs <= 0:
+		return dropBlob(ctx, tx, blobID)
+	}
+	return false, nil
+}
+
+// dropBlob deletes a blob nothing references any more, reporting whether its
+// file is now unused. A transferred document's blob can share its file with
+// the blob it came from, so the file stays while either is left.
+func dropBlob(ctx context.Context, tx *sql.Tx, blobID uuid.UUID) (bool, error) {
+	// An upload of the same content may have claimed the blob since. The
+	// deleted row is still visible to the rest of the statement, hence the
+	// id check.
+	var orphaned bool
+	err := tx.QueryRowContext(ctx,
+		`WITH gone AS (DELETE FROM blobs WHERE id = $1 AND ref_count <= 0 RETURNING file_path)
+		 SELECT EXISTS (SELECT 1 FROM gone)
+		 AND NOT EXISTS (SELECT 1 FROM blobs b JOIN gone g ON b.file_path = g.file_path WHERE b.id <> $1)`,
+		blobID,
+	).Scan(&orphaned)
+	return orphaned, err
+}
+
+func (r *postgresDocumentRepository) FileDeleted(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM file_deletions WHERE id = $1`, id)
+	return err
+}
+
+func (r *postgresDocumentRepository) SetSHA256(ctx context.Context, id uuid.UUID, sha256 string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE documents SET sha256 = $1 WHERE id = $2 AND sha256 IS NULL`,
+		sha256, id,
+	)
+	return err
+}
+
+func (r *postgresDocumentRepository) Rename(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time, event *models.WebhookEvent) error {
+	return r.db.InTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE documents SET name = $1, updated_at = $2 WHERE id = $3`,
+			name, updatedAt, id,
+		)
+		if err != nil {
+			return err
+		}
+		return queueEvent(ctx, tx, event)
+	})
+}
+
+func (r *postgresDocumentRepository) Move(ctx context.Context, id uuid.UUID, folderID *uuid.UUID, updatedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE documents SET folder_id = $1, updated_at = $2 WHERE id = $3`,
+		folderID, updatedAt, id,
+	)
+	return err
+}
+
+func (r *postgresDocumentRepository) FolderOwner(ctx context.Context, folderID uuid.UUID) (uuid.UUID, error) {
+	var ownerID uuid.UUID
+	err := r.db.QueryRowContext(ctx, `SELECT owner_id FROM folders WHERE id = $1`, folderID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrFolderNotFound
+	}
+	return ownerID, err
+}
+
+type postgresShareRepository struct {
+	db *database.DB
+}
+
+func (r *postgresShareRepository) Share(ctx context.Context, documentID, ownerID uuid.UUID, email, permission string, event *models.WebhookEvent) (uuid.UUID, error) {
+	var sharedWithID uuid.UUID
+	err := r.db.InTx(ctx, func(tx *sql.Tx) error {
+		// Hold the document until the grant is in, so a transfer can't
+		// complete between the ownership check and the insert
+		var currentOwner uuid.UUID
+		err := tx.QueryRowContext(ctx,
+			`SELECT owner_id FROM documents WHERE id = $1 AND deleted_at IS NULL FOR SHARE`,
+			documentID,
+		).Scan(&currentOwner)
+		if err == sql.ErrNoRows {
+			return ErrDocumentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if currentOwner != ownerID {
+			return ErrAccessDenied
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&sharedWithID)
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO document_shares (document_id, shared_by_id, shared_with_id, permission)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (document_id, shared_with_id) DO UPDATE SET permission = $4`,
+			documentID, ownerID, sharedWithID, permission,
+		)
+		if err != nil || event == nil {
+			return err
+		}
+
+		if event.Data == nil {
+			event.Data = map[string]interface{}{}
+		}
+		event.Data["shared_with_id"] = sharedWithID
+		return queueWebhookEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return sharedWithID, nil
+}
+
+func (r *postgresShareRepository) Remove(ctx context.Context, documentID, sharedWithID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM document_shares WHERE document_id = $1 AND shared_with_id = $2`,
+		documentID, sharedWithID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// sharedPermissionQuery resolves the strongest unexpired grant a user holds on a
+// document, either shared directly or inherited from a share on any folder
+// above it. Only folders of the document's owner pass shares down. UNION keeps
+// the ancestor walk finite even if the folder tree somehow contains a cycle.
+const sharedPermissionQuery = `WITH RECURSIVE ancestors AS (
+		SELECT f.id, f.parent_id FROM folders f
+		JOIN documents d ON d.folder_id = f.id AND f.owner_id = d.owner_id WHERE d.id = $1
+		UNION
+		SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+	)
+	SELECT permission FROM (
+		SELECT permission FROM document_shares
+		WHERE document_id = $1 AND shared_with_id = $2
+		AND (expires_at IS NULL OR expires_at > NOW())
+		UNION ALL
+		SELECT fs.permission FROM folder_shares fs
+		JOIN ancestors a ON fs.folder_id = a.id
+		WHERE fs.shared_with_id = $2
+		AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+	) grants
+	ORDER BY CASE permission WHEN 'edit' THEN 0 ELSE 1 END
+	LIMIT 1`
+
+func (r *postgresShareRepository) Permission(ctx context.Context, documentID, userID uuid.UUID) (string, error) {
+	var permission string
+	err := r.db.QueryRowContext(ctx, sharedPermissionQuery, documentID, userID).Scan(&permission)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return permission, nil
+}
+
+// ListShared orders by share time by default. Folder filters don't apply:
+// shared documents live in their owner's folders.
+func (r *postgresShareRepository) ListShared(ctx context.Context, userID uuid.UUID, filter models.DocumentFilter, opts models.ListOptions) ([]models.DocumentResponse, models.PageInfo, error) {
+	l, err := newListing(opts, sharedSortColumns, "shared_at", "d.id")
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	q := &documentQuery{}
+	q.where("ds.shared_with_id = ?", userID)
+	q.where("d.deleted_at IS NULL")
+	q.where("(ds.expires_at IS NULL OR ds.expires_at > NOW())")
+	applyDocumentFilter(q, filter, "d")
+
+	// Get total count
+	var total int
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM document_shares ds
+		 JOIN documents d ON ds.document_id = d.id
+		 WHERE `+q.clause(),
+		q.args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	// Get shared documents with owner info
+	l.seek(q)
+	where := q.clause()
+	tail := l.tail(q)
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT d.id, d.owner_id, d.name, d.original_name, d.size, d.mime_type, d.encryption_algo,
+		        d.is_encrypted, d.folder_id, d.created_at, d.updated_at, u.name as owner_name, ds.permission, ds.created_at
+		 FROM document_shares ds
+		 JOIN documents d ON ds.document_id = d.id
+		 JOIN users u ON d.owner_id = u.id
+		 WHERE `+where+`
+		 `+tail,
+		q.args...,
+	)
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var shared []sharedDocument
+	for rows.Next() {
+		var row sharedDocument
+		var permission string
+		if err := rows.Scan(&row.doc.ID, &row.doc.OwnerID, &row.doc.Name, &row.doc.OriginalName, &row.doc.Size, &row.doc.MimeType,
+			&row.doc.EncryptionAlgo, &row.doc.IsEncrypted, &row.doc.FolderID, &row.doc.CreatedAt, &row.doc.UpdatedAt,
+			&row.doc.OwnerName, &permission, &row.sharedAt); err != nil {
+			return nil, models.PageInfo{}, err
+		}
+		shared = append(shared, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	shared, info := paginate(l, shared, total, func(row sharedDocument) (string, uuid.UUID) {
+		return documentSortValue(l.sort, &row.doc.Document, row.sharedAt), row.doc.ID
+	})
+	return sharedResponses(shared), info, nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+)
+
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// Highlight markers passed to ts_headline. They are private-use code points so
+// the surrounding text can be HTML-escaped before they're swapped for <mark>.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+const (
+	nameHeadlineOptions    = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", HighlightAll=true`
+	contentHeadlineOptions = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=" ... "`
+)
+
+// accessibleDocumentsCTE resolves every document the user ($1) can read along
+// with their best permission (0 owner, 1 edit, 2 view), applying the same
+// rules as DocumentService.CanAccess: ownership, direct shares and shares on
+// any ancestor folder belonging to the document's owner. The walk uses UNION
+// so a parent_id loop revisits no row and the recursion still terminates.
+const accessibleDocumentsCTE = `WITH RECURSIVE shared_folders AS (
+		SELECT fs.folder_id AS id, f.owner_id, fs.permission FROM folder_shares fs
+		JOIN folders f ON f.id = fs.folder_id
+		WHERE fs.shared_with_id = $1 AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+		UNION
+		SELECT f.id, f.owner_id, sf.permission FROM folders f JOIN shared_folders sf ON f.parent_id = sf.id
+	),
+	grants AS (
+		SELECT d.id AS document_id, 'owner' AS permission FROM documents d WHERE d.owner_id = $1
+		UNION ALL
+		SELECT ds.document_id, ds.permission FROM document_shares ds
+		WHERE ds.shared_with_id = $1 AND (ds.expires_at IS NULL OR ds.expires_at > NOW())
+		UNION ALL
+		SELECT d.id, sf.permission FROM documents d
+		JOIN shared_folders sf ON d.folder_id = sf.id AND d.owner_id = sf.owner_id
+	),
+	accessible AS (
+		SELECT document_id, MIN(CASE permission WHEN 'owner' THEN 0 WHEN 'edit' THEN 1 ELSE 2 END) AS level
+		FROM grants GROUP BY document_id
+	)`
+
+type SearchService struct {
+	db *database.DB
+}
+
+func NewSearchService(db *database.DB) *SearchService {
+	return &SearchService{db: db}
+}
+
+// Search runs a web-style full-text query (quoted phrases, OR, -exclusion)
+// over the names and extracted content of documents the user can access,
+// best matches first.
+func (s *SearchService) Search(ctx context.Context, userID uuid.UUID, query string, page, perPage int) ([]models.SearchResult, int, error) {
+	ctx, span := tracing.Start(ctx, "SearchService.Search")
+	defer span.End()
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, 0, ErrEmptyQuery
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	offset := (page - 1) * perPage
+
+	var total int
+	err := s.db.QueryRowContext(ctx,
+		accessibleDocumentsCTE+`
+		SELECT COUNT(*) FROM accessible a
+		JOIN documents d ON d.id = a.document_id
+		WHERE d.deleted_at IS NULL AND d.search_vector @@ websearch_to_tsquery('english', $2)`,
+		userID, query,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		accessibleDocumentsCTE+`
+		SELECT d.id, d.owner_id, d.name, d.original_name, d.size, d.mime_type, d.encryption_algo,
+		       d.is_encrypted, d.folder_id, d.created_at, d.updated_at, u.name,
+		       CASE a.level WHEN 0 THEN 'owner' WHEN 1 THEN 'edit' ELSE 'view' END,
+		       ts_rank(d.search_vector, q.query) AS rank,
+		       ts_headline('english', d.name, q.query, $5),
+		       ts_headline('english', COALESCE(d.content_text, ''), q.query, $6)
+		FROM accessible a
+		JOIN documents d ON d.id = a.document_id
+		JOIN users u ON u.id = d.owner_id
+		CROSS JOIN websearch_to_tsquery('english', $2) AS q(query)
+		WHERE d.deleted_at IS NULL AND d.search_vector @@ q.query
+		ORDER BY rank DESC, d.updated_at DESC
+		LIMIT $3 OFFSET $4`,
+		userID, query, perPage, offset, nameHeadlineOptions, contentHeadlineOptions,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var r models.SearchResult
+		var snippet string
+		if err := rows.Scan(&r.ID, &r.OwnerID, &r.Name, &r.OriginalName, &r.Size, &r.MimeType,
+			&r.EncryptionAlgo, &r.IsEncrypted, &r.FolderID, &r.CreatedAt, &r.UpdatedAt, &r.OwnerName,
+			&r.Permission, &r.Rank, &r.NameHighlight, &snippet); err != nil {
+			return nil, 0, err
+		}
+		r.NameHighlight = markHighlights(r.NameHighlight)
+		// ts_headline falls back to the start of the text when only the name
+		// matched; a snippet without a highlight adds nothing to the result
+		if strings.Contains(snippet, highlightStart) {
+			r.Snippet = markHighlights(snippet)
+		}
+		results = append(results, r)
+	}
+
+	return results, total, rows.Err()
+}
+
+// markHighlights HTML-escapes a ts_headline result and turns the highlight
+// markers into <mark> tags, so clients can render it as markup safely.
+func markHighlights(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	return strings.ReplaceAll(s, highlightStop, "</mark>")
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var searchColumns = []string{
+	"id", "owner_id", "name", "original_name", "size", "mime_type", "encryption_algo",
+	"is_encrypted", "folder_id", "created_at", "updated_at", "owner_name",
+	"permission", "rank", "name_headline", "content_headline",
+}
+
+func TestSearchService_Search_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewSearchService(db)
+
+	userID := uuid.New()
+	docID := uuid.New()
+
+	mock.ExpectQuery(`WITH RECURSIVE shared_folders .+ SELECT COUNT\(\*\) FROM accessible`).
+		WithArgs(userID, "revenue").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery(`WITH RECURSIVE shared_folders .+ ts_headline.+ORDER BY rank DESC`).
+		WithArgs(userID, "revenue", 20, 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(searchColumns).AddRow(
+			docID, uuid.New(), "Q3 <draft>", "q3.txt", 100, "text/plain", "AES-256-GCM",
+			false, nil, time.Now(), time.Now(), "Alice",
+			"view", 0.6, "Q3 <draft>", "projected "+highlightStart+"revenue"+highlightStop+" & costs",
+		))
+
+	results, total, err := service.Search(context.Background(), userID, "  revenue ", 0, 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if total != 1 || len(results) != 1 {
+		t.Fatalf("Search() returned %d results (total %d), want 1", len(results), total)
+	}
+
+	r := results[0]
+	if r.ID != docID || r.Permission != "view" || r.OwnerName != "Alice" {
+		t.Errorf("Search() result = %+v, unexpected fields", r)
+	}
+
+	if r.Snippet != "projected <mark>revenue</mark> &amp; costs" {
+		t.Errorf("Snippet = %q, want highlighted and escaped", r.Snippet)
+	}
+
+	if r.NameHighlight != "Q3 &lt;draft&gt;" {
+		t.Errorf("NameHighlight = %q, want escaped name", r.NameHighlight)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSearchService_Search_NameOnlyMatchHasNoSnippet(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewSearchService(db)
+
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM accessible`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`ts_headline`).
+		WillReturnRows(sqlmock.NewRows(searchColumns).AddRow(
+			uuid.New(), userID, "Budget", "budget.pdf", 100, "application/pdf", "AES-256-GCM",
+			false, nil, time.Now(), time.Now(), "Me",
+			"owner", 0.9, highlightStart+"Budget"+highlightStop, "Lorem ipsum dolor",
+		))
+
+	results, _, err := service.Search(context.Background(), userID, "budget", 1, 20)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if results[0].Snippet != "" {
+		t.Errorf("Snippet = %q, want empty when content did not match", results[0].Snippet)
+	}
+
+	if results[0].NameHighlight != "<mark>Budget</mark>" {
+		t.Errorf("NameHighlight = %q, want %q", results[0].NameHighlight, "<mark>Budget</mark>")
+	}
+}
+
+func TestSearchService_Search_EmptyQuery(t *testing.T) {
+	db, _ := newMockDB(t)
+	defer db.Close()
+	service := NewSearchService(db)
+
+	if _, _, err := service.Search(context.Background(), uuid.New(), "   ", 1, 20); err != ErrEmptyQuery {
+		t.Errorf("Search() error = %v, want ErrEmptyQuery", err)
+	}
+}
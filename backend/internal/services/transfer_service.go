@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+)
+
+var (
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferToSelf   = errors.New("cannot transfer a document to its owner")
+	ErrTransferStale    = errors.New("document owner changed since the transfer was offered")
+)
+
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+)
+
+type TransferService struct {
+	db              *database.DB
+	documentService *DocumentService
+	notifications   *NotificationService
+}
+
+func NewTransferService(db *database.DB, documentService *DocumentService) *TransferService {
+	return &TransferService{db: db, documentService: documentService, notifications: NewNotificationService(db)}
+}
+
+// Offer proposes handing ownership of a single document to the user with the
+// given email. Any earlier pending offer for the same document is cancelled.
+func (s *TransferService) Offer(ctx context.Context, documentID, ownerID uuid.UUID, toEmail string, keepAccess bool) (*models.DocumentTransfer, error) {
+	ctx, span := tracing.Start(ctx, "TransferService.Offer")
+	defer span.End()
+
+	doc, err := s.documentService.GetByID(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if doc.OwnerID != ownerID {
+		return nil, ErrAccessDenied
+	}
+
+	toUserID, err := s.lookupRecipient(ctx, ownerID, toEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := s.createOffer(ctx, doc.ID, ownerID, toUserID, keepAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	logNotifyError(NotificationTransferOffered, s.notifications.Notify(ctx, toUserID, models.Notification{
+		Type:       NotificationTransferOffered,
+		ActorID:    &ownerID,
+		DocumentID: &doc.ID,
+		Data:       map[string]interface{}{"name": doc.Name},
+	}))
+
+	return transfer, nil
+}
+
+// OfferAll proposes handing over every document the owner currently has.
+func (s *TransferService) OfferAll(ctx context.Context, ownerID uuid.UUID, toEmail string, keepAccess bool) ([]models.DocumentTransfer, error) {
+	ctx, span := tracing.Start(ctx, "TransferService.OfferAll")
+	defer span.End()
+
+	toUserID, err := s.lookupRecipient(ctx, ownerID, toEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM documents WHERE owner_id = $1 AND deleted_at IS NULL ORDER BY created_at`,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var documentIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		documentIDs = append(documentIDs, id)
+	}
+	rows.Close()
+
+	transfers := make([]models.DocumentTransfer, 0, len(documentIDs))
+	for _, documentID := range documentIDs {
+		transfer, err := s.createOffer(ctx, documentID, ownerID, toUserID, keepAccess)
+		// Documents deleted or handed over since they were listed are skipped
+		if errors.Is(err, ErrDocumentNotFound) || errors.Is(err, ErrAccessDenied) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *transfer)
+	}
+
+	// One notification for the whole batch rather than one per document
+	if len(transfers) > 0 {
+		logNotifyError(NotificationTransferOffered, s.notifications.Notify(ctx, toUserID, models.Notification{
+			Type:    NotificationTransferOffered,
+			ActorID: &ownerID,
+			Data:    map[string]interface{}{"count": len(transfers)},
+		}))
+	}
+
+	return transfers, nil
+}
+
+// ListPending returns the offers waiting for the given user to respond.
+func (s *TransferService) ListPending(ctx context.Context, userID uuid.UUID) ([]models.DocumentTransfer, error) {
+	ctx, span := tracing.Start(ctx, "TransferService.ListPending")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT t.id, t.document_id, t.from_user_id, t.to_user_id, t.keep_access, t.status, t.created_at, t.responded_at,
+		        d.name, u.name
+		 FROM document_transfers t
+		 JOIN documents d ON t.document_id = d.id
+		 JOIN users u ON t.from_user_id = u.id
+		 WHERE t.to_user_id = $1 AND t.status = 'pending' AND d.deleted_at IS NULL
+		 ORDER BY t.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []models.DocumentTransfer{}
+	for rows.Next() {
+		var t models.DocumentTransfer
+		if err := rows.Scan(&t.ID, &t.DocumentID, &t.FromUserID, &t.ToUserID, &t.KeepAccess, &t.Status,
+			&t.CreatedAt, &t.RespondedAt, &t.DocumentName, &t.FromUserName); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+
+	return transfers, nil
+}
+
+// Accept completes a pending transfer. Existing shares are left untouched; the
+// recipient's own share (if any) is dropped since they now own the document,
+// and the previous owner is granted "edit" access when the offer asked for it.
+func (s *TransferService) Accept(ctx context.Context, transferID, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "TransferService.Accept")
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var t models.DocumentTransfer
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, document_id, from_user_id, to_user_id, keep_access
+		 FROM document_transfers WHERE id = $1 AND to_user_id = $2 AND status = 'pending'
+		 FOR UPDATE`,
+		transferID, userID,
+	).Scan(&t.ID, &t.DocumentID, &t.FromUserID, &t.ToUserID, &t.KeepAccess)
+	if err == sql.ErrNoRows {
+		return ErrTransferNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Lock the document so a concurrent transfer or delete can't interleave
+	var currentOwner uuid.UUID
+	var blobID uuid.NullUUID
+	var filePath string
+	err = tx.QueryRowContext(ctx,
+		`SELECT owner_id, name, blob_id, file_path FROM documents WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		t.DocumentID,
+	).Scan(&currentOwner, &t.DocumentName, &blobID, &filePath)
+	if err == sql.ErrNoRows {
+		return ErrDocumentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if currentOwner != t.FromUserID {
+		return ErrTransferStale
+	}
+
+	// Documents uploaded before blobs existed own their file outright
+	if blobID.Valid {
+		newBlobID, newPath, err := transferBlob(ctx, tx, t.DocumentID, blobID.UUID, t.ToUserID)
+		if err != nil {
+			return err
+		}
+		blobID.UUID, filePath = newBlobID, newPath
+	}
+
+	// The document leaves the previous owner's folder tree for the new
+	// owner's root, so the previous owner's folder shares stop reaching it
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE documents SET owner_id = $1, folder_id = NULL, blob_id = $2, file_path = $3, updated_at = $4 WHERE id = $5`,
+		t.ToUserID, blobID, filePath, now, t.DocumentID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM document_shares WHERE document_id = $1 AND shared_with_id = $2`,
+		t.DocumentID, t.ToUserID,
+	); err != nil {
+		return err
+	}
+
+	if t.KeepAccess {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO document_shares (document_id, shared_by_id, shared_with_id, permission)
+			 VALUES ($1, $2, $3, 'edit')
+			 ON CONFLICT (document_id, shared_with_id) DO UPDATE SET permission = 'edit', expires_at = NULL`,
+			t.DocumentID, t.ToUserID, t.FromUserID,
+		); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE document_transfers SET status = 'accepted', responded_at = $1 WHERE id = $2`,
+		now, t.ID,
+	); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logNotifyError(NotificationTransferAccepted, s.notifications.Notify(ctx, t.FromUserID, models.Notification{
+		Type:       NotificationTransferAccepted,
+		ActorID:    &t.ToUserID,
+		DocumentID: &t.DocumentID,
+		Data:       map[string]interface{}{"name": t.DocumentName},
+	}))
+
+	return nil
+}
+
+// transferBlob moves a document's reference from its blob to the new owner's
+// blob for the same content, creating that blob on the existing file if the
+// new owner has none. It returns the blob and file the document now uses.
+func transferBlob(ctx context.Context, tx *sql.Tx, documentID, blobID, toUserID uuid.UUID) (uuid.UUID, string, error) {
+	var sha, oldPath string
+	var size int64
+	var refs int
+	err := tx.QueryRowContext(ctx,
+		`UPDATE blobs SET ref_count = ref_count - 1 WHERE id = $1
+		 RETURNING sha256, size, file_path, ref_count`,
+		blobID,
+	).Scan(&sha, &size, &oldPath, &refs)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	var newBlobID uuid.UUID
+	var newPath string
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO blobs (id, owner_id, sha256, size, file_path)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (owner_id, sha256) DO UPDATE SET ref_count = blobs.ref_count + 1
+		 RETURNING id, file_path`,
+		uuid.New(), toUserID, sha, size, oldPath,
+	).Scan(&newBlobID, &newPath)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	if refs > 0 {
+		return newBlobID, newPath, nil
+	}
+
+	// The new owner already had this content, so the old file may have
+	// nothing left pointing at it
+	orphaned, err := dropBlob(ctx, tx, blobID)
+	if err != nil || !orphaned {
+		return newBlobID, newPath, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO file_deletions (id, document_id, file_path) VALUES ($1, $2, $3)`,
+		uuid.New(), documentID, oldPath,
+	)
+	return newBlobID, newPath, err
+}
+
+// AcceptAll accepts every pending transfer offered to userID by fromUserID and
+// returns how many were completed.
+func (s *TransferService) AcceptAll(ctx context.Context, userID, fromUserID uuid.UUID) (int, error) {
+	ctx, span := tracing.Start(ctx, "TransferService.AcceptAll")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM document_transfers
+		 WHERE to_user_id = $1 AND from_user_id = $2 AND status = 'pending'
+		 ORDER BY created_at`,
+		userID, fromUserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var transferIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		transferIDs = append(transferIDs, id)
+	}
+	rows.Close()
+
+	accepted := 0
+	for _, id := range transferIDs {
+		if err := s.Accept(ctx, id, userID); err != nil {
+			// Offers for documents deleted or moved on in the meantime are skipped
+			if errors.Is(err, ErrTransferStale) || errors.Is(err, ErrDocumentNotFound) {
+				continue
+			}
+			return accepted, err
+		}
+		accepted++
+	}
+
+	return accepted, nil
+}
+
+// Decline rejects a pending transfer offered to userID.
+func (s *TransferService) Decline(ctx context.Context, transferID, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "TransferService.Decline")
+	defer span.End()
+
+	t, err := s.respond(ctx, transferID, `to_user_id`, userID, TransferDeclined)
+	if err != nil {
+		return err
+	}
+
+	logNotifyError(NotificationTransferDeclined, s.notifications.Notify(ctx, t.FromUserID, models.Notification{
+		Type:       NotificationTransferDeclined,
+		ActorID:    &userID,
+		DocumentID: &t.DocumentID,
+		Data:       map[string]interface{}{"name": t.DocumentName},
+	}))
+
+	return nil
+}
+
+// Cancel withdraws a pending transfer offered by userID.
+func (s *TransferService) Cancel(ctx context.Context, transferID, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "TransferService.Cancel")
+	defer span.End()
+
+	_, err := s.respond(ctx, transferID, `from_user_id`, userID, TransferCancelled)
+	return err
+}
+
+func (s *TransferService) respond(ctx context.Context, transferID uuid.UUID, userColumn string, userID uuid.UUID, status string) (*models.DocumentTransfer, error) {
+	var t models.DocumentTransfer
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`UPDATE document_transfers t SET status = $1, responded_at = $2
+		 FROM documents d
+		 WHERE d.id = t.document_id AND t.id = $3 AND t.%s = $4 AND t.status = 'pending'
+		 RETURNING t.from_user_id, t.document_id, d.name`, userColumn),
+		status, time.Now(), transferID, userID,
+	).Scan(&t.FromUserID, &t.DocumentID, &t.DocumentName)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (s *TransferService) lookupRecipient(ctx context.Context, ownerID uuid.UUID, email string) (uuid.UUID, error) {
+	var toUserID uuid.UUID
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&toUserID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrUserNotFound
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if toUserID == ownerID {
+		return uuid.Nil, ErrTransferToSelf
+	}
+	return toUserID, nil
+}
+
+func (s *TransferService) createOffer(ctx context.Context, documentID, fromUserID, toUserID uuid.UUID, keepAccess bool) (*models.DocumentTransfer, error) {
+	transfer := &models.DocumentTransfer{
+		ID:         uuid.New(),
+		DocumentID: documentID,
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		KeepAccess: keepAccess,
+		Status:     TransferPending,
+		CreatedAt:  time.Now(),
+	}
+
+	err := s.db.InTx(ctx, func(tx *sql.Tx) error {
+		// Lock the document so concurrent offers for it take turns, and a
+		// transfer or delete can't slip in between the check and the offer
+		var ownerID uuid.UUID
+		err := tx.QueryRowContext(ctx,
+			`SELECT owner_id FROM documents WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+			documentID,
+		).Scan(&ownerID)
+		if err == sql.ErrNoRows {
+			return ErrDocumentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if ownerID != fromUserID {
+			return ErrAccessDenied
+		}
+
+		// Only one offer may be pending per document; a new offer supersedes the old one
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE document_transfers SET status = 'cancelled', responded_at = $1
+			 WHERE document_id = $2 AND status = 'pending'`,
+			transfer.CreatedAt, documentID,
+		); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO document_transfers (id, document_id, from_user_id, to_user_id, keep_access, status, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			transfer.ID, transfer.DocumentID, transfer.FromUserID, transfer.ToUserID,
+			transfer.KeepAccess, transfer.Status, transfer.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to save transfer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// expectOfferLock expects the transaction creating an offer to begin by
+// locking the document, currently owned by ownerID.
+func expectOfferLock(mock sqlmock.Sqlmock, docID, ownerID uuid.UUID) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT owner_id FROM documents WHERE id = \$1 AND deleted_at IS NULL FOR UPDATE`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+}
+
+func TestTransferService_Offer_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+	recipientID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
+		WithArgs("new-owner@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(recipientID))
+
+	expectOfferLock(mock, docID, ownerID)
+	mock.ExpectExec(`UPDATE document_transfers SET status = 'cancelled'`).
+		WithArgs(sqlmock.AnyArg(), docID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(`INSERT INTO document_transfers`).
+		WithArgs(sqlmock.AnyArg(), docID, ownerID, recipientID, true, TransferPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectNotification(mock, NotificationTransferOffered)
+
+	transfer, err := service.Offer(context.Background(), docID, ownerID, "new-owner@example.com", true)
+	if err != nil {
+		t.Fatalf("Offer() error = %v", err)
+	}
+
+	if transfer.ToUserID != recipientID {
+		t.Errorf("transfer.ToUserID = %v, want %v", transfer.ToUserID, recipientID)
+	}
+
+	if transfer.Status != TransferPending {
+		t.Errorf("transfer.Status = %q, want %q", transfer.Status, TransferPending)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Offer_NotOwner(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	_, err := service.Offer(context.Background(), docID, uuid.New(), "someone@example.com", false)
+
+	if err != ErrAccessDenied {
+		t.Errorf("Offer() by non-owner error = %v, want ErrAccessDenied", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Offer_ToSelf(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	docID := uuid.New()
+	ownerID := uuid.New()
+
+	getRows := sqlmock.NewRows(documentColumns).AddRow(docID, ownerID, "Test", "test.pdf", 1024, "application/pdf", "AES-256-GCM", "/path", false, time.Now(), time.Now(), nil, nil, "")
+
+	mock.ExpectQuery(`SELECT .+ FROM documents WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs(docID).
+		WillReturnRows(getRows)
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
+		WithArgs("owner@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(ownerID))
+
+	_, err := service.Offer(context.Background(), docID, ownerID, "owner@example.com", false)
+
+	if err != ErrTransferToSelf {
+		t.Errorf("Offer() to self error = %v, want ErrTransferToSelf", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_OfferAll_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	ownerID := uuid.New()
+	recipientID := uuid.New()
+	docIDs := []uuid.UUID{uuid.New(), uuid.New()}
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
+		WithArgs("new-owner@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(recipientID))
+
+	mock.ExpectQuery(`SELECT id FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL`).
+		WithArgs(ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(docIDs[0]).AddRow(docIDs[1]))
+
+	for _, docID := range docIDs {
+		expectOfferLock(mock, docID, ownerID)
+		mock.ExpectExec(`UPDATE document_transfers SET status = 'cancelled'`).
+			WithArgs(sqlmock.AnyArg(), docID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO document_transfers`).
+			WithArgs(sqlmock.AnyArg(), docID, ownerID, recipientID, false, TransferPending, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	// A single notification covers the batch
+	expectNotification(mock, NotificationTransferOffered)
+
+	transfers, err := service.OfferAll(context.Background(), ownerID, "new-owner@example.com", false)
+	if err != nil {
+		t.Fatalf("OfferAll() error = %v", err)
+	}
+
+	if len(transfers) != 2 {
+		t.Errorf("len(transfers) = %d, want 2", len(transfers))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_OfferAll_SkipsTransferredMeanwhile(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	ownerID := uuid.New()
+	recipientID := uuid.New()
+	movedID, keptID := uuid.New(), uuid.New()
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE email = \$1`).
+		WithArgs("new-owner@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(recipientID))
+	mock.ExpectQuery(`SELECT id FROM documents WHERE owner_id = \$1 AND deleted_at IS NULL`).
+		WithArgs(ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(movedID).AddRow(keptID))
+
+	// The first document changed hands after it was listed
+	expectOfferLock(mock, movedID, uuid.New())
+	mock.ExpectRollback()
+
+	expectOfferLock(mock, keptID, ownerID)
+	mock.ExpectExec(`UPDATE document_transfers SET status = 'cancelled'`).
+		WithArgs(sqlmock.AnyArg(), keptID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO document_transfers`).
+		WithArgs(sqlmock.AnyArg(), keptID, ownerID, recipientID, false, TransferPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectNotification(mock, NotificationTransferOffered)
+
+	transfers, err := service.OfferAll(context.Background(), ownerID, "new-owner@example.com", false)
+	if err != nil {
+		t.Fatalf("OfferAll() error = %v", err)
+	}
+	if len(transfers) != 1 || transfers[0].DocumentID != keptID {
+		t.Errorf("transfers = %+v, want only the document still owned", transfers)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Accept_KeepAccess(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	transferID := uuid.New()
+	docID := uuid.New()
+	fromID := uuid.New()
+	toID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .+ FROM document_transfers WHERE id = \$1 AND to_user_id = \$2 AND status = 'pending'`).
+		WithArgs(transferID, toID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document_id", "from_user_id", "to_user_id", "keep_access"}).
+			AddRow(transferID, docID, fromID, toID, true))
+	mock.ExpectQuery(`SELECT owner_id, name, blob_id, file_path FROM documents WHERE id = \$1 AND deleted_at IS NULL FOR UPDATE`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "name", "blob_id", "file_path"}).AddRow(fromID, "Contract", nil, "/uploads/contract"))
+	mock.ExpectExec(`UPDATE documents SET owner_id = \$1, folder_id = NULL, blob_id = \$2, file_path = \$3, updated_at = \$4 WHERE id = \$5`).
+		WithArgs(toID, uuid.NullUUID{}, "/uploads/contract", sqlmock.AnyArg(), docID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM document_shares WHERE document_id = \$1 AND shared_with_id = \$2`).
+		WithArgs(docID, toID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO document_shares`).
+		WithArgs(docID, toID, fromID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE document_transfers SET status = 'accepted'`).
+		WithArgs(sqlmock.AnyArg(), transferID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectNotification(mock, NotificationTransferAccepted)
+
+	if err := service.Accept(context.Background(), transferID, toID); err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Accept_SharedBlob(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	transferID := uuid.New()
+	docID := uuid.New()
+	fromID := uuid.New()
+	toID := uuid.New()
+	blobID := uuid.New()
+	newBlobID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .+ FROM document_transfers`).
+		WithArgs(transferID, toID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document_id", "from_user_id", "to_user_id", "keep_access"}).
+			AddRow(transferID, docID, fromID, toID, false))
+	mock.ExpectQuery(`SELECT owner_id, name, blob_id, file_path FROM documents`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "name", "blob_id", "file_path"}).AddRow(fromID, "Contract", blobID, "/uploads/original"))
+
+	// The previous owner's other copy keeps the old blob; the recipient gets
+	// their own blob on the same file
+	mock.ExpectQuery(`UPDATE blobs SET ref_count = ref_count - 1 WHERE id = \$1`).
+		WithArgs(blobID).
+		WillReturnRows(sqlmock.NewRows([]string{"sha256", "size", "file_path", "ref_count"}).AddRow("abc123", 1024, "/uploads/original", 1))
+	mock.ExpectQuery(`INSERT INTO blobs .+ON CONFLICT \(owner_id, sha256\) DO UPDATE SET ref_count = blobs.ref_count \+ 1`).
+		WithArgs(sqlmock.AnyArg(), toID, "abc123", 1024, "/uploads/original").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_path"}).AddRow(newBlobID, "/uploads/original"))
+	mock.ExpectExec(`UPDATE documents SET owner_id = \$1, folder_id = NULL, blob_id = \$2, file_path = \$3`).
+		WithArgs(toID, uuid.NullUUID{UUID: newBlobID, Valid: true}, "/uploads/original", sqlmock.AnyArg(), docID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM document_shares`).
+		WithArgs(docID, toID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE document_transfers SET status = 'accepted'`).
+		WithArgs(sqlmock.AnyArg(), transferID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectNotification(mock, NotificationTransferAccepted)
+
+	if err := service.Accept(context.Background(), transferID, toID); err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Accept_RecipientHasContent(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	transferID := uuid.New()
+	docID := uuid.New()
+	fromID := uuid.New()
+	toID := uuid.New()
+	blobID := uuid.New()
+	existingBlobID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .+ FROM document_transfers`).
+		WithArgs(transferID, toID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document_id", "from_user_id", "to_user_id", "keep_access"}).
+			AddRow(transferID, docID, fromID, toID, false))
+	mock.ExpectQuery(`SELECT owner_id, name, blob_id, file_path FROM documents`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "name", "blob_id", "file_path"}).AddRow(fromID, "Contract", blobID, "/uploads/original"))
+
+	// The recipient already stores this content, so the document moves onto
+	// their file and the old one is queued for removal
+	mock.ExpectQuery(`UPDATE blobs SET ref_count = ref_count - 1 WHERE id = \$1`).
+		WithArgs(blobID).
+		WillReturnRows(sqlmock.NewRows([]string{"sha256", "size", "file_path", "ref_count"}).AddRow("abc123", 1024, "/uploads/original", 0))
+	mock.ExpectQuery(`INSERT INTO blobs`).
+		WithArgs(sqlmock.AnyArg(), toID, "abc123", 1024, "/uploads/original").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_path"}).AddRow(existingBlobID, "/uploads/theirs"))
+	mock.ExpectQuery(`DELETE FROM blobs WHERE id = \$1 AND ref_count <= 0`).
+		WithArgs(blobID).
+		WillReturnRows(sqlmock.NewRows([]string{"orphaned"}).AddRow(true))
+	mock.ExpectExec(`INSERT INTO file_deletions`).
+		WithArgs(sqlmock.AnyArg(), docID, "/uploads/original").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE documents SET owner_id = \$1, folder_id = NULL, blob_id = \$2, file_path = \$3`).
+		WithArgs(toID, uuid.NullUUID{UUID: existingBlobID, Valid: true}, "/uploads/theirs", sqlmock.AnyArg(), docID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM document_shares`).
+		WithArgs(docID, toID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE document_transfers SET status = 'accepted'`).
+		WithArgs(sqlmock.AnyArg(), transferID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectNotification(mock, NotificationTransferAccepted)
+
+	if err := service.Accept(context.Background(), transferID, toID); err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Accept_OwnerChanged(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	transferID := uuid.New()
+	docID := uuid.New()
+	fromID := uuid.New()
+	toID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .+ FROM document_transfers`).
+		WithArgs(transferID, toID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document_id", "from_user_id", "to_user_id", "keep_access"}).
+			AddRow(transferID, docID, fromID, toID, false))
+	mock.ExpectQuery(`SELECT owner_id, name, blob_id, file_path FROM documents`).
+		WithArgs(docID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "name", "blob_id", "file_path"}).AddRow(uuid.New(), "Contract", nil, "/uploads/contract"))
+	mock.ExpectRollback()
+
+	err := service.Accept(context.Background(), transferID, toID)
+
+	if err != ErrTransferStale {
+		t.Errorf("Accept() after owner change error = %v, want ErrTransferStale", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Accept_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .+ FROM document_transfers`).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err := service.Accept(context.Background(), uuid.New(), uuid.New())
+
+	if err != ErrTransferNotFound {
+		t.Errorf("Accept() error = %v, want ErrTransferNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Decline_NotFound(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	transferID := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectQuery(`UPDATE document_transfers t SET status = \$1, responded_at = \$2.+t.to_user_id = \$4`).
+		WithArgs(TransferDeclined, sqlmock.AnyArg(), transferID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"from_user_id", "document_id", "name"}))
+
+	err := service.Decline(context.Background(), transferID, userID)
+
+	if err != ErrTransferNotFound {
+		t.Errorf("Decline() error = %v, want ErrTransferNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransferService_Decline_NotifiesOwner(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+
+	service := NewTransferService(db, NewDocumentService(db, t.TempDir()))
+
+	transferID := uuid.New()
+	docID := uuid.New()
+	fromID := uuid.New()
+	toID := uuid.New()
+
+	mock.ExpectQuery(`UPDATE document_transfers t SET status = \$1`).
+		WithArgs(TransferDeclined, sqlmock.AnyArg(), transferID, toID).
+		WillReturnRows(sqlmock.NewRows([]string{"from_user_id", "document_id", "name"}).AddRow(fromID, docID, "Contract"))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(sqlmock.AnyArg(), fromID, NotificationTransferDeclined, toID.String(), docID.String(), nil,
+			`{"name":"Contract"}`, false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := service.Decline(context.Background(), transferID, toID); err != nil {
+		t.Fatalf("Decline() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
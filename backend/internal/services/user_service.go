@@ -1,33 +1,43 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/katim/secure-doc-vault/internal/database"
 	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrUserNotFound     = errors.New("user not found")
-	ErrUserExists       = errors.New("user already exists")
-	ErrInvalidPassword  = errors.New("invalid password")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrUserExists      = errors.New("user already exists")
+	ErrInvalidPassword = errors.New("invalid password")
 )
 
 type UserService struct {
-	db *database.DB
+	users UserRepository
 }
 
 func NewUserService(db *database.DB) *UserService {
-	return &UserService{db: db}
+	return NewUserServiceFromRepository(NewPostgresRepositories(db).Users)
 }
 
-func (s *UserService) Create(email, password, name string) (*models.User, error) {
+// NewUserServiceFromRepository returns a service storing accounts in users,
+// such as the in-memory store.
+func NewUserServiceFromRepository(users UserRepository) *UserService {
+	return &UserService{users: users}
+}
+
+func (s *UserService) Create(ctx context.Context, email, password, name string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Create")
+	defer span.End()
+
 	// Check if user exists
-	existing, _ := s.GetByEmail(email)
+	existing, _ := s.GetByEmail(ctx, email)
 	if existing != nil {
 		return nil, ErrUserExists
 	}
@@ -47,52 +57,32 @@ func (s *UserService) Create(email, password, name string) (*models.User, error)
 		UpdatedAt: time.Now(),
 	}
 
-	_, err = s.db.Exec(
-		`INSERT INTO users (id, email, password, name, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		user.ID, user.Email, user.Password, user.Name, user.CreatedAt, user.UpdatedAt,
-	)
-	if err != nil {
+	if err := s.users.Create(ctx, user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-func (s *UserService) GetByID(id uuid.UUID) (*models.User, error) {
-	user := &models.User{}
-	err := s.db.QueryRow(
-		`SELECT id, email, password, name, created_at, updated_at FROM users WHERE id = $1`,
-		id,
-	).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByID")
+	defer span.End()
 
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return s.users.GetByID(ctx, id)
 }
 
-func (s *UserService) GetByEmail(email string) (*models.User, error) {
-	user := &models.User{}
-	err := s.db.QueryRow(
-		`SELECT id, email, password, name, created_at, updated_at FROM users WHERE email = $1`,
-		email,
-	).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+func (s *UserService) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByEmail")
+	defer span.End()
 
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return s.users.GetByEmail(ctx, email)
 }
 
-func (s *UserService) Authenticate(email, password string) (*models.User, error) {
-	user, err := s.GetByEmail(email)
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Authenticate")
+	defer span.End()
+
+	user, err := s.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
@@ -104,22 +94,9 @@ func (s *UserService) Authenticate(email, password string) (*models.User, error)
 	return user, nil
 }
 
-func (s *UserService) UpdateName(id uuid.UUID, name string) error {
-	result, err := s.db.Exec(
-		`UPDATE users SET name = $1, updated_at = $2 WHERE id = $3`,
-		name, time.Now(), id,
-	)
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if rows == 0 {
-		return ErrUserNotFound
-	}
+func (s *UserService) UpdateName(ctx context.Context, id uuid.UUID, name string) error {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateName")
+	defer span.End()
 
-	return nil
+	return s.users.UpdateName(ctx, id, name, time.Now())
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"testing"
@@ -31,12 +32,13 @@ func TestNewUserService(t *testing.T) {
 		t.Fatal("NewUserService returned nil")
 	}
 
-	if service.db != db {
-		t.Error("UserService.db not set correctly")
+	if users, ok := service.users.(*postgresUserRepository); !ok || users.db != db {
+		t.Error("UserService.users not backed by the database")
 	}
 }
 
 func TestUserService_Create_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -55,7 +57,7 @@ func TestUserService_Create_Success(t *testing.T) {
 		WithArgs(sqlmock.AnyArg(), email, sqlmock.AnyArg(), name, sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	user, err := service.Create(email, password, name)
+	user, err := service.Create(ctx, email, password, name)
 	if err != nil {
 		t.Fatalf("Create() error = %v", err)
 	}
@@ -93,6 +95,7 @@ func TestUserService_Create_Success(t *testing.T) {
 }
 
 func TestUserService_Create_UserExists(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -107,7 +110,7 @@ func TestUserService_Create_UserExists(t *testing.T) {
 		WithArgs(email).
 		WillReturnRows(rows)
 
-	_, err := service.Create(email, "password", "New Name")
+	_, err := service.Create(ctx, email, "password", "New Name")
 
 	if err != ErrUserExists {
 		t.Errorf("Create() error = %v, want ErrUserExists", err)
@@ -119,6 +122,7 @@ func TestUserService_Create_UserExists(t *testing.T) {
 }
 
 func TestUserService_Create_DBError(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -131,7 +135,7 @@ func TestUserService_Create_DBError(t *testing.T) {
 		WithArgs(email).
 		WillReturnError(dbError)
 
-	_, err := service.Create(email, "password", "Test")
+	_, err := service.Create(ctx, email, "password", "Test")
 
 	if err == nil {
 		t.Error("Create() should return error on DB failure")
@@ -139,6 +143,7 @@ func TestUserService_Create_DBError(t *testing.T) {
 }
 
 func TestUserService_GetByID_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -156,7 +161,7 @@ func TestUserService_GetByID_Success(t *testing.T) {
 		WithArgs(userID).
 		WillReturnRows(rows)
 
-	user, err := service.GetByID(userID)
+	user, err := service.GetByID(ctx, userID)
 	if err != nil {
 		t.Fatalf("GetByID() error = %v", err)
 	}
@@ -179,6 +184,7 @@ func TestUserService_GetByID_Success(t *testing.T) {
 }
 
 func TestUserService_GetByID_NotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -189,7 +195,7 @@ func TestUserService_GetByID_NotFound(t *testing.T) {
 		WithArgs(userID).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err := service.GetByID(userID)
+	_, err := service.GetByID(ctx, userID)
 
 	if err != ErrUserNotFound {
 		t.Errorf("GetByID() error = %v, want ErrUserNotFound", err)
@@ -201,6 +207,7 @@ func TestUserService_GetByID_NotFound(t *testing.T) {
 }
 
 func TestUserService_GetByEmail_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -216,7 +223,7 @@ func TestUserService_GetByEmail_Success(t *testing.T) {
 		WithArgs(email).
 		WillReturnRows(rows)
 
-	user, err := service.GetByEmail(email)
+	user, err := service.GetByEmail(ctx, email)
 	if err != nil {
 		t.Fatalf("GetByEmail() error = %v", err)
 	}
@@ -231,6 +238,7 @@ func TestUserService_GetByEmail_Success(t *testing.T) {
 }
 
 func TestUserService_GetByEmail_NotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -241,7 +249,7 @@ func TestUserService_GetByEmail_NotFound(t *testing.T) {
 		WithArgs(email).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err := service.GetByEmail(email)
+	_, err := service.GetByEmail(ctx, email)
 
 	if err != ErrUserNotFound {
 		t.Errorf("GetByEmail() error = %v, want ErrUserNotFound", err)
@@ -253,6 +261,7 @@ func TestUserService_GetByEmail_NotFound(t *testing.T) {
 }
 
 func TestUserService_Authenticate_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -269,7 +278,7 @@ func TestUserService_Authenticate_Success(t *testing.T) {
 		WithArgs(email).
 		WillReturnRows(rows)
 
-	user, err := service.Authenticate(email, password)
+	user, err := service.Authenticate(ctx, email, password)
 	if err != nil {
 		t.Fatalf("Authenticate() error = %v", err)
 	}
@@ -284,6 +293,7 @@ func TestUserService_Authenticate_Success(t *testing.T) {
 }
 
 func TestUserService_Authenticate_WrongPassword(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -300,7 +310,7 @@ func TestUserService_Authenticate_WrongPassword(t *testing.T) {
 		WithArgs(email).
 		WillReturnRows(rows)
 
-	_, err := service.Authenticate(email, wrongPassword)
+	_, err := service.Authenticate(ctx, email, wrongPassword)
 
 	if err != ErrInvalidPassword {
 		t.Errorf("Authenticate() with wrong password error = %v, want ErrInvalidPassword", err)
@@ -312,6 +322,7 @@ func TestUserService_Authenticate_WrongPassword(t *testing.T) {
 }
 
 func TestUserService_Authenticate_UserNotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -322,7 +333,7 @@ func TestUserService_Authenticate_UserNotFound(t *testing.T) {
 		WithArgs(email).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err := service.Authenticate(email, "anypassword")
+	_, err := service.Authenticate(ctx, email, "anypassword")
 
 	if err != ErrUserNotFound {
 		t.Errorf("Authenticate() with non-existent user error = %v, want ErrUserNotFound", err)
@@ -334,6 +345,7 @@ func TestUserService_Authenticate_UserNotFound(t *testing.T) {
 }
 
 func TestUserService_UpdateName_Success(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -345,7 +357,7 @@ func TestUserService_UpdateName_Success(t *testing.T) {
 		WithArgs(newName, sqlmock.AnyArg(), userID).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := service.UpdateName(userID, newName)
+	err := service.UpdateName(ctx, userID, newName)
 	if err != nil {
 		t.Fatalf("UpdateName() error = %v", err)
 	}
@@ -356,6 +368,7 @@ func TestUserService_UpdateName_Success(t *testing.T) {
 }
 
 func TestUserService_UpdateName_UserNotFound(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -367,7 +380,7 @@ func TestUserService_UpdateName_UserNotFound(t *testing.T) {
 		WithArgs(newName, sqlmock.AnyArg(), userID).
 		WillReturnResult(sqlmock.NewResult(0, 0)) // 0 rows affected
 
-	err := service.UpdateName(userID, newName)
+	err := service.UpdateName(ctx, userID, newName)
 
 	if err != ErrUserNotFound {
 		t.Errorf("UpdateName() with non-existent user error = %v, want ErrUserNotFound", err)
@@ -379,6 +392,7 @@ func TestUserService_UpdateName_UserNotFound(t *testing.T) {
 }
 
 func TestUserService_UpdateName_DBError(t *testing.T) {
+	ctx := context.Background()
 	db, mock := newMockDB(t)
 	defer db.Close()
 	service := NewUserService(db)
@@ -390,7 +404,7 @@ func TestUserService_UpdateName_DBError(t *testing.T) {
 		WithArgs("New Name", sqlmock.AnyArg(), userID).
 		WillReturnError(dbError)
 
-	err := service.UpdateName(userID, "New Name")
+	err := service.UpdateName(ctx, userID, "New Name")
 
 	if err == nil {
 		t.Error("UpdateName() should return error on DB failure")
@@ -401,6 +415,33 @@ func TestUserService_UpdateName_DBError(t *testing.T) {
 	}
 }
 
+func TestUserService_MemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	service := NewUserServiceFromRepository(NewMemoryRepositories().Users)
+
+	user, err := service.Create(ctx, "memory@example.com", "securepassword123", "Memory User")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := service.Create(ctx, "memory@example.com", "otherpassword", "Someone Else"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Create() with a taken email error = %v, want ErrUserExists", err)
+	}
+
+	if authenticated, err := service.Authenticate(ctx, "memory@example.com", "securepassword123"); err != nil || authenticated.ID != user.ID {
+		t.Errorf("Authenticate() = %v, %v; want the created user", authenticated, err)
+	}
+	if _, err := service.Authenticate(ctx, "memory@example.com", "wrongpassword"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Authenticate() with a wrong password error = %v, want ErrInvalidPassword", err)
+	}
+
+	if err := service.UpdateName(ctx, user.ID, "Renamed"); err != nil {
+		t.Fatalf("UpdateName() error = %v", err)
+	}
+	if found, _ := service.GetByID(ctx, user.ID); found == nil || found.Name != "Renamed" {
+		t.Errorf("GetByID() after UpdateName = %+v, want the new name", found)
+	}
+}
+
 // Benchmark tests
 func BenchmarkPasswordHashing(b *testing.B) {
 	password := "testpassword123"
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/metrics"
+)
+
+const (
+	webhookBatchSize    = 20
+	webhookPollInterval = 2 * time.Second
+	webhookTimeout      = 10 * time.Second
+	// webhookLease keeps a claimed delivery from being picked up by another
+	// dispatcher while its request is in flight.
+	webhookLease = time.Minute
+	// webhookMaxAttempts is how many failures move a delivery to the dead
+	// letter state. With retryBackoff the retries span about 4h15m; its cap
+	// only matters for deliveries replayed after many attempts.
+	webhookMaxAttempts = 10
+)
+
+// Signature headers sent with every delivery. The signature is the hex HMAC
+// SHA-256 of "<timestamp>.<body>" keyed with the webhook secret.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// WebhookDispatcher sends queued deliveries, retrying failures with
+// exponential backoff until they succeed or go dead.
+type WebhookDispatcher struct {
+	db     *database.DB
+	client *http.Client
+}
+
+func NewWebhookDispatcher(db *database.DB) *WebhookDispatcher {
+	return &WebhookDispatcher{db: db, client: newWebhookClient(blockedWebhookIP)}
+}
+
+type pendingDelivery struct {
+	id        uuid.UUID
+	eventType string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+// Run dispatches due deliveries until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	for {
+		sent, err := d.DispatchDue(ctx)
+		metrics.ObserveJob("webhook_dispatch", sent, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "webhook dispatch failed", "error", err)
+		}
+
+		wait := webhookPollInterval
+		if sent == webhookBatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// DispatchDue claims a batch of due deliveries and attempts each once. It
+// returns how many were attempted. Once ctx is cancelled the rest of the
+// batch is left claimed, to be retried when the lease runs out.
+func (d *WebhookDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`UPDATE webhook_deliveries wd
+		 SET next_attempt_at = $2
+		 FROM webhooks w
+		 WHERE w.id = wd.webhook_id AND wd.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING wd.id, wd.event_type, wd.payload, wd.attempts, w.url, w.secret`,
+		webhookBatchSize, time.Now().Add(webhookLease),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []pendingDelivery
+	for rows.Next() {
+		var p pendingDelivery
+		if err := rows.Scan(&p.id, &p.eventType, &p.payload, &p.attempts, &p.url, &p.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, p := range batch {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := d.attempt(ctx, p); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// attempt sends one delivery and records the outcome. Only a failure to
+// record is returned; delivery failures are stored on the row. A send cut
+// short by ctx is not counted as a failure and the delivery keeps its lease.
+func (d *WebhookDispatcher) attempt(ctx context.Context, p pendingDelivery) error {
+	statusCode, sendErr := d.send(ctx, p)
+	if sendErr != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	// The request has been made, so its outcome is recorded regardless
+	ctx = context.WithoutCancel(ctx)
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	if sendErr == nil {
+		_, err := d.db.ExecContext(ctx,
+			`UPDATE webhook_deliveries
+			 SET status = 'delivered', attempts = attempts + 1, last_status_code = $1, last_error = NULL, delivered_at = NOW()
+			 WHERE id = $2`,
+			code, p.id,
+		)
+		return err
+	}
+
+	attempts := p.attempts + 1
+	status := DeliveryPending
+	if attempts >= webhookMaxAttempts {
+		status = DeliveryDead
+	}
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4, last_error = $5
+		 WHERE id = $6`,
+		status, attempts, time.Now().Add(retryBackoff(attempts)), code, sendErr.Error(), p.id,
+	)
+	return err
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, p pendingDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(p.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, p.eventType)
+	req.Header.Set(WebhookDeliveryHeader, p.id.String())
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(p.secret, timestamp, p.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload computes the signature subscribers should compare,
+// in constant time, against the X-Webhook-Signature header.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
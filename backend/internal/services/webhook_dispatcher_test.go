@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+)
+
+var claimedColumns = []string{"id", "event_type", "payload", "attempts", "url", "secret"}
+
+// newTestDispatcher returns a dispatcher allowed to reach the loopback
+// httptest servers its tests deliver to.
+func newTestDispatcher(db *database.DB) *WebhookDispatcher {
+	dispatcher := NewWebhookDispatcher(db)
+	dispatcher.client = newWebhookClient(func(net.IP) bool { return false })
+	return dispatcher
+}
+
+func TestWebhookDispatcher_DeliversSignedPayload(t *testing.T) {
+	payload := []byte(`{"type":"document.created"}`)
+
+	var gotSignature, gotTimestamp, gotEvent string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(WebhookSignatureHeader)
+		gotTimestamp = r.Header.Get(WebhookTimestampHeader)
+		gotEvent = r.Header.Get(WebhookEventHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	db, mock := newMockDB(t)
+	defer db.Close()
+	dispatcher := newTestDispatcher(db)
+
+	deliveryID := uuid.New()
+	mock.ExpectQuery(`UPDATE webhook_deliveries wd.+FOR UPDATE SKIP LOCKED.+RETURNING`).
+		WithArgs(webhookBatchSize, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(claimedColumns).
+			AddRow(deliveryID, EventDocumentCreated, payload, 0, server.URL, "s3cret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries\s+SET status = 'delivered'`).
+		WithArgs(http.StatusNoContent, deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sent, err := dispatcher.DispatchDue(context.Background())
+	if err != nil {
+		t.Fatalf("DispatchDue() error = %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("DispatchDue() = %d, want 1", sent)
+	}
+
+	if string(gotBody) != string(payload) || gotEvent != EventDocumentCreated {
+		t.Errorf("received %s (%s), want the stored payload", gotBody, gotEvent)
+	}
+	if want := "sha256=" + SignWebhookPayload("s3cret", gotTimestamp, payload); gotSignature != want {
+		t.Errorf("signature = %q, want %q", gotSignature, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestWebhookDispatcher_FailureSchedulesRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	db, mock := newMockDB(t)
+	defer db.Close()
+	dispatcher := newTestDispatcher(db)
+
+	deliveryID := uuid.New()
+	mock.ExpectQuery(`UPDATE webhook_deliveries wd`).
+		WillReturnRows(sqlmock.NewRows(claimedColumns).
+			AddRow(deliveryID, EventDocumentShared, []byte(`{}`), 2, server.URL, "s3cret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries\s+SET status = \$1, attempts = \$2`).
+		WithArgs(DeliveryPending, 3, sqlmock.AnyArg(), http.StatusBadGateway, "unexpected status 502", deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("DispatchDue() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestWebhookDispatcher_CancelledLeavesBatchLeased(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan struct{}, 2)
+	answer := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Shut down while the subscriber is still answering
+		received <- struct{}{}
+		cancel()
+		<-answer
+	}))
+	defer server.Close()
+	defer close(answer)
+
+	db, mock := newMockDB(t)
+	defer db.Close()
+	dispatcher := newTestDispatcher(db)
+
+	mock.ExpectQuery(`UPDATE webhook_deliveries wd`).
+		WillReturnRows(sqlmock.NewRows(claimedColumns).
+			AddRow(uuid.New(), EventDocumentShared, []byte(`{}`), 0, server.URL, "s3cret").
+			AddRow(uuid.New(), EventDocumentShared, []byte(`{}`), 0, server.URL, "s3cret"))
+
+	// The first send is cut short and the second never made. Neither is
+	// recorded: both wait out the lease and go again
+	sent, err := dispatcher.DispatchDue(ctx)
+	if err != nil {
+		t.Fatalf("DispatchDue() error = %v", err)
+	}
+	if sent != 1 {
+		t.Errorf("DispatchDue() = %d, want 1", sent)
+	}
+	if len(received) != 1 {
+		t.Errorf("subscriber received %d requests, want only the interrupted one", len(received))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestWebhookDispatcher_LastAttemptGoesDead(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	dispatcher := newTestDispatcher(db)
+
+	deliveryID := uuid.New()
+	// Nothing listens on this port
+	mock.ExpectQuery(`UPDATE webhook_deliveries wd`).
+		WillReturnRows(sqlmock.NewRows(claimedColumns).
+			AddRow(deliveryID, EventDocumentDeleted, []byte(`{}`), webhookMaxAttempts-1, "http://127.0.0.1:1/hook", "s3cret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries\s+SET status = \$1`).
+		WithArgs(DeliveryDead, webhookMaxAttempts, sqlmock.AnyArg(), nil, sqlmock.AnyArg(), deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("DispatchDue() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// errorContains matches a stored last_error containing the given text.
+type errorContains string
+
+func (e errorContains) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && strings.Contains(s, string(e))
+}
+
+func TestWebhookDispatcher_RefusesInternalAddress(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	db, mock := newMockDB(t)
+	defer db.Close()
+	// The real guard, as a registered hostname now resolving to loopback
+	// would reach it
+	dispatcher := NewWebhookDispatcher(db)
+
+	deliveryID := uuid.New()
+	mock.ExpectQuery(`UPDATE webhook_deliveries wd`).
+		WillReturnRows(sqlmock.NewRows(claimedColumns).
+			AddRow(deliveryID, EventDocumentCreated, []byte(`{}`), 0, server.URL, "s3cret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries\s+SET status = \$1`).
+		WithArgs(DeliveryPending, 1, sqlmock.AnyArg(), nil, errorContains(ErrWebhookAddress.Error()), deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("DispatchDue() error = %v", err)
+	}
+	if called {
+		t.Error("delivery reached a loopback address")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestWebhookDispatcher_DoesNotFollowRedirects(t *testing.T) {
+	var redirected bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	db, mock := newMockDB(t)
+	defer db.Close()
+	dispatcher := newTestDispatcher(db)
+
+	deliveryID := uuid.New()
+	mock.ExpectQuery(`UPDATE webhook_deliveries wd`).
+		WillReturnRows(sqlmock.NewRows(claimedColumns).
+			AddRow(deliveryID, EventDocumentCreated, []byte(`{}`), 0, server.URL, "s3cret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries\s+SET status = \$1`).
+		WithArgs(DeliveryPending, 1, sqlmock.AnyArg(), http.StatusTemporaryRedirect, "unexpected status 307", deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("DispatchDue() error = %v", err)
+	}
+	if redirected {
+		t.Error("dispatcher followed the redirect")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBlockedWebhookIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.0.0.5", true},
+		{"172.16.4.1", true},
+		{"192.168.0.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"100.64.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"203.0.113.10", false},
+		{"8.8.8.8", false},
+		{"2606:4700::1111", false},
+	}
+
+	for _, tt := range tests {
+		if got := blockedWebhookIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("blockedWebhookIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
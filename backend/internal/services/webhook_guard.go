@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// blockedWebhookNets are ranges net.IP has no predicate for but that still
+// reach the host or its network rather than the internet.
+var blockedWebhookNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"64:ff9b::/96",  // NAT64, which embeds IPv4 addresses
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// blockedWebhookIP reports whether ip is loopback, private, link-local
+// (including the 169.254.169.254 metadata endpoint) or otherwise not a
+// public unicast address. Webhooks must never be delivered to one.
+func blockedWebhookIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range blockedWebhookNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebhookHost resolves host and rejects it if any address it resolves
+// to is blocked.
+func checkWebhookHost(ctx context.Context, lookup func(context.Context, string) ([]net.IPAddr, error), host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedWebhookIP(ip) {
+			return ErrWebhookAddress
+		}
+		return nil
+	}
+
+	addrs, err := lookup(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return ErrWebhookHostUnresolved
+	}
+	for _, addr := range addrs {
+		if blockedWebhookIP(addr.IP) {
+			return ErrWebhookAddress
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns the HTTP client deliveries are sent with. The
+// address is checked again when connecting, after DNS resolution, so a
+// hostname that was public at registration can't later be pointed at an
+// internal service. Proxies are not used, since the check would then only
+// see the proxy's address.
+func newWebhookClient(blocked func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blocked(ip) {
+				return ErrWebhookAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   webhookTimeout,
+			ResponseHeaderTimeout: webhookTimeout,
+			MaxIdleConns:          20,
+		},
+		// Receivers are expected to answer directly. A redirect is returned
+		// as the response and counts as a failed delivery, so it can't be
+		// used to bounce a signed request somewhere else.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
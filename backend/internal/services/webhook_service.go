@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/database"
+	"github.com/katim/secure-doc-vault/internal/models"
+	"github.com/katim/secure-doc-vault/internal/tracing"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWebhookNotFound   = errors.New("webhook not found")
+	ErrDeliveryNotFound  = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidEventType  = errors.New("unknown webhook event type")
+	// ErrWebhookAddress covers loopback, private and link-local targets,
+	// which would let webhooks probe the vault's own network.
+	ErrWebhookAddress        = errors.New("webhook URL must not point at a loopback, private or link-local address")
+	ErrWebhookHostUnresolved = errors.New("webhook URL host could not be resolved")
+)
+
+// Webhook event types
+const (
+	EventDocumentCreated = "document.created"
+	EventDocumentShared  = "document.shared"
+	EventDocumentRenamed = "document.renamed"
+	EventDocumentDeleted = "document.deleted"
+)
+
+var webhookEventTypes = map[string]bool{
+	EventDocumentCreated: true,
+	EventDocumentShared:  true,
+	EventDocumentRenamed: true,
+	EventDocumentDeleted: true,
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+const webhookColumns = `id, owner_id, url, event_types, is_global, created_at`
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+type WebhookService struct {
+	db       *database.DB
+	lookupIP func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func NewWebhookService(db *database.DB) *WebhookService {
+	return &WebhookService{db: db, lookupIP: net.DefaultResolver.LookupIPAddr}
+}
+
+// Create registers a webhook and generates its signing secret, which is only
+// returned here.
+func (s *WebhookService) Create(ctx context.Context, ownerID uuid.UUID, rawURL string, eventTypes []string, global bool) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Create")
+	defer span.End()
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	if err := checkWebhookHost(ctx, s.lookupIP, u.Hostname()); err != nil {
+		return nil, err
+	}
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	for _, t := range eventTypes {
+		if !webhookEventTypes[t] {
+			return nil, ErrInvalidEventType
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	webhook := &models.Webhook{
+		ID:         uuid.New(),
+		OwnerID:    ownerID,
+		URL:        rawURL,
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: eventTypes,
+		IsGlobal:   global,
+		CreatedAt:  time.Now(),
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO webhooks (id, owner_id, url, secret, event_types, is_global, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		webhook.ID, webhook.OwnerID, webhook.URL, webhook.Secret,
+		pq.Array(webhook.EventTypes), webhook.IsGlobal, webhook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, ownerID uuid.UUID) ([]models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.List")
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE owner_id = $1 ORDER BY created_at`,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		if err := rows.Scan(&w.ID, &w.OwnerID, &w.URL, pq.Array(&w.EventTypes), &w.IsGlobal, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *WebhookService) Delete(ctx context.Context, id, ownerID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "WebhookService.Delete")
+	defer span.End()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1 AND owner_id = $2`, id, ownerID)
+	if err != nil {
+		return err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns the webhook's deliveries, newest first, optionally
+// limited to one status.
+func (s *WebhookService) ListDeliveries(ctx context.Context, webhookID, ownerID uuid.UUID, status string) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ListDeliveries")
+	defer span.End()
+
+	if err := s.checkOwner(ctx, webhookID, ownerID); err != nil {
+		return nil, err
+	}
+
+	q := &documentQuery{}
+	q.where("webhook_id = ?", webhookID)
+	if status != "" {
+		q.where("status = ?", status)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE `+q.clause()+` ORDER BY created_at DESC LIMIT 100`,
+		q.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var lastError sql.NullString
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatusCode, &lastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		d.LastError = lastError.String
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Replay queues deliveries for another round of attempts: a single delivery
+// in any state when deliveryID is given, otherwise every dead delivery of the
+// webhook. It returns how many were queued.
+func (s *WebhookService) Replay(ctx context.Context, webhookID, ownerID uuid.UUID, deliveryID *uuid.UUID) (int, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Replay")
+	defer span.End()
+
+	if err := s.checkOwner(ctx, webhookID, ownerID); err != nil {
+		return 0, err
+	}
+
+	q := &documentQuery{}
+	q.where("webhook_id = ?", webhookID)
+	if deliveryID != nil {
+		q.where("id = ?", *deliveryID)
+	} else {
+		q.where("status = ?", DeliveryDead)
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		 SET status = 'pending', attempts = 0, next_attempt_at = NOW(), delivered_at = NULL
+		 WHERE `+q.clause(),
+		q.args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _ := result.RowsAffected()
+	if deliveryID != nil && rows == 0 {
+		return 0, ErrDeliveryNotFound
+	}
+	return int(rows), nil
+}
+
+// newWebhookEvent describes a change to a document for webhook subscribers.
+func newWebhookEvent(eventType string, documentID, actorID uuid.UUID, data map[string]interface{}) *models.WebhookEvent {
+	return &models.WebhookEvent{
+		ID:         uuid.New(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		DocumentID: documentID,
+		ActorID:    actorID,
+		Data:       data,
+	}
+}
+
+// queueWebhookEvent queues an event for every webhook subscribed to it:
+// those of the document's owner and the global ones. It runs in the
+// transaction making the change, so the event is queued exactly when the
+// change commits. Delivery happens in the background.
+func queueWebhookEvent(ctx context.Context, tx *sql.Tx, event *models.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		 SELECT w.id, $1, $2, $3
+		 FROM webhooks w
+		 WHERE (w.is_global OR w.owner_id = (SELECT owner_id FROM documents WHERE id = $4))
+		   AND (cardinality(w.event_types) = 0 OR $2 = ANY(w.event_types))`,
+		event.ID, event.Type, string(payload), event.DocumentID,
+	)
+	return err
+}
+
+func (s *WebhookService) checkOwner(ctx context.Context, webhookID, ownerID uuid.UUID) error {
+	var owner uuid.UUID
+	err := s.db.QueryRowContext(ctx, `SELECT owner_id FROM webhooks WHERE id = $1`, webhookID).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != ownerID) {
+		// Someone else's webhook looks the same as a missing one
+		return ErrWebhookNotFound
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/katim/secure-doc-vault/internal/models"
+)
+
+// stubLookup resolves every host to addrs without touching DNS.
+func stubLookup(addrs ...string) func(context.Context, string) ([]net.IPAddr, error) {
+	return func(context.Context, string) ([]net.IPAddr, error) {
+		var ips []net.IPAddr
+		for _, a := range addrs {
+			ips = append(ips, net.IPAddr{IP: net.ParseIP(a)})
+		}
+		return ips, nil
+	}
+}
+
+// expectWebhookEmit expects the delivery fan-out queued by queueWebhookEvent.
+func expectWebhookEmit(mock sqlmock.Sqlmock, eventType string) {
+	mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+		WithArgs(sqlmock.AnyArg(), eventType, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestWebhookService_Create_Success(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewWebhookService(db)
+	service.lookupIP = stubLookup("203.0.113.10")
+
+	ownerID := uuid.New()
+	mock.ExpectExec(`INSERT INTO webhooks`).
+		WithArgs(sqlmock.AnyArg(), ownerID, "https://hooks.example.com/vault", sqlmock.AnyArg(), sqlmock.AnyArg(), false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	webhook, err := service.Create(context.Background(), ownerID, "https://hooks.example.com/vault", []string{EventDocumentShared}, false)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if len(webhook.Secret) != 64 {
+		t.Errorf("Secret = %q, want 64 hex characters", webhook.Secret)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestWebhookService_Create_Invalid(t *testing.T) {
+	db, _ := newMockDB(t)
+	defer db.Close()
+	service := NewWebhookService(db)
+	service.lookupIP = stubLookup("203.0.113.10")
+
+	tests := []struct {
+		name       string
+		url        string
+		eventTypes []string
+		want       error
+	}{
+		{"relative URL", "/hooks", nil, ErrInvalidWebhookURL},
+		{"non-http scheme", "ftp://example.com/hooks", nil, ErrInvalidWebhookURL},
+		{"unknown event", "https://example.com/hooks", []string{"document.viewed"}, ErrInvalidEventType},
+		{"loopback", "http://127.0.0.1:8080/hooks", nil, ErrWebhookAddress},
+		{"localhost IPv6", "http://[::1]/hooks", nil, ErrWebhookAddress},
+		{"private network", "http://10.1.2.3/hooks", nil, ErrWebhookAddress},
+		{"metadata endpoint", "http://169.254.169.254/latest/meta-data/", nil, ErrWebhookAddress},
+		{"IPv4-mapped loopback", "http://[::ffff:127.0.0.1]/hooks", nil, ErrWebhookAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Create(context.Background(), uuid.New(), tt.url, tt.eventTypes, false); err != tt.want {
+				t.Errorf("Create() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueWebhookEvent_Payload(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	documents := NewPostgresRepositories(db).Documents
+
+	docID := uuid.New()
+	actorID := uuid.New()
+
+	// The event is queued in the rename's own transaction
+	var payload payloadArg
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE documents SET name`).
+		WithArgs("new.pdf", sqlmock.AnyArg(), docID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO webhook_deliveries .+ FROM webhooks w\s+WHERE \(w.is_global OR w.owner_id = .+\$2 = ANY\(w.event_types\)`).
+		WithArgs(sqlmock.AnyArg(), EventDocumentRenamed, &payload, docID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	event := newWebhookEvent(EventDocumentRenamed, docID, actorID, map[string]interface{}{"name": "new.pdf"})
+	if err := documents.Rename(context.Background(), docID, "new.pdf", time.Now(), event); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+
+	if payload.event.Type != EventDocumentRenamed || payload.event.DocumentID != docID || payload.event.ActorID != actorID {
+		t.Errorf("payload = %+v, want renamed event for the document", payload.event)
+	}
+	if payload.event.Data["name"] != "new.pdf" {
+		t.Errorf("payload data = %v, want the new name", payload.event.Data)
+	}
+}
+
+// payloadArg captures and decodes the JSON payload argument.
+type payloadArg struct {
+	event models.WebhookEvent
+}
+
+func (a *payloadArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && json.Unmarshal([]byte(s), &a.event) == nil
+}
+
+func TestWebhookService_Create_HostResolvesInternally(t *testing.T) {
+	db, _ := newMockDB(t)
+	defer db.Close()
+	service := NewWebhookService(db)
+
+	// One internal address among public ones is enough to refuse the host.
+	service.lookupIP = stubLookup("203.0.113.10", "192.168.1.20")
+	if _, err := service.Create(context.Background(), uuid.New(), "https://hooks.example.com/vault", nil, false); err != ErrWebhookAddress {
+		t.Errorf("Create() error = %v, want ErrWebhookAddress", err)
+	}
+
+	service.lookupIP = stubLookup()
+	if _, err := service.Create(context.Background(), uuid.New(), "https://hooks.example.com/vault", nil, false); err != ErrWebhookHostUnresolved {
+		t.Errorf("Create() error = %v, want ErrWebhookHostUnresolved", err)
+	}
+}
+
+func TestWebhookService_Replay_DeadDeliveries(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewWebhookService(db)
+
+	ownerID := uuid.New()
+	webhookID := uuid.New()
+
+	mock.ExpectQuery(`SELECT owner_id FROM webhooks WHERE id = \$1`).
+		WithArgs(webhookID).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+	mock.ExpectExec(`UPDATE webhook_deliveries\s+SET status = 'pending', attempts = 0.+WHERE webhook_id = \$1 AND status = \$2`).
+		WithArgs(webhookID, DeliveryDead).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	replayed, err := service.Replay(context.Background(), webhookID, ownerID, nil)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 3 {
+		t.Errorf("Replay() = %d, want 3", replayed)
+	}
+}
+
+func TestWebhookService_Replay_OtherOwner(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewWebhookService(db)
+
+	webhookID := uuid.New()
+	mock.ExpectQuery(`SELECT owner_id FROM webhooks WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(uuid.New()))
+
+	if _, err := service.Replay(context.Background(), webhookID, uuid.New(), nil); err != ErrWebhookNotFound {
+		t.Errorf("Replay() error = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func TestWebhookService_ListDeliveries(t *testing.T) {
+	db, mock := newMockDB(t)
+	defer db.Close()
+	service := NewWebhookService(db)
+
+	ownerID := uuid.New()
+	webhookID := uuid.New()
+
+	mock.ExpectQuery(`SELECT owner_id FROM webhooks`).
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(ownerID))
+	mock.ExpectQuery(`FROM webhook_deliveries WHERE webhook_id = \$1 AND status = \$2 ORDER BY created_at DESC`).
+		WithArgs(webhookID, DeliveryDead).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "webhook_id", "event_id", "event_type", "status", "attempts", "next_attempt_at",
+			"last_status_code", "last_error", "created_at", "delivered_at",
+		}).AddRow(uuid.New(), webhookID, uuid.New(), EventDocumentCreated, DeliveryDead, 10, time.Now(),
+			500, "unexpected status 500", time.Now(), nil))
+
+	deliveries, err := service.ListDeliveries(context.Background(), webhookID, ownerID, DeliveryDead)
+	if err != nil {
+		t.Fatalf("ListDeliveries() error = %v", err)
+	}
+
+	if len(deliveries) != 1 || *deliveries[0].LastStatusCode != 500 || deliveries[0].LastError == "" {
+		t.Errorf("ListDeliveries() = %+v, want the dead delivery with its last error", deliveries)
+	}
+}
@@ -0,0 +1,86 @@
+// Package tracing sets up OpenTelemetry tracing: W3C traceparent
+// propagation and export over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/katim/secure-doc-vault/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans this code creates, as opposed
+// to the gin and SQL instrumentation's.
+const instrumentationName = "github.com/katim/secure-doc-vault"
+
+// Setup installs the global tracer provider and propagator. Without an
+// endpoint the propagator is still installed, so a caller's trace ID is
+// carried in request contexts, but no spans are recorded. The returned
+// function flushes pending spans and should be called on shutdown.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if cfg.TracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts, err := exporterOptions(cfg.TracingEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := Install(cfg.TracingServiceName, cfg.TracingSampleRatio, sdktrace.NewBatchSpanProcessor(exporter))
+	return provider.Shutdown, nil
+}
+
+// exporterOptions points the exporter at endpoint, the collector's base URL;
+// traces go to its /v1/traces path.
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: want a URL such as http://collector:4318", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return opts, nil
+}
+
+// Install makes a tracer provider sending spans to processor the global
+// one. New traces are sampled at ratio; requests carrying a traceparent
+// follow the caller's decision. Tests pass a processor wrapping an
+// in-memory exporter.
+func Install(serviceName string, ratio float64, processor sdktrace.SpanProcessor) *sdktrace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	otel.SetTracerProvider(provider)
+	return provider
+}
+
+// Start starts a span as a child of the one in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/katim/secure-doc-vault/internal/config"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a provider keeping every span in memory, restoring
+// the previous one when the test ends.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	previous := otel.GetTracerProvider()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := Install("test", 1, sdktrace.NewSimpleSpanProcessor(exporter))
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func TestExporterOptions(t *testing.T) {
+	for _, endpoint := range []string{"http://collector:4318", "https://otlp.example.com/prefix/"} {
+		if _, err := exporterOptions(endpoint); err != nil {
+			t.Errorf("exporterOptions(%q) error = %v", endpoint, err)
+		}
+	}
+	for _, endpoint := range []string{"collector:4318", "ftp://collector", "http://"} {
+		if _, err := exporterOptions(endpoint); err == nil {
+			t.Errorf("exporterOptions(%q) accepted an invalid endpoint", endpoint)
+		}
+	}
+}
+
+func TestSetup_WithoutEndpoint(t *testing.T) {
+	shutdown, err := Setup(context.Background(), &config.Config{})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+
+	// W3C trace context is understood even when nothing is exported
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("extracted trace ID = %s, want the traceparent's", got)
+	}
+}
+
+func TestStart_NestsSpans(t *testing.T) {
+	exporter := recordSpans(t)
+
+	ctx, parent := Start(context.Background(), "DocumentService.GetFilePath")
+	_, child := Start(ctx, "DocumentService.GetByID")
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	if spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("%s should be a child of %s", spans[0].Name, spans[1].Name)
+	}
+}
+
+func TestGinMiddleware_ContinuesCallerTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := recordSpans(t)
+	if _, err := Setup(context.Background(), &config.Config{}); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Use(otelgin.Middleware("test"))
+	router.GET("/documents/:id", func(c *gin.Context) {
+		_, span := Start(c.Request.Context(), "DocumentService.GetByID")
+		span.End()
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/documents/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	for _, span := range spans {
+		if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s is in trace %s, want the caller's", span.Name, span.SpanContext.TraceID())
+		}
+	}
+	if server := spans[1]; server.Name != "/documents/:id" || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span = %s under %s, want /documents/:id under the caller's span", server.Name, server.Parent.SpanID())
+	}
+}
@@ -0,0 +1,293 @@
+// Package extract pulls plain text out of uploaded files so it can be indexed
+// for full-text search. Extraction is best effort: unsupported or malformed
+// files simply yield no text.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTextBytes caps how much extracted text is kept per document. Postgres
+// rejects a tsvector over 1MB, and one built from text of mostly distinct
+// words can be about three times the size of the text.
+const MaxTextBytes = 256 << 10 // 256KB
+
+// maxInputBytes caps how much of a file is read for formats that must be
+// parsed in memory.
+const maxInputBytes = 32 << 20 // 32MB
+
+var ErrUnsupported = errors.New("unsupported content type")
+
+// Supported reports whether text can be extracted from the given MIME type.
+func Supported(mimeType string) bool {
+	_, ok := extractors[baseType(mimeType)]
+	return ok
+}
+
+// File extracts text from the file at path according to its MIME type.
+func File(path, mimeType string) (string, error) {
+	extractor, ok := extractors[baseType(mimeType)]
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxInputBytes))
+	if err != nil {
+		return "", err
+	}
+
+	text, err := extractor(data)
+	if err != nil {
+		return "", err
+	}
+	return clean(text), nil
+}
+
+var extractors = map[string]func([]byte) (string, error){
+	"text/plain":       plainText,
+	"text/csv":         plainText,
+	"text/markdown":    plainText,
+	"application/json": jsonText,
+	"application/xml":  xmlText,
+	"text/xml":         xmlText,
+	"application/pdf":  pdfText,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": docxText,
+}
+
+func baseType(mimeType string) string {
+	if idx := strings.Index(mimeType, ";"); idx != -1 {
+		mimeType = mimeType[:idx]
+	}
+	return strings.TrimSpace(strings.ToLower(mimeType))
+}
+
+func plainText(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// jsonText keeps object keys and scalar values, dropping the punctuation.
+func jsonText(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var b strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch v := tok.(type) {
+		case string:
+			b.WriteString(v)
+			b.WriteByte(' ')
+		case json.Number:
+			b.WriteString(v.String())
+			b.WriteByte(' ')
+		}
+	}
+	return b.String(), nil
+}
+
+// xmlText keeps character data, dropping tags and attributes.
+func xmlText(data []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+
+	var b strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return b.String(), nil // Keep whatever was readable before the error
+		}
+		if cd, ok := tok.(xml.CharData); ok {
+			b.Write(cd)
+			b.WriteByte(' ')
+		}
+	}
+	return b.String(), nil
+}
+
+// docxText reads word/document.xml from the OOXML package, emitting the runs
+// of text (<w:t>) with paragraph breaks (<w:p>) as newlines.
+func docxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		dec := xml.NewDecoder(io.LimitReader(rc, maxInputBytes))
+		var b strings.Builder
+		inText := false
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "t" {
+					inText = true
+				}
+				if t.Name.Local == "tab" {
+					b.WriteByte('\t')
+				}
+			case xml.EndElement:
+				if t.Name.Local == "t" {
+					inText = false
+				}
+				if t.Name.Local == "p" {
+					b.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					b.Write(t)
+				}
+			}
+		}
+		return b.String(), nil
+	}
+
+	return "", errors.New("word/document.xml not found")
+}
+
+var (
+	pdfStream      = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	pdfTextObject  = regexp.MustCompile(`(?s)BT(.*?)ET`)
+	pdfShowText    = regexp.MustCompile(`(?s)\((?:\\.|[^\\)])*\)\s*(?:Tj|'|")|\[(?:[^\]]*)\]\s*TJ|T\*|Td|TD`)
+	pdfLiteralText = regexp.MustCompile(`\((?:\\.|[^\\)])*\)`)
+)
+
+// pdfText is a minimal content-stream reader: it inflates FlateDecode streams
+// and collects the literal strings passed to the Tj, TJ, ' and " operators.
+// PDFs using hex-encoded CID fonts or other filters produce little or no text.
+func pdfText(data []byte) (string, error) {
+	var b strings.Builder
+
+	for _, loc := range pdfStream.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			inflated, err := io.ReadAll(io.LimitReader(zr, maxInputBytes))
+			zr.Close()
+			if err != nil && len(inflated) == 0 {
+				continue
+			}
+			content = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue // Other filters (DCT, LZW, ...) don't carry text we can read
+		}
+
+		for _, obj := range pdfTextObject.FindAllSubmatch(content, -1) {
+			for _, op := range pdfShowText.FindAll(obj[1], -1) {
+				if !bytes.ContainsAny(op, "([") {
+					b.WriteByte(' ') // Text positioning operators break words
+					continue
+				}
+				for _, lit := range pdfLiteralText.FindAll(op, -1) {
+					b.WriteString(unescapePDFString(lit[1 : len(lit)-1]))
+				}
+			}
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String(), nil
+}
+
+func unescapePDFString(s []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'b', 'f':
+			// Backspace and form feed carry no searchable text
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to three octal digits
+			v := 0
+			j := 0
+			for ; j < 3 && i+j < len(s) && s[i+j] >= '0' && s[i+j] <= '7'; j++ {
+				v = v*8 + int(s[i+j]-'0')
+			}
+			i += j - 1
+			b.WriteByte(byte(v))
+		case '\r', '\n':
+			// Line continuation
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// clean drops invalid UTF-8 and NUL bytes (which Postgres rejects in text),
+// collapses runs of whitespace and truncates to MaxTextBytes.
+func clean(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.ReplaceAll(text, "\x00", "")
+	text = strings.Join(strings.Fields(text), " ")
+
+	if len(text) > MaxTextBytes {
+		text = text[:MaxTextBytes]
+		// Don't cut a multi-byte rune in half
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
@@ -0,0 +1,156 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	return path
+}
+
+func TestFile_PlainText(t *testing.T) {
+	path := writeTempFile(t, []byte("Quarterly  revenue\n\nforecast\x00"))
+
+	text, err := File(path, "text/plain; charset=utf-8")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	if text != "Quarterly revenue forecast" {
+		t.Errorf("File() = %q, want %q", text, "Quarterly revenue forecast")
+	}
+}
+
+func TestFile_PlainTextTruncated(t *testing.T) {
+	var content strings.Builder
+	for i := 0; content.Len() < 2<<20; i++ {
+		fmt.Fprintf(&content, "w%x ", i)
+	}
+	path := writeTempFile(t, []byte(content.String()))
+
+	text, err := File(path, "text/plain")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	if len(text) > MaxTextBytes {
+		t.Errorf("File() length = %d, want <= %d", len(text), MaxTextBytes)
+	}
+}
+
+func TestFile_JSON(t *testing.T) {
+	path := writeTempFile(t, []byte(`{"customer": "Acme", "items": [{"sku": "X-1", "qty": 3}]}`))
+
+	text, err := File(path, "application/json")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	for _, want := range []string{"customer", "Acme", "X-1", "3"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("File() = %q, missing %q", text, want)
+		}
+	}
+	if strings.ContainsAny(text, "{}[]\":") {
+		t.Errorf("File() = %q, should not contain JSON punctuation", text)
+	}
+}
+
+func TestFile_XML(t *testing.T) {
+	path := writeTempFile(t, []byte(`<?xml version="1.0"?><invoice id="42"><to>Acme Corp</to><total>100</total></invoice>`))
+
+	text, err := File(path, "application/xml")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	if text != "Acme Corp 100" {
+		t.Errorf("File() = %q, want %q", text, "Acme Corp 100")
+	}
+}
+
+func TestFile_DOCX(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("word/document.xml")
+	w.Write([]byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		`<w:p><w:r><w:t>Master services</w:t></w:r><w:r><w:t xml:space="preserve"> agreement</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>Confidential</w:t></w:r></w:p>` +
+		`</w:body></w:document>`))
+	zw.Close()
+
+	path := writeTempFile(t, buf.Bytes())
+
+	text, err := File(path, "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	if text != "Master services agreement Confidential" {
+		t.Errorf("File() = %q, want %q", text, "Master services agreement Confidential")
+	}
+}
+
+func TestFile_PDF(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 720 Td (Signed \\(final\\)) Tj T* [(con) -20 (tract)] TJ ET")
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(content)
+	zw.Close()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Length 44 >>\nstream\n")
+	pdf.WriteString("BT (Plain page) Tj ET")
+	pdf.WriteString("\nendstream\nendobj\n2 0 obj\n<< /Filter /FlateDecode >>\nstream\n")
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+
+	path := writeTempFile(t, pdf.Bytes())
+
+	text, err := File(path, "application/pdf")
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	for _, want := range []string{"Plain page", "Signed (final)", "contract"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("File() = %q, missing %q", text, want)
+		}
+	}
+}
+
+func TestFile_Unsupported(t *testing.T) {
+	path := writeTempFile(t, []byte{0x89, 'P', 'N', 'G'})
+
+	if Supported("image/png") {
+		t.Error("Supported(image/png) = true, want false")
+	}
+
+	if _, err := File(path, "image/png"); err != ErrUnsupported {
+		t.Errorf("File() error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestClean_Truncates(t *testing.T) {
+	text := clean(strings.Repeat("é", MaxTextBytes))
+
+	if len(text) > MaxTextBytes {
+		t.Errorf("clean() length = %d, want <= %d", len(text), MaxTextBytes)
+	}
+	if !strings.HasSuffix(text, "é") {
+		t.Error("clean() should not split a multi-byte character")
+	}
+}
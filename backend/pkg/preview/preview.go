@@ -0,0 +1,154 @@
+// Package preview renders small stand-ins for uploaded files: scaled-down
+// thumbnails of images and the opening text of plain-text formats, so
+// clients don't have to download a whole file to show what it is.
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register decoder
+)
+
+const (
+	// ThumbnailSize bounds the longer side of a thumbnail in pixels.
+	ThumbnailSize = 256
+	// MaxTextBytes caps how much of a file a text preview keeps.
+	MaxTextBytes = 4 << 10 // 4KB
+	// maxPixels rejects images whose decoded size would be unreasonable to
+	// hold in memory, however small the file.
+	maxPixels = 50_000_000
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported content type")
+	ErrTooLarge    = errors.New("image dimensions too large")
+)
+
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var textTypes = map[string]bool{
+	"text/plain":       true,
+	"text/csv":         true,
+	"text/markdown":    true,
+	"application/json": true,
+}
+
+// Thumbnailable reports whether a thumbnail can be made for the MIME type.
+func Thumbnailable(mimeType string) bool {
+	return thumbnailTypes[baseType(mimeType)]
+}
+
+// Textual reports whether a text preview can be made for the MIME type.
+func Textual(mimeType string) bool {
+	return textTypes[baseType(mimeType)]
+}
+
+// Supported reports whether any preview can be made for the MIME type.
+func Supported(mimeType string) bool {
+	return Thumbnailable(mimeType) || Textual(mimeType)
+}
+
+// Types lists every MIME type a preview can be made for.
+func Types() []string {
+	var types []string
+	for t := range thumbnailTypes {
+		types = append(types, t)
+	}
+	for t := range textTypes {
+		types = append(types, t)
+	}
+	return types
+}
+
+// Thumbnail decodes an image and scales it to fit within size×size pixels,
+// never enlarging it. Opaque images are encoded as JPEG and anything with
+// transparency as PNG; the returned content type says which.
+func Thumbnail(r io.Reader, size int) ([]byte, string, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), size)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var out bytes.Buffer
+	if dst.Opaque() {
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 80})
+		return out.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&out, dst)
+	return out.Bytes(), "image/png", err
+}
+
+// fit scales width×height down to fit within size×size, keeping the aspect
+// ratio and at least one pixel on each side.
+func fit(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+// Text returns up to maxBytes of the start of a text file, cut at the last
+// line break when one is close enough, and whether anything was left out.
+// Invalid UTF-8 is replaced rather than rejected.
+func Text(r io.Reader, maxBytes int) (string, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if err != nil {
+		return "", false, err
+	}
+
+	truncated := len(data) > maxBytes
+	if truncated {
+		data = data[:maxBytes]
+		// Don't end on half a rune
+		for i := 1; i < utf8.UTFMax; i++ {
+			if r, size := utf8.DecodeLastRune(data); r != utf8.RuneError || size != 1 {
+				break
+			}
+			data = data[:len(data)-1]
+		}
+		if i := bytes.LastIndexByte(data, '\n'); i > maxBytes/2 {
+			data = data[:i+1]
+		}
+	}
+
+	return strings.ToValidUTF8(string(data), "�"), truncated, nil
+}
+
+func baseType(mimeType string) string {
+	if idx := strings.Index(mimeType, ";"); idx != -1 {
+		mimeType = mimeType[:idx]
+	}
+	return strings.TrimSpace(strings.ToLower(mimeType))
+}
@@ -0,0 +1,117 @@
+package preview
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestThumbnail_ScalesOpaqueImageToJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for x := 0; x < 1000; x++ {
+		for y := 0; y < 500; y++ {
+			src.Set(x, y, color.RGBA{R: 200, G: 50, B: 50, A: 255})
+		}
+	}
+
+	data, contentType, err := Thumbnail(encodePNG(t, src), 256)
+	if err != nil {
+		t.Fatalf("Thumbnail() error = %v", err)
+	}
+	if contentType != "image/jpeg" {
+		t.Errorf("Thumbnail() content type = %q, want image/jpeg", contentType)
+	}
+
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("thumbnail isn't a JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Errorf("thumbnail is %dx%d, want 256x128", b.Dx(), b.Dy())
+	}
+}
+
+func TestThumbnail_KeepsTransparency(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 80))
+
+	data, contentType, err := Thumbnail(encodePNG(t, src), 256)
+	if err != nil {
+		t.Fatalf("Thumbnail() error = %v", err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("Thumbnail() content type = %q, want image/png", contentType)
+	}
+
+	// Small images aren't enlarged
+	thumb, _ := png.Decode(bytes.NewReader(data))
+	if b := thumb.Bounds(); b.Dx() != 40 || b.Dy() != 80 {
+		t.Errorf("thumbnail is %dx%d, want 40x80", b.Dx(), b.Dy())
+	}
+}
+
+func TestThumbnail_Invalid(t *testing.T) {
+	if _, _, err := Thumbnail(strings.NewReader("not an image"), 256); err == nil {
+		t.Error("Thumbnail() expected an error for garbage input")
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, wantW, wantH int
+	}{
+		{100, 50, 100, 50},
+		{1024, 768, 256, 192},
+		{768, 1024, 192, 256},
+		{10000, 1, 256, 1},
+	}
+
+	for _, tt := range tests {
+		if w, h := fit(tt.w, tt.h, 256); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fit(%d, %d) = %d, %d; want %d, %d", tt.w, tt.h, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	text, truncated, err := Text(strings.NewReader("short file\n"), 64)
+	if err != nil || truncated || text != "short file\n" {
+		t.Errorf("Text() = %q, %v, %v", text, truncated, err)
+	}
+
+	// Cut at the last line break past the halfway mark
+	text, truncated, _ = Text(strings.NewReader("first line\nsecond line\nthird line\n"), 28)
+	if !truncated || text != "first line\nsecond line\n" {
+		t.Errorf("Text() = %q, %v; want the first two lines, truncated", text, truncated)
+	}
+
+	// A cut through a multi-byte rune drops the partial rune
+	text, _, _ = Text(strings.NewReader(strings.Repeat("é", 10)), 5)
+	if text != "éé" {
+		t.Errorf("Text() = %q, want two whole runes", text)
+	}
+}
+
+func TestSupportedTypes(t *testing.T) {
+	if !Thumbnailable("image/webp") || Thumbnailable("image/svg+xml") {
+		t.Error("Thumbnailable() should accept WebP and refuse SVG")
+	}
+	if !Textual("text/csv; charset=utf-8") || Textual("application/pdf") {
+		t.Error("Textual() should accept CSV with parameters and refuse PDF")
+	}
+	if len(Types()) != 8 {
+		t.Errorf("Types() = %v, want 8 types", Types())
+	}
+}
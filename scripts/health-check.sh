@@ -48,7 +48,7 @@ fi
 
 # Check Backend API
 echo -n "Checking Backend API (http://localhost:8080)... "
-BACKEND_RESPONSE=$(curl -s -o /dev/null -w "%{http_code}" http://localhost:8080/health 2>/dev/null || echo "000")
+BACKEND_RESPONSE=$(curl -s -o /dev/null -w "%{http_code}" http://localhost:8080/readyz 2>/dev/null || echo "000")
 if [ "$BACKEND_RESPONSE" -eq 200 ]; then
     echo -e "${GREEN}✓ OK${NC}"
 else
@@ -71,7 +71,7 @@ fi
 # Test Backend API functionality
 echo -n "Testing Backend API endpoints... "
 # Test health endpoint returns JSON
-HEALTH_JSON=$(curl -s http://localhost:8080/health 2>/dev/null)
+HEALTH_JSON=$(curl -s http://localhost:8080/readyz 2>/dev/null)
 if echo "$HEALTH_JSON" | grep -q "status"; then
     echo -e "${GREEN}✓ OK${NC}"
 else